@@ -0,0 +1,210 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+	"github.com/jonbodner/dbtimer/internal/grpcwire"
+	"github.com/jonbodner/dbtimer/wire"
+)
+
+// Client calls the Admin service of one instrumented service.
+type Client struct {
+	address string
+	client  *http.Client
+}
+
+// NewClient returns a Client for the service at address, such as
+// "http://orders:7071". An http URL uses unencrypted HTTP/2; tlsConfig is
+// used for https URLs, and the default configuration if it is nil.
+func NewClient(address string, tlsConfig *tls.Config) (*Client, error) {
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		return nil, &dbtimer.Error{Kind: dbtimer.ErrConfig, Err: fmt.Errorf("admin address %q is not an http or https URL", address)}
+	}
+	var p http.Protocols
+	p.SetHTTP2(true)
+	p.SetUnencryptedHTTP2(true)
+	return &Client{
+		address: strings.TrimSuffix(address, "/"),
+		client: &http.Client{Transport: &http.Transport{
+			Protocols:       &p,
+			TLSClientConfig: tlsConfig,
+		}},
+	}, nil
+}
+
+// GetStats returns the service's statistics for each statement.
+func (c *Client) GetStats(ctx context.Context) ([]dbtimer.QueryStats, error) {
+	msg, err := c.unary(ctx, getStatsPath)
+	if err != nil {
+		return nil, err
+	}
+	return wire.UnmarshalStatsReport(msg)
+}
+
+// ListActiveQueries returns the calls the service is running now, oldest
+// first.
+func (c *Client) ListActiveQueries(ctx context.Context) ([]dbtimer.InFlightQuery, error) {
+	msg, err := c.unary(ctx, listActivePath)
+	if err != nil {
+		return nil, err
+	}
+	return wire.UnmarshalActiveQueries(msg)
+}
+
+// StreamEvents passes the service's events that match f to tl as they
+// happen, until ctx is done or the service ends the stream.
+func (c *Client) StreamEvents(ctx context.Context, f Filter, tl dbtimer.TimerLogger) error {
+	resp, err := c.call(ctx, streamEventsPath, marshalFilter(f))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	for {
+		msg, err := grpcwire.ReadMessage(resp.Body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		ti, err := wire.UnmarshalProto(msg)
+		if err != nil {
+			return err
+		}
+		tl.Log(ti)
+	}
+	return trailerStatus(resp)
+}
+
+// unary makes a call with an empty request and returns its response message.
+func (c *Client) unary(ctx context.Context, path string) ([]byte, error) {
+	resp, err := c.call(ctx, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	msg, err := grpcwire.ReadMessage(resp.Body)
+	if err == io.EOF {
+		return nil, trailerStatus(resp)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return nil, err
+	}
+	return msg, trailerStatus(resp)
+}
+
+// call starts a call with the request message req, returning the response
+// once its headers have arrived.
+func (c *Client) call(ctx context.Context, path string, req []byte) (*http.Response, error) {
+	var body bytes.Buffer
+	grpcwire.WriteMessage(&body, req)
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, c.address+path, &body)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/grpc+proto")
+	r.Header.Set("Te", "trailers")
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("admin: HTTP status %s", resp.Status)
+	}
+	if err := grpcwire.Status("admin", resp.Header); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+func trailerStatus(resp *http.Response) error {
+	if resp.Trailer.Get("Grpc-Status") == "" {
+		return errors.New("admin: response has no grpc-status")
+	}
+	return grpcwire.Status("admin", resp.Trailer)
+}
+
+// marshalFilter encodes f as a StreamEventsRequest message.
+func marshalFilter(f Filter) []byte {
+	var b []byte
+	if f.Fingerprint != "" {
+		b = append(b, 1<<3|2)
+		b = binary.AppendUvarint(b, uint64(len(f.Fingerprint)))
+		b = append(b, f.Fingerprint...)
+	}
+	if f.MinDuration > 0 {
+		b = append(b, 2<<3|0)
+		b = binary.AppendUvarint(b, uint64(f.MinDuration))
+	}
+	if f.ErrorsOnly {
+		b = append(b, 3<<3|0, 1)
+	}
+	return b
+}
+
+// unmarshalFilter decodes a StreamEventsRequest message. Unknown fields are
+// ignored.
+func unmarshalFilter(b []byte) (Filter, error) {
+	var f Filter
+	bad := errors.New("bad StreamEventsRequest")
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return f, bad
+		}
+		b = b[n:]
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return f, bad
+			}
+			b = b[n:]
+			switch tag >> 3 {
+			case 2:
+				f.MinDuration = time.Duration(v)
+			case 3:
+				f.ErrorsOnly = v != 0
+			}
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return f, bad
+			}
+			if tag>>3 == 1 {
+				f.Fingerprint = string(b[n : n+int(l)])
+			}
+			b = b[n+int(l):]
+		case 1, 5:
+			size := 8
+			if tag&7 == 5 {
+				size = 4
+			}
+			if len(b) < size {
+				return f, bad
+			}
+			b = b[size:]
+		default:
+			return f, bad
+		}
+	}
+	return f, nil
+}
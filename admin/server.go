@@ -0,0 +1,220 @@
+// Package admin serves the Admin gRPC service in wire/event.proto, so that
+// internal tooling can ask any instrumented service for its statistics, the
+// calls it is running and a live stream of its events without scraping HTML
+// or JSON. Server is the service, Client calls it.
+//
+// Like the collector, the service is implemented on net/http's HTTP/2
+// support, so neither side needs the gRPC module, and both interoperate with
+// standard gRPC clients and servers.
+package admin
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+	"github.com/jonbodner/dbtimer/internal/grpcwire"
+	"github.com/jonbodner/dbtimer/wire"
+)
+
+const (
+	getStatsPath     = "/dbtimer.v1.Admin/GetStats"
+	listActivePath   = "/dbtimer.v1.Admin/ListActiveQueries"
+	streamEventsPath = "/dbtimer.v1.Admin/StreamEvents"
+)
+
+// Server is both a dbtimer.TimerLogger and the http.Handler of the Admin
+// service. Install it as a logger, alongside any other with
+// dbtimer.MultiLogger, so that it can stream events:
+//
+//	stats := &dbtimer.Stats{}
+//	s := admin.NewServer(stats)
+//	defer s.Close()
+//	dbtimer.SetTimerLogger(dbtimer.MultiLogger(stats, s))
+//	go admin.NewHTTPServer(":7071", s, nil).ListenAndServe()
+type Server struct {
+	stats *dbtimer.Stats
+
+	mu     sync.Mutex
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+// subscriber is a StreamEvents call, which is sent the events that match f.
+type subscriber struct {
+	c chan []byte
+	f Filter
+}
+
+// NewServer returns a Server whose GetStats reports stats, which may be nil,
+// and turns on dbtimer.TrackInFlight so that ListActiveQueries can list
+// running calls. Call Close when it is no longer served.
+func NewServer(stats *dbtimer.Stats) *Server {
+	dbtimer.TrackInFlight(true)
+	return &Server{
+		stats: stats,
+		subs:  map[*subscriber]struct{}{},
+	}
+}
+
+// NewHTTPServer returns an http.Server that serves s at addr over HTTP/2,
+// both with TLS (if started with ListenAndServeTLS) and unencrypted. Requests
+// that aren't gRPC are passed to other, if it isn't nil.
+func NewHTTPServer(addr string, s *Server, other http.Handler) *http.Server {
+	return grpcwire.NewHTTPServer(addr, s, other)
+}
+
+// Close ends every StreamEvents call and turns off the in-flight tracking
+// that NewServer turned on.
+func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for sub := range s.subs {
+		close(sub.c)
+	}
+	s.subs = nil
+	dbtimer.TrackInFlight(false)
+}
+
+// Log sends ti to every StreamEvents call whose filter it matches.
+func (s *Server) Log(ti dbtimer.TimerInfo) {
+	var fp string
+	if ti.Query != "" {
+		fp = dbtimer.Fingerprint(ti.Query)
+	}
+	var msg []byte
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for sub := range s.subs {
+		if !sub.f.match(fp, ti) {
+			continue
+		}
+		if msg == nil {
+			msg = wire.MarshalProto(ti)
+		}
+		select {
+		case sub.c <- msg:
+		default:
+			dbtimer.ReportError(dbtimer.ErrDropped, errors.New("admin: event stream is behind"))
+		}
+	}
+}
+
+// ServeHTTP handles the calls of the Admin service.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/grpc")
+	if r.Method != http.MethodPost || !grpcwire.IsGRPC(r) {
+		grpcwire.WriteStatus(w, grpcwire.CodeUnimplemented, "not a gRPC call")
+		return
+	}
+	req, err := grpcwire.ReadMessage(r.Body)
+	if err == io.EOF {
+		err = errors.New("missing request message")
+	}
+	if err != nil {
+		grpcwire.WriteStatus(w, grpcwire.CodeInvalidArgument, err.Error())
+		return
+	}
+	switch r.URL.Path {
+	case getStatsPath:
+		var stats []dbtimer.QueryStats
+		if s.stats != nil {
+			stats = s.stats.Report()
+		}
+		reply(w, wire.MarshalStatsReport(stats))
+	case listActivePath:
+		reply(w, wire.MarshalActiveQueries(dbtimer.InFlight()))
+	case streamEventsPath:
+		f, err := unmarshalFilter(req)
+		if err != nil {
+			grpcwire.WriteStatus(w, grpcwire.CodeInvalidArgument, err.Error())
+			return
+		}
+		s.streamEvents(w, r, f)
+	default:
+		grpcwire.WriteStatus(w, grpcwire.CodeUnimplemented, "unknown method "+r.URL.Path)
+	}
+}
+
+// reply sends the response of a unary call.
+func reply(w http.ResponseWriter, msg []byte) {
+	w.WriteHeader(http.StatusOK)
+	if err := grpcwire.WriteMessage(w, msg); err != nil {
+		return
+	}
+	grpcwire.SetTrailer(w, grpcwire.CodeOK, "")
+}
+
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request, f Filter) {
+	sub := &subscriber{c: make(chan []byte, 256), f: f}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		grpcwire.WriteStatus(w, grpcwire.CodeUnavailable, "admin server is closed")
+		return
+	}
+	s.subs[sub] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subs, sub)
+		s.mu.Unlock()
+	}()
+
+	flusher, _ := w.(http.Flusher)
+	// Send the headers now, so that the client knows the stream is open.
+	w.WriteHeader(http.StatusOK)
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for {
+		select {
+		case msg, ok := <-sub.c:
+			if !ok {
+				grpcwire.SetTrailer(w, grpcwire.CodeUnavailable, "admin server is closed")
+				return
+			}
+			if err := grpcwire.WriteMessage(w, msg); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// Filter chooses the events a StreamEvents call receives. The zero Filter
+// matches every event.
+type Filter struct {
+	// Fingerprint, if not empty, must appear in the fingerprint of the
+	// event's statement.
+	Fingerprint string
+
+	// MinDuration is the shortest duration an event may have.
+	MinDuration time.Duration
+
+	// ErrorsOnly matches only the events of failed calls.
+	ErrorsOnly bool
+}
+
+// match reports whether ti, whose statement has the fingerprint fp, passes f.
+func (f Filter) match(fp string, ti dbtimer.TimerInfo) bool {
+	if f.Fingerprint != "" && !strings.Contains(fp, f.Fingerprint) {
+		return false
+	}
+	if ti.Elapsed() < f.MinDuration {
+		return false
+	}
+	return !f.ErrorsOnly || ti.Err != nil
+}
@@ -0,0 +1,152 @@
+package dbtimer
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Advice is a note on a plan from the heuristics of a PlanWatcher, such as a
+// large table read with a sequential scan, and the columns an index might
+// serve. It is best-effort: the heuristics read the planner's estimates,
+// don't know the indexes that exist or the rest of the workload, and an
+// index has a cost on every write. Check a suggestion with EXPLAIN ANALYZE
+// before acting on it.
+type Advice struct {
+	Table   string
+	Columns []string
+	Note    string
+}
+
+func (a Advice) String() string {
+	return a.Note
+}
+
+var (
+	pgScanRE   = regexp.MustCompile(`^(\s*(?:->\s*)?)(?:Parallel )?Seq Scan on (\S+)(?: \S+)?\s+\(cost=[\d.]+\.\.([\d.]+) rows=(\d+)`)
+	pgFilterRE = regexp.MustCompile(`^\s*Filter: (.*)$`)
+	pgColumnRE = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_.]*)\)?(?:::[A-Za-z_][A-Za-z0-9_ ]*)?\)?\s*(?:=|<>|!=|<=|>=|<|>|~~\*?|!~~|IS NULL|IS NOT NULL|= ANY)\s*`)
+)
+
+// advise applies the heuristics of dialect to the rows of an EXPLAIN's
+// output, with its column names. A scan is large if its estimated cost, in
+// PostgreSQL, or the rows it examines, in MySQL, are at least large.
+// Other dialects get no advice.
+func advise(dialect Dialect, columns []string, rows [][]string, large float64) []Advice {
+	switch dialect {
+	case PostgreSQL:
+		lines := make([]string, len(rows))
+		for i, r := range rows {
+			lines[i] = strings.Join(r, " ")
+		}
+		return advisePostgres(lines, large)
+	case MySQL:
+		return adviseMySQL(columns, rows, large)
+	}
+	return nil
+}
+
+// advisePostgres reads PostgreSQL's text plans: a Seq Scan node whose cost
+// is large, with the Filter under it if it has one.
+func advisePostgres(lines []string, large float64) []Advice {
+	var out []Advice
+	for i, line := range lines {
+		m := pgScanRE.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		cost, _ := strconv.ParseFloat(m[3], 64)
+		if cost < large {
+			continue
+		}
+		table := m[2]
+		// The node's details are the lines after it indented deeper than
+		// its arrow, up to the next node.
+		var cols []string
+		indent := len(m[1])
+		for _, detail := range lines[i+1:] {
+			if len(detail)-len(strings.TrimLeft(detail, " ")) <= indent || strings.Contains(detail, "->") {
+				break
+			}
+			if f := pgFilterRE.FindStringSubmatch(detail); f != nil {
+				cols = filterColumns(f[1])
+			}
+		}
+		a := Advice{Table: table, Columns: cols}
+		if len(cols) > 0 {
+			a.Note = fmt.Sprintf("sequential scan of %s (cost %.0f) filtered on %s: an index on %s (%s) may help", table, cost, strings.Join(cols, ", "), table, strings.Join(cols, ", "))
+		} else {
+			a.Note = fmt.Sprintf("sequential scan of all of %s (cost %.0f, about %s rows): check that the statement needs every row", table, cost, m[4])
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// filterColumns returns the columns compared in a PostgreSQL Filter, in the
+// order they first appear, without their table.
+func filterColumns(filter string) []string {
+	var cols []string
+	seen := map[string]bool{}
+	for _, m := range pgColumnRE.FindAllStringSubmatchIndex(filter, -1) {
+		if strings.HasSuffix(filter[:m[2]], "::") {
+			// A cast's type, not a column.
+			continue
+		}
+		col := filter[m[2]:m[3]]
+		if i := strings.LastIndexByte(col, '.'); i >= 0 {
+			col = col[i+1:]
+		}
+		if col == "" || seen[col] || strings.EqualFold(col, "AND") || strings.EqualFold(col, "OR") || strings.EqualFold(col, "NOT") {
+			continue
+		}
+		seen[col] = true
+		cols = append(cols, col)
+	}
+	return cols
+}
+
+// adviseMySQL reads MySQL's tabular EXPLAIN: full table scans and full index
+// scans that examine many rows, and joins that buffer rows for want of an
+// index.
+func adviseMySQL(columns []string, rows [][]string, large float64) []Advice {
+	col := map[string]int{}
+	for i, c := range columns {
+		col[strings.ToLower(c)] = i
+	}
+	field := func(r []string, name string) string {
+		if i, ok := col[name]; ok && i < len(r) && r[i] != "NULL" {
+			return r[i]
+		}
+		return ""
+	}
+	var out []Advice
+	for _, r := range rows {
+		table, access, extra := field(r, "table"), field(r, "type"), field(r, "extra")
+		if table == "" {
+			continue
+		}
+		examined, _ := strconv.ParseFloat(field(r, "rows"), 64)
+		switch {
+		case strings.Contains(extra, "Using join buffer"):
+			out = append(out, Advice{Table: table, Note: fmt.Sprintf("%s is joined without an index (%s): index its join columns", table, extra)})
+		case access == "ALL" && examined >= large:
+			a := Advice{Table: table}
+			if keys := field(r, "possible_keys"); keys != "" {
+				a.Note = fmt.Sprintf("full scan of %s (about %.0f rows) though %s could be used: the index may not be selective enough for these arguments", table, examined, keys)
+			} else if strings.Contains(extra, "Using where") {
+				a.Note = fmt.Sprintf("full scan of %s (about %.0f rows) with no usable index for its conditions: index the columns of its WHERE clause", table, examined)
+			} else {
+				a.Note = fmt.Sprintf("full scan of all of %s (about %.0f rows): check that the statement needs every row", table, examined)
+			}
+			out = append(out, a)
+		case access == "index" && examined >= large:
+			out = append(out, Advice{Table: table, Note: fmt.Sprintf("full scan of index %s on %s (about %.0f rows)", field(r, "key"), table, examined)})
+		}
+		if strings.Contains(extra, "Using filesort") && examined >= large {
+			out = append(out, Advice{Table: table, Note: fmt.Sprintf("%s is sorted with a filesort (about %.0f rows): an index in the ORDER BY order may avoid it", table, examined)})
+		}
+	}
+	return out
+}
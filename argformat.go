@@ -0,0 +1,92 @@
+package dbtimer
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ArgFormatter renders the arguments of a statement as text. Events carry
+// their arguments as driver.Values, and sinks that write text format them
+// only when they write an event, so loggers that only aggregate metrics never
+// pay for it.
+type ArgFormatter interface {
+	FormatArgs(args []driver.Value) string
+}
+
+// ArgFormatterFunc adapts a function to an ArgFormatter.
+type ArgFormatterFunc func(args []driver.Value) string
+
+func (f ArgFormatterFunc) FormatArgs(args []driver.Value) string {
+	return f(args)
+}
+
+// DefaultArgFormatter renders arguments as a comma-separated list of values
+// formatted by FormatArg.
+var DefaultArgFormatter ArgFormatter = ArgFormatterFunc(func(args []driver.Value) string {
+	var sb strings.Builder
+	for i, a := range args {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(FormatArg(a))
+	}
+	return sb.String()
+})
+
+// maxFormattedBytes is the most bytes of a []byte argument FormatArg shows.
+const maxFormattedBytes = 64
+
+// FormatArg renders one argument readably: nil as NULL, strings quoted,
+// []byte as a quoted string if it is valid UTF-8 and as hex otherwise, and
+// times in RFC 3339. A driver.Valuer is rendered as the value it returns, and
+// any other type with fmt.
+func FormatArg(v driver.Value) string {
+	if valuer, ok := v.(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		if err != nil {
+			return fmt.Sprintf("<%T: %v>", v, err)
+		}
+		if _, again := dv.(driver.Valuer); !again {
+			v = dv
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return strconv.Quote(v)
+	case []byte:
+		if utf8.Valid(v) {
+			return strconv.Quote(string(v))
+		}
+		if len(v) > maxFormattedBytes {
+			return fmt.Sprintf("0x%s... (%d bytes)", hex.EncodeToString(v[:maxFormattedBytes]), len(v))
+		}
+		return "0x" + hex.EncodeToString(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
+
+// Args is a list of arguments that formats itself with DefaultArgFormatter
+// when it is printed, so it can be passed to a log call without formatting
+// the arguments up front:
+//
+//	log.Printf("%s %v", ti.Query, dbtimer.Args(ti.Args))
+type Args []driver.Value
+
+func (a Args) String() string {
+	return DefaultArgFormatter.FormatArgs(a)
+}
@@ -0,0 +1,108 @@
+package dbtimer
+
+import (
+	"sync"
+	"time"
+)
+
+// AsyncConfig configures an AsyncLogger.
+type AsyncConfig struct {
+	// QueueSize is the number of events that can wait to be logged. The
+	// default is 1024.
+	QueueSize int
+
+	// Backpressure is what happens to an event when the queue is full. The
+	// default is DropNewest.
+	Backpressure Backpressure
+
+	// BlockTimeout is how long an event waits for room under Block. The
+	// default is 100 milliseconds.
+	BlockTimeout time.Duration
+}
+
+// AsyncLogger is a TimerLogger that hands events to another TimerLogger on a
+// goroutine of its own, so that a slow logger, such as one writing to a file
+// or a network, doesn't slow down the calls being timed.
+type AsyncLogger struct {
+	tl    TimerLogger
+	queue *Queue
+	flush chan chan error
+	quit  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+}
+
+// NewAsyncLogger returns an AsyncLogger that logs to tl.
+func NewAsyncLogger(tl TimerLogger, cfg AsyncConfig) *AsyncLogger {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	al := &AsyncLogger{
+		tl:    tl,
+		queue: NewQueue("async logger", cfg.QueueSize, cfg.Backpressure, cfg.BlockTimeout),
+		flush: make(chan chan error),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go al.run()
+	return al
+}
+
+// Log queues ti to be logged.
+func (al *AsyncLogger) Log(ti TimerInfo) {
+	al.queue.Put(ti)
+}
+
+// QueueStats returns the counts of events queued and lost.
+func (al *AsyncLogger) QueueStats() QueueStats {
+	return al.queue.Stats()
+}
+
+// Flush logs the events queued so far and flushes the logger they are logged
+// to, if it is a Flusher.
+func (al *AsyncLogger) Flush() error {
+	req := make(chan error, 1)
+	select {
+	case al.flush <- req:
+		return <-req
+	case <-al.done:
+		return nil
+	}
+}
+
+// Close logs the queued events and stops the logger. Events logged after
+// Close are dropped. The logger the events are logged to is left open.
+func (al *AsyncLogger) Close() error {
+	al.once.Do(func() {
+		al.queue.Close()
+		close(al.quit)
+	})
+	<-al.done
+	return nil
+}
+
+func (al *AsyncLogger) run() {
+	defer close(al.done)
+	for {
+		select {
+		case ti := <-al.queue.Events():
+			logEvent(al.tl, ti)
+		case req := <-al.flush:
+			al.drain()
+			var err error
+			if f, ok := al.tl.(Flusher); ok {
+				err = f.Flush()
+			}
+			req <- err
+		case <-al.quit:
+			al.drain()
+			return
+		}
+	}
+}
+
+func (al *AsyncLogger) drain() {
+	for ti, ok := al.queue.Next(); ok; ti, ok = al.queue.Next() {
+		logEvent(al.tl, ti)
+	}
+}
@@ -0,0 +1,101 @@
+package dbtimer
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// RoundTripBaseline has a Driver measure a minimal round trip to the server
+// on each connection, so that the time of each statement can be split into
+// the cost of reaching the server and the cost of running the statement. The
+// round trip is measured before a connection's first statement, and again
+// before the first statement after Interval has passed; it isn't counted in
+// the statement's time. Events of statements carry the connection's latest
+// round trip as their Baseline.
+type RoundTripBaseline struct {
+	// Interval is how long a measurement is used for. The default is a
+	// minute.
+	Interval time.Duration
+
+	// Query is run to measure the round trip. If it is empty, the
+	// connection is pinged if its driver can be, and "SELECT 1" is run if
+	// it can't.
+	Query string
+}
+
+// SetRoundTripBaseline sets the measurement of round trips on d's
+// connections. Passing nil stops measuring them.
+func (d *Driver) SetRoundTripBaseline(b *RoundTripBaseline) {
+	var rb *RoundTripBaseline
+	if b != nil {
+		cfg := *b
+		if cfg.Interval <= 0 {
+			cfg.Interval = time.Minute
+		}
+		rb = &cfg
+	}
+	d.baseline.Store(baselineHolder{rb})
+}
+
+// WithRoundTripBaseline sets the measurement of round trips on the driver's
+// connections, as SetRoundTripBaseline does.
+func WithRoundTripBaseline(b *RoundTripBaseline) Option {
+	return func(d *Driver) error {
+		d.SetRoundTripBaseline(b)
+		return nil
+	}
+}
+
+type baselineHolder struct {
+	b *RoundTripBaseline
+}
+
+// Excess returns how much longer the call took than the round trip to the
+// server: the time spent running the statement rather than reaching the
+// server. It is the whole duration if the event has no Baseline, and zero if
+// the call was faster than the Baseline.
+func (ti TimerInfo) Excess() time.Duration {
+	if d := ti.Elapsed() - ti.Baseline; d > 0 {
+		return d
+	}
+	return 0
+}
+
+// roundTrip returns the connection's latest round trip, measuring it first if
+// the driver has a RoundTripBaseline and the last measurement is too old. A
+// COPY in progress is never interrupted.
+func (cs *connState) roundTrip(ctx context.Context, method string) time.Duration {
+	h, _ := cs.d.baseline.Load().(baselineHolder)
+	if h.b == nil || !runsStatement(method) || method == "conn.CopyIn" || cs.conn == nil {
+		return 0
+	}
+	now := cs.d.now()
+	if !cs.baselineAt.IsZero() && now.Sub(cs.baselineAt) < h.b.Interval {
+		return cs.baseline
+	}
+	err := pingConn(ctx, cs.conn, h.b.Query)
+	end := cs.d.now()
+	if err == nil {
+		cs.baseline = end.Sub(now)
+		cs.baselineAt = end
+	}
+	return cs.baseline
+}
+
+// pingConn makes one round trip on c with query, or with a ping if query is
+// empty and c can be pinged.
+func pingConn(ctx context.Context, c driver.Conn, query string) error {
+	if query == "" {
+		if p, ok := c.(driver.Pinger); ok {
+			return p.Ping(ctx)
+		}
+		query = "SELECT 1"
+	}
+	rows, closeStmt, err := probeQuery(ctx, c, query)
+	if err != nil {
+		return err
+	}
+	defer closeStmt()
+	return rows.Close()
+}
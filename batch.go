@@ -0,0 +1,46 @@
+package dbtimer
+
+import "strings"
+
+// InsertRows returns the number of rows in the VALUES list of an INSERT or
+// REPLACE statement, or 0 if query isn't one. A multi-row INSERT of 10,000
+// rows returns 10000, so that its latency can be judged per row rather than
+// as a single statement.
+func InsertRows(query string) int {
+	if !startsWithInsert(query) {
+		return 0
+	}
+	toks := tokenize(query)
+	if len(toks) == 0 || (toks[0].text != "insert" && toks[0].text != "replace") {
+		return 0
+	}
+	for i := 1; i < len(toks); i++ {
+		if toks[i].kind != wordToken || toks[i].text != "values" {
+			continue
+		}
+		rows := 0
+		for j := i + 1; ; {
+			end := groupEnd(toks, j)
+			if end == -1 {
+				break
+			}
+			rows++
+			if end+1 >= len(toks) || toks[end+1].text != "," {
+				break
+			}
+			j = end + 2
+		}
+		return rows
+	}
+	return 0
+}
+
+// startsWithInsert is a cheap test that query could be an INSERT or REPLACE,
+// so that other statements aren't tokenized.
+func startsWithInsert(query string) bool {
+	query = strings.TrimLeft(query, " \t\r\n")
+	if len(query) < len("insert") {
+		return false
+	}
+	return strings.EqualFold(query[:6], "insert") || (len(query) >= 7 && strings.EqualFold(query[:7], "replace"))
+}
@@ -0,0 +1,279 @@
+// Package bench compares the latency of a query workload on two databases,
+// for evaluating a driver or server upgrade. Both databases are reached
+// through the timer driver, so the numbers are the ones dbtimer reports. It
+// also measures the overhead of the timer itself; see MeasureOverhead.
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// Target is a database to run the workload against.
+type Target struct {
+	Name       string
+	DriverName string
+	DSN        string
+}
+
+// Query is one statement in a workload. Statements that don't return rows
+// should set Exec.
+type Query struct {
+	SQL  string
+	Args []interface{}
+	Exec bool
+}
+
+// Options controls how the workload is run. Each target runs the whole
+// workload Iterations times, spread across Concurrency goroutines, after
+// running it Warmup times without measuring.
+type Options struct {
+	Iterations  int
+	Concurrency int
+	Warmup      int
+}
+
+// Percentiles are the latency percentiles reported for each fingerprint.
+var Percentiles = []float64{50, 90, 99}
+
+// Report is the result of a comparison.
+type Report struct {
+	A, B  string
+	Stats []FingerprintStats
+}
+
+// FingerprintStats compares the latency of one fingerprint on both targets.
+// A and B hold the latency at each of Percentiles.
+type FingerprintStats struct {
+	Fingerprint string
+	Count       int
+	A, B        []time.Duration
+	Errors      [2]int
+}
+
+var targetID int64
+
+// Compare runs workload against a and then b, and reports the latency of each
+// fingerprint on both. The targets are run one after the other so that they
+// don't compete for resources.
+func Compare(ctx context.Context, a, b Target, workload []Query, opts Options) (*Report, error) {
+	if opts.Iterations <= 0 {
+		opts.Iterations = 1
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+	ra, err := run(ctx, a, workload, opts)
+	if err != nil {
+		return nil, err
+	}
+	rb, err := run(ctx, b, workload, opts)
+	if err != nil {
+		return nil, err
+	}
+	return newReport(a.Name, b.Name, ra, rb), nil
+}
+
+func newReport(a, b string, ra, rb *result) *Report {
+	r := &Report{A: a, B: b}
+	for fp, da := range ra.durations {
+		db := rb.durations[fp]
+		r.Stats = append(r.Stats, FingerprintStats{
+			Fingerprint: fp,
+			Count:       len(da),
+			A:           percentiles(da),
+			B:           percentiles(db),
+			Errors:      [2]int{ra.errors[fp], rb.errors[fp]},
+		})
+	}
+	sort.Slice(r.Stats, func(i, j int) bool {
+		return r.Stats[i].Fingerprint < r.Stats[j].Fingerprint
+	})
+	return r
+}
+
+type result struct {
+	mu        sync.Mutex
+	recording bool
+	durations map[string][]time.Duration
+	errors    map[string]int
+}
+
+func (r *result) Log(ti dbtimer.TimerInfo) {
+	if !isStatement(ti.Method) {
+		return
+	}
+	fp := dbtimer.Fingerprint(ti.Query)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.recording {
+		return
+	}
+	r.durations[fp] = append(r.durations[fp], ti.Elapsed())
+	if ti.Err != nil {
+		r.errors[fp]++
+	}
+}
+
+// open opens t through its own timer driver, which sends its events to tl, so
+// that faults or a clock set on one target's driver don't affect the others
+// and the program's own loggers are left alone.
+func open(t Target, conns int, tl dbtimer.TimerLogger) (*sql.DB, error) {
+	name := fmt.Sprintf("dbtimer-bench-%d", atomic.AddInt64(&targetID, 1))
+	if _, err := dbtimer.RegisterTimer(name, dbtimer.WithDriver(t.DriverName), dbtimer.WithTimerLogger(tl)); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(name, t.DSN)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(conns)
+	db.SetMaxIdleConns(conns)
+	return db, nil
+}
+
+func newResult() *result {
+	return &result{durations: map[string][]time.Duration{}, errors: map[string]int{}}
+}
+
+func run(ctx context.Context, t Target, workload []Query, opts Options) (*result, error) {
+	r := newResult()
+	db, err := open(t, opts.Concurrency, r)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	for i := 0; i < opts.Warmup; i++ {
+		if err := runOnce(ctx, db, workload); err != nil {
+			return nil, err
+		}
+	}
+	r.mu.Lock()
+	r.recording = true
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	var firstErr error
+	var errOnce sync.Once
+	iterations := make(chan struct{})
+	for i := 0; i < opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range iterations {
+				if err := runOnce(ctx, db, workload); err != nil {
+					errOnce.Do(func() { firstErr = err })
+				}
+			}
+		}()
+	}
+	for i := 0; i < opts.Iterations && ctx.Err() == nil; i++ {
+		iterations <- struct{}{}
+	}
+	close(iterations)
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return r, ctx.Err()
+}
+
+// runOnce runs the workload a single time. Errors from statements are
+// recorded in the results rather than stopping the run; only a cancelled
+// context stops it.
+func runOnce(ctx context.Context, db *sql.DB, workload []Query) error {
+	for _, q := range workload {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if q.Exec {
+			db.ExecContext(ctx, q.SQL, q.Args...)
+			continue
+		}
+		rows, err := db.QueryContext(ctx, q.SQL, q.Args...)
+		if err != nil {
+			continue
+		}
+		for rows.Next() {
+		}
+		rows.Close()
+	}
+	return nil
+}
+
+func percentiles(ds []time.Duration) []time.Duration {
+	out := make([]time.Duration, len(Percentiles))
+	if len(ds) == 0 {
+		return out
+	}
+	sorted := make([]time.Duration, len(ds))
+	copy(sorted, ds)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	for i, p := range Percentiles {
+		idx := int(float64(len(sorted))*p/100+0.5) - 1
+		if idx < 0 {
+			idx = 0
+		}
+		if idx >= len(sorted) {
+			idx = len(sorted) - 1
+		}
+		out[i] = sorted[idx]
+	}
+	return out
+}
+
+// WriteTo writes the report as a table, with one row per fingerprint and the
+// change from A to B at each percentile.
+func (r *Report) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	tw := tabwriter.NewWriter(cw, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "fingerprint\tcount")
+	for _, p := range Percentiles {
+		fmt.Fprintf(tw, "\tp%g %s\tp%g %s\tchange", p, r.A, p, r.B)
+	}
+	fmt.Fprint(tw, "\terrors\n")
+	for _, s := range r.Stats {
+		fmt.Fprintf(tw, "%s\t%d", s.Fingerprint, s.Count)
+		for i := range Percentiles {
+			fmt.Fprintf(tw, "\t%v\t%v\t%s", s.A[i], s.B[i], change(s.A[i], s.B[i]))
+		}
+		fmt.Fprintf(tw, "\t%d/%d\n", s.Errors[0], s.Errors[1])
+	}
+	err := tw.Flush()
+	return cw.n, err
+}
+
+func (r *Report) String() string {
+	var sb strings.Builder
+	r.WriteTo(&sb)
+	return sb.String()
+}
+
+func change(a, b time.Duration) string {
+	if a == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.1f%%", (float64(b)-float64(a))/float64(a)*100)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,87 @@
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// openPair opens the in-memory driver directly and through the timer, as
+// MeasureOverhead does.
+func openPair(b *testing.B) (plain, timed *sql.DB) {
+	b.Helper()
+	registerNop()
+	plain, err := sql.Open(nopDriverName, "")
+	if err != nil {
+		b.Fatal(err)
+	}
+	timed, err = dbtimer.OpenDB(nopDriverName, "", dbtimer.WithTimerLogger(dbtimer.TimerLoggerFunc(func(dbtimer.TimerInfo) {})))
+	if err != nil {
+		plain.Close()
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		plain.Close()
+		timed.Close()
+	})
+	return plain, timed
+}
+
+// benchmarkPath runs path through database/sql, unwrapped and wrapped by the
+// timer, as sub-benchmarks, so that `go test -bench` compares them.
+func benchmarkPath(b *testing.B, path string) {
+	plain, timed := openPair(b)
+	ctx := context.Background()
+	for _, db := range []struct {
+		name string
+		db   *sql.DB
+	}{{"Plain", plain}, {"Timed", timed}} {
+		b.Run(db.name, func(b *testing.B) {
+			// Open the connection before measuring.
+			if err := runPath(ctx, db.db, path); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := runPath(ctx, db.db, path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkExec(b *testing.B) {
+	benchmarkPath(b, "Exec")
+}
+
+func BenchmarkQuery(b *testing.B) {
+	benchmarkPath(b, "Query")
+}
+
+func BenchmarkPrepare(b *testing.B) {
+	benchmarkPath(b, "Prepare")
+}
+
+func BenchmarkTx(b *testing.B) {
+	benchmarkPath(b, "Tx")
+}
+
+func TestMeasureOverhead(t *testing.T) {
+	results, err := MeasureOverhead(context.Background(), OverheadOptions{Duration: 10 * time.Millisecond, Rounds: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != len(OverheadPaths) {
+		t.Fatalf("got %d results, want %d", len(results), len(OverheadPaths))
+	}
+	for i, o := range results {
+		if o.Path != OverheadPaths[i] || o.Plain <= 0 || o.Timed <= 0 {
+			t.Errorf("result %d: %+v", i, o)
+		}
+	}
+}
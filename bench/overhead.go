@@ -0,0 +1,245 @@
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// OverheadOptions controls how MeasureOverhead runs.
+type OverheadOptions struct {
+	// Duration is how long each path runs on each database in a round. The
+	// default is 200ms.
+	Duration time.Duration
+
+	// Rounds is how many times each path is measured; the fastest round
+	// counts, which keeps a noisy machine from inflating the overhead. The
+	// default is 3.
+	Rounds int
+
+	// Timer are the options of the timer driver, so that the overhead of
+	// features such as sampling or call sites can be measured. Its events go
+	// to a logger that discards them unless one of these sets another.
+	Timer []dbtimer.Option
+}
+
+// Overhead is the cost of one path through database/sql with and without the
+// timer, per call.
+type Overhead struct {
+	Path         string
+	Plain, Timed time.Duration
+	PlainAllocs  float64
+	TimedAllocs  float64
+}
+
+// PerCall returns the time the timer adds to each call, or zero if the timed
+// call was no slower.
+func (o Overhead) PerCall() time.Duration {
+	if d := o.Timed - o.Plain; d > 0 {
+		return d
+	}
+	return 0
+}
+
+// OverheadPaths are the paths MeasureOverhead measures: an Exec, a Query
+// whose one row is read, a prepared statement that is executed and closed,
+// and a transaction with one Exec.
+var OverheadPaths = []string{"Exec", "Query", "Prepare", "Tx"}
+
+// MeasureOverhead measures how much time and how many allocations the timer
+// adds to each of OverheadPaths, by running it against an in-memory driver
+// that does nothing, directly and through the timer. With nothing to wait on,
+// what remains is the cost of database/sql and of the timer.
+func MeasureOverhead(ctx context.Context, opts OverheadOptions) ([]Overhead, error) {
+	if opts.Duration <= 0 {
+		opts.Duration = 200 * time.Millisecond
+	}
+	if opts.Rounds <= 0 {
+		opts.Rounds = 3
+	}
+	registerNop()
+	plain, err := sql.Open(nopDriverName, "")
+	if err != nil {
+		return nil, err
+	}
+	defer plain.Close()
+	timerOpts := append([]dbtimer.Option{dbtimer.WithTimerLogger(dbtimer.TimerLoggerFunc(func(dbtimer.TimerInfo) {}))}, opts.Timer...)
+	timed, err := dbtimer.OpenDB(nopDriverName, "", timerOpts...)
+	if err != nil {
+		return nil, err
+	}
+	defer timed.Close()
+
+	out := make([]Overhead, 0, len(OverheadPaths))
+	for _, path := range OverheadPaths {
+		o := Overhead{Path: path}
+		for i := 0; i < opts.Rounds; i++ {
+			d, allocs, err := measurePath(ctx, plain, path, opts.Duration)
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 || d < o.Plain {
+				o.Plain, o.PlainAllocs = d, allocs
+			}
+			d, allocs, err = measurePath(ctx, timed, path, opts.Duration)
+			if err != nil {
+				return nil, err
+			}
+			if i == 0 || d < o.Timed {
+				o.Timed, o.TimedAllocs = d, allocs
+			}
+		}
+		out = append(out, o)
+	}
+	return out, nil
+}
+
+// CheckOverhead returns an error naming every path whose overhead per call is
+// over budget, for failing a CI job:
+//
+//	results, err := bench.MeasureOverhead(ctx, bench.OverheadOptions{})
+//	if err == nil {
+//		err = bench.CheckOverhead(results, 2*time.Microsecond)
+//	}
+func CheckOverhead(results []Overhead, budget time.Duration) error {
+	var over []string
+	for _, o := range results {
+		if o.PerCall() > budget {
+			over = append(over, fmt.Sprintf("%s adds %v", o.Path, o.PerCall()))
+		}
+	}
+	if len(over) == 0 {
+		return nil
+	}
+	return fmt.Errorf("bench: timer overhead is over the budget of %v per call: %s", budget, strings.Join(over, ", "))
+}
+
+// WriteOverhead writes results as a table, one row per path.
+func WriteOverhead(w io.Writer, results []Overhead) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "path\tplain\ttimed\toverhead\tplain allocs\ttimed allocs\n")
+	for _, o := range results {
+		fmt.Fprintf(tw, "%s\t%v\t%v\t%v\t%.1f\t%.1f\n", o.Path, o.Plain, o.Timed, o.PerCall(), o.PlainAllocs, o.TimedAllocs)
+	}
+	return tw.Flush()
+}
+
+// measurePath runs path on db repeatedly for d, and returns the time and
+// allocations of each run.
+func measurePath(ctx context.Context, db *sql.DB, path string, d time.Duration) (time.Duration, float64, error) {
+	// Open the connection before measuring.
+	if err := runPath(ctx, db, path); err != nil {
+		return 0, 0, err
+	}
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	deadline := start.Add(d)
+	n := 0
+	for ; n == 0 || n%64 != 0 || time.Now().Before(deadline); n++ {
+		if err := runPath(ctx, db, path); err != nil {
+			return 0, 0, err
+		}
+	}
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return elapsed / time.Duration(n), float64(after.Mallocs-before.Mallocs) / float64(n), nil
+}
+
+func runPath(ctx context.Context, db *sql.DB, path string) error {
+	switch path {
+	case "Exec":
+		_, err := db.ExecContext(ctx, "UPDATE t SET a = ? WHERE id = ?", 1, 2)
+		return err
+	case "Query":
+		var a int64
+		return db.QueryRowContext(ctx, "SELECT a FROM t WHERE id = ?", 2).Scan(&a)
+	case "Prepare":
+		stmt, err := db.PrepareContext(ctx, "UPDATE t SET a = ? WHERE id = ?")
+		if err != nil {
+			return err
+		}
+		if _, err := stmt.ExecContext(ctx, 1, 2); err != nil {
+			stmt.Close()
+			return err
+		}
+		return stmt.Close()
+	case "Tx":
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "UPDATE t SET a = ? WHERE id = ?", 1, 2); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	}
+	return fmt.Errorf("bench: unknown path %q", path)
+}
+
+// nopDriverName is the name the driver that does nothing is registered as.
+const nopDriverName = "dbtimer-bench-nop"
+
+var nopOnce sync.Once
+
+func registerNop() {
+	nopOnce.Do(func() { sql.Register(nopDriverName, nopDriver{}) })
+}
+
+// nopDriver is a driver whose statements succeed at once, affecting one row
+// or returning one row with the value 1.
+type nopDriver struct{}
+
+func (nopDriver) Open(string) (driver.Conn, error) { return nopConn{}, nil }
+
+type nopConn struct{}
+
+func (nopConn) Prepare(query string) (driver.Stmt, error) { return nopStmt{}, nil }
+func (nopConn) Close() error                              { return nil }
+func (nopConn) Begin() (driver.Tx, error)                 { return nopTx{}, nil }
+
+func (nopConn) ExecContext(context.Context, string, []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (nopConn) QueryContext(context.Context, string, []driver.NamedValue) (driver.Rows, error) {
+	return &nopRows{}, nil
+}
+
+type nopStmt struct{}
+
+func (nopStmt) Close() error  { return nil }
+func (nopStmt) NumInput() int { return -1 }
+
+func (nopStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (nopStmt) Query([]driver.Value) (driver.Rows, error)  { return &nopRows{}, nil }
+
+type nopTx struct{}
+
+func (nopTx) Commit() error   { return nil }
+func (nopTx) Rollback() error { return nil }
+
+type nopRows struct{ done bool }
+
+func (*nopRows) Columns() []string { return []string{"a"} }
+func (*nopRows) Close() error      { return nil }
+
+func (r *nopRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
@@ -0,0 +1,116 @@
+package bench
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// ReplayOptions controls how recorded traffic is replayed.
+type ReplayOptions struct {
+	// Speed scales the time between statements: 1 keeps the recorded pacing,
+	// 2 replays twice as fast, and 0 sends each statement as soon as a
+	// connection is free.
+	Speed float64
+
+	// Concurrency limits the statements running at once. The default is 16.
+	Concurrency int
+}
+
+// Replay runs the statements in events against t, starting each one at the
+// same offset from the first that it had when it was recorded, and reports
+// the recorded latency of each fingerprint as A ("recorded") and the replayed
+// latency as B. Events that didn't run a statement are skipped.
+//
+// The events are usually read from a JSON log with dbtimer.ReadJSONLog. Logs
+// written in compliance mode have no arguments and can't be replayed.
+func Replay(ctx context.Context, t Target, events []dbtimer.TimerInfo, opts ReplayOptions) (*Report, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 16
+	}
+	if opts.Speed < 0 {
+		return nil, errors.New("bench: replay speed can't be negative")
+	}
+	recorded := newResult()
+	recorded.recording = true
+	var stmts []dbtimer.TimerInfo
+	for _, ti := range events {
+		if ti.Query == "" || !isStatement(ti.Method) {
+			continue
+		}
+		recorded.Log(ti)
+		stmts = append(stmts, ti)
+	}
+	sort.SliceStable(stmts, func(i, j int) bool { return stmts[i].Start.Before(stmts[j].Start) })
+
+	replayed := newResult()
+	replayed.recording = true
+	db, err := open(t, opts.Concurrency, replayed)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	begin := time.Now()
+	for _, ti := range stmts {
+		if opts.Speed > 0 {
+			offset := time.Duration(float64(ti.Start.Sub(stmts[0].Start)) / opts.Speed)
+			if wait := time.Until(begin.Add(offset)); wait > 0 {
+				timer := time.NewTimer(wait)
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					timer.Stop()
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(ti dbtimer.TimerInfo) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			replayOne(ctx, db, ti)
+		}(ti)
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return newReport("recorded", t.Name, recorded, replayed), nil
+}
+
+func isStatement(method string) bool {
+	return strings.HasSuffix(method, ".Exec") || strings.HasSuffix(method, ".Query")
+}
+
+// replayOne runs a recorded statement. Its outcome is recorded by the logger.
+func replayOne(ctx context.Context, db *sql.DB, ti dbtimer.TimerInfo) {
+	args := make([]interface{}, len(ti.Args))
+	for i, a := range ti.Args {
+		args[i] = a
+	}
+	if strings.HasSuffix(ti.Method, ".Exec") {
+		db.ExecContext(ctx, ti.Query, args...)
+		return
+	}
+	rows, err := db.QueryContext(ctx, ti.Query, args...)
+	if err != nil {
+		return
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+}
@@ -0,0 +1,260 @@
+package dbtimer
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Breaker configures a circuit breaker for the statements run through a
+// Driver. While a circuit is closed, statements run as usual and their errors
+// and latency are measured over a window. When the error rate or the p99
+// latency of a window goes over its limit, the circuit opens, and statements
+// fail fast with a *CircuitOpenError instead of reaching the database. After
+// OpenFor, the circuit is half-open: a few probe statements are let through,
+// and the circuit closes if they succeed or opens again if they fail. A
+// statement that failed because its context was cancelled isn't counted,
+// since the caller gave up on it rather than the database failing; one that
+// ran past a deadline, the caller's or the driver's Timeouts, counts as a
+// failure, with its latency.
+//
+// Every change of state is logged as an event with the method
+// "breaker.Open", "breaker.HalfOpen" or "breaker.Close" and the circuit's
+// key as the query.
+type Breaker struct {
+	// PerFingerprint keeps a circuit for each statement fingerprint. If it is
+	// false, there is one circuit for the whole database.
+	PerFingerprint bool
+
+	// Window is the length of the windows over which statements are measured.
+	// The default is ten seconds.
+	Window time.Duration
+
+	// MinRequests is the number of statements a window needs before it can
+	// open the circuit. The default is 20.
+	MinRequests int
+
+	// MaxErrorRate, if not 0, is the fraction of failing statements, between 0
+	// and 1, above which the circuit opens.
+	MaxErrorRate float64
+
+	// MaxP99, if not 0, is the p99 latency above which the circuit opens.
+	// Probes slower than MaxP99 count as failures.
+	MaxP99 time.Duration
+
+	// OpenFor is how long the circuit stays open before probing. The default
+	// is 30 seconds.
+	OpenFor time.Duration
+
+	// Probes is the number of statements let through at once while half-open.
+	// The default is 1.
+	Probes int
+}
+
+// ErrCircuitOpen matches every *CircuitOpenError with errors.Is.
+var ErrCircuitOpen = errors.New("dbtimer: circuit breaker is open")
+
+// CircuitOpenError is returned in place of running a statement while its
+// circuit is open. Key is the fingerprint, or "" for the whole database.
+type CircuitOpenError struct {
+	Key   string
+	Until time.Time
+}
+
+func (ce *CircuitOpenError) Error() string {
+	if ce.Key == "" {
+		return fmt.Sprintf("%v until %v", ErrCircuitOpen, ce.Until.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%v for %q until %v", ErrCircuitOpen, ce.Key, ce.Until.Format(time.RFC3339))
+}
+
+func (ce *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// SetBreaker sets the circuit breaker for the statements run through d,
+// starting with every circuit closed. Passing nil removes it. It is an
+// ErrConfig error if b has neither MaxErrorRate nor MaxP99.
+func (d *Driver) SetBreaker(b *Breaker) error {
+	var br *breaker
+	if b != nil {
+		if b.MaxErrorRate <= 0 && b.MaxP99 <= 0 {
+			return &Error{Kind: ErrConfig, Err: errors.New("breaker has neither MaxErrorRate nor MaxP99")}
+		}
+		cfg := *b
+		if cfg.Window <= 0 {
+			cfg.Window = 10 * time.Second
+		}
+		if cfg.MinRequests <= 0 {
+			cfg.MinRequests = 20
+		}
+		if cfg.OpenFor <= 0 {
+			cfg.OpenFor = 30 * time.Second
+		}
+		if cfg.Probes <= 0 {
+			cfg.Probes = 1
+		}
+		br = &breaker{cfg: cfg, circuits: map[string]*circuit{}}
+	}
+	d.breaker.Store(breakerHolder{br})
+	return nil
+}
+
+// WithBreaker sets the driver's circuit breaker, as SetBreaker does.
+func WithBreaker(b *Breaker) Option {
+	return func(d *Driver) error {
+		return d.SetBreaker(b)
+	}
+}
+
+type breakerHolder struct {
+	b *breaker
+}
+
+type breaker struct {
+	cfg      Breaker
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+var circuitMethods = map[circuitState]string{
+	circuitClosed:   "breaker.Close",
+	circuitOpen:     "breaker.Open",
+	circuitHalfOpen: "breaker.HalfOpen",
+}
+
+type circuit struct {
+	state       circuitState
+	windowStart time.Time
+	count       int
+	errors      int
+	latency     Histogram
+	openUntil   time.Time
+	probes      int
+}
+
+// allowStatement checks the circuit for a statement. If the statement may
+// run, it returns the function to call with its outcome; otherwise it returns
+// a *CircuitOpenError. ctx is the statement's context.
+func (cs *connState) allowStatement(ctx context.Context, method, query string) (func(err error), error) {
+	h, _ := cs.d.breaker.Load().(breakerHolder)
+	if h.b == nil || !runsStatement(method) {
+		return nil, nil
+	}
+	b := h.b
+	key := ""
+	if b.cfg.PerFingerprint {
+		key = Fingerprint(query)
+	}
+	start := cs.d.now()
+	var transition circuitState = -1
+	b.mu.Lock()
+	c := b.circuits[key]
+	if c == nil {
+		c = &circuit{windowStart: start, latency: NewHistogram(nil)}
+		b.circuits[key] = c
+	}
+	if c.state == circuitOpen {
+		if start.Before(c.openUntil) {
+			until := c.openUntil
+			b.mu.Unlock()
+			return nil, &CircuitOpenError{Key: key, Until: until}
+		}
+		c.state, c.probes = circuitHalfOpen, 0
+		transition = circuitHalfOpen
+	}
+	if c.state == circuitHalfOpen {
+		if c.probes >= b.cfg.Probes {
+			until := c.openUntil
+			b.mu.Unlock()
+			cs.logTransition(transition, key, start)
+			return nil, &CircuitOpenError{Key: key, Until: until}
+		}
+		c.probes++
+	}
+	b.mu.Unlock()
+	cs.logTransition(transition, key, start)
+	return func(err error) {
+		end := cs.d.now()
+		cs.logTransition(b.record(c, err, ctx.Err() != nil, end.Sub(start), end), key, end)
+	}, nil
+}
+
+// record adds the outcome of a statement to c and returns the state c moved
+// to, or -1 if it didn't change. driver.ErrSkip means the statement didn't
+// run, and context.Canceled once ctxDone means the caller gave up on it, so
+// neither is counted. Deadlines are failures.
+func (b *breaker) record(c *circuit, err error, ctxDone bool, d time.Duration, now time.Time) circuitState {
+	failed := err != nil
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if errors.Is(err, driver.ErrSkip) || (ctxDone && errors.Is(err, context.Canceled)) {
+		if c.state == circuitHalfOpen {
+			c.probes--
+		}
+		return -1
+	}
+	switch c.state {
+	case circuitHalfOpen:
+		c.probes--
+		if failed || (b.cfg.MaxP99 > 0 && d > b.cfg.MaxP99) {
+			c.state, c.openUntil = circuitOpen, now.Add(b.cfg.OpenFor)
+			return circuitOpen
+		}
+		c.state = circuitClosed
+		c.resetWindow(now)
+		return circuitClosed
+	case circuitClosed:
+		if now.Sub(c.windowStart) >= b.cfg.Window {
+			c.resetWindow(now)
+		}
+		c.count++
+		if failed {
+			c.errors++
+		}
+		c.latency.Observe(d)
+		if c.count < b.cfg.MinRequests {
+			return -1
+		}
+		if (b.cfg.MaxErrorRate > 0 && float64(c.errors)/float64(c.count) > b.cfg.MaxErrorRate) ||
+			(b.cfg.MaxP99 > 0 && c.latency.Quantile(0.99) > b.cfg.MaxP99) {
+			c.state, c.openUntil = circuitOpen, now.Add(b.cfg.OpenFor)
+			return circuitOpen
+		}
+	}
+	return -1
+}
+
+func (c *circuit) resetWindow(now time.Time) {
+	c.windowStart = now
+	c.count, c.errors = 0, 0
+	c.latency = NewHistogram(c.latency.Bounds)
+}
+
+// logTransition logs a change of a circuit's state, if there was one.
+func (cs *connState) logTransition(state circuitState, key string, at time.Time) {
+	if state < 0 {
+		return
+	}
+	if tl := cs.d.timerLogger(); tl != nil {
+		logEvent(tl, TimerInfo{
+			Method: circuitMethods[state],
+			Query:  key,
+			Start:  at,
+			End:    at,
+			ConnID: cs.id,
+			Tags:   cs.d.labels,
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package dbtimer
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"time"
+)
+
+// UnwrapConn returns the underlying driver's connection if c is a connection
+// from the timer driver, and c itself otherwise. Use it with sql.Conn.Raw to
+// reach driver-specific APIs, such as pgx's CopyFrom:
+//
+//	conn.Raw(func(dc interface{}) error {
+//		pc := dbtimer.UnwrapConn(dc.(driver.Conn)).(*stdlib.Conn)
+//		_, err := pc.Conn().CopyFrom(ctx, table, columns, src)
+//		return err
+//	})
+//
+// Calls made on the underlying connection aren't timed.
+func UnwrapConn(c driver.Conn) driver.Conn {
+	for {
+		u, ok := c.(interface{ Unwrap() driver.Conn })
+		if !ok {
+			return c
+		}
+		c = u.Unwrap()
+	}
+}
+
+// Unwrap returns the underlying driver's statement.
+func (s *Stmt) Unwrap() driver.Stmt {
+	return s.s
+}
+
+// isCopyFromStdin reports whether query is a PostgreSQL COPY ... FROM STDIN,
+// as prepared by pq.CopyIn.
+func isCopyFromStdin(query string) bool {
+	q := strings.TrimLeft(query, " \t\r\n")
+	return len(q) > 4 && strings.EqualFold(q[:4], "copy") && strings.Contains(strings.ToLower(q), "from stdin")
+}
+
+// isLoadData reports whether query is a MySQL LOAD DATA statement.
+func isLoadData(query string) bool {
+	q := strings.TrimLeft(query, " \t\r\n")
+	return len(q) > 9 && strings.EqualFold(q[:9], "load data")
+}
+
+// newStmt wraps a statement prepared on the connection.
+func (cs *connState) newStmt(s driver.Stmt, query string) driver.Stmt {
+	st := &Stmt{s: s, query: query, cs: cs, guard: cs.newGuard("stmt")}
+	if isCopyFromStdin(query) {
+		st.copy = &copyIn{}
+	}
+	return wrapStmt(st)
+}
+
+// copyIn is the progress of a COPY FROM STDIN statement.
+type copyIn struct {
+	start time.Time
+	rows  int
+}
+
+// execCopy runs an Exec of a COPY FROM STDIN statement. pq sends a row with
+// each Exec that has arguments, and ends the copy with one that has none. The
+// rows aren't logged on their own; the copy is logged as "conn.CopyIn" when it
+// ends or fails, timed from its first row, with the number of rows as its
+// BatchSize.
+func (s *Stmt) execCopy(ctx context.Context, args []driver.Value, exec func() (driver.Result, error)) (driver.Result, error) {
+	c := s.copy
+	if c.start.IsZero() {
+		c.start = s.cs.d.now()
+	}
+	var r driver.Result
+	var err error
+	if len(args) > 0 {
+		r, err = exec()
+		if err == nil {
+			c.rows++
+			return r, nil
+		}
+		start, rows := c.start, c.rows
+		*c = copyIn{}
+		s.cs.doTimingWith(ctx, "conn.CopyIn", s.query, nil, timing{since: start, rows: &rows}, func() error { return err })
+		return r, err
+	}
+	start, rows := c.start, c.rows
+	*c = copyIn{}
+	err = s.cs.doTimingWith(ctx, "conn.CopyIn", s.query, nil, timing{since: start, rows: &rows}, func() error {
+		r, err = exec()
+		return err
+	})
+	return r, err
+}
+
+// timeExec times an Exec on the connection or a statement, as method, with
+// the rows it affected. A MySQL LOAD DATA statement run on the connection is
+// logged as "conn.LoadData", with the number of rows it loaded as its
+// BatchSize.
+func (cs *connState) timeExec(ctx context.Context, method, query string, args []driver.Value, exec func() (driver.Result, error)) (driver.Result, error) {
+	var r driver.Result
+	var err error
+	var affected int64
+	t := timing{affected: &affected}
+	var rows int
+	if method == "conn.Exec" && isLoadData(query) {
+		method = "conn.LoadData"
+		t.rows = &rows
+	}
+	err = cs.doTimingWith(ctx, method, query, args, t, func() error {
+		r, err = exec()
+		if err == nil && r != nil {
+			if n, rerr := r.RowsAffected(); rerr == nil {
+				affected = n
+				rows = int(n)
+			}
+		}
+		return err
+	})
+	return r, err
+}
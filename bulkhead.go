@@ -0,0 +1,197 @@
+package dbtimer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bulkhead limits the number of statements that run at once through a
+// Driver, so that one slow or misbehaving database can't hold every
+// connection in a shared pool. A statement that finds every slot taken waits
+// for one; the time it waits is recorded in its event as Wait. A query gives
+// its slot back when the driver returns its rows, not when they are closed.
+type Bulkhead struct {
+	// MaxInFlight is the number of statements that may run at once.
+	MaxInFlight int
+
+	// MaxWait, if not 0, is the longest a statement waits for a slot before
+	// failing with ErrBulkheadFull. Otherwise it waits until its context is
+	// done.
+	MaxWait time.Duration
+}
+
+// ErrBulkheadFull is returned in place of running a statement that waited
+// MaxWait for a slot without getting one.
+var ErrBulkheadFull = errors.New("dbtimer: too many statements in flight")
+
+// BulkheadStats describes how saturated a Driver's bulkhead is.
+type BulkheadStats struct {
+	// Limit is the bulkhead's MaxInFlight, or 0 if the Driver has none.
+	Limit int
+
+	// InFlight and Waiting are the statements running and waiting for a slot
+	// now.
+	InFlight int
+	Waiting  int
+
+	// Acquired is the number of statements that got a slot, Waited the number
+	// of those that had to wait for it, and Rejected the number that gave up
+	// waiting.
+	Acquired int64
+	Waited   int64
+	Rejected int64
+
+	// TotalWait and MaxWait are the total and the longest time statements
+	// waited, whether or not they got a slot.
+	TotalWait time.Duration
+	MaxWait   time.Duration
+}
+
+// SetBulkhead sets the bulkhead for the statements run through d. Passing nil
+// removes it. Statements already waiting under the old bulkhead keep waiting
+// for it. It is an ErrConfig error if MaxInFlight is less than 1.
+func (d *Driver) SetBulkhead(b *Bulkhead) error {
+	var bh *bulkhead
+	if b != nil {
+		if b.MaxInFlight < 1 {
+			return &Error{Kind: ErrConfig, Err: errors.New("bulkhead MaxInFlight must be at least 1")}
+		}
+		bh = &bulkhead{cfg: *b, slots: make(chan struct{}, b.MaxInFlight)}
+	}
+	d.bulkhead.Store(bulkheadHolder{bh})
+	return nil
+}
+
+// WithBulkhead sets the driver's bulkhead, as SetBulkhead does.
+func WithBulkhead(b *Bulkhead) Option {
+	return func(d *Driver) error {
+		return d.SetBulkhead(b)
+	}
+}
+
+// BulkheadStats returns the saturation of d's bulkhead since it was set.
+func (d *Driver) BulkheadStats() BulkheadStats {
+	h, _ := d.bulkhead.Load().(bulkheadHolder)
+	if h.b == nil {
+		return BulkheadStats{}
+	}
+	h.b.mu.Lock()
+	defer h.b.mu.Unlock()
+	s := h.b.stats
+	s.Limit = h.b.cfg.MaxInFlight
+	s.InFlight = len(h.b.slots)
+	return s
+}
+
+type bulkheadHolder struct {
+	b *bulkhead
+}
+
+type bulkhead struct {
+	cfg   Bulkhead
+	slots chan struct{}
+	mu    sync.Mutex
+	stats BulkheadStats
+}
+
+// acquireSlot takes a bulkhead slot for a statement, waiting for one if they
+// are all taken. It returns the function that gives the slot back and how
+// long the statement waited. If no slot was taken, the error is
+// ErrBulkheadFull or the context's error.
+func (cs *connState) acquireSlot(ctx context.Context, method string) (func(), time.Duration, error) {
+	h, _ := cs.d.bulkhead.Load().(bulkheadHolder)
+	if h.b == nil || !runsStatement(method) {
+		return func() {}, 0, nil
+	}
+	b := h.b
+	release := func() { <-b.slots }
+	select {
+	case b.slots <- struct{}{}:
+		b.mu.Lock()
+		b.stats.Acquired++
+		b.mu.Unlock()
+		return release, 0, nil
+	default:
+	}
+	start := cs.d.now()
+	b.mu.Lock()
+	b.stats.Waiting++
+	b.mu.Unlock()
+	var timeout <-chan time.Time
+	if b.cfg.MaxWait > 0 {
+		t := time.NewTimer(b.cfg.MaxWait)
+		defer t.Stop()
+		timeout = t.C
+	}
+	var err error
+	select {
+	case b.slots <- struct{}{}:
+	case <-timeout:
+		err = ErrBulkheadFull
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	wait := cs.d.now().Sub(start)
+	b.mu.Lock()
+	b.stats.Waiting--
+	b.stats.TotalWait += wait
+	if wait > b.stats.MaxWait {
+		b.stats.MaxWait = wait
+	}
+	if err != nil {
+		b.stats.Rejected++
+	} else {
+		b.stats.Acquired++
+		b.stats.Waited++
+	}
+	b.mu.Unlock()
+	if err != nil {
+		return func() {}, wait, err
+	}
+	return release, wait, nil
+}
+
+// WritePrometheus writes the stats in the Prometheus text exposition format,
+// as gauges and counters named dbtimer_bulkhead_*, labelled with the given
+// label pairs, such as the driver's name.
+func (bs BulkheadStats) WritePrometheus(w io.Writer, labels map[string]string) error {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var sb strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		fmt.Fprintf(&sb, "%s=\"%s\"", promLabelName(k), promLabel(labels[k]))
+	}
+	l := sb.String()
+	bw := bufio.NewWriter(w)
+	for _, m := range []struct {
+		name, typ, help string
+		value           string
+	}{
+		{"dbtimer_bulkhead_limit", "gauge", "Statements a bulkhead lets run at once.", strconv.Itoa(bs.Limit)},
+		{"dbtimer_bulkhead_in_flight", "gauge", "Statements running under a bulkhead.", strconv.Itoa(bs.InFlight)},
+		{"dbtimer_bulkhead_waiting", "gauge", "Statements waiting for a bulkhead slot.", strconv.Itoa(bs.Waiting)},
+		{"dbtimer_bulkhead_acquired_total", "counter", "Statements that got a bulkhead slot.", strconv.FormatInt(bs.Acquired, 10)},
+		{"dbtimer_bulkhead_waited_total", "counter", "Statements that waited for a bulkhead slot.", strconv.FormatInt(bs.Waited, 10)},
+		{"dbtimer_bulkhead_rejected_total", "counter", "Statements that gave up waiting for a bulkhead slot.", strconv.FormatInt(bs.Rejected, 10)},
+		{"dbtimer_bulkhead_wait_seconds_total", "counter", "Time statements waited for a bulkhead slot.", promFloat(bs.TotalWait.Seconds())},
+	} {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", m.name, m.typ)
+		fmt.Fprintf(bw, "%s{%s} %s\n", m.name, l, m.value)
+	}
+	return bw.Flush()
+}
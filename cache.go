@@ -0,0 +1,389 @@
+package dbtimer
+
+import (
+	"bufio"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ResultCache serves the results of allow-listed reads from memory for a
+// while after they were last read from the database, for hot reference data
+// the timer shows is read far more often than it changes. It is opt-in by
+// fingerprint: set it on a driver with SetResultCache, and list the reads it
+// may cache, and for how long, in TTLs.
+//
+// A result is cached once the application has read all its rows, or all but
+// none are left when it closes them, as with QueryRow, keyed by
+// the query text and arguments. Reads in a transaction are never cached, as
+// they may need to see the transaction's own writes. Results with more than
+// MaxRows rows, or more than one result set, aren't cached. A hit returns the
+// rows and their column names, but not the driver's column types.
+//
+// Cached results go stale when the data changes. Call Invalidate, or
+// InvalidateAll, from the code that changes it, or set InvalidateOnWrite to
+// drop a fingerprint's results whenever a statement run through the same
+// driver writes to its table. A write in a transaction drops them both when
+// it runs and when the transaction commits, so that results read by other
+// connections before the commit don't outlive it. A read that was under way
+// when its results were invalidated doesn't store them.
+type ResultCache struct {
+	// TTLs are how long the results of each read may be served from the
+	// cache. The keys can be any query with the same fingerprint.
+	// Changing TTLs after the cache is set on a driver has no effect.
+	TTLs map[string]time.Duration
+
+	// MaxEntries is the number of results kept; once it is reached, the
+	// result that expires soonest is dropped. The default is 1000.
+	MaxEntries int
+
+	// MaxRows is the number of rows a result may have to be cached. The
+	// default is 1000.
+	MaxRows int
+
+	// InvalidateOnWrite drops the results of the reads of a table when a
+	// statement that isn't a read, run through the driver, names it.
+	InvalidateOnWrite bool
+
+	once    sync.Once
+	mu      sync.Mutex
+	ttls    map[string]time.Duration
+	entries map[string]*cacheEntry
+	stats   map[string]*CacheStats
+
+	// gen, tableGens and fpGens count the invalidations of everything, of
+	// each table and of each fingerprint. A read keeps their sum for its
+	// fingerprint and table from its lookup, and its result is only stored
+	// if the sum hasn't changed since.
+	gen       uint64
+	tableGens map[string]uint64
+	fpGens    map[string]uint64
+}
+
+// CacheStats counts the lookups of one fingerprint in a ResultCache: the
+// Hits served from it, the Misses that went to the database, the results
+// Stored, and the ones dropped by invalidation or Evicted for room.
+type CacheStats struct {
+	Fingerprint   string
+	Hits          int64
+	Misses        int64
+	Stored        int64
+	Invalidations int64
+	Evicted       int64
+}
+
+// HitRate returns the fraction of lookups that were hits.
+func (cs CacheStats) HitRate() float64 {
+	if cs.Hits+cs.Misses == 0 {
+		return 0
+	}
+	return float64(cs.Hits) / float64(cs.Hits+cs.Misses)
+}
+
+type cacheEntry struct {
+	fingerprint string
+	table       string
+	gen         uint64
+	expires     time.Time
+	columns     []string
+	rows        [][]driver.Value
+}
+
+// SetResultCache sets the cache of read results on d. Passing nil stops
+// caching. The same cache may be set on several drivers of the same
+// database. It is an ErrConfig error if a TTL isn't positive.
+func (d *Driver) SetResultCache(rc *ResultCache) error {
+	if rc != nil {
+		for q, ttl := range rc.TTLs {
+			if ttl <= 0 {
+				return &Error{Kind: ErrConfig, Err: fmt.Errorf("result cache TTL %v for %q is not positive", ttl, q)}
+			}
+		}
+		rc.once.Do(rc.init)
+	}
+	d.cache.Store(cacheHolder{rc})
+	return nil
+}
+
+// WithResultCache sets the driver's cache of read results, as
+// SetResultCache does.
+func WithResultCache(rc *ResultCache) Option {
+	return func(d *Driver) error {
+		return d.SetResultCache(rc)
+	}
+}
+
+type cacheHolder struct {
+	rc *ResultCache
+}
+
+func (d *Driver) resultCache() *ResultCache {
+	h, _ := d.cache.Load().(cacheHolder)
+	return h.rc
+}
+
+func (rc *ResultCache) init() {
+	rc.ttls = map[string]time.Duration{}
+	for q, ttl := range rc.TTLs {
+		rc.ttls[Fingerprint(q)] = ttl
+	}
+	rc.entries = map[string]*cacheEntry{}
+	rc.stats = map[string]*CacheStats{}
+	rc.tableGens = map[string]uint64{}
+	rc.fpGens = map[string]uint64{}
+}
+
+// generation returns the invalidations so far that affect the reads of fp,
+// whose table is table. rc.mu is held.
+func (rc *ResultCache) generation(fp, table string) uint64 {
+	return rc.gen + rc.tableGens[table] + rc.fpGens[fp]
+}
+
+// stat returns the stats of fp. rc.mu is held.
+func (rc *ResultCache) stat(fp string) *CacheStats {
+	s := rc.stats[fp]
+	if s == nil {
+		s = &CacheStats{Fingerprint: fp}
+		rc.stats[fp] = s
+	}
+	return s
+}
+
+// lookup returns the rows cached for query and args if there are some that
+// haven't expired by now. Otherwise it returns the key and TTL to store them
+// under, with the generation they must be stored at, or "" if query isn't
+// cached.
+func (rc *ResultCache) lookup(query string, args []driver.Value, now time.Time) (driver.Rows, string, string, time.Duration, uint64) {
+	fp := Fingerprint(query)
+	ttl, ok := rc.ttls[fp]
+	if !ok {
+		return nil, "", "", 0, 0
+	}
+	key := readKey(query, args)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	s := rc.stat(fp)
+	if e, ok := rc.entries[key]; ok {
+		if now.Before(e.expires) {
+			s.Hits++
+			return &cachedRows{columns: e.columns, rows: e.rows}, "", "", 0, 0
+		}
+		delete(rc.entries, key)
+	}
+	s.Misses++
+	return nil, key, fp, ttl, rc.generation(fp, statementTable(fp))
+}
+
+// store keeps e under key, making room for it if the cache is full, unless
+// its reads have been invalidated since e was read.
+func (rc *ResultCache) store(key string, e *cacheEntry) {
+	max := rc.MaxEntries
+	if max <= 0 {
+		max = 1000
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.generation(e.fingerprint, e.table) != e.gen {
+		return
+	}
+	if _, ok := rc.entries[key]; !ok && len(rc.entries) >= max {
+		var soonest string
+		for k, old := range rc.entries {
+			if soonest == "" || old.expires.Before(rc.entries[soonest].expires) {
+				soonest = k
+			}
+		}
+		rc.stat(rc.entries[soonest].fingerprint).Evicted++
+		delete(rc.entries, soonest)
+	}
+	rc.entries[key] = e
+	rc.stat(e.fingerprint).Stored++
+}
+
+// Invalidate drops the cached results of every read with the same
+// fingerprint as query.
+func (rc *ResultCache) Invalidate(query string) {
+	fp := Fingerprint(query)
+	rc.invalidate(func() { rc.fpGens[fp]++ }, func(e *cacheEntry) bool { return e.fingerprint == fp })
+}
+
+// InvalidateTable drops the cached results of every read of table, as Table
+// names it.
+func (rc *ResultCache) InvalidateTable(table string) {
+	if table == "" {
+		return
+	}
+	rc.invalidate(func() { rc.tableGens[table]++ }, func(e *cacheEntry) bool { return e.table == table })
+}
+
+// InvalidateAll drops every cached result.
+func (rc *ResultCache) InvalidateAll() {
+	rc.invalidate(func() { rc.gen++ }, func(*cacheEntry) bool { return true })
+}
+
+// invalidate counts an invalidation with bump and drops the entries that
+// match.
+func (rc *ResultCache) invalidate(bump func(), match func(*cacheEntry) bool) {
+	rc.mu.Lock()
+	bump()
+	for k, e := range rc.entries {
+		if match(e) {
+			rc.stat(e.fingerprint).Invalidations++
+			delete(rc.entries, k)
+		}
+	}
+	rc.mu.Unlock()
+}
+
+// observeWrite invalidates the reads of the table query writes to, if
+// InvalidateOnWrite is set, and returns the table, or "" if it invalidated
+// nothing.
+func (rc *ResultCache) observeWrite(query string) string {
+	if !rc.InvalidateOnWrite || query == "" || isRead(query) {
+		return ""
+	}
+	table := Table(query)
+	rc.InvalidateTable(table)
+	return table
+}
+
+// Stats returns the lookups of each cached fingerprint so far, the most
+// lookups first.
+func (rc *ResultCache) Stats() []CacheStats {
+	rc.mu.Lock()
+	out := make([]CacheStats, 0, len(rc.stats))
+	for _, s := range rc.stats {
+		out = append(out, *s)
+	}
+	rc.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if li, lj := out[i].Hits+out[i].Misses, out[j].Hits+out[j].Misses; li != lj {
+			return li > lj
+		}
+		return out[i].Fingerprint < out[j].Fingerprint
+	})
+	return out
+}
+
+// WritePrometheus writes the cache's stats in the Prometheus text exposition
+// format, as the counters dbtimer_cache_hits_total,
+// dbtimer_cache_misses_total, dbtimer_cache_stores_total,
+// dbtimer_cache_invalidations_total and dbtimer_cache_evictions_total,
+// labelled by fingerprint.
+func (rc *ResultCache) WritePrometheus(w io.Writer) error {
+	stats := rc.Stats()
+	bw := bufio.NewWriter(w)
+	for _, m := range []struct {
+		name, help string
+		value      func(CacheStats) int64
+	}{
+		{"dbtimer_cache_hits_total", "Reads served from the result cache.", func(s CacheStats) int64 { return s.Hits }},
+		{"dbtimer_cache_misses_total", "Cacheable reads that went to the database.", func(s CacheStats) int64 { return s.Misses }},
+		{"dbtimer_cache_stores_total", "Results stored in the result cache.", func(s CacheStats) int64 { return s.Stored }},
+		{"dbtimer_cache_invalidations_total", "Cached results dropped by invalidation.", func(s CacheStats) int64 { return s.Invalidations }},
+		{"dbtimer_cache_evictions_total", "Cached results dropped to make room.", func(s CacheStats) int64 { return s.Evicted }},
+	} {
+		fmt.Fprintf(bw, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(bw, "# TYPE %s counter\n", m.name)
+		for _, s := range stats {
+			fmt.Fprintf(bw, "%s{fingerprint=\"%s\"} %d\n", m.name, promLabel(s.Fingerprint), m.value(s))
+		}
+	}
+	return bw.Flush()
+}
+
+// capture returns rows that store their result in rc under key once they
+// have all been read.
+func (rc *ResultCache) capture(rows driver.Rows, key, fp, query string, gen uint64, expires time.Time) driver.Rows {
+	max := rc.MaxRows
+	if max <= 0 {
+		max = 1000
+	}
+	return keepRowsInterfaces(&captureRows{
+		Rows:  rows,
+		rc:    rc,
+		key:   key,
+		entry: &cacheEntry{fingerprint: fp, table: statementTable(fp), gen: gen, expires: expires, columns: rows.Columns()},
+		max:   max,
+	}, rows)
+}
+
+// captureRows copies the rows the application reads, and stores them in the
+// cache when the last has been read.
+type captureRows struct {
+	driver.Rows
+	rc    *ResultCache
+	key   string
+	entry *cacheEntry
+	max   int
+}
+
+func (cr *captureRows) Next(dest []driver.Value) error {
+	err := cr.Rows.Next(dest)
+	if cr.entry == nil {
+		return err
+	}
+	switch {
+	case err == io.EOF:
+		if rs, ok := cr.Rows.(driver.RowsNextResultSet); !ok || !rs.HasNextResultSet() {
+			cr.rc.store(cr.key, cr.entry)
+		}
+		cr.entry = nil
+	case err != nil || len(cr.entry.rows) == cr.max:
+		cr.entry = nil
+	default:
+		row := make([]driver.Value, len(dest))
+		for i, v := range dest {
+			// Drivers may reuse the memory of []byte values.
+			if b, ok := v.([]byte); ok {
+				v = append([]byte(nil), b...)
+			}
+			row[i] = v
+		}
+		cr.entry.rows = append(cr.entry.rows, row)
+	}
+	return err
+}
+
+// Close stores the result if the application read every row but the sql
+// package didn't ask for the end, as QueryRow doesn't. It takes one more Next
+// to tell, which the driver would read past on Close anyway.
+func (cr *captureRows) Close() error {
+	if cr.entry != nil {
+		cr.Next(make([]driver.Value, len(cr.entry.columns)))
+	}
+	return cr.Rows.Close()
+}
+
+// cachedRows replays a result from the cache.
+type cachedRows struct {
+	columns []string
+	rows    [][]driver.Value
+	i       int
+}
+
+func (cr *cachedRows) Columns() []string {
+	return cr.columns
+}
+
+func (cr *cachedRows) Close() error {
+	return nil
+}
+
+func (cr *cachedRows) Next(dest []driver.Value) error {
+	if cr.i == len(cr.rows) {
+		return io.EOF
+	}
+	for i, v := range cr.rows[cr.i] {
+		// The application may keep a []byte it scanned into a RawBytes.
+		if b, ok := v.([]byte); ok {
+			v = append([]byte(nil), b...)
+		}
+		dest[i] = v
+	}
+	cr.i++
+	return nil
+}
@@ -0,0 +1,197 @@
+package dbtimer
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// CacheEstimator measures how much a ResultCache could save before one is
+// set up: for the reads run through a driver, it counts the runs that
+// returned the same result as a run of the same query and arguments less
+// than TTL before, which a cache with that TTL would have served from
+// memory. It hashes the rows the application reads, as Shadow's
+// CompareResults does, and keeps only the hash, so it never holds results.
+//
+// Like a cache, it leaves out reads in a transaction. A read the application
+// stops reading early is compared by the rows it read.
+type CacheEstimator struct {
+	// TTL is how long a result counts as cached after it was read. The
+	// default is a minute.
+	TTL time.Duration
+
+	// Rate, if not 0, is the fraction of the distinct reads that are
+	// hashed, between 0 and 1. Reads are chosen by their query and
+	// arguments, so every run of a chosen read is seen.
+	Rate float64
+
+	// MaxReads is the number of distinct reads whose last result is
+	// remembered. The default is 10000.
+	MaxReads int
+
+	mu    sync.Mutex
+	reads map[string]*estimatedRead
+	order []string
+	byFP  map[string]*CachePotential
+}
+
+// CachePotential is what a cache of one fingerprint's results would have
+// done with the reads the estimator sampled: the Hits it would have served,
+// which would have saved Saved, and the Stale results it would have served
+// when the data changed within the TTL.
+type CachePotential struct {
+	Fingerprint string
+	Sampled     int64
+	Hits        int64
+	Stale       int64
+	Saved       time.Duration
+}
+
+// HitRate returns the fraction of the sampled reads that would have been
+// hits.
+func (cp CachePotential) HitRate() float64 {
+	if cp.Sampled == 0 {
+		return 0
+	}
+	return float64(cp.Hits) / float64(cp.Sampled)
+}
+
+type estimatedRead struct {
+	at   time.Time
+	rows int
+	hash uint64
+}
+
+// SetCacheEstimator sets the estimator of the cacheability of d's reads.
+// Passing nil stops estimating. The same estimator may be set on several
+// drivers of the same database. It is an ErrConfig error if TTL is negative
+// or Rate isn't between 0 and 1.
+func (d *Driver) SetCacheEstimator(ce *CacheEstimator) error {
+	if ce != nil {
+		if ce.TTL < 0 {
+			return &Error{Kind: ErrConfig, Err: fmt.Errorf("cache estimator TTL %v is negative", ce.TTL)}
+		}
+		if ce.Rate < 0 || ce.Rate > 1 {
+			return &Error{Kind: ErrConfig, Err: fmt.Errorf("cache estimator Rate %v is not between 0 and 1", ce.Rate)}
+		}
+	}
+	d.cacheEst.Store(cacheEstimatorHolder{ce})
+	return nil
+}
+
+// WithCacheEstimator sets the driver's cache estimator, as SetCacheEstimator
+// does.
+func WithCacheEstimator(ce *CacheEstimator) Option {
+	return func(d *Driver) error {
+		return d.SetCacheEstimator(ce)
+	}
+}
+
+type cacheEstimatorHolder struct {
+	ce *CacheEstimator
+}
+
+func (d *Driver) cacheEstimator() *CacheEstimator {
+	h, _ := d.cacheEst.Load().(cacheEstimatorHolder)
+	return h.ce
+}
+
+// watch returns rows that hash their result for the estimator, or rows
+// itself if query isn't a read or isn't sampled. start is when the read
+// began, so that a hit saves the time from then until the rows are closed.
+func (ce *CacheEstimator) watch(d *Driver, rows driver.Rows, query string, args []driver.Value, start time.Time) driver.Rows {
+	if !isRead(query) {
+		return rows
+	}
+	key := readKey(query, args)
+	if ce.Rate != 0 {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		if float64(h.Sum64())/math.MaxUint64 >= ce.Rate {
+			return rows
+		}
+	}
+	return keepRowsInterfaces(&countingRows{Rows: rows, hash: true, done: func(n int, sum uint64) {
+		end := d.now()
+		ce.observe(key, Fingerprint(query), estimatedRead{at: end, rows: n, hash: sum}, end.Sub(start))
+	}}, rows)
+}
+
+// observe compares the result of a read that took d with the last result of
+// the same read that a cache would still hold.
+func (ce *CacheEstimator) observe(key, fp string, res estimatedRead, d time.Duration) {
+	ttl := ce.TTL
+	if ttl <= 0 {
+		ttl = time.Minute
+	}
+	ce.mu.Lock()
+	defer ce.mu.Unlock()
+	if ce.reads == nil {
+		ce.reads = map[string]*estimatedRead{}
+		ce.byFP = map[string]*CachePotential{}
+	}
+	cp := ce.byFP[fp]
+	if cp == nil {
+		cp = &CachePotential{Fingerprint: fp}
+		ce.byFP[fp] = cp
+	}
+	cp.Sampled++
+	last, ok := ce.reads[key]
+	if !ok {
+		max := ce.MaxReads
+		if max <= 0 {
+			max = 10000
+		}
+		if len(ce.order) >= max {
+			delete(ce.reads, ce.order[0])
+			ce.order = ce.order[1:]
+		}
+		ce.order = append(ce.order, key)
+		ce.reads[key] = &res
+		return
+	}
+	if res.at.Sub(last.at) >= ttl {
+		// The cached result would have expired, and this read stored anew.
+		*last = res
+		return
+	}
+	if last.rows == res.rows && last.hash == res.hash {
+		cp.Hits++
+		cp.Saved += d
+		return
+	}
+	// A cache would have kept serving the old result until it expired.
+	cp.Stale++
+}
+
+// Potential returns what a cache would have done for each fingerprint
+// sampled since the estimator was created or last reset, the most time saved
+// first.
+func (ce *CacheEstimator) Potential() []CachePotential {
+	ce.mu.Lock()
+	out := make([]CachePotential, 0, len(ce.byFP))
+	for _, cp := range ce.byFP {
+		out = append(out, *cp)
+	}
+	ce.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Saved != out[j].Saved {
+			return out[i].Saved > out[j].Saved
+		}
+		return out[i].Fingerprint < out[j].Fingerprint
+	})
+	return out
+}
+
+// Reset forgets all reads and potentials.
+func (ce *CacheEstimator) Reset() {
+	ce.mu.Lock()
+	ce.reads = nil
+	ce.order = nil
+	ce.byFP = nil
+	ce.mu.Unlock()
+}
@@ -0,0 +1,96 @@
+package dbtimer
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SetCallSites sets whether d adds the file, line and function of the
+// application code that made each call to its event, in the "call_site"
+// tag, so that time can be traced back to the code that spends it. It costs
+// a stack trace per call.
+func (d *Driver) SetCallSites(on bool) {
+	d.callSites.Store(on)
+}
+
+// WithCallSites has the driver add call sites to its events, as SetCallSites
+// does.
+func WithCallSites() Option {
+	return func(d *Driver) error {
+		d.SetCallSites(true)
+		return nil
+	}
+}
+
+// FoldedStacks is a TimerLogger that adds up the time of statements by call
+// site and fingerprint, and writes it as folded stacks, one line per pair:
+//
+//	/src/app/orders.go:42 (main.loadOrder);select * from orders where id = ? 15230
+//
+// That is the input of Brendan Gregg's flamegraph.pl and of tools such as
+// speedscope, which draw a flame graph of application code → SQL time. The
+// count on each line is in microseconds. Call sites come from the
+// "call_site" tag, so turn them on with SetCallSites; statements without one
+// are under "unknown".
+type FoldedStacks struct {
+	mu     sync.Mutex
+	totals map[[2]string]time.Duration
+}
+
+// Log adds the time of the statement run by ti to its call site and
+// fingerprint. Events that don't run a statement are ignored.
+func (fs *FoldedStacks) Log(ti TimerInfo) {
+	if !runsStatement(ti.Method) || ti.Query == "" {
+		return
+	}
+	site := ti.Tags["call_site"]
+	if site == "" {
+		site = "unknown"
+	}
+	k := [2]string{site, Fingerprint(ti.Query)}
+	fs.mu.Lock()
+	if fs.totals == nil {
+		fs.totals = map[[2]string]time.Duration{}
+	}
+	fs.totals[k] += ti.Elapsed()
+	fs.mu.Unlock()
+}
+
+// Reset forgets the time added up so far.
+func (fs *FoldedStacks) Reset() {
+	fs.mu.Lock()
+	fs.totals = nil
+	fs.mu.Unlock()
+}
+
+// WriteTo writes the folded stacks, in order, with each total rounded up to
+// the microsecond.
+func (fs *FoldedStacks) WriteTo(w io.Writer) (int64, error) {
+	fs.mu.Lock()
+	keys := make([][2]string, 0, len(fs.totals))
+	totals := make(map[[2]string]time.Duration, len(fs.totals))
+	for k, d := range fs.totals {
+		keys = append(keys, k)
+		totals[k] = d
+	}
+	fs.mu.Unlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	cw := &countingWriter{w: w}
+	frame := strings.NewReplacer(";", ",", "\n", " ")
+	for _, k := range keys {
+		us := (totals[k] + time.Microsecond - 1) / time.Microsecond
+		if _, err := fmt.Fprintf(cw, "%s;%s %d\n", frame.Replace(k[0]), frame.Replace(k[1]), us); err != nil {
+			return cw.n, err
+		}
+	}
+	return cw.n, nil
+}
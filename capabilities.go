@@ -0,0 +1,152 @@
+package dbtimer
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+//go:generate go run -tags integration ./cmd/dbtimer-capabilities -go capmatrix.go -json capabilities.json
+
+// Capabilities reports which of the optional database/sql/driver interfaces an
+// underlying driver and its connections implement.
+type Capabilities struct {
+	SupportsConnector      bool // driver.DriverContext
+	SupportsQueryer        bool // driver.Queryer
+	SupportsQueryerContext bool // driver.QueryerContext
+	SupportsExecer         bool // driver.Execer
+	SupportsExecerContext  bool // driver.ExecerContext
+	SupportsPrepareContext bool // driver.ConnPrepareContext
+	SupportsTxOptions      bool // driver.ConnBeginTx
+	SupportsPing           bool // driver.Pinger
+	SupportsSessionReset   bool // driver.SessionResetter
+	SupportsValidation     bool // driver.Validator
+	SupportsNamedValues    bool // driver.NamedValueChecker
+}
+
+// Inspect returns the capabilities of the underlying driver ud and its
+// connection c.
+func Inspect(ud driver.Driver, c driver.Conn) Capabilities {
+	var caps Capabilities
+	_, caps.SupportsConnector = ud.(driver.DriverContext)
+	_, caps.SupportsQueryer = c.(driver.Queryer)
+	_, caps.SupportsQueryerContext = c.(driver.QueryerContext)
+	_, caps.SupportsExecer = c.(driver.Execer)
+	_, caps.SupportsExecerContext = c.(driver.ExecerContext)
+	_, caps.SupportsPrepareContext = c.(driver.ConnPrepareContext)
+	_, caps.SupportsTxOptions = c.(driver.ConnBeginTx)
+	_, caps.SupportsPing = c.(driver.Pinger)
+	_, caps.SupportsSessionReset = c.(driver.SessionResetter)
+	_, caps.SupportsValidation = c.(driver.Validator)
+	_, caps.SupportsNamedValues = c.(driver.NamedValueChecker)
+	return caps
+}
+
+// capabilityNames are the names of the interfaces behind Capabilities' fields,
+// in their order.
+var capabilityNames = []string{
+	"DriverContext", "Queryer", "QueryerContext", "Execer", "ExecerContext", "ConnPrepareContext",
+	"ConnBeginTx", "Pinger", "SessionResetter", "Validator", "NamedValueChecker",
+}
+
+func (caps Capabilities) list() []bool {
+	return []bool{
+		caps.SupportsConnector, caps.SupportsQueryer, caps.SupportsQueryerContext, caps.SupportsExecer,
+		caps.SupportsExecerContext, caps.SupportsPrepareContext, caps.SupportsTxOptions, caps.SupportsPing,
+		caps.SupportsSessionReset, caps.SupportsValidation, caps.SupportsNamedValues,
+	}
+}
+
+// Missing returns the names of the interfaces that want has and caps
+// doesn't.
+func (caps Capabilities) Missing(want Capabilities) []string {
+	var out []string
+	has := caps.list()
+	for i, w := range want.list() {
+		if w && !has[i] {
+			out = append(out, capabilityNames[i])
+		}
+	}
+	return out
+}
+
+// KnownCapabilities returns the capabilities of a well-known driver, by the
+// name it registers itself as, from the compatibility matrix generated by
+// the dbtimer-capabilities command, or false if it isn't in the matrix.
+func KnownCapabilities(driverName string) (Capabilities, bool) {
+	caps, ok := knownCapabilities[driverName]
+	return caps, ok
+}
+
+// Degradations lists what the timer, or the sql package behind it, does
+// differently because of the interfaces that are missing.
+func (caps Capabilities) Degradations() []string {
+	var out []string
+	switch {
+	case !caps.SupportsQueryerContext && !caps.SupportsQueryer:
+		out = append(out, "no Queryer: every query is prepared first, costing a round trip, and is logged as conn.Prepare and stmt.Query")
+	case !caps.SupportsQueryerContext:
+		out = append(out, "no QueryerContext: a query can't be canceled once it starts")
+	}
+	switch {
+	case !caps.SupportsExecerContext && !caps.SupportsExecer:
+		out = append(out, "no Execer: every exec is prepared first, costing a round trip, and is logged as conn.Prepare and stmt.Exec")
+	case !caps.SupportsExecerContext:
+		out = append(out, "no ExecerContext: an exec can't be canceled once it starts")
+	}
+	if !caps.SupportsPrepareContext {
+		out = append(out, "no ConnPrepareContext: a prepare can't be canceled once it starts")
+	}
+	if !caps.SupportsTxOptions {
+		out = append(out, "no ConnBeginTx: transactions can't set an isolation level or be read-only")
+	}
+	if !caps.SupportsPing {
+		out = append(out, "no Pinger: pings always succeed and aren't logged")
+	}
+	if !caps.SupportsSessionReset {
+		out = append(out, "no SessionResetter: connections are reused without being reset")
+	}
+	return out
+}
+
+// Capabilities returns the capabilities of the underlying driver called
+// driverName, as found on the first connection d opened to it. It returns
+// false if d hasn't connected to driverName yet. For a *sql.DB opened through
+// the timer, d is db.Driver().(*dbtimer.Driver).
+func (d *Driver) Capabilities(driverName string) (Capabilities, bool) {
+	caps, ok := d.checked.Load(driverName)
+	if !ok {
+		return Capabilities{}, false
+	}
+	return caps.(Capabilities), true
+}
+
+// Capabilities returns the capabilities of the connector's underlying driver,
+// or false if it hasn't connected yet.
+func (c *connector) Capabilities() (Capabilities, bool) {
+	return c.d.Capabilities(c.driverName)
+}
+
+// checkCapabilities records the capabilities of driverName, and reports to
+// the error handler, as ErrDegraded, each way that connections to it are
+// degraded, and each interface it lacks that the compatibility matrix says
+// it has, which means it is wrapped by something that hides it or isn't the
+// version the matrix was made with. It checks the first connection d opens
+// to each underlying driver.
+func (d *Driver) checkCapabilities(driverName string, ud driver.Driver, c driver.Conn) {
+	if _, ok := d.checked.Load(driverName); ok {
+		return
+	}
+	caps := Inspect(ud, c)
+	if _, checked := d.checked.LoadOrStore(driverName, caps); checked {
+		return
+	}
+	for _, msg := range caps.Degradations() {
+		handleError(&Error{Kind: ErrDegraded, Err: fmt.Errorf("driver %q: %s", driverName, msg)})
+	}
+	if known, ok := KnownCapabilities(driverName); ok {
+		if missing := caps.Missing(known); len(missing) > 0 {
+			handleError(&Error{Kind: ErrDegraded, Err: fmt.Errorf("driver %q lacks %s, which the compatibility matrix says it has; it may be wrapped, or a different version", driverName, strings.Join(missing, ", "))})
+		}
+	}
+}
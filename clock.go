@@ -0,0 +1,102 @@
+package dbtimer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Clock is the source of the Start and End times recorded in a TimerInfo.
+// Replacing the clock of a Driver lets tests of loggers, thresholds and
+// aggregation control time instead of sleeping.
+type Clock interface {
+	Now() time.Time
+}
+
+// ClockFunc adapts a function to the Clock interface.
+type ClockFunc func() time.Time
+
+func (cf ClockFunc) Now() time.Time {
+	return cf()
+}
+
+// SetClock sets the clock used to time calls made through d. A nil Clock
+// restores the system clock. It is safe to call while calls are being made.
+func (d *Driver) SetClock(c Clock) {
+	d.clock.Store(clockHolder{c})
+}
+
+type clockHolder struct {
+	c Clock
+}
+
+func (d *Driver) now() time.Time {
+	h, _ := d.clock.Load().(clockHolder)
+	if h.c == nil {
+		return time.Now()
+	}
+	return h.c.Now()
+}
+
+// Elapsed returns how long the call took: Duration if it is set, and
+// otherwise End less Start.
+func (ti TimerInfo) Elapsed() time.Duration {
+	if ti.Duration != 0 {
+		return ti.Duration
+	}
+	return ti.End.Sub(ti.Start)
+}
+
+// WallDuration returns End less Start by their wall clock readings alone,
+// which is what a sink that serializes them sees. It differs from Duration
+// if the system clock was set during the call.
+func (ti TimerInfo) WallDuration() time.Duration {
+	return ti.End.Round(0).Sub(ti.Start.Round(0))
+}
+
+// CoarseClock is a Clock for very hot paths, where even reading the system
+// clock for each call is too much. It reads the system clock every
+// resolution in a goroutine of its own, and Now returns the latest reading,
+// so calls shorter than the resolution may be timed as taking no time at
+// all. The readings keep their monotonic clock readings, so durations are
+// still immune to the system clock being set. Call Stop when it is no longer
+// used.
+type CoarseClock struct {
+	now  atomic.Value
+	stop chan struct{}
+	once sync.Once
+}
+
+// NewCoarseClock returns a CoarseClock that reads the system clock every
+// resolution, or every millisecond if resolution isn't positive.
+func NewCoarseClock(resolution time.Duration) *CoarseClock {
+	if resolution <= 0 {
+		resolution = time.Millisecond
+	}
+	cc := &CoarseClock{stop: make(chan struct{})}
+	cc.now.Store(time.Now())
+	go func() {
+		t := time.NewTicker(resolution)
+		defer t.Stop()
+		for {
+			select {
+			case now := <-t.C:
+				cc.now.Store(now)
+			case <-cc.stop:
+				return
+			}
+		}
+	}()
+	return cc
+}
+
+// Now returns the latest reading of the system clock.
+func (cc *CoarseClock) Now() time.Time {
+	return cc.now.Load().(time.Time)
+}
+
+// Stop stops reading the system clock. Now keeps returning the last
+// reading.
+func (cc *CoarseClock) Stop() {
+	cc.once.Do(func() { close(cc.stop) })
+}
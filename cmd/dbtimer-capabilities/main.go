@@ -0,0 +1,136 @@
+//go:build integration
+
+// Command dbtimer-capabilities probes well-known drivers for the optional
+// database/sql/driver interfaces, and writes the compatibility matrix that
+// dbtimer.KnownCapabilities reports and the timer checks connections
+// against. It starts postgres, mysql and sqlserver in docker containers and
+// probes lib/pq and the pgx stdlib driver against postgres,
+// go-sql-driver/mysql, go-mssqldb and mattn/go-sqlite3, in memory. It needs a
+// docker daemon, so it is built only with the integration tag; dbtimer runs
+// it with go generate:
+//
+//	go run -tags integration ./cmd/dbtimer-capabilities -go capmatrix.go -json capabilities.json
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"os/signal"
+	"sort"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jonbodner/dbtimer"
+	"github.com/jonbodner/dbtimer/integration"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	_ "github.com/microsoft/go-mssqldb"
+	"github.com/ory/dockertest/v3"
+)
+
+func main() {
+	goPath := flag.String("go", "", "write the matrix as Go source to this file")
+	jsonPath := flag.String("json", "", "write the matrix as JSON to this file")
+	wait := flag.Duration("wait", 2*time.Minute, "how long to wait for a container to accept connections")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		fail(err)
+	}
+	pool.MaxWait = *wait
+
+	matrix := map[string]dbtimer.Capabilities{}
+	probe := func(driverName, dsn string) {
+		caps, err := inspect(ctx, driverName, dsn)
+		if err != nil {
+			fail(fmt.Errorf("%s: %v", driverName, err))
+		}
+		matrix[driverName] = caps
+	}
+	for _, db := range []integration.Database{integration.Postgres, integration.MySQL, integration.SQLServer} {
+		target, remove, err := integration.Start(ctx, pool, db)
+		if err != nil {
+			fail(err)
+		}
+		probe(target.DriverName, target.DSN)
+		if db.Name == integration.Postgres.Name {
+			probe("pgx", target.DSN)
+		}
+		remove()
+	}
+	probe("sqlite3", ":memory:")
+
+	if *jsonPath != "" {
+		b, err := json.MarshalIndent(matrix, "", "  ")
+		if err != nil {
+			fail(err)
+		}
+		if err := os.WriteFile(*jsonPath, append(b, '\n'), 0644); err != nil {
+			fail(err)
+		}
+	}
+	if *goPath != "" {
+		if err := os.WriteFile(*goPath, goSource(matrix), 0644); err != nil {
+			fail(err)
+		}
+	}
+}
+
+// inspect opens a connection with the driver registered as driverName and
+// returns its capabilities.
+func inspect(ctx context.Context, driverName, dsn string) (dbtimer.Capabilities, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return dbtimer.Capabilities{}, err
+	}
+	defer db.Close()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return dbtimer.Capabilities{}, err
+	}
+	defer conn.Close()
+	var caps dbtimer.Capabilities
+	err = conn.Raw(func(dc interface{}) error {
+		caps = dbtimer.Inspect(db.Driver(), dc.(driver.Conn))
+		return nil
+	})
+	return caps, err
+}
+
+// goSource returns the Go source of the matrix, for the dbtimer package.
+func goSource(matrix map[string]dbtimer.Capabilities) []byte {
+	names := make([]string, 0, len(matrix))
+	for name := range matrix {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b bytes.Buffer
+	fmt.Fprint(&b, "// Code generated by dbtimer-capabilities; DO NOT EDIT.\n\npackage dbtimer\n\n")
+	fmt.Fprint(&b, "// knownCapabilities is the compatibility matrix of well-known drivers, by\n// the names they register themselves as.\n")
+	fmt.Fprint(&b, "var knownCapabilities = map[string]Capabilities{\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "%q: %#v,\n", name, matrix[name])
+	}
+	fmt.Fprint(&b, "}\n")
+	src, err := format.Source(bytes.ReplaceAll(b.Bytes(), []byte("dbtimer.Capabilities"), nil))
+	if err != nil {
+		fail(err)
+	}
+	return src
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
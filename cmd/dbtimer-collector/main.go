@@ -0,0 +1,59 @@
+// Command dbtimer-collector is a reference collector for events shipped by
+// collector.Sink. It aggregates the events from every instance into per
+// fingerprint statistics, served in the Prometheus text format at /metrics on
+// the same port, and can also append every event to a JSON log.
+//
+//	dbtimer-collector -addr :7070 -tls-cert cert.pem -tls-key key.pem -log events.ndjson
+//
+// Without a certificate the collector serves unencrypted HTTP/2, which should
+// only be used on a trusted network.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/jonbodner/dbtimer"
+	"github.com/jonbodner/dbtimer/collector"
+)
+
+func main() {
+	addr := flag.String("addr", ":7070", "the address to listen on")
+	certFile := flag.String("tls-cert", "", "the TLS certificate file")
+	keyFile := flag.String("tls-key", "", "the TLS key file")
+	logPath := flag.String("log", "", "a file to append every event to as JSON")
+	flag.Parse()
+	if (*certFile == "") != (*keyFile == "") {
+		fmt.Fprintln(os.Stderr, "-tls-cert and -tls-key must be used together")
+		os.Exit(2)
+	}
+
+	stats := &dbtimer.Stats{}
+	var logger dbtimer.TimerLogger = stats
+	if *logPath != "" {
+		f, err := os.OpenFile(*logPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		logger = dbtimer.MultiLogger(stats, dbtimer.NewJSONLogger(f))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		stats.WritePrometheus(w)
+	})
+	srv := collector.NewHTTPServer(*addr, &collector.Server{Logger: logger}, mux)
+	var err error
+	if *certFile != "" {
+		err = srv.ListenAndServeTLS(*certFile, *keyFile)
+	} else {
+		err = srv.ListenAndServe()
+	}
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,62 @@
+//go:build integration
+
+// Command dbtimer-integration starts postgres and mysql in docker containers
+// and runs the checks of the integration package against each, through lib/pq
+// and go-sql-driver/mysql. It needs a docker daemon, so it is built only with
+// the integration tag:
+//
+//	go run -tags integration ./cmd/dbtimer-integration
+//
+// It exits with status 1 if any check fails.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jonbodner/dbtimer/integration"
+	_ "github.com/lib/pq"
+	"github.com/ory/dockertest/v3"
+)
+
+func main() {
+	only := flag.String("only", "", "run against this database alone: postgres or mysql")
+	wait := flag.Duration("wait", 2*time.Minute, "how long to wait for a container to accept connections")
+	flag.Parse()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	pool.MaxWait = *wait
+
+	failed := false
+	for _, db := range []integration.Database{integration.Postgres, integration.MySQL} {
+		if *only != "" && *only != db.Name {
+			continue
+		}
+		target, remove, err := integration.Start(ctx, pool, db)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			continue
+		}
+		results := integration.Run(ctx, target)
+		remove()
+		for _, r := range results {
+			fmt.Println(r)
+		}
+		failed = failed || integration.Failed(results)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
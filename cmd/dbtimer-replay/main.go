@@ -0,0 +1,61 @@
+// Command dbtimer-replay replays a query log written by dbtimer's JSON logger
+// against a database, at the recorded pacing or scaled, and reports how the
+// latency of each fingerprint compares with what was recorded. Use it to try
+// a schema change or an index with production-shaped traffic.
+//
+//	dbtimer-replay -log queries.ndjson -driver postgres -dsn "postgres://localhost/staging" -speed 2
+//
+// Only the drivers imported by this command can be used: postgres (lib/pq)
+// and mysql (go-sql-driver/mysql).
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jonbodner/dbtimer"
+	"github.com/jonbodner/dbtimer/bench"
+	_ "github.com/lib/pq"
+)
+
+func main() {
+	logPath := flag.String("log", "", "the JSON query log to replay")
+	driverName := flag.String("driver", "", "the driver for the target database")
+	dsn := flag.String("dsn", "", "the DSN of the target database")
+	speed := flag.Float64("speed", 1, "pacing relative to the recording; 0 runs as fast as possible")
+	concurrency := flag.Int("concurrency", 16, "the most statements to run at once")
+	flag.Parse()
+	if *logPath == "" || *driverName == "" || *dsn == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(*logPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var events []dbtimer.TimerInfo
+	err = dbtimer.ReadJSONLog(f, func(ti dbtimer.TimerInfo) {
+		events = append(events, ti)
+	})
+	f.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	target := bench.Target{Name: "replayed", DriverName: *driverName, DSN: *dsn}
+	r, err := bench.Replay(ctx, target, events, bench.ReplayOptions{Speed: *speed, Concurrency: *concurrency})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	r.WriteTo(os.Stdout)
+}
@@ -0,0 +1,73 @@
+// Package collector ships dbtimer events from many instances to a central
+// collector over gRPC, using the Collector service and EventBatch messages in
+// wire/event.proto. Sink is the client, a dbtimer.TimerLogger that batches
+// events and streams them; Server is the collector, which passes everything
+// it receives to a TimerLogger of its own, such as a dbtimer.Stats.
+//
+// The gRPC protocol is implemented on net/http's HTTP/2 support, so neither
+// side needs the gRPC module, and both interoperate with standard gRPC clients
+// and servers. Use https addresses for TLS, or http addresses for unencrypted
+// HTTP/2 on a trusted network.
+package collector
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	shipPath       = "/dbtimer.v1.Collector/Ship"
+	instanceHeader = "Dbtimer-Instance"
+)
+
+// marshalShipResponse encodes a ShipResponse message.
+func marshalShipResponse(received uint64) []byte {
+	if received == 0 {
+		return nil
+	}
+	b := []byte{1<<3 | 0}
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], received)]...)
+}
+
+// unmarshalShipResponse decodes a ShipResponse message. Fields other than
+// received are ignored.
+func unmarshalShipResponse(b []byte) (uint64, error) {
+	var received uint64
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return 0, errors.New("bad ShipResponse")
+		}
+		b = b[n:]
+		switch tag & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return 0, errors.New("bad ShipResponse")
+			}
+			b = b[n:]
+			if tag>>3 == 1 {
+				received = v
+			}
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b)-n) {
+				return 0, errors.New("bad ShipResponse")
+			}
+			b = b[n+int(l):]
+		case 1, 5:
+			size := 8
+			if tag&7 == 5 {
+				size = 4
+			}
+			if len(b) < size {
+				return 0, errors.New("bad ShipResponse")
+			}
+			b = b[size:]
+		default:
+			return 0, errors.New("bad ShipResponse")
+		}
+	}
+	return received, nil
+}
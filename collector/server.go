@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/jonbodner/dbtimer"
+	"github.com/jonbodner/dbtimer/internal/grpcwire"
+	"github.com/jonbodner/dbtimer/wire"
+)
+
+// Server is the collector side of the Collector service. It passes every
+// event it receives to Logger, tagged with the name of the instance that sent
+// it under the "instance" tag.
+type Server struct {
+	Logger dbtimer.TimerLogger
+}
+
+// NewHTTPServer returns an http.Server that serves s at addr over HTTP/2,
+// both with TLS (if started with ListenAndServeTLS) and unencrypted. Requests
+// that aren't gRPC are passed to other, if it isn't nil, so that metrics can
+// be served from the same port.
+func NewHTTPServer(addr string, s *Server, other http.Handler) *http.Server {
+	return grpcwire.NewHTTPServer(addr, s, other)
+}
+
+// ServeHTTP handles a Ship call.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/grpc")
+	if r.Method != http.MethodPost || r.URL.Path != shipPath || !grpcwire.IsGRPC(r) {
+		grpcwire.WriteStatus(w, grpcwire.CodeUnimplemented, "unknown method "+r.URL.Path)
+		return
+	}
+	instance := r.Header.Get(instanceHeader)
+	// Send the headers now, so that the client knows the stream is open.
+	w.WriteHeader(http.StatusOK)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	var received uint64
+	for {
+		msg, err := grpcwire.ReadMessage(r.Body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			grpcwire.SetTrailer(w, grpcwire.CodeInternal, err.Error())
+			return
+		}
+		events, err := wire.UnmarshalProtoBatch(msg)
+		if err != nil {
+			grpcwire.SetTrailer(w, grpcwire.CodeInvalidArgument, err.Error())
+			return
+		}
+		for _, ti := range events {
+			if instance != "" {
+				tags := make(map[string]string, len(ti.Tags)+1)
+				for k, v := range ti.Tags {
+					tags[k] = v
+				}
+				tags["instance"] = instance
+				ti.Tags = tags
+			}
+			if s.Logger != nil {
+				s.Logger.Log(ti)
+			}
+		}
+		received += uint64(len(events))
+	}
+	if err := grpcwire.WriteMessage(w, marshalShipResponse(received)); err != nil {
+		return
+	}
+	grpcwire.SetTrailer(w, grpcwire.CodeOK, "")
+}
@@ -0,0 +1,295 @@
+package collector
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+	"github.com/jonbodner/dbtimer/internal/grpcwire"
+	"github.com/jonbodner/dbtimer/wire"
+)
+
+// SinkConfig configures a Sink.
+type SinkConfig struct {
+	// Address is the collector's URL, such as "https://collector:7070". An
+	// http URL uses unencrypted HTTP/2.
+	Address string
+
+	// Instance names this instance to the collector.
+	Instance string
+
+	// TLSConfig is used for https addresses. If it is nil, the default
+	// configuration is used.
+	TLSConfig *tls.Config
+
+	// BatchSize is the most events sent in one message. The default is 100.
+	BatchSize int
+
+	// FlushInterval is the longest an event waits to be sent. The default is
+	// one second.
+	FlushInterval time.Duration
+
+	// QueueSize is the number of events that can wait to be sent. The default
+	// is 10000.
+	QueueSize int
+
+	// Backpressure is what happens to an event when the queue is full. The
+	// default is dbtimer.DropNewest, which drops it and reports ErrDropped
+	// to the error handler.
+	Backpressure dbtimer.Backpressure
+
+	// BlockTimeout is how long an event waits for room under dbtimer.Block.
+	// The default is 100 milliseconds.
+	BlockTimeout time.Duration
+}
+
+// Sink is a dbtimer.TimerLogger that streams events to a collector. Logging
+// never waits for the network: events are queued, and a background goroutine
+// sends them in batches over a long-lived Ship stream, opening a new stream
+// when one fails. Problems are reported to the error handler.
+type Sink struct {
+	cfg    SinkConfig
+	client *http.Client
+	queue  *dbtimer.Queue
+	flush  chan chan struct{}
+	quit   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+
+	stream   *shipStream
+	closeErr error
+}
+
+// NewSink returns a Sink that sends to the collector at cfg.Address.
+func NewSink(cfg SinkConfig) (*Sink, error) {
+	if !strings.HasPrefix(cfg.Address, "http://") && !strings.HasPrefix(cfg.Address, "https://") {
+		return nil, &dbtimer.Error{Kind: dbtimer.ErrConfig, Err: fmt.Errorf("collector address %q is not an http or https URL", cfg.Address)}
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 10000
+	}
+	var p http.Protocols
+	p.SetHTTP2(true)
+	p.SetUnencryptedHTTP2(true)
+	s := &Sink{
+		cfg: cfg,
+		client: &http.Client{Transport: &http.Transport{
+			Protocols:       &p,
+			TLSClientConfig: cfg.TLSConfig,
+		}},
+		queue: dbtimer.NewQueue("collector sink", cfg.QueueSize, cfg.Backpressure, cfg.BlockTimeout),
+		flush: make(chan chan struct{}),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Log queues ti to be sent.
+func (s *Sink) Log(ti dbtimer.TimerInfo) {
+	s.queue.Put(ti)
+}
+
+// QueueStats returns the counts of events queued and lost.
+func (s *Sink) QueueStats() dbtimer.QueueStats {
+	return s.queue.Stats()
+}
+
+// Flush sends the queued events without waiting for the flush interval.
+// Failures are reported to the error handler, as they are in the background.
+func (s *Sink) Flush() error {
+	req := make(chan struct{})
+	select {
+	case s.flush <- req:
+		<-req
+	case <-s.done:
+	}
+	return nil
+}
+
+// Close sends the queued events, ends the stream and waits for the
+// collector's reply. Events logged after Close are dropped.
+func (s *Sink) Close() error {
+	s.once.Do(func() {
+		s.queue.Close()
+		close(s.quit)
+	})
+	<-s.done
+	return s.closeErr
+}
+
+func (s *Sink) run() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]dbtimer.TimerInfo, 0, s.cfg.BatchSize)
+	for {
+		select {
+		case ti := <-s.queue.Events():
+			batch = append(batch, ti)
+			if len(batch) >= s.cfg.BatchSize {
+				batch = s.send(batch)
+			}
+		case <-ticker.C:
+			batch = s.send(batch)
+		case req := <-s.flush:
+			batch = s.send(s.drain(batch))
+			close(req)
+		case <-s.quit:
+			s.send(s.drain(batch))
+			if s.stream != nil {
+				s.closeErr = s.stream.close()
+			}
+			return
+		}
+	}
+}
+
+// drain adds the queued events to batch, sending it whenever it is full.
+func (s *Sink) drain(batch []dbtimer.TimerInfo) []dbtimer.TimerInfo {
+	for ti, ok := s.queue.Next(); ok; ti, ok = s.queue.Next() {
+		batch = append(batch, ti)
+		if len(batch) >= s.cfg.BatchSize {
+			batch = s.send(batch)
+		}
+	}
+	return batch
+}
+
+// send sends batch, opening a stream if there isn't one, and returns batch
+// emptied for reuse. A batch that fails on a new stream is dropped.
+func (s *Sink) send(batch []dbtimer.TimerInfo) []dbtimer.TimerInfo {
+	if len(batch) == 0 {
+		return batch
+	}
+	msg := wire.MarshalProtoBatch(batch)
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.stream == nil {
+			s.stream = s.open()
+		}
+		err := s.stream.send(msg)
+		if err == nil {
+			return batch[:0]
+		}
+		s.stream.abort()
+		s.stream = nil
+		dbtimer.ReportError(dbtimer.ErrSink, err)
+	}
+	dbtimer.ReportError(dbtimer.ErrDropped, fmt.Errorf("collector: dropped %d events", len(batch)))
+	return batch[:0]
+}
+
+// shipStream is one Ship call. Messages are written to the request body
+// through a pipe while the call runs in its own goroutine.
+type shipStream struct {
+	pw     *io.PipeWriter
+	result chan error
+}
+
+func (s *Sink) open() *shipStream {
+	pr, pw := io.Pipe()
+	st := &shipStream{pw: pw, result: make(chan error, 1)}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(s.cfg.Address, "/")+shipPath, pr)
+	if err != nil {
+		pw.CloseWithError(err)
+		st.result <- err
+		return st
+	}
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	req.Header.Set("Te", "trailers")
+	if s.cfg.Instance != "" {
+		req.Header.Set(instanceHeader, s.cfg.Instance)
+	}
+	go func() {
+		err := call(s.client, req)
+		pr.CloseWithError(err)
+		st.result <- err
+	}()
+	return st
+}
+
+func (st *shipStream) send(msg []byte) error {
+	select {
+	case err := <-st.result:
+		if err == nil {
+			err = errors.New("collector: stream ended early")
+		}
+		st.result <- err
+		return err
+	default:
+	}
+	err := grpcwire.WriteMessage(st.pw, msg)
+	if err == nil {
+		return nil
+	}
+	// The transport closes the body when the call fails, so the call's own
+	// error is the more useful one.
+	select {
+	case cerr := <-st.result:
+		st.result <- cerr
+		if cerr != nil {
+			return cerr
+		}
+	case <-time.After(time.Second):
+	}
+	return err
+}
+
+// close ends the stream and waits for the collector's reply.
+func (st *shipStream) close() error {
+	st.pw.Close()
+	return <-st.result
+}
+
+// abort ends the stream without waiting.
+func (st *shipStream) abort() {
+	st.pw.CloseWithError(errors.New("collector: stream aborted"))
+}
+
+// call runs a Ship call and returns its gRPC status as an error.
+func call(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("collector: HTTP status %s", resp.Status)
+	}
+	if err := grpcStatus(resp.Header); err != nil {
+		return err
+	}
+	for {
+		msg, err := grpcwire.ReadMessage(resp.Body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := unmarshalShipResponse(msg); err != nil {
+			return err
+		}
+	}
+	if resp.Trailer.Get("Grpc-Status") == "" {
+		return errors.New("collector: response has no grpc-status")
+	}
+	return grpcStatus(resp.Trailer)
+}
+
+func grpcStatus(h http.Header) error {
+	return grpcwire.Status("collector", h)
+}
@@ -0,0 +1,100 @@
+package dbtimer
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sync/atomic"
+)
+
+// ColumnCapture records the columns returned by queries in their events, to
+// tell which variant of a query ran when its column list is built at run
+// time. Columns are read from the driver's rows when the query returns, so
+// capturing them costs a little on every query that is sampled.
+type ColumnCapture struct {
+	// MaxColumns is the most columns recorded for a query; the rest are left
+	// out. The default is 32.
+	MaxColumns int
+
+	// Every records the columns of one query in this many. The default, 1,
+	// records them for every query.
+	Every int
+}
+
+// Column is a column returned by a query. DatabaseType is the database's name
+// for its type, such as "VARCHAR" or "INT4", if the driver reports it.
+type Column struct {
+	Name         string
+	DatabaseType string
+}
+
+// SetColumnCapture sets the capture of returned columns in the events from d.
+// Passing nil stops capturing them. It is an ErrConfig error if MaxColumns or
+// Every is negative.
+func (d *Driver) SetColumnCapture(cc *ColumnCapture) error {
+	var h columnsHolder
+	if cc != nil {
+		if cc.MaxColumns < 0 {
+			return &Error{Kind: ErrConfig, Err: fmt.Errorf("column capture MaxColumns %d is negative", cc.MaxColumns)}
+		}
+		if cc.Every < 0 {
+			return &Error{Kind: ErrConfig, Err: fmt.Errorf("column capture Every %d is negative", cc.Every)}
+		}
+		cfg := *cc
+		if cfg.MaxColumns == 0 {
+			cfg.MaxColumns = 32
+		}
+		if cfg.Every == 0 {
+			cfg.Every = 1
+		}
+		h.c = &columnCapture{cfg: cfg}
+	}
+	d.columns.Store(h)
+	return nil
+}
+
+// WithColumnCapture sets the driver's capture of returned columns, as
+// SetColumnCapture does.
+func WithColumnCapture(cc *ColumnCapture) Option {
+	return func(d *Driver) error {
+		return d.SetColumnCapture(cc)
+	}
+}
+
+type columnsHolder struct {
+	c *columnCapture
+}
+
+type columnCapture struct {
+	n   uint64
+	cfg ColumnCapture
+}
+
+// captureColumns reports whether the columns of the next query from d should
+// be captured.
+func (d *Driver) captureColumns() (*columnCapture, bool) {
+	h, _ := d.columns.Load().(columnsHolder)
+	if h.c == nil {
+		return nil, false
+	}
+	if h.c.cfg.Every > 1 && atomic.AddUint64(&h.c.n, 1)%uint64(h.c.cfg.Every) != 1 {
+		return nil, false
+	}
+	return h.c, true
+}
+
+// columns returns the columns of rows, up to MaxColumns.
+func (cc *columnCapture) columns(rows driver.Rows) []Column {
+	names := rows.Columns()
+	if len(names) > cc.cfg.MaxColumns {
+		names = names[:cc.cfg.MaxColumns]
+	}
+	out := make([]Column, len(names))
+	types, _ := rows.(driver.RowsColumnTypeDatabaseTypeName)
+	for i, name := range names {
+		out[i].Name = name
+		if types != nil {
+			out[i].DatabaseType = types.ColumnTypeDatabaseTypeName(i)
+		}
+	}
+	return out
+}
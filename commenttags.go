@@ -0,0 +1,104 @@
+package dbtimer
+
+import (
+	"context"
+	"strings"
+)
+
+// SetCommentTags sets whether d turns the comments at the start of each
+// statement into tags on its event. A comment of comma-separated key:value
+// (or key=value) pairs, such as
+//
+//	/* app:checkout, owner:payments */ SELECT ...
+//
+// gives the event the tags app and owner, so that queries already annotated
+// for DBAs get the same dimensions in Stats and the other loggers. Tags set
+// on the call's context or the connection win over those from comments.
+func (d *Driver) SetCommentTags(on bool) {
+	d.commentTags.Store(on)
+}
+
+// WithCommentTags has the driver tag events from statement comments, as
+// SetCommentTags does.
+func WithCommentTags() Option {
+	return func(d *Driver) error {
+		d.SetCommentTags(true)
+		return nil
+	}
+}
+
+// CommentTags returns the tags in the comments at the start of query, or nil
+// if there are none. Both /* */ and -- comments are read, as many as come
+// before the statement. Pairs are separated by commas, and keys from values
+// by the first colon or equals sign; quotes around values are removed, and
+// text that isn't a pair is ignored. Where a key repeats, the last value
+// wins.
+func CommentTags(query string) map[string]string {
+	var tags map[string]string
+	q := query
+	for {
+		q = strings.TrimLeft(q, " \t\r\n")
+		var body string
+		switch {
+		case strings.HasPrefix(q, "/*"):
+			end := strings.Index(q[2:], "*/")
+			if end < 0 {
+				return tags
+			}
+			body, q = q[2:2+end], q[4+end:]
+		case strings.HasPrefix(q, "--"):
+			end := strings.IndexByte(q, '\n')
+			if end < 0 {
+				end = len(q)
+			}
+			body, q = q[2:end], q[end:]
+		default:
+			return tags
+		}
+		for _, pair := range strings.Split(body, ",") {
+			i := strings.IndexAny(pair, ":=")
+			if i < 0 {
+				continue
+			}
+			k := strings.TrimSpace(pair[:i])
+			v := unquoteTag(strings.TrimSpace(pair[i+1:]))
+			if k == "" || strings.ContainsAny(k, " \t\r\n") {
+				continue
+			}
+			if tags == nil {
+				tags = map[string]string{}
+			}
+			tags[k] = v
+		}
+	}
+}
+
+func unquoteTag(v string) string {
+	if len(v) >= 2 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// statementTags returns the tags for the events of query: those of ctx and
+// the connection, those in query's comments if d reads them, and its owner.
+func (cs *connState) statementTags(ctx context.Context, query string) map[string]string {
+	tags := cs.tags(ctx)
+	if on, _ := cs.d.commentTags.Load().(bool); on {
+		tags = withCommentTags(tags, query)
+	}
+	return cs.d.withOwner(tags, query)
+}
+
+// withCommentTags adds the tags in query's comments to tags, keeping the
+// values tags already has.
+func withCommentTags(tags map[string]string, query string) map[string]string {
+	ct := CommentTags(query)
+	if len(ct) == 0 {
+		return tags
+	}
+	for k, v := range tags {
+		ct[k] = v
+	}
+	return ct
+}
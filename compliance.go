@@ -0,0 +1,78 @@
+package dbtimer
+
+import (
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+)
+
+var complianceMode int32
+
+// SetComplianceMode turns compliance mode on or off. Compliance mode is for
+// regulated environments (GDPR, PCI DSS) that still want latency data. While
+// it is on, no application data leaves the driver in an event:
+//
+//   - Args is always nil;
+//   - Query holds the statement's fingerprint, with every literal replaced
+//     by ?, so metrics are keyed by fingerprint only;
+//   - "driver.Open" events have no Query, since the DSN may hold credentials;
+//   - ShadowResults carry the fingerprint and no arguments.
+//
+// Anything in this package that would capture more than timing, such as
+// query plans, stays off while compliance mode is on. Errors returned by the
+// underlying driver are passed on unchanged, so a driver that puts values in
+// its error messages can still leak them through TimerInfo.Err.
+func SetComplianceMode(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&complianceMode, v)
+}
+
+// ComplianceMode reports whether compliance mode is on.
+func ComplianceMode() bool {
+	return atomic.LoadInt32(&complianceMode) == 1
+}
+
+// VerifyCompliance returns an error unless compliance mode is on, so that a
+// service can refuse to start, or fail a health check, when it isn't.
+func VerifyCompliance() error {
+	if !ComplianceMode() {
+		return &Error{Kind: ErrConfig, Err: errors.New("compliance mode is not on")}
+	}
+	return nil
+}
+
+// scrub removes application data from an event's query and arguments when
+// compliance mode is on.
+func scrub(method string, query string, args []driver.Value) (string, []driver.Value) {
+	if !ComplianceMode() {
+		return query, args
+	}
+	if method == "driver.Open" || query == "" {
+		return "", nil
+	}
+	return Fingerprint(query), nil
+}
+
+// SetRedactArgs sets whether the events from d leave out the arguments of
+// calls, keeping the query text. It is a lighter measure than compliance mode
+// for services whose queries are safe to log but whose arguments aren't.
+func (d *Driver) SetRedactArgs(on bool) {
+	d.redact.Store(on)
+}
+
+// WithRedactArgs leaves the arguments of calls out of the driver's events, as
+// SetRedactArgs does.
+func WithRedactArgs() Option {
+	return func(d *Driver) error {
+		d.SetRedactArgs(true)
+		return nil
+	}
+}
+
+func (d *Driver) redactArgs() bool {
+	on, _ := d.redact.Load().(bool)
+	return on
+}
@@ -0,0 +1,298 @@
+package dbtimer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Config is the part of the timer's configuration that operators may need to
+// change while a service runs, such as tightening timeouts during an
+// incident. It is read from a JSON file with LoadConfig, and kept up to date
+// with WatchConfig:
+//
+//	{
+//	  "filter": {"deny": ["^SELECT 1$"], "deny_fingerprints": ["SELECT now()"]},
+//	  "compliance": true,
+//	  "redact_args": true,
+//	  "sampling": {"slow_threshold": "200ms", "rate": 0.1,
+//	    "exempt_fingerprints": ["UPDATE payments SET state = ?"], "exempt_tags": {"tenant": "acme"}},
+//	  "timeouts": {"default": "5s", "methods": {"conn.Query": "2s"}},
+//	  "column_capture": {"every": 100},
+//	  "owners": {"default": "platform", "tables": [{"pattern": "billing.*", "owner": "payments"}]}
+//	}
+//
+// Durations are written as time.ParseDuration strings. A section left out of
+// the file turns its setting off. A sampling rate, if given, must be greater
+// than 0 and at most 1; leave it out to log every event over the threshold.
+// Only JSON is read, so that the package keeps its lack of dependencies;
+// convert YAML with a tool such as yq.
+type Config struct {
+	// Filter is the filter of the statements each driver logs, as
+	// SetQueryFilter sets.
+	Filter QueryFilter
+
+	// Compliance is whether compliance mode is on, as SetComplianceMode
+	// sets.
+	Compliance bool
+
+	// RedactArgs is whether each driver leaves arguments out of its events,
+	// as SetRedactArgs sets.
+	RedactArgs bool
+
+	// Sampling is the sampling of each driver's events, as SetSampling
+	// sets.
+	Sampling *Sampling
+
+	// Timeouts are the timeouts enforced by each driver, as SetTimeouts
+	// sets.
+	Timeouts *Timeouts
+
+	// ColumnCapture is the sampling of returned columns by each driver, as
+	// SetColumnCapture sets.
+	ColumnCapture *ColumnCapture
+
+	// Owners are the owners of statements run through each driver, as
+	// SetOwners sets. The section is written as ParseOwners reads it.
+	Owners *Owners
+}
+
+type jsonConfig struct {
+	Filter *struct {
+		Allow             []string `json:"allow"`
+		Deny              []string `json:"deny"`
+		AllowFingerprints []string `json:"allow_fingerprints"`
+		DenyFingerprints  []string `json:"deny_fingerprints"`
+	} `json:"filter"`
+	Compliance bool `json:"compliance"`
+	RedactArgs bool `json:"redact_args"`
+	Sampling   *struct {
+		SlowThreshold      string            `json:"slow_threshold"`
+		Rate               *float64          `json:"rate"`
+		ExemptFingerprints []string          `json:"exempt_fingerprints"`
+		ExemptTags         map[string]string `json:"exempt_tags"`
+	} `json:"sampling"`
+	Timeouts *struct {
+		Default      string            `json:"default"`
+		Methods      map[string]string `json:"methods"`
+		Fingerprints map[string]string `json:"fingerprints"`
+	} `json:"timeouts"`
+	ColumnCapture *struct {
+		MaxColumns int `json:"max_columns"`
+		Every      int `json:"every"`
+	} `json:"column_capture"`
+	Owners *jsonOwners `json:"owners"`
+}
+
+// ParseConfig parses a Config from JSON. It is an ErrConfig error if the JSON
+// is malformed, has unknown fields or holds an invalid setting.
+func ParseConfig(data []byte) (*Config, error) {
+	var jc jsonConfig
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&jc); err != nil {
+		return nil, &Error{Kind: ErrConfig, Err: err}
+	}
+	c := &Config{Compliance: jc.Compliance, RedactArgs: jc.RedactArgs}
+	if f := jc.Filter; f != nil {
+		c.Filter = QueryFilter{Allow: f.Allow, Deny: f.Deny, AllowFingerprints: f.AllowFingerprints, DenyFingerprints: f.DenyFingerprints}
+	}
+	if s := jc.Sampling; s != nil {
+		c.Sampling = &Sampling{ExemptFingerprints: s.ExemptFingerprints, ExemptTags: s.ExemptTags}
+		var err error
+		if c.Sampling.SlowThreshold, err = parseConfigDuration("sampling.slow_threshold", s.SlowThreshold); err != nil {
+			return nil, err
+		}
+		if s.Rate != nil {
+			if *s.Rate <= 0 || *s.Rate > 1 {
+				return nil, &Error{Kind: ErrConfig, Err: fmt.Errorf("sampling.rate: %v is not a rate greater than 0 and at most 1", *s.Rate)}
+			}
+			c.Sampling.Rate = *s.Rate
+		}
+	}
+	if t := jc.Timeouts; t != nil {
+		c.Timeouts = &Timeouts{Methods: map[string]time.Duration{}, Fingerprints: map[string]time.Duration{}}
+		var err error
+		if c.Timeouts.Default, err = parseConfigDuration("timeouts.default", t.Default); err != nil {
+			return nil, err
+		}
+		for m, s := range t.Methods {
+			if c.Timeouts.Methods[m], err = parseConfigDuration("timeouts.methods."+m, s); err != nil {
+				return nil, err
+			}
+		}
+		for q, s := range t.Fingerprints {
+			if c.Timeouts.Fingerprints[q], err = parseConfigDuration("timeouts.fingerprints", s); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if cc := jc.ColumnCapture; cc != nil {
+		c.ColumnCapture = &ColumnCapture{MaxColumns: cc.MaxColumns, Every: cc.Every}
+	}
+	if jc.Owners != nil {
+		c.Owners = jc.Owners.owners()
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func parseConfigDuration(field, s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, &Error{Kind: ErrConfig, Err: fmt.Errorf("%s: %q is not a duration", field, s)}
+	}
+	return d, nil
+}
+
+// validate checks the settings that the Set functions can reject, so that a
+// bad Config is refused before any of it is applied.
+func (c *Config) validate() error {
+	for _, patterns := range [][]string{c.Filter.Allow, c.Filter.Deny} {
+		if _, err := compileAll(patterns); err != nil {
+			return &Error{Kind: ErrConfig, Err: err}
+		}
+	}
+	if err := (&Driver{}).SetOwners(c.Owners); err != nil {
+		return err
+	}
+	if err := (&Driver{}).SetSampling(c.Sampling); err != nil {
+		return err
+	}
+	return (&Driver{}).SetColumnCapture(c.ColumnCapture)
+}
+
+// LoadConfig reads and parses the Config in the JSON file at path.
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &Error{Kind: ErrConfig, Err: err}
+	}
+	return ParseConfig(data)
+}
+
+// Apply puts c into effect: compliance mode for the whole process, and the
+// filter, redaction, sampling, timeouts, column capture and owners for each
+// of drivers.
+func (c *Config) Apply(drivers ...*Driver) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	SetComplianceMode(c.Compliance)
+	for _, d := range drivers {
+		if err := d.SetQueryFilter(c.Filter); err != nil {
+			return err
+		}
+		d.SetRedactArgs(c.RedactArgs)
+		if err := d.SetSampling(c.Sampling); err != nil {
+			return err
+		}
+		d.SetTimeouts(c.Timeouts)
+		if err := d.SetColumnCapture(c.ColumnCapture); err != nil {
+			return err
+		}
+		if err := d.SetOwners(c.Owners); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ConfigWatcher keeps the configuration in a file applied. See WatchConfig.
+type ConfigWatcher struct {
+	path    string
+	drivers []*Driver
+	quit    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+
+	// modTime and size identify the version of the file last read. Only
+	// the watching goroutine touches them after WatchConfig returns.
+	modTime time.Time
+	size    int64
+}
+
+// WatchConfig loads the Config in the JSON file at path, applies it to
+// drivers, and then applies it again whenever the process receives SIGHUP or
+// the file's modification time or size changes, checking every interval (a
+// second if it is 0). The file is polled, rather than watched through the
+// operating system, so that it also works for files replaced through a
+// symlink, as Kubernetes does with ConfigMaps.
+//
+// It returns an error if the first load fails. A later reload that fails is
+// reported to the error handler as an ErrConfig error, and the configuration
+// in effect is kept. Call Close to stop watching.
+func WatchConfig(path string, interval time.Duration, drivers ...*Driver) (*ConfigWatcher, error) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	cw := &ConfigWatcher{
+		path:    path,
+		drivers: drivers,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if err := cw.reload(); err != nil {
+		return nil, err
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go cw.run(hup, interval)
+	return cw, nil
+}
+
+func (cw *ConfigWatcher) run(hup chan os.Signal, interval time.Duration) {
+	defer close(cw.done)
+	defer signal.Stop(hup)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-hup:
+		case <-t.C:
+			fi, err := os.Stat(cw.path)
+			if err != nil || (fi.ModTime().Equal(cw.modTime) && fi.Size() == cw.size) {
+				continue
+			}
+		case <-cw.quit:
+			return
+		}
+		if err := cw.reload(); err != nil {
+			handleError(err)
+		}
+	}
+}
+
+// reload reads the file and applies it.
+func (cw *ConfigWatcher) reload() error {
+	fi, err := os.Stat(cw.path)
+	if err != nil {
+		return &Error{Kind: ErrConfig, Err: err}
+	}
+	// The file's version is recorded even if it is invalid, so that a bad
+	// edit is reported once rather than on every poll.
+	cw.modTime, cw.size = fi.ModTime(), fi.Size()
+	c, err := LoadConfig(cw.path)
+	if err != nil {
+		return err
+	}
+	return c.Apply(cw.drivers...)
+}
+
+// Close stops watching the file. The configuration in effect is kept.
+func (cw *ConfigWatcher) Close() {
+	cw.once.Do(func() {
+		close(cw.quit)
+	})
+	<-cw.done
+}
@@ -0,0 +1,185 @@
+package dbtimer
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// ConsistencyProbe measures replica lag as the application sees it: how long
+// after a write to the primary returns a read from a replica observes it.
+// Servers report lag from their replication streams, which can disagree with
+// what a request that reads its own writes actually sees through the pool,
+// proxies and load balancers in between.
+//
+// Each probe inserts a unique token into Table through Primary, then reads
+// it through Replica every PollInterval until it is found, and deletes it.
+// The probe's calls carry the token in the "consistency_probe" tag, so they
+// can be told apart in the events. The table needs a single text column
+// named token:
+//
+//	CREATE TABLE dbtimer_consistency (token VARCHAR(32) PRIMARY KEY)
+type ConsistencyProbe struct {
+	// Primary and Replica are the databases written and read.
+	Primary *sql.DB
+	Replica *sql.DB
+
+	// Table is the table the tokens are written to. The default is
+	// "dbtimer_consistency".
+	Table string
+
+	// Interval is the time between probes made by Run. The default is ten
+	// seconds.
+	Interval time.Duration
+
+	// PollInterval is the time between reads of the replica. It bounds the
+	// precision of the measurement. The default is 10ms.
+	PollInterval time.Duration
+
+	// Timeout is how long the replica has to show a write before the probe
+	// fails. The default is 30 seconds.
+	Timeout time.Duration
+
+	// OnLag, if set, is called with the result of each probe.
+	OnLag func(ReplicaLag)
+
+	mu     sync.Mutex
+	lags   Histogram
+	probes int64
+	failed int64
+	last   ReplicaLag
+}
+
+// ReplicaLag is the result of one probe. Lag is the time from when the write
+// returned to when a read first observed it; if the probe failed, Err says
+// why.
+type ReplicaLag struct {
+	Token   string
+	Written time.Time
+	Lag     time.Duration
+	Err     error
+}
+
+// ConsistencyReport is the results of the probes made so far.
+type ConsistencyReport struct {
+	Probes int64
+	Failed int64
+	Last   ReplicaLag
+	Lag    Histogram
+}
+
+var identifierRE = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Measure makes one probe and returns its result.
+func (cp *ConsistencyProbe) Measure(ctx context.Context) ReplicaLag {
+	res := cp.measure(ctx)
+	cp.mu.Lock()
+	if cp.probes == 0 {
+		cp.lags = NewHistogram(nil)
+	}
+	cp.probes++
+	if res.Err != nil {
+		cp.failed++
+	} else {
+		cp.lags.Observe(res.Lag)
+	}
+	cp.last = res
+	cp.mu.Unlock()
+	if cp.OnLag != nil {
+		cp.OnLag(res)
+	}
+	return res
+}
+
+func (cp *ConsistencyProbe) measure(ctx context.Context) ReplicaLag {
+	table := cp.Table
+	if table == "" {
+		table = "dbtimer_consistency"
+	}
+	if !identifierRE.MatchString(table) {
+		return ReplicaLag{Err: &Error{Kind: ErrConfig, Err: fmt.Errorf("consistency probe table %q is not an identifier", table)}}
+	}
+	if cp.Primary == nil || cp.Replica == nil {
+		return ReplicaLag{Err: &Error{Kind: ErrConfig, Err: errors.New("consistency probe needs a Primary and a Replica")}}
+	}
+	poll, timeout := cp.PollInterval, cp.Timeout
+	if poll <= 0 {
+		poll = 10 * time.Millisecond
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return ReplicaLag{Err: err}
+	}
+	// The token is hex, so it is safe to write as a literal, which avoids
+	// the differences between drivers' placeholders.
+	res := ReplicaLag{Token: hex.EncodeToString(b[:])}
+	ctx = WithTag(ctx, "consistency_probe", res.Token)
+	if _, err := cp.Primary.ExecContext(ctx, "INSERT INTO "+table+" (token) VALUES ('"+res.Token+"')"); err != nil {
+		res.Err = err
+		return res
+	}
+	res.Written = time.Now()
+	defer cp.Primary.ExecContext(ctx, "DELETE FROM "+table+" WHERE token = '"+res.Token+"'")
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	t := time.NewTicker(poll)
+	defer t.Stop()
+	for {
+		var token string
+		err := cp.Replica.QueryRowContext(ctx, "SELECT token FROM "+table+" WHERE token = '"+res.Token+"'").Scan(&token)
+		if err == nil {
+			res.Lag = time.Since(res.Written)
+			return res
+		}
+		if err == sql.ErrNoRows {
+			err = nil
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			if err == nil {
+				err = ctx.Err()
+			}
+			res.Err = fmt.Errorf("replica did not show the write within %v: %w", timeout, err)
+			return res
+		}
+	}
+}
+
+// Run probes every Interval until ctx is done, and returns ctx's error.
+func (cp *ConsistencyProbe) Run(ctx context.Context) error {
+	interval := cp.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		cp.Measure(ctx)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Report returns the results of the probes made so far.
+func (cp *ConsistencyProbe) Report() ConsistencyReport {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	r := ConsistencyReport{Probes: cp.probes, Failed: cp.failed, Last: cp.last, Lag: NewHistogram(nil)}
+	if cp.probes > 0 {
+		r.Lag = cp.lags.clone()
+	}
+	return r
+}
@@ -0,0 +1,287 @@
+package dbtimer
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+type ctxKey int
+
+const (
+	logModeKey ctxKey = iota
+	tagsKey
+)
+
+type logMode int
+
+const (
+	logSilenced logMode = iota + 1
+	logForced
+)
+
+// Silence returns a context under which calls are not logged, for code paths
+// such as migrations, bulk loads and health checks that would drown out
+// everything else.
+func Silence(ctx context.Context) context.Context {
+	return context.WithValue(ctx, logModeKey, logSilenced)
+}
+
+// Force returns a context under which every call is logged, overriding the
+// query filter and sampling. It is meant for debugging a specific code path.
+//
+// The innermost of Silence and Force applies when they are nested.
+func Force(ctx context.Context) context.Context {
+	return context.WithValue(ctx, logModeKey, logForced)
+}
+
+func logModeFrom(ctx context.Context) logMode {
+	m, _ := ctx.Value(logModeKey).(logMode)
+	return m
+}
+
+// WithTag returns a context that adds the tag key=value to the events of
+// calls made with it, on top of any tags ctx already carries.
+func WithTag(ctx context.Context, key, value string) context.Context {
+	return WithTags(ctx, map[string]string{key: value})
+}
+
+// WithTags returns a context that adds tags to the events of calls made with
+// it, on top of any tags ctx already carries. Where the keys are the same,
+// the new value wins.
+func WithTags(ctx context.Context, tags map[string]string) context.Context {
+	old := TagsFromContext(ctx)
+	merged := make(map[string]string, len(old)+len(tags))
+	for k, v := range old {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, tagsKey, merged)
+}
+
+// TagsFromContext returns the tags carried by ctx. The returned map must not
+// be modified.
+func TagsFromContext(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(tagsKey).(map[string]string)
+	return tags
+}
+
+func (cs *connState) prepareContext(ctx context.Context, c driver.Conn, query string) (driver.Stmt, error) {
+	ctx, cancel := cs.enforceTimeout(ctx, "conn.Prepare", query)
+	defer cancel()
+	var s driver.Stmt
+	var err error
+	err = cs.doTiming(ctx, "conn.Prepare", query, nil, func() error {
+		if cpc, ok := c.(driver.ConnPrepareContext); ok {
+			s, err = cpc.PrepareContext(ctx, query)
+		} else {
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			s, err = c.Prepare(query)
+		}
+		if err != nil {
+			return err
+		}
+		s = cs.newStmt(s, query)
+		return nil
+	})
+	return s, err
+}
+
+// queryContext runs a query directly on the connection, or returns
+// driver.ErrSkip so that the sql package prepares a statement instead if the
+// underlying connection can't do that.
+func (cs *connState) queryContext(ctx context.Context, c driver.Conn, query string, args []driver.NamedValue) (driver.Rows, error) {
+	qc, isQueryerContext := c.(driver.QueryerContext)
+	q, isQueryer := c.(driver.Queryer)
+	if !isQueryerContext && !isQueryer {
+		return nil, driver.ErrSkip
+	}
+	ctx, cancel := cs.enforceTimeout(ctx, "conn.Query", query)
+	rows, err := cs.timeQuery(ctx, "conn.Query", query, values(args), func() (driver.Rows, error) {
+		if isQueryerContext {
+			return qc.QueryContext(ctx, query, args)
+		}
+		dargs, err := namedValueToValue(args)
+		if err != nil {
+			return nil, err
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return q.Query(query, dargs)
+	})
+	return cancelOnClose(rows, err, cancel)
+}
+
+// timeQuery times a call that returns rows, and each of their result sets if
+// they have several, mirroring it to the shadow database if there is one.
+func (cs *connState) timeQuery(ctx context.Context, method string, query string, args []driver.Value, q func() (driver.Rows, error)) (driver.Rows, error) {
+	var r driver.Rows
+	var err error
+	var start time.Time
+	var elapsed time.Duration
+	sh := cs.d.getShadow()
+	var t timing
+	var columns []Column
+	cc, capture := cs.d.captureColumns()
+	if capture {
+		t.columns = &columns
+	}
+	rc := cs.d.resultCache()
+	var hit bool
+	var key, fp string
+	var gen uint64
+	var expires time.Time
+	if rc != nil && atomic.LoadUint64(&cs.txID) == 0 {
+		t.cacheHit = &hit
+	}
+	ce := cs.d.cacheEstimator()
+	var begin time.Time
+	if ce != nil {
+		begin = cs.d.now()
+	}
+	err = cs.doTimingWith(ctx, method, query, args, t, func() error {
+		if t.cacheHit != nil {
+			var ttl time.Duration
+			if r, key, fp, ttl, gen = rc.lookup(query, args, cs.d.now()); r != nil {
+				hit = true
+				return nil
+			}
+			expires = cs.d.now().Add(ttl)
+		}
+		if sh != nil {
+			start = time.Now()
+		}
+		r, err = q()
+		if sh != nil {
+			elapsed = time.Since(start)
+		}
+		if capture && err == nil && r != nil {
+			columns = cc.columns(r)
+		}
+		return err
+	})
+	if err == nil && r != nil && key != "" {
+		r = rc.capture(r, key, fp, query, gen, expires)
+	}
+	if ce != nil && err == nil && r != nil && !hit && atomic.LoadUint64(&cs.txID) == 0 {
+		r = ce.watch(cs.d, r, query, args, begin)
+	}
+	if err == nil && r != nil {
+		r = cs.timeResultSets(ctx, method, query, r)
+		r = cs.measureResponse(ctx, method, query, r)
+	}
+	if sh != nil && err != driver.ErrSkip && !hit {
+		r = sh.mirror(query, args, cs.d.redactArgs(), elapsed, err, r)
+	}
+	return r, err
+}
+
+func (cs *connState) beginTx(ctx context.Context, c driver.Conn, opts driver.TxOptions) (driver.Tx, error) {
+	cs.checkNestedTx()
+	var tx driver.Tx
+	var err error
+	err = cs.doTiming(ctx, "conn.Begin", "", nil, func() error {
+		if cbt, ok := c.(driver.ConnBeginTx); ok {
+			tx, err = cbt.BeginTx(ctx, opts)
+		} else {
+			// The same checks the sql package makes for drivers that
+			// don't support BeginTx.
+			if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+				return errors.New("sql: driver does not support non-default isolation level")
+			}
+			if opts.ReadOnly {
+				return errors.New("sql: driver does not support read-only transactions")
+			}
+			if err = ctx.Err(); err != nil {
+				return err
+			}
+			tx, err = c.Begin()
+		}
+		if err != nil {
+			return err
+		}
+		tx = cs.newTx(tx)
+		return nil
+	})
+	return tx, err
+}
+
+func (cs *connState) ping(ctx context.Context, c driver.Conn) error {
+	p, ok := c.(driver.Pinger)
+	if !ok {
+		return nil
+	}
+	return cs.doTiming(ctx, "conn.Ping", "", nil, func() error {
+		return p.Ping(ctx)
+	})
+}
+
+func resetSession(ctx context.Context, c driver.Conn) error {
+	if sr, ok := c.(driver.SessionResetter); ok {
+		return sr.ResetSession(ctx)
+	}
+	return nil
+}
+
+func isValid(c driver.Conn) bool {
+	if v, ok := c.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// checkNamedValue uses the first of checkers that can check values, or
+// returns driver.ErrSkip so that the sql package uses its default conversion.
+// A sql.Out for a stored procedure's OUT parameter is passed through only if
+// one of them accepts it, since the default conversion can't.
+func checkNamedValue(nv *driver.NamedValue, checkers ...interface{}) error {
+	for _, c := range checkers {
+		if nvc, ok := c.(driver.NamedValueChecker); ok {
+			return nvc.CheckNamedValue(nv)
+		}
+	}
+	if _, ok := nv.Value.(sql.Out); ok {
+		return errOutUnsupported
+	}
+	return driver.ErrSkip
+}
+
+func values(args []driver.NamedValue) []driver.Value {
+	if len(args) == 0 {
+		return nil
+	}
+	out := make([]driver.Value, len(args))
+	for i, a := range args {
+		out[i] = a.Value
+	}
+	return out
+}
+
+// namedValueToValue converts arguments for a driver that predates contexts,
+// which can't support named parameters.
+func namedValueToValue(named []driver.NamedValue) ([]driver.Value, error) {
+	dargs := make([]driver.Value, len(named))
+	for n, param := range named {
+		if len(param.Name) > 0 {
+			return nil, errors.New("sql: driver does not support the use of Named Parameters")
+		}
+		dargs[n] = param.Value
+	}
+	return dargs, nil
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	named := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		named[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return named
+}
@@ -0,0 +1,131 @@
+package dbtimer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// CostModel turns database time into a cost, so that capacity planning can
+// weigh statements with one number: a statement run a million times at 2ms
+// costs more than one run ten times at 5s.
+type CostModel struct {
+	// PerMillisecond is the cost of a millisecond of database time, such
+	// as the share of an instance's hourly price one millisecond of its
+	// capacity is worth.
+	PerMillisecond float64
+
+	// Unit names the cost in reports, such as "USD". The default is
+	// "cost".
+	Unit string
+}
+
+// Cost returns the cost of d.
+func (cm *CostModel) Cost(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond) * cm.PerMillisecond
+}
+
+func (cm *CostModel) unit() string {
+	if cm.Unit == "" {
+		return "cost"
+	}
+	return cm.Unit
+}
+
+// QueryCost is what one fingerprint, or stored procedure, consumed: its total
+// time, which weighs its latency by how often it runs, its Share of the
+// total time of every statement, and its Cost under the report's model.
+type QueryCost struct {
+	Fingerprint string
+	Procedure   string
+	Labels      map[string]string
+	Count       int64
+	Total       time.Duration
+	Mean        time.Duration
+	P99         time.Duration
+	Share       float64
+	Cost        float64
+}
+
+// CostReport ranks statements by the total time they consumed.
+type CostReport struct {
+	// Model is the cost model the costs are under, or nil if there are
+	// none.
+	Model *CostModel
+
+	Total time.Duration
+	Cost  float64
+
+	// Queries are the statements, the most total time first.
+	Queries []QueryCost
+}
+
+// CostReport returns the statements in the stats ranked by the total time
+// they consumed, with their costs under model if it isn't nil.
+func (s *Stats) CostReport(model *CostModel) *CostReport {
+	report := s.Report()
+	r := &CostReport{Model: model, Queries: make([]QueryCost, 0, len(report))}
+	for _, qs := range report {
+		r.Total += qs.Total
+	}
+	for _, qs := range report {
+		qc := QueryCost{
+			Fingerprint: qs.Fingerprint,
+			Procedure:   qs.Procedure,
+			Labels:      qs.Labels,
+			Count:       qs.Count,
+			Total:       qs.Total,
+			Mean:        qs.Mean(),
+			P99:         qs.Quantile(0.99),
+		}
+		if r.Total > 0 {
+			qc.Share = float64(qs.Total) / float64(r.Total)
+		}
+		if model != nil {
+			qc.Cost = model.Cost(qs.Total)
+		}
+		r.Queries = append(r.Queries, qc)
+	}
+	if model != nil {
+		r.Cost = model.Cost(r.Total)
+	}
+	return r
+}
+
+// WriteTo writes the report as a table, with one row per statement and a
+// last row of the totals.
+func (r *CostReport) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	tw := tabwriter.NewWriter(cw, 0, 4, 2, ' ', 0)
+	fmt.Fprint(tw, "statement\tcount\ttotal\tshare\tmean\tp99")
+	if r.Model != nil {
+		fmt.Fprintf(tw, "\t%s", r.Model.unit())
+	}
+	fmt.Fprintln(tw)
+	for _, qc := range r.Queries {
+		stmt := qc.Fingerprint
+		if qc.Procedure != "" {
+			stmt = "CALL " + qc.Procedure
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%.1f%%\t%v\t%v", stmt, qc.Count, qc.Total, qc.Share*100, qc.Mean, qc.P99)
+		if r.Model != nil {
+			fmt.Fprintf(tw, "\t%.2f", qc.Cost)
+		}
+		fmt.Fprintln(tw)
+	}
+	fmt.Fprintf(tw, "total\t\t%v\t100.0%%", r.Total)
+	if r.Model != nil {
+		fmt.Fprintf(tw, "\t\t\t%.2f", r.Cost)
+	}
+	fmt.Fprintln(tw)
+	err := tw.Flush()
+	return cw.n, err
+}
+
+func (r *CostReport) String() string {
+	var sb strings.Builder
+	r.WriteTo(&sb)
+	return sb.String()
+}
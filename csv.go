@@ -0,0 +1,254 @@
+package dbtimer
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CSVColumn is a column a CSV logger can write. Besides the constants, a
+// column named "tag:<key>" holds the value of one tag.
+type CSVColumn string
+
+// The columns a CSV logger can write.
+const (
+	CSVMethod      CSVColumn = "method"
+	CSVQuery       CSVColumn = "query"
+	CSVFingerprint CSVColumn = "fingerprint"
+	CSVStart       CSVColumn = "start"
+	CSVEnd         CSVColumn = "end"
+	CSVDuration    CSVColumn = "duration_ms"
+	CSVArgs        CSVColumn = "args"
+	CSVError       CSVColumn = "error"
+	CSVConnID      CSVColumn = "conn_id"
+	CSVTags        CSVColumn = "tags"
+	CSVWait        CSVColumn = "wait_ms"
+	CSVColumns     CSVColumn = "columns"
+	CSVBytes       CSVColumn = "response_bytes"
+	CSVBaseline    CSVColumn = "baseline_ms"
+	CSVTxID        CSVColumn = "tx_id"
+
+	// CSVDebugQuery is the query with its args interpolated for
+	// CSVOptions.Dialect. See Interpolate.
+	CSVDebugQuery CSVColumn = "debug_query"
+)
+
+// DefaultCSVColumns are the columns written when none are chosen.
+var DefaultCSVColumns = []CSVColumn{CSVStart, CSVMethod, CSVDuration, CSVQuery, CSVError}
+
+// CSVOptions configures a CSV logger.
+type CSVOptions struct {
+	// Columns are the columns to write, in order. If it is empty,
+	// DefaultCSVColumns is used.
+	Columns []CSVColumn
+
+	// NoHeader leaves out the header row of column names.
+	NoHeader bool
+
+	// Gzip compresses the output. Close the logger to finish the gzip stream.
+	Gzip bool
+
+	// ArgFormatter, if set, renders the args column instead of JSON, for
+	// example DefaultArgFormatter for readable text.
+	ArgFormatter ArgFormatter
+
+	// Dialect is the dialect the debug_query column is quoted for.
+	Dialect Dialect
+}
+
+// CSVLogger is a TimerLogger that writes each event as a CSV row, for loading
+// into a spreadsheet or a warehouse. Fields are quoted as CSV requires, so
+// SQL text with commas, quotes and newlines survives the trip. Times are
+// RFC 3339, durations are in milliseconds, and args and tags are JSON unless
+// an ArgFormatter is set.
+type CSVLogger struct {
+	mu      sync.Mutex
+	columns []CSVColumn
+	args    ArgFormatter
+	dialect Dialect
+	cw      *csv.Writer
+	gz      *gzip.Writer
+	row     []string
+}
+
+// NewCSVLogger returns a CSVLogger that writes to w, and writes the header row
+// unless opts.NoHeader is set. It returns an ErrConfig error if a column is
+// unknown.
+func NewCSVLogger(w io.Writer, opts CSVOptions) (*CSVLogger, error) {
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = DefaultCSVColumns
+	}
+	for _, c := range columns {
+		if !validCSVColumn(c) {
+			return nil, &Error{Kind: ErrConfig, Err: fmt.Errorf("unknown CSV column %q", c)}
+		}
+	}
+	cl := &CSVLogger{columns: columns, args: opts.ArgFormatter, dialect: opts.Dialect, row: make([]string, len(columns))}
+	if opts.Gzip {
+		cl.gz = gzip.NewWriter(w)
+		w = cl.gz
+	}
+	cl.cw = csv.NewWriter(w)
+	if !opts.NoHeader {
+		for i, c := range columns {
+			cl.row[i] = string(c)
+		}
+		cl.cw.Write(cl.row)
+		cl.cw.Flush()
+		if err := cl.cw.Error(); err != nil {
+			return nil, err
+		}
+	}
+	return cl, nil
+}
+
+func validCSVColumn(c CSVColumn) bool {
+	switch c {
+	case CSVMethod, CSVQuery, CSVFingerprint, CSVStart, CSVEnd, CSVDuration, CSVArgs, CSVError, CSVConnID, CSVTags, CSVWait, CSVColumns, CSVBytes, CSVBaseline, CSVTxID, CSVDebugQuery:
+		return true
+	}
+	return strings.HasPrefix(string(c), "tag:") && len(c) > len("tag:")
+}
+
+// Log writes ti as a row. Write errors are reported to the error handler as
+// ErrSink.
+func (cl *CSVLogger) Log(ti TimerInfo) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	for i, c := range cl.columns {
+		cl.row[i] = cl.field(c, ti)
+	}
+	cl.cw.Write(cl.row)
+	// A gzip stream is only flushed by Flush and Close, so that it
+	// compresses well.
+	cl.cw.Flush()
+	if err := cl.cw.Error(); err != nil {
+		handleError(&Error{Kind: ErrSink, Err: err})
+	}
+}
+
+func (cl *CSVLogger) field(c CSVColumn, ti TimerInfo) string {
+	switch c {
+	case CSVMethod:
+		return ti.Method
+	case CSVQuery:
+		return ti.Query
+	case CSVFingerprint:
+		if ti.Query == "" {
+			return ""
+		}
+		return Fingerprint(ti.Query)
+	case CSVStart:
+		return ti.Start.Format(time.RFC3339Nano)
+	case CSVEnd:
+		return ti.End.Format(time.RFC3339Nano)
+	case CSVDuration:
+		return strconv.FormatFloat(float64(ti.Elapsed())/float64(time.Millisecond), 'f', -1, 64)
+	case CSVArgs:
+		if len(ti.Args) == 0 {
+			return ""
+		}
+		if cl.args != nil {
+			return cl.args.FormatArgs(ti.Args)
+		}
+		b, err := json.Marshal(ti.Args)
+		if err != nil {
+			handleError(&Error{Kind: ErrSerialization, Err: err})
+			return ""
+		}
+		return string(b)
+	case CSVError:
+		if ti.Err == nil {
+			return ""
+		}
+		return ti.Err.Error()
+	case CSVConnID:
+		if ti.ConnID == 0 {
+			return ""
+		}
+		return strconv.FormatUint(ti.ConnID, 10)
+	case CSVTxID:
+		if ti.TxID == 0 {
+			return ""
+		}
+		return strconv.FormatUint(ti.TxID, 10)
+	case CSVDebugQuery:
+		if ti.Query == "" {
+			return ""
+		}
+		return Interpolate(cl.dialect, ti.Query, ti.Args)
+	case CSVColumns:
+		var sb strings.Builder
+		for i, col := range ti.Columns {
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			sb.WriteString(col.Name)
+			if col.DatabaseType != "" {
+				sb.WriteByte(' ')
+				sb.WriteString(col.DatabaseType)
+			}
+		}
+		return sb.String()
+	case CSVBytes:
+		if ti.ResponseBytes == 0 {
+			return ""
+		}
+		return strconv.FormatInt(ti.ResponseBytes, 10)
+	case CSVBaseline:
+		if ti.Baseline == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(float64(ti.Baseline)/float64(time.Millisecond), 'f', -1, 64)
+	case CSVWait:
+		if ti.Wait == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(float64(ti.Wait)/float64(time.Millisecond), 'f', -1, 64)
+	case CSVTags:
+		if len(ti.Tags) == 0 {
+			return ""
+		}
+		// encoding/json sorts map keys, so the column is stable.
+		b, _ := json.Marshal(ti.Tags)
+		return string(b)
+	}
+	return ti.Tags[strings.TrimPrefix(string(c), "tag:")]
+}
+
+// Flush writes any buffered data, including compressed data that is waiting
+// for more input.
+func (cl *CSVLogger) Flush() error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.cw.Flush()
+	if err := cl.cw.Error(); err != nil {
+		return err
+	}
+	if cl.gz != nil {
+		return cl.gz.Flush()
+	}
+	return nil
+}
+
+// Close flushes the logger and, if it compresses, finishes the gzip stream.
+// It doesn't close the underlying writer.
+func (cl *CSVLogger) Close() error {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.cw.Flush()
+	if err := cl.cw.Error(); err != nil {
+		return err
+	}
+	if cl.gz != nil {
+		return cl.gz.Close()
+	}
+	return nil
+}
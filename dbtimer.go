@@ -1,15 +1,19 @@
 package dbtimer
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"os"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 func init() {
-	sql.Register("timer", &Driver{})
+	sql.Register("timer", driverFromEnv(os.Getenv))
 }
 
 type TimerInfo struct {
@@ -17,18 +21,113 @@ type TimerInfo struct {
 	Query  string
 	Start  time.Time
 	End    time.Time
+
+	// Duration is how long the call took, from the monotonic clock readings
+	// of Start and End, so that it stays right when the system clock is set
+	// during the call, and when a sink serializes Start and End and loses
+	// their monotonic readings. Use Elapsed to read it.
+	Duration time.Duration
+
 	Args   []driver.Value
 	Err    error
+	ConnID uint64
+	Tags   map[string]string
+
+	// Wait is how long the call waited for a slot in the driver's Bulkhead
+	// before Start.
+	Wait time.Duration
+
+	// FullQuery is the compressed text of Query if the driver's Truncation
+	// shortened it and asked for compression.
+	FullQuery CompressedQuery
+
+	// BatchSize is the number of rows in the VALUES list of an INSERT, as
+	// counted by InsertRows, or 0 for other statements.
+	BatchSize int
+
+	// ResultSet is the index, from 0, of the result set a "rows.ResultSet"
+	// event times, and RowCount the number of rows read from it, or from
+	// all of a query's rows for a "rows.Close" event.
+	ResultSet int
+	RowCount  int
+
+	// ResponseBytes is the estimated size of the values read from a query's
+	// rows, on its "rows.Close" event. See SetResponseSize.
+	ResponseBytes int64
+
+	// Baseline is the latest round trip to the server measured on the
+	// connection, if the driver has a RoundTripBaseline. See Excess.
+	Baseline time.Duration
+
+	// TxID identifies the transaction the call was made in, from its
+	// "conn.Begin" event to its "tx.Commit" or "tx.Rollback", or is 0
+	// outside a transaction. IDs are unique within the process.
+	TxID uint64
+
+	// Columns are the columns a query returned, if the driver's
+	// ColumnCapture recorded them.
+	Columns []Column
+
+	// RowsAffected is the number of rows an Exec reported it affected, or 0
+	// if it didn't report one.
+	RowsAffected int64
+
+	// Warmup reports whether the call was part of the driver's warm-up. See
+	// SetWarmup.
+	Warmup bool
+
+	// Memory is what the Go runtime did while the call ran, if the driver
+	// records it. See SetMemStats.
+	Memory MemDelta
+
+	// DeadlineSource is where the deadline of the call's context came from,
+	// if it had one: DeadlineCaller if the application set it, or
+	// DeadlineTimeouts if the driver's Timeouts did. Deadline is how long
+	// was left before it when the call started. See MissedDeadline.
+	DeadlineSource string
+	Deadline       time.Duration
+
+	// Canceled reports whether the call's context was canceled, or its
+	// deadline passed, while the driver was running it, and CancelLatency
+	// is how long the driver took to return after that. A driver that
+	// doesn't watch the context keeps the connection busy until the
+	// statement finishes anyway.
+	Canceled      bool
+	CancelLatency time.Duration
+
+	// CacheHit reports whether the query's rows came from the driver's
+	// ResultCache rather than the database.
+	CacheHit bool
 }
 
 type TimerLogger interface {
 	Log(TimerInfo)
 }
 
-var timerLogger TimerLogger
+// timerLogger holds a loggerHolder so that the logger can be swapped while
+// queries are running.
+var timerLogger atomic.Value
 
+type loggerHolder struct {
+	tl TimerLogger
+}
+
+// SetTimerLogger sets the TimerLogger for events from drivers that weren't
+// registered with one of their own. Until the first one is set, up to 1000
+// events are kept, and the first logger set is passed them at once, so that
+// the timings of connections opened while the program starts aren't lost.
+// Call DiscardEarlyEvents to drop them instead.
 func SetTimerLogger(tl TimerLogger) {
-	timerLogger = tl
+	timerLogger.Store(loggerHolder{tl})
+	if tl != nil {
+		replayEarly(tl)
+	}
+}
+
+// GetTimerLogger returns the current TimerLogger, or nil if none is set.
+func GetTimerLogger() TimerLogger {
+	h, _ := timerLogger.Load().(loggerHolder)
+	return h.tl
 }
 
 type TimerLoggerFunc func(TimerInfo)
@@ -38,31 +137,382 @@ func (tlf TimerLoggerFunc) Log(ti TimerInfo) {
 }
 
 func SetTimerLoggerFunc(lf TimerLoggerFunc) {
-	timerLogger = lf
+	if lf == nil {
+		SetTimerLogger(nil)
+		return
+	}
+	SetTimerLogger(lf)
+}
+
+// MultiLogger returns a TimerLogger that passes each event to every one of
+// loggers, in order. Nil loggers are skipped.
+func MultiLogger(loggers ...TimerLogger) TimerLogger {
+	var ml multiLogger
+	for _, tl := range loggers {
+		if tl != nil {
+			ml = append(ml, tl)
+		}
+	}
+	return ml
+}
+
+type multiLogger []TimerLogger
+
+func (ml multiLogger) Log(ti TimerInfo) {
+	for _, tl := range ml {
+		tl.Log(ti)
+	}
+}
+
+// ConnStats reports how many connections have been opened and closed through
+// the timer driver, and how many times an underlying driver reported
+// driver.ErrBadConn.
+type ConnStats struct {
+	Opened  uint64
+	Closed  uint64
+	BadConn uint64
+}
+
+// ReconnectRate returns the number of bad connections reported per connection
+// opened. The sql package discards a connection and opens a new one every time
+// it sees driver.ErrBadConn, so this is the fraction of opens that were
+// reconnects caused by a broken connection.
+func (cs ConnStats) ReconnectRate() float64 {
+	if cs.Opened == 0 {
+		return 0
+	}
+	return float64(cs.BadConn) / float64(cs.Opened)
+}
+
+var connStats struct {
+	lastID  uint64
+	opened  uint64
+	closed  uint64
+	badConn uint64
+}
+
+// GetConnStats returns the connection counts across all timer connections.
+func GetConnStats() ConnStats {
+	return ConnStats{
+		Opened:  atomic.LoadUint64(&connStats.opened),
+		Closed:  atomic.LoadUint64(&connStats.closed),
+		BadConn: atomic.LoadUint64(&connStats.badConn),
+	}
+}
+
+// connState is the bookkeeping shared by a connection and the statements and
+// transactions created from it.
+type connState struct {
+	d        *Driver
+	conn     driver.Conn
+	id       uint64
+	badConns uint64
+
+	// labels are the driver's labels and the settings found by its
+	// SessionProbe.
+	labels map[string]string
+
+	// baseline is the latest round trip measured on the connection, at
+	// baselineAt. Only the goroutine using the connection touches them.
+	baseline   time.Duration
+	baselineAt time.Time
+
+	// txID is the ID of the transaction open on the connection, or 0.
+	txID uint64
+
+	// txSite is where the open transaction was begun, if the driver
+	// detects misuse.
+	txSite atomic.Value
+
+	// txWrites are the tables the open transaction wrote to, whose cached
+	// reads are invalidated again when it commits. Only the goroutine
+	// using the connection touches them.
+	txWrites []string
+}
+
+// opened assigns the connection its ID once the underlying driver has
+// successfully opened it.
+func (cs *connState) opened(c driver.Conn) {
+	cs.conn = c
+	atomic.AddUint64(&connStats.opened, 1)
+	cs.id = atomic.AddUint64(&connStats.lastID, 1)
 }
 
-func doTiming(method string, query string, args []driver.Value, c func() error) {
+// BadConns returns the number of times driver.ErrBadConn was returned on
+// this connection.
+func (cs *connState) BadConns() uint64 {
+	return atomic.LoadUint64(&cs.badConns)
+}
+
+// doTiming calls c and logs how long it took. It returns the error from c, or
+// the error injected in its place by a Fault.
+func (cs *connState) doTiming(ctx context.Context, method string, query string, args []driver.Value, c func() error) error {
+	return cs.doTimingWith(ctx, method, query, args, timing{}, c)
+}
+
+// timing is extra detail for the event of a call.
+type timing struct {
+	// since, if it isn't zero, is when the event starts, rather than when
+	// the call is made.
+	since time.Time
+
+	// rows, if it isn't nil, holds the event's BatchSize once the call
+	// returns.
+	rows *int
+
+	// columns, if it isn't nil, holds the event's Columns once the call
+	// returns.
+	columns *[]Column
+
+	// affected, if it isn't nil, holds the event's RowsAffected once the
+	// call returns.
+	affected *int64
+
+	// cacheHit, if it isn't nil, holds the event's CacheHit once the call
+	// returns.
+	cacheHit *bool
+}
+
+// doTimingWith is doTiming with the extra detail in t.
+func (cs *connState) doTimingWith(ctx context.Context, method string, query string, args []driver.Value, t timing, c func() error) error {
+	tl := cs.d.loggerFor(ctx)
+	if tl != nil && !cs.d.shouldLog(ctx, query) {
+		tl = nil
+	}
+	release, wait, err := cs.acquireSlot(ctx, method)
+	err = enforced(ctx, err)
+	var baseline time.Duration
+	if tl != nil && err == nil {
+		baseline = cs.roundTrip(ctx, method)
+	}
 	var s time.Time
-	if timerLogger != nil {
-		s = time.Now()
-	}
-	err := c()
-	if timerLogger != nil {
-		e := time.Now()
-		timerLogger.Log(TimerInfo{
-			Method: method,
-			Query:  query,
-			Start:  s,
-			End:    e,
-			Err:    err,
-			Args:   args,
+	if tl != nil {
+		s = cs.d.now()
+		if !t.since.IsZero() {
+			s = t.since
+		}
+	}
+	if err == nil {
+		err = cs.d.injectFault(ctx, method, query)
+	}
+	var outcome func(error)
+	if err == nil {
+		outcome, err = cs.allowStatement(ctx, method, query)
+	}
+	var mem *memSample
+	var deadline time.Duration
+	var deadlineSource string
+	var canceled bool
+	var cancelLatency time.Duration
+	if tl != nil {
+		mem = cs.d.sampleMem()
+		deadline, deadlineSource = deadlineOf(ctx)
+	}
+	if err == nil {
+		done := cs.startInFlight(ctx, method, query)
+		var watch *cancelWatch
+		if tl != nil {
+			watch = watchCancel(ctx, cs.d.now)
+		}
+		err = enforced(ctx, c())
+		canceled, cancelLatency = watch.latency(cs.d.now())
+		done()
+		if rc := cs.d.resultCache(); rc != nil && err == nil && runsStatement(method) {
+			if table := rc.observeWrite(query); table != "" && atomic.LoadUint64(&cs.txID) != 0 {
+				cs.txWrites = append(cs.txWrites, table)
+			}
+		}
+		if outcome != nil {
+			outcome(err)
+		}
+	}
+	release()
+	var e time.Time
+	var warm bool
+	var memory MemDelta
+	if tl != nil {
+		e = cs.d.now()
+		memory = mem.since()
+		warm = cs.d.warmingUp(method)
+		if err != driver.ErrSkip {
+			cs.watchFingerprint(ctx, tl, method, query, s, e, warm)
+		}
+		if !cs.d.sampled(ctx, query, e.Sub(s), err) {
+			tl = nil
+		}
+	}
+	if tl != nil && err != driver.ErrSkip {
+		batch := 0
+		if t.rows != nil {
+			batch = *t.rows
+		} else {
+			batch = InsertRows(query)
+		}
+		tags := cs.statementTags(ctx, query)
+		query, args := scrub(method, query, outParams(args))
+		if cs.d.redactArgs() {
+			args = nil
+		}
+		query, full := cs.d.truncate(query)
+		var columns []Column
+		if t.columns != nil {
+			columns = *t.columns
+		}
+		var affected int64
+		if t.affected != nil {
+			affected = *t.affected
+		}
+		if on, _ := cs.d.callSites.Load().(bool); on {
+			tags = withTag(tags, "call_site", callSite())
+		}
+		logEvent(tl, TimerInfo{
+			Method:    method,
+			Query:     query,
+			Start:     s,
+			End:       e,
+			Err:       err,
+			Args:      args,
+			ConnID:    cs.id,
+			Tags:      tags,
+			Wait:      wait,
+			FullQuery: full,
+			BatchSize: batch,
+			Columns:   columns,
+			Baseline:  baseline,
+			TxID:      atomic.LoadUint64(&cs.txID),
+
+			RowsAffected: affected,
+			Warmup:       warm,
+			Memory:       memory,
+
+			DeadlineSource: deadlineSource,
+			Deadline:       deadline,
+			Canceled:       canceled,
+			CancelLatency:  cancelLatency,
+			CacheHit:       t.cacheHit != nil && *t.cacheHit,
+		})
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		cs.badConn()
+	}
+	return err
+}
+
+// badConn records a driver.ErrBadConn. The sql package discards a connection
+// that returns it, so a "conn.Discard" event is logged for the connection.
+func (cs *connState) badConn() {
+	atomic.AddUint64(&connStats.badConn, 1)
+	if cs.id == 0 {
+		return
+	}
+	atomic.AddUint64(&cs.badConns, 1)
+	if tl := cs.d.timerLogger(); tl != nil {
+		now := cs.d.now()
+		logEvent(tl, TimerInfo{
+			Method: "conn.Discard",
+			Start:  now,
+			End:    now,
+			Err:    driver.ErrBadConn,
+			ConnID: cs.id,
+			Tags:   cs.labels,
 		})
 	}
 }
 
 type Driver struct {
-	driverName       string
-	connectionString string
+	target      string
+	autodetect  bool
+	labels      map[string]string
+	logger      TimerLogger
+	clock       atomic.Value
+	faults      atomic.Value
+	shadow      atomic.Value
+	timeouts    atomic.Value
+	breaker     atomic.Value
+	bulkhead    atomic.Value
+	truncation  atomic.Value
+	columns     atomic.Value
+	respSize    atomic.Value
+	misuse      atomic.Value
+	sampling    atomic.Value
+	quiet       atomic.Value
+	fpWatch     atomic.Value
+	callSites   atomic.Value
+	commentTags atomic.Value
+	owners      atomic.Value
+	cache       atomic.Value
+	cacheEst    atomic.Value
+	filter      atomic.Value
+	redact      atomic.Value
+	disabled    bool
+	envErr      error
+	envOnce     sync.Once
+	probe       atomic.Value
+	baseline    atomic.Value
+	warmup      atomic.Value
+	memStats    atomic.Value
+	checked     sync.Map
+}
+
+// timerLogger returns the logger for events from d: its own, if it was
+// registered with one, or else the global one, or else the buffer of early
+// events, passing its events to any taps as well. A driver disabled through
+// DBTIMER_DISABLED has none.
+func (d *Driver) timerLogger() TimerLogger {
+	if d.disabled {
+		return nil
+	}
+	if d.logger != nil {
+		return tapped(d.logger)
+	}
+	if tl := GetTimerLogger(); tl != nil {
+		return tapped(tl)
+	}
+	return tapped(earlyLogger())
+}
+
+// tags returns the tags for an event from a call made with ctx: the
+// connection's labels, overridden by the tags ctx carries.
+func (cs *connState) tags(ctx context.Context) map[string]string {
+	tags := TagsFromContext(ctx)
+	if len(cs.labels) == 0 {
+		return tags
+	}
+	if len(tags) == 0 {
+		return cs.labels
+	}
+	merged := make(map[string]string, len(cs.labels)+len(tags))
+	for k, v := range cs.labels {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return merged
+}
+
+// parse splits name into the underlying driver and its DSN. Nothing is kept
+// on d, so that each connection string opened through d can name a different
+// database.
+func (d *Driver) parse(name string) (string, string, error) {
+	if d.target != "" {
+		return d.target, name, nil
+	}
+	if d.autodetect && !strings.HasPrefix(name, "timer:") && !strings.HasPrefix(name, "timer+") {
+		driverName, err := detectDriver(name)
+		return driverName, name, err
+	}
+	return parseDSN(name)
+}
+
+// underlying returns the registered driver called driverName.
+func underlying(driverName, dsn string) (driver.Driver, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return db.Driver(), nil
 }
 
 // Open returns a new connection to the database.
@@ -75,129 +525,154 @@ type Driver struct {
 // The returned connection is only used by one goroutine at a
 // time.
 func (d *Driver) Open(name string) (driver.Conn, error) {
-	if d.driverName == "" {
-		parts := strings.SplitN(name, " ", 2)
-		if len(parts) != 2 {
-			return nil, errors.New("Invalid format for timer ")
-		}
-		d.driverName = parts[0]
-		d.connectionString = parts[1]
+	driverName, dsn, err := d.parse(name)
+	if err != nil {
+		return nil, err
 	}
-	var err error
-	var c driver.Conn
-	doTiming("driver.Open", name, nil, func() error {
-		var db *sql.DB
-		db, err = sql.Open(d.driverName, d.connectionString)
-		if err != nil {
-			return err
-		}
-		c, err = db.Driver().Open(d.connectionString)
-		if _, ok := c.(driver.Execer); ok {
-			c = &Conn{c}
-		} else {
-			c = &NoExecConn{c}
-		}
-		return err
+	ud, err := underlying(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	return d.open(context.Background(), name, driverName, ud, func() (driver.Conn, error) {
+		return ud.Open(dsn)
 	})
-	return c, err
 }
 
-type Conn struct {
-	c driver.Conn
+// OpenConnector parses name once and returns a connector for it, which
+// sql.OpenDB and sql.Open use instead of calling Open for each connection. If
+// the underlying driver has connectors of its own, one is used.
+func (d *Driver) OpenConnector(name string) (driver.Connector, error) {
+	driverName, dsn, err := d.parse(name)
+	if err != nil {
+		return nil, err
+	}
+	ud, err := underlying(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	c := &connector{d: d, name: name, driverName: driverName, ud: ud, dsn: dsn}
+	if dc, ok := ud.(driver.DriverContext); ok {
+		if c.uc, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
 }
 
-// Prepare returns a prepared statement, bound to this connection.
-func (c *Conn) Prepare(query string) (driver.Stmt, error) {
-	var err error
-	var s driver.Stmt
-	doTiming("conn.Prepare", query, nil, func() error {
-		s, err = c.c.Prepare(query)
-		s = &Stmt{s, query}
-		return err
-	})
-	return s, err
+type connector struct {
+	d          *Driver
+	name       string
+	driverName string
+	ud         driver.Driver
+	uc         driver.Connector
+	dsn        string
 }
 
-func (c *Conn) Exec(query string, args []driver.Value) (driver.Result, error) {
-	var err error
-	var r driver.Result
-	doTiming("conn.Exec", query, args, func() error {
-		r, err = c.c.(driver.Execer).Exec(query, args)
-		return err
+// Connect returns a new timed connection to the database.
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.d.open(ctx, c.name, c.driverName, c.ud, func() (driver.Conn, error) {
+		if c.uc != nil {
+			return c.uc.Connect(ctx)
+		}
+		return c.ud.Open(c.dsn)
 	})
-	return r, err
 }
 
-// Close invalidates and potentially stops any current
-// prepared statements and transactions, marking this
-// connection as no longer in use.
-//
-// Because the sql package maintains a free pool of
-// connections and only calls Close when there's a surplus of
-// idle connections, it shouldn't be necessary for drivers to
-// do their own connection caching.
-func (c *Conn) Close() error {
-	var err error
-	doTiming("conn.Close", "", nil, func() error {
-		err = c.c.Close()
-		return err
+// Driver returns the timer driver.
+func (c *connector) Driver() driver.Driver {
+	return c.d
+}
+
+// open times a call to connect, which opens an underlying connection to
+// driverName, ud, and wraps the connection it returns.
+func (d *Driver) open(ctx context.Context, name, driverName string, ud driver.Driver, connect func() (driver.Conn, error)) (driver.Conn, error) {
+	d.reportEnv()
+	var c driver.Conn
+	cs := &connState{d: d, labels: d.labels}
+	err := cs.doTiming(ctx, "driver.Open", name, nil, func() error {
+		var err error
+		c, err = connect()
+		if err != nil {
+			return err
+		}
+		cs.opened(c)
+		d.checkCapabilities(driverName, ud, c)
+		c = wrapConn(c, cs)
+		return nil
 	})
-	return err
+	if err == nil {
+		cs.probeSession(ctx, UnwrapConn(c))
+	}
+	return c, err
 }
 
-// Begin starts and returns a new transaction.
-func (c *Conn) Begin() (driver.Tx, error) {
-	var tx driver.Tx
+//go:generate go run ./internal/wrapgen -o wrappers_gen.go
+
+// The timed connection types, Conn, NoExecConn, NoQueryConn and
+// NoExecNoQueryConn, are generated by wrapgen and call these.
+
+func (cs *connState) prepare(c driver.Conn, query string) (driver.Stmt, error) {
+	var s driver.Stmt
 	var err error
-	doTiming("conn.Begin", "", nil, func() error {
-		tx, err = c.c.Begin()
-		tx = &Tx{tx}
-		return err
+	err = cs.doTiming(context.Background(), "conn.Prepare", query, nil, func() error {
+		s, err = c.Prepare(query)
+		if err != nil {
+			return err
+		}
+		s = cs.newStmt(s, query)
+		return nil
 	})
-	return tx, err
+	return s, err
 }
 
-type NoExecConn struct {
-	c driver.Conn
+func (cs *connState) exec(c driver.Conn, query string, args []driver.Value) (driver.Result, error) {
+	return cs.timeExec(context.Background(), "conn.Exec", query, args, func() (driver.Result, error) {
+		if e, ok := c.(driver.Execer); ok {
+			return e.Exec(query, args)
+		}
+		return c.(driver.ExecerContext).ExecContext(context.Background(), query, namedValues(args))
+	})
 }
 
-// Prepare returns a prepared statement, bound to this connection.
-func (c *NoExecConn) Prepare(query string) (driver.Stmt, error) {
-	var err error
-	var s driver.Stmt
-	doTiming("conn.Prepare", query, nil, func() error {
-		s, err = c.c.Prepare(query)
-		s = &Stmt{s, query}
-		return err
+func (cs *connState) execContext(ctx context.Context, c driver.Conn, query string, args []driver.NamedValue) (driver.Result, error) {
+	ctx, cancel := cs.enforceTimeout(ctx, "conn.Exec", query)
+	defer cancel()
+	return cs.timeExec(ctx, "conn.Exec", query, values(args), func() (driver.Result, error) {
+		if ec, ok := c.(driver.ExecerContext); ok {
+			return ec.ExecContext(ctx, query, args)
+		}
+		dargs, err := namedValueToValue(args)
+		if err != nil {
+			return nil, err
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		return c.(driver.Execer).Exec(query, dargs)
 	})
-	return s, err
 }
 
-// Close invalidates and potentially stops any current
-// prepared statements and transactions, marking this
-// connection as no longer in use.
-//
-// Because the sql package maintains a free pool of
-// connections and only calls Close when there's a surplus of
-// idle connections, it shouldn't be necessary for drivers to
-// do their own connection caching.
-func (c *NoExecConn) Close() error {
+func (cs *connState) close(c driver.Conn) error {
 	var err error
-	doTiming("conn.Close", "", nil, func() error {
-		err = c.c.Close()
+	err = cs.doTiming(context.Background(), "conn.Close", "", nil, func() error {
+		err = c.Close()
 		return err
 	})
+	atomic.AddUint64(&connStats.closed, 1)
 	return err
 }
 
-// Begin starts and returns a new transaction.
-func (c *NoExecConn) Begin() (driver.Tx, error) {
+func (cs *connState) begin(c driver.Conn) (driver.Tx, error) {
+	cs.checkNestedTx()
 	var tx driver.Tx
 	var err error
-	doTiming("conn.Begin", "", nil, func() error {
-		tx, err = c.c.Begin()
-		tx = &Tx{tx}
-		return err
+	err = cs.doTiming(context.Background(), "conn.Begin", "", nil, func() error {
+		tx, err = c.Begin()
+		if err != nil {
+			return err
+		}
+		tx = cs.newTx(tx)
+		return nil
 	})
 	return tx, err
 }
@@ -205,6 +680,9 @@ func (c *NoExecConn) Begin() (driver.Tx, error) {
 type Stmt struct {
 	s     driver.Stmt
 	query string
+	cs    *connState
+	copy  *copyIn
+	guard *useGuard
 }
 
 // Close closes the statement.
@@ -212,8 +690,9 @@ type Stmt struct {
 // As of Go 1.1, a Stmt will not be closed if it's in use
 // by any queries.
 func (s *Stmt) Close() error {
+	defer s.guard.enter(s.cs, s.query)()
 	var err error
-	doTiming("stmt.Close", "", nil, func() error {
+	err = s.cs.doTiming(context.Background(), "stmt.Close", "", nil, func() error {
 		err = s.s.Close()
 		return err
 	})
@@ -236,45 +715,111 @@ func (s *Stmt) NumInput() int {
 // Exec executes a query that doesn't return rows, such
 // as an INSERT or UPDATE.
 func (s *Stmt) Exec(args []driver.Value) (driver.Result, error) {
-	var r driver.Result
-	var err error
-	doTiming("stmt.Exec", s.query, args, func() error {
-		r, err = s.s.Exec(args)
-		return err
+	defer s.guard.enter(s.cs, s.query)()
+	if s.copy != nil {
+		return s.execCopy(context.Background(), args, func() (driver.Result, error) {
+			return s.s.Exec(args)
+		})
+	}
+	return s.cs.timeExec(context.Background(), "stmt.Exec", s.query, args, func() (driver.Result, error) {
+		return s.s.Exec(args)
 	})
-	return r, err
+}
+
+// ExecContext executes a query that doesn't return rows, such
+// as an INSERT or UPDATE.
+//
+// ExecContext must honor the context timeout and return when it is canceled.
+func (s *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	defer s.guard.enter(s.cs, s.query)()
+	ctx, cancel := s.cs.enforceTimeout(ctx, "stmt.Exec", s.query)
+	defer cancel()
+	exec := func() (driver.Result, error) {
+		if sec, ok := s.s.(driver.StmtExecContext); ok {
+			return sec.ExecContext(ctx, args)
+		}
+		dargs, err := namedValueToValue(args)
+		if err != nil {
+			return nil, err
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		return s.s.Exec(dargs)
+	}
+	if s.copy != nil {
+		return s.execCopy(ctx, values(args), exec)
+	}
+	return s.cs.timeExec(ctx, "stmt.Exec", s.query, values(args), exec)
 }
 
 // Query executes a query that may return rows, such as a
 // SELECT.
 func (s *Stmt) Query(args []driver.Value) (driver.Rows, error) {
-	var r driver.Rows
-	var err error
-	doTiming("stmt.Query", s.query, args, func() error {
-		r, err = s.s.Query(args)
-		return err
+	defer s.guard.enter(s.cs, s.query)()
+	return s.cs.timeQuery(context.Background(), "stmt.Query", s.query, args, func() (driver.Rows, error) {
+		return s.s.Query(args)
+	})
+}
+
+// QueryContext executes a query that may return rows, such as a
+// SELECT.
+//
+// QueryContext must honor the context timeout and return when it is canceled.
+func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	defer s.guard.enter(s.cs, s.query)()
+	ctx, cancel := s.cs.enforceTimeout(ctx, "stmt.Query", s.query)
+	rows, err := s.cs.timeQuery(ctx, "stmt.Query", s.query, values(args), func() (driver.Rows, error) {
+		if sqc, ok := s.s.(driver.StmtQueryContext); ok {
+			return sqc.QueryContext(ctx, args)
+		}
+		dargs, err := namedValueToValue(args)
+		if err != nil {
+			return nil, err
+		}
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		return s.s.Query(dargs)
 	})
-	return r, err
+	return cancelOnClose(rows, err, cancel)
+}
+
+// CheckNamedValue is called before passing arguments to the driver
+// and is called in place of any ColumnConverter.
+func (s *Stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	return checkNamedValue(nv, s.s, s.cs.conn)
 }
 
 type Tx struct {
-	tx driver.Tx
+	tx    driver.Tx
+	cs    *connState
+	guard *useGuard
 }
 
 func (t *Tx) Commit() error {
+	defer t.guard.enter(t.cs, "")()
 	var err error
-	doTiming("tx.Commit", "", nil, func() error {
+	err = t.cs.doTiming(context.Background(), "tx.Commit", "", nil, func() error {
 		err = t.tx.Commit()
 		return err
 	})
+	if rc := t.cs.d.resultCache(); rc != nil && err == nil {
+		for _, table := range t.cs.txWrites {
+			rc.InvalidateTable(table)
+		}
+	}
+	t.cs.endTx()
 	return err
 }
 
 func (t *Tx) Rollback() error {
+	defer t.guard.enter(t.cs, "")()
 	var err error
-	doTiming("tx.Rollback", "", nil, func() error {
+	err = t.cs.doTiming(context.Background(), "tx.Rollback", "", nil, func() error {
 		err = t.tx.Rollback()
 		return err
 	})
+	t.cs.endTx()
 	return err
 }
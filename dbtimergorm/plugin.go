@@ -0,0 +1,107 @@
+// Package dbtimergorm is a GORM plugin that sends a GORM database's calls
+// through dbtimer and tags them with what GORM is doing, so that GORM users
+// get dbtimer's telemetry with one Use call:
+//
+//	db, err := gorm.Open(postgres.Open(dsn))
+//	// ...
+//	err = db.Use(&dbtimergorm.Plugin{DriverName: "postgres", DSN: dsn})
+//
+// Each call carries the tags "gorm.operation" (create, query, update,
+// delete, row or raw), "gorm.model", the name of the model's type, and
+// "gorm.table".
+package dbtimergorm
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jonbodner/dbtimer"
+	"gorm.io/gorm"
+)
+
+// Plugin is the dbtimer plugin for GORM.
+type Plugin struct {
+	// DriverName and DSN are the database/sql driver and DSN of the
+	// database GORM opened. If DSN is set, Initialize replaces GORM's
+	// connection pool with one opened through dbtimer by OpenDB, and
+	// closes the original, so set the pool's limits on db.DB() after Use.
+	// If DSN is empty the pool is left alone, for dialectors that were
+	// given a *sql.DB that is already timed.
+	DriverName string
+	DSN        string
+
+	// Options configure the timer's Driver.
+	Options []dbtimer.Option
+}
+
+// Name returns the plugin's name.
+func (p *Plugin) Name() string {
+	return "dbtimer"
+}
+
+// Initialize installs the timer's connection pool and the callbacks that tag
+// GORM's calls.
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	if p.DSN != "" {
+		if err := p.replacePool(db); err != nil {
+			return err
+		}
+	}
+	cb := db.Callback()
+	for _, err := range []error{
+		cb.Create().Before("gorm:create").Register("dbtimer:create", tag("create")),
+		cb.Query().Before("gorm:query").Register("dbtimer:query", tag("query")),
+		cb.Update().Before("gorm:update").Register("dbtimer:update", tag("update")),
+		cb.Delete().Before("gorm:delete").Register("dbtimer:delete", tag("delete")),
+		cb.Row().Before("gorm:row").Register("dbtimer:row", tag("row")),
+		cb.Raw().Before("gorm:raw").Register("dbtimer:raw", tag("raw")),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replacePool opens the database through dbtimer and puts it in place of the
+// pool GORM opened, under GORM's prepared statement cache if it has one.
+func (p *Plugin) replacePool(db *gorm.DB) error {
+	timed, err := dbtimer.OpenDB(p.DriverName, p.DSN, p.Options...)
+	if err != nil {
+		return err
+	}
+	old := db.ConnPool
+	if ps, ok := db.ConnPool.(*gorm.PreparedStmtDB); ok {
+		old = ps.ConnPool
+		ps.ConnPool = timed
+	} else {
+		db.ConnPool = timed
+		if db.Statement != nil {
+			db.Statement.ConnPool = timed
+		}
+	}
+	if sqlDB, ok := old.(*sql.DB); ok {
+		sqlDB.Close()
+	}
+	return nil
+}
+
+// tag returns a callback that adds the tags of a GORM operation to the
+// context of its statement.
+func tag(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		stmt := db.Statement
+		tags := map[string]string{"gorm.operation": operation}
+		if stmt.Schema != nil {
+			tags["gorm.model"] = stmt.Schema.Name
+		}
+		if stmt.Table != "" {
+			tags["gorm.table"] = stmt.Table
+		}
+		ctx := stmt.Context
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		stmt.Context = dbtimer.WithTags(ctx, tags)
+	}
+}
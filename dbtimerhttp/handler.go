@@ -0,0 +1,379 @@
+// Package dbtimerhttp serves a live view of the database calls made through
+// dbtimer: a small web page that streams events as they happen, shows recent
+// latency percentiles for each fingerprint, and lists the calls that are
+// running now, like pg_stat_activity for your application.
+package dbtimerhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// Handler is both a dbtimer.TimerLogger and an http.Handler. Install it as a
+// logger, alongside any other with dbtimer.MultiLogger, and mount it on a path
+// that ends in a slash:
+//
+//	h := dbtimerhttp.NewHandler()
+//	dbtimer.SetTimerLogger(dbtimer.MultiLogger(myLogger, h))
+//	http.Handle("/debug/dbtimer/", h)
+//
+// It serves the page at the mount point, and below it "events" (a WebSocket
+// stream of events as JSON), "sse" (the same stream as Server-Sent Events,
+// filtered), "stats" and "inflight" (JSON snapshots), and, if Aggregates is
+// set, "windows" and "slo" (its rolling windows and the compliance of its
+// SLOs, as JSON).
+type Handler struct {
+	// Window is how far back the percentiles look. The default is a minute.
+	Window time.Duration
+
+	// Aggregates, if set, is the Stats whose Windows "windows" reports and
+	// whose SLOs "slo" reports.
+	Aggregates *dbtimer.Stats
+
+	mu      sync.Mutex
+	samples map[string][]sample
+	subs    map[*subscriber]struct{}
+	closed  bool
+}
+
+type sample struct {
+	end time.Time
+	d   time.Duration
+}
+
+// maxSamples limits the samples kept for each fingerprint.
+const maxSamples = 1000
+
+// NewHandler returns a Handler and turns on dbtimer.TrackInFlight so that it
+// can list running calls. Call Close when it is no longer served.
+func NewHandler() *Handler {
+	dbtimer.TrackInFlight(true)
+	return &Handler{
+		samples: map[string][]sample{},
+		subs:    map[*subscriber]struct{}{},
+	}
+}
+
+// Close disconnects every event stream and turns off the in-flight tracking
+// that NewHandler turned on.
+func (h *Handler) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	h.closed = true
+	for s := range h.subs {
+		close(s.c)
+	}
+	h.subs = nil
+	dbtimer.TrackInFlight(false)
+}
+
+func (h *Handler) window() time.Duration {
+	if h.Window > 0 {
+		return h.Window
+	}
+	return time.Minute
+}
+
+// event is the form an event is streamed in. Arguments are left out so that
+// the page doesn't show application data.
+type event struct {
+	Method     string            `json:"method"`
+	Query      string            `json:"query,omitempty"`
+	Start      time.Time         `json:"start"`
+	DurationMS float64           `json:"duration_ms"`
+	ConnID     uint64            `json:"conn_id,omitempty"`
+	Err        string            `json:"error,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Log streams ti to every connected page and adds it to the percentiles of
+// its fingerprint.
+func (h *Handler) Log(ti dbtimer.TimerInfo) {
+	d := ti.Elapsed()
+	e := event{
+		Method:     ti.Method,
+		Query:      ti.Query,
+		Start:      ti.Start,
+		DurationMS: ms(d),
+		ConnID:     ti.ConnID,
+		Tags:       ti.Tags,
+	}
+	if ti.Err != nil {
+		e.Err = ti.Err.Error()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		dbtimer.ReportError(dbtimer.ErrSerialization, err)
+		return
+	}
+	isQuery := ti.Query != "" && (strings.HasSuffix(ti.Method, ".Exec") || strings.HasSuffix(ti.Method, ".Query") ||
+		ti.Method == "conn.CopyIn" || ti.Method == "conn.LoadData")
+	var fp string
+	if isQuery {
+		fp = dbtimer.Fingerprint(ti.Query)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return
+	}
+	for s := range h.subs {
+		if !s.f.match(fp, d, ti.Err) {
+			continue
+		}
+		select {
+		case s.c <- b:
+		default:
+			dbtimer.ReportError(dbtimer.ErrDropped, errors.New("dbtimerhttp: event stream is behind"))
+		}
+	}
+	if isQuery {
+		s := append(h.samples[fp], sample{ti.End, d})
+		if len(s) > maxSamples {
+			s = s[len(s)-maxSamples:]
+		}
+		h.samples[fp] = s
+	}
+}
+
+// FingerprintStats are the recent latency percentiles of one fingerprint.
+type FingerprintStats struct {
+	Fingerprint string  `json:"fingerprint"`
+	Count       int     `json:"count"`
+	P50MS       float64 `json:"p50_ms"`
+	P90MS       float64 `json:"p90_ms"`
+	P99MS       float64 `json:"p99_ms"`
+	MaxMS       float64 `json:"max_ms"`
+	TotalMS     float64 `json:"total_ms"`
+}
+
+// Stats returns the percentiles of every fingerprint seen within the window,
+// the most total time first.
+func (h *Handler) Stats() []FingerprintStats {
+	cutoff := time.Now().Add(-h.window())
+	h.mu.Lock()
+	var out []FingerprintStats
+	var ds []time.Duration
+	for fp, s := range h.samples {
+		i := sort.Search(len(s), func(i int) bool { return s[i].end.After(cutoff) })
+		s = s[i:]
+		if len(s) == 0 {
+			delete(h.samples, fp)
+			continue
+		}
+		h.samples[fp] = s
+		ds = ds[:0]
+		var total time.Duration
+		for _, x := range s {
+			ds = append(ds, x.d)
+			total += x.d
+		}
+		sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+		out = append(out, FingerprintStats{
+			Fingerprint: fp,
+			Count:       len(ds),
+			P50MS:       ms(percentile(ds, 50)),
+			P90MS:       ms(percentile(ds, 90)),
+			P99MS:       ms(percentile(ds, 99)),
+			MaxMS:       ms(ds[len(ds)-1]),
+			TotalMS:     ms(total),
+		})
+	}
+	h.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].TotalMS != out[j].TotalMS {
+			return out[i].TotalMS > out[j].TotalMS
+		}
+		return out[i].Fingerprint < out[j].Fingerprint
+	})
+	return out
+}
+
+// percentile returns the nearest-rank percentile p of the sorted ds.
+func percentile(ds []time.Duration, p float64) time.Duration {
+	i := int(p/100*float64(len(ds))+0.5) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(ds) {
+		i = len(ds) - 1
+	}
+	return ds[i]
+}
+
+// sloStatus is the form an SLO's compliance is served in.
+type sloStatus struct {
+	Name          string             `json:"name"`
+	Objective     float64            `json:"objective"`
+	WindowSeconds float64            `json:"window_seconds"`
+	Good          int64              `json:"good"`
+	Total         int64              `json:"total"`
+	Compliance    float64            `json:"compliance"`
+	Budget        float64            `json:"error_budget_remaining"`
+	BurnRates     map[string]float64 `json:"burn_rates"`
+}
+
+func newSLOStatus(st dbtimer.SLOStatus) sloStatus {
+	out := sloStatus{
+		Name:          st.Name,
+		Objective:     st.Objective,
+		WindowSeconds: st.Window.Seconds(),
+		Good:          st.Good,
+		Total:         st.Total,
+		Compliance:    st.Compliance,
+		Budget:        st.Budget,
+		BurnRates:     map[string]float64{},
+	}
+	for _, br := range st.BurnRates {
+		out.BurnRates[br.Window.String()] = br.Rate
+	}
+	return out
+}
+
+type inFlightCall struct {
+	ConnID    uint64            `json:"conn_id,omitempty"`
+	Method    string            `json:"method"`
+	Query     string            `json:"query,omitempty"`
+	Start     time.Time         `json:"start"`
+	RunningMS float64           `json:"running_ms"`
+	Tags      map[string]string `json:"tags,omitempty"`
+}
+
+// ServeHTTP serves the page, the event stream and the JSON snapshots.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch path.Base(r.URL.Path) {
+	case "events":
+		h.serveEvents(w, r)
+	case "sse":
+		h.serveSSE(w, r)
+	case "stats":
+		writeJSON(w, h.Stats())
+	case "windows":
+		windows := map[string][]FingerprintStats{}
+		if h.Aggregates != nil {
+			now := time.Now()
+			for _, win := range h.Aggregates.Windows {
+				fs := []FingerprintStats{}
+				for _, qs := range h.Aggregates.WindowReport(win, now) {
+					fs = append(fs, FingerprintStats{
+						Fingerprint: qs.Fingerprint,
+						Count:       int(qs.Count),
+						P50MS:       ms(qs.Quantile(0.5)),
+						P90MS:       ms(qs.Quantile(0.9)),
+						P99MS:       ms(qs.Quantile(0.99)),
+						MaxMS:       ms(qs.Max),
+						TotalMS:     ms(qs.Total),
+					})
+				}
+				windows[win.String()] = fs
+			}
+		}
+		writeJSON(w, windows)
+	case "slo":
+		slos := []sloStatus{}
+		if h.Aggregates != nil {
+			for _, st := range h.Aggregates.SLOStatus(time.Now()) {
+				slos = append(slos, newSLOStatus(st))
+			}
+		}
+		writeJSON(w, slos)
+	case "inflight":
+		now := time.Now()
+		calls := []inFlightCall{}
+		for _, q := range dbtimer.InFlight() {
+			calls = append(calls, inFlightCall{
+				ConnID:    q.ConnID,
+				Method:    q.Method,
+				Query:     q.Query,
+				Start:     q.Start,
+				RunningMS: ms(now.Sub(q.Start)),
+				Tags:      q.Tags,
+			})
+		}
+		writeJSON(w, calls)
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		dbtimer.ReportError(dbtimer.ErrSink, err)
+	}
+}
+
+func (h *Handler) serveEvents(w http.ResponseWriter, r *http.Request) {
+	ws, err := upgrade(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.conn.Close()
+	s := h.subscribe(filter{})
+	if s == nil {
+		return
+	}
+	defer h.unsubscribe(s)
+
+	gone := make(chan struct{})
+	go func() {
+		ws.discardFrames()
+		close(gone)
+	}()
+	for {
+		select {
+		case b, ok := <-s.c:
+			if !ok {
+				ws.close()
+				return
+			}
+			if err := ws.writeText(b); err != nil {
+				return
+			}
+		case <-gone:
+			return
+		}
+	}
+}
+
+// subscriber is a stream of the events that match f.
+type subscriber struct {
+	c chan []byte
+	f filter
+}
+
+// subscribe adds a stream of the events that match f, or returns nil if the
+// handler is closed. The stream's channel is closed when the handler is.
+func (h *Handler) subscribe(f filter) *subscriber {
+	s := &subscriber{c: make(chan []byte, 256), f: f}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		return nil
+	}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+func (h *Handler) unsubscribe(s *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, s)
+}
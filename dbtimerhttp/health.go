@@ -0,0 +1,203 @@
+package dbtimerhttp
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// HealthCheck is both a dbtimer.TimerLogger and an http.Handler for
+// Kubernetes readiness probes. It keeps the recent latency of pings and the
+// recent error rate of calls, and answers 503 Service Unavailable when
+// either passes its limit, so that a pod whose path to the database has
+// degraded stops receiving traffic until it recovers:
+//
+//	hc := &dbtimerhttp.HealthCheck{DB: db, MaxLatency: 200 * time.Millisecond}
+//	dbtimer.SetTimerLogger(dbtimer.MultiLogger(myLogger, hc))
+//	http.Handle("/readyz", hc)
+//
+// The body is the Health as JSON. Keep liveness probes off it: restarting a
+// pod doesn't fix its database.
+type HealthCheck struct {
+	// DB, if set, is pinged on each request, so that the probe itself keeps
+	// the ping latency current. It must be opened through dbtimer with the
+	// HealthCheck among its loggers for its pings to count.
+	DB *sql.DB
+
+	// Window is how far back the latency and error rate look. The default
+	// is 30 seconds.
+	Window time.Duration
+
+	// MaxLatency is the mean ping latency above which the database is
+	// unhealthy. The default is a second.
+	MaxLatency time.Duration
+
+	// MaxErrorRate is the fraction of calls that may fail before the
+	// database is unhealthy. Calls that fail because their context was
+	// canceled don't count. The default is 0.5.
+	MaxErrorRate float64
+
+	// MinCalls is the number of calls in the window below which the error
+	// rate isn't judged. The default is 10.
+	MinCalls int
+
+	mu      sync.Mutex
+	buckets []healthBucket
+}
+
+// healthBucket counts the events of one second.
+type healthBucket struct {
+	sec       int64
+	pings     int
+	pingTotal time.Duration
+	calls     int
+	errors    int
+}
+
+// Health is the state of the database path as a HealthCheck sees it.
+type Health struct {
+	Healthy      bool    `json:"healthy"`
+	Reason       string  `json:"reason,omitempty"`
+	Pings        int     `json:"pings"`
+	PingMS       float64 `json:"ping_ms"`
+	Calls        int     `json:"calls"`
+	Errors       int     `json:"errors"`
+	ErrorRate    float64 `json:"error_rate"`
+	WindowSecs   float64 `json:"window_seconds"`
+	MaxPingMS    float64 `json:"max_ping_ms"`
+	MaxErrorRate float64 `json:"max_error_rate"`
+}
+
+// Log adds ti to the ping latency if it is a ping, and to the error rate if
+// it is a ping or runs a statement.
+func (hc *HealthCheck) Log(ti dbtimer.TimerInfo) {
+	ping := ti.Method == "conn.Ping"
+	if !ping && (ti.Query == "" || !(strings.HasSuffix(ti.Method, ".Exec") || strings.HasSuffix(ti.Method, ".Query") ||
+		ti.Method == "conn.CopyIn" || ti.Method == "conn.LoadData")) {
+		return
+	}
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	b := hc.bucket(ti.End.Unix())
+	if b == nil {
+		return
+	}
+	b.calls++
+	if ti.Err != nil && !errors.Is(ti.Err, context.Canceled) {
+		b.errors++
+	}
+	if ping {
+		b.pings++
+		b.pingTotal += ti.Elapsed()
+	}
+}
+
+// bucket returns the bucket of the second sec, reusing the slot of a second
+// that has left the window, or nil if sec itself has.
+func (hc *HealthCheck) bucket(sec int64) *healthBucket {
+	n := int(hc.window() / time.Second)
+	if n < 1 {
+		n = 1
+	}
+	if len(hc.buckets) != n {
+		hc.buckets = make([]healthBucket, n)
+	}
+	b := &hc.buckets[int(sec%int64(n))]
+	if b.sec > sec {
+		return nil
+	}
+	if b.sec != sec {
+		*b = healthBucket{sec: sec}
+	}
+	return b
+}
+
+func (hc *HealthCheck) window() time.Duration {
+	if hc.Window > 0 {
+		return hc.Window
+	}
+	return 30 * time.Second
+}
+
+// Check returns the state of the database path over the window before now.
+func (hc *HealthCheck) Check(now time.Time) Health {
+	maxLatency := hc.MaxLatency
+	if maxLatency <= 0 {
+		maxLatency = time.Second
+	}
+	maxRate := hc.MaxErrorRate
+	if maxRate <= 0 {
+		maxRate = 0.5
+	}
+	minCalls := hc.MinCalls
+	if minCalls <= 0 {
+		minCalls = 10
+	}
+	h := Health{
+		Healthy:      true,
+		WindowSecs:   hc.window().Seconds(),
+		MaxPingMS:    ms(maxLatency),
+		MaxErrorRate: maxRate,
+	}
+	oldest := now.Add(-hc.window()).Unix()
+	var pingTotal time.Duration
+	hc.mu.Lock()
+	for _, b := range hc.buckets {
+		if b.sec <= oldest || b.sec > now.Unix() {
+			continue
+		}
+		h.Pings += b.pings
+		pingTotal += b.pingTotal
+		h.Calls += b.calls
+		h.Errors += b.errors
+	}
+	hc.mu.Unlock()
+	if h.Pings > 0 {
+		mean := pingTotal / time.Duration(h.Pings)
+		h.PingMS = ms(mean)
+		if mean > maxLatency {
+			h.Healthy = false
+			h.Reason = fmt.Sprintf("mean ping latency %v is over %v", mean, maxLatency)
+		}
+	}
+	if h.Calls > 0 {
+		h.ErrorRate = float64(h.Errors) / float64(h.Calls)
+		if h.Calls >= minCalls && h.ErrorRate > maxRate {
+			h.Healthy = false
+			h.Reason = fmt.Sprintf("%d of %d calls failed", h.Errors, h.Calls)
+		}
+	}
+	return h
+}
+
+// ServeHTTP pings DB, if it is set, and answers with the Health: 200 OK if
+// it is healthy, and 503 Service Unavailable if it isn't. The ping is
+// limited to MaxLatency, or the request's own deadline if that is sooner.
+func (hc *HealthCheck) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if hc.DB != nil {
+		limit := hc.MaxLatency
+		if limit <= 0 {
+			limit = time.Second
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), limit)
+		hc.DB.PingContext(ctx)
+		cancel()
+	}
+	h := hc.Check(time.Now())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if !h.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(h); err != nil {
+		dbtimer.ReportError(dbtimer.ErrSerialization, err)
+	}
+}
@@ -0,0 +1,91 @@
+package dbtimerhttp
+
+// page is the dashboard. It uses relative URLs, so it works wherever the
+// handler is mounted.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>dbtimer</title>
+<style>
+body { font-family: sans-serif; margin: 20px; font-size: 13px; }
+table { border-collapse: collapse; margin-bottom: 24px; width: 100%; }
+th, td { text-align: left; padding: 3px 8px; border-bottom: 1px solid #ddd; vertical-align: top; }
+td.num { text-align: right; font-variant-numeric: tabular-nums; }
+td.sql { font-family: monospace; word-break: break-all; }
+tr.err td { color: #b00; }
+#status { color: #888; }
+</style>
+</head>
+<body>
+<h1>dbtimer <span id="status"></span></h1>
+<h2>In flight</h2>
+<table>
+<thead><tr><th>Conn</th><th>Method</th><th>Running (ms)</th><th>Query</th></tr></thead>
+<tbody id="inflight"></tbody>
+</table>
+<h2>Recent latency by fingerprint</h2>
+<table>
+<thead><tr><th>Count</th><th>p50 (ms)</th><th>p90 (ms)</th><th>p99 (ms)</th><th>Max (ms)</th><th>Fingerprint</th></tr></thead>
+<tbody id="stats"></tbody>
+</table>
+<h2>Events</h2>
+<table>
+<thead><tr><th>Start</th><th>Conn</th><th>Method</th><th>ms</th><th>Query</th><th>Error</th></tr></thead>
+<tbody id="events"></tbody>
+</table>
+<script>
+function row(cells, cls) {
+	var tr = document.createElement("tr");
+	if (cls) tr.className = cls;
+	cells.forEach(function(c) {
+		var td = document.createElement("td");
+		if (typeof c === "number") {
+			td.className = "num";
+			c = c.toFixed(2);
+		} else if (c && c.sql !== undefined) {
+			td.className = "sql";
+			c = c.sql;
+		}
+		td.textContent = c === undefined ? "" : c;
+		tr.appendChild(td);
+	});
+	return tr;
+}
+function fill(id, rows) {
+	var body = document.getElementById(id);
+	body.textContent = "";
+	rows.forEach(function(r) { body.appendChild(r); });
+}
+function poll() {
+	fetch("stats").then(function(r) { return r.json(); }).then(function(stats) {
+		fill("stats", (stats || []).map(function(s) {
+			return row([s.count, s.p50_ms, s.p90_ms, s.p99_ms, s.max_ms, {sql: s.fingerprint}]);
+		}));
+	});
+	fetch("inflight").then(function(r) { return r.json(); }).then(function(calls) {
+		fill("inflight", calls.map(function(c) {
+			return row([c.conn_id, c.method, c.running_ms, {sql: c.query}]);
+		}));
+	});
+}
+function connect() {
+	var proto = location.protocol === "https:" ? "wss:" : "ws:";
+	var ws = new WebSocket(proto + "//" + location.host + location.pathname.replace(/[^\/]*$/, "") + "events");
+	var status = document.getElementById("status");
+	ws.onopen = function() { status.textContent = "(live)"; };
+	ws.onclose = function() { status.textContent = "(disconnected, retrying)"; setTimeout(connect, 2000); };
+	ws.onmessage = function(m) {
+		var e = JSON.parse(m.data);
+		var body = document.getElementById("events");
+		body.insertBefore(row([e.start, e.conn_id, e.method, e.duration_ms, {sql: e.query}, e.error], e.error ? "err" : ""), body.firstChild);
+		while (body.childNodes.length > 200) body.removeChild(body.lastChild);
+	};
+}
+connect();
+poll();
+setInterval(poll, 2000);
+</script>
+</body>
+</html>
+`
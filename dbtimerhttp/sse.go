@@ -0,0 +1,109 @@
+package dbtimerhttp
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// filter chooses the events sent to a stream. The zero filter matches every
+// event.
+type filter struct {
+	// fingerprint, if not empty, must appear in the event's fingerprint.
+	fingerprint string
+	// min is the shortest duration an event may have.
+	min time.Duration
+	// errorsOnly matches only the events of failed calls.
+	errorsOnly bool
+}
+
+// parseFilter reads a filter from the query parameters "fingerprint",
+// "min_ms" and "errors".
+func parseFilter(r *http.Request) (filter, error) {
+	q := r.URL.Query()
+	f := filter{fingerprint: q.Get("fingerprint")}
+	if s := q.Get("min_ms"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < 0 {
+			return f, errors.New("min_ms must be a number of milliseconds")
+		}
+		f.min = time.Duration(v * float64(time.Millisecond))
+	}
+	if s := q.Get("errors"); s != "" {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return f, errors.New("errors must be true or false")
+		}
+		f.errorsOnly = v
+	}
+	return f, nil
+}
+
+// match reports whether an event with the fingerprint fp, which is empty for
+// calls that aren't statements, the duration d and the error err passes f.
+func (f filter) match(fp string, d time.Duration, err error) bool {
+	if f.fingerprint != "" && !strings.Contains(fp, f.fingerprint) {
+		return false
+	}
+	if d < f.min {
+		return false
+	}
+	return !f.errorsOnly || err != nil
+}
+
+// ssePing is how often a comment is sent on an idle stream, so that proxies
+// don't close it.
+const ssePing = 15 * time.Second
+
+// serveSSE streams events as Server-Sent Events, one JSON event per message,
+// for clients without WebSockets:
+//
+//	curl -N 'http://localhost:8080/debug/dbtimer/sse?min_ms=100'
+//
+// The query parameters "fingerprint" (a substring of the fingerprint),
+// "min_ms" and "errors=true" choose which events are sent.
+func (h *Handler) serveSSE(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	s := h.subscribe(f)
+	if s == nil {
+		http.Error(w, "handler is closed", http.StatusServiceUnavailable)
+		return
+	}
+	defer h.unsubscribe(s)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	ping := time.NewTicker(ssePing)
+	defer ping.Stop()
+	for {
+		var err error
+		select {
+		case b, ok := <-s.c:
+			if !ok {
+				return
+			}
+			_, err = w.Write(append(append([]byte("data: "), b...), '\n', '\n'))
+		case <-ping.C:
+			_, err = w.Write([]byte(": ping\n\n"))
+		case <-r.Context().Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,141 @@
+package dbtimerhttp
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// wsConn is the server side of a WebSocket (RFC 6455) that only sends text
+// messages. It is all the event stream needs, so the package has no
+// dependencies.
+type wsConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// upgrade completes the WebSocket handshake. Requests from a page on another
+// host are refused, so that other sites can't read the stream through a
+// visitor's browser.
+func upgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !headerHas(r.Header, "Connection", "upgrade") || !headerHas(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "WebSocket upgrade required", http.StatusBadRequest)
+		return nil, errors.New("not a WebSocket request")
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			http.Error(w, "cross-origin WebSocket requests are not allowed", http.StatusForbidden)
+			return nil, errors.New("cross-origin WebSocket request")
+		}
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing Sec-WebSocket-Key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("ResponseWriter is not a Hijacker")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha1.Sum([]byte(key + wsGUID))
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn, rw}, nil
+}
+
+func headerHas(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const (
+	wsText  = 0x1
+	wsClose = 0x8
+)
+
+func (ws *wsConn) writeFrame(op byte, payload []byte) error {
+	hdr := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n < 126:
+		hdr = append(hdr, byte(n))
+	case n <= 0xffff:
+		hdr = append(hdr, 126, 0, 0)
+		binary.BigEndian.PutUint16(hdr[2:], uint16(n))
+	default:
+		hdr = append(hdr, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(hdr[2:], uint64(n))
+	}
+	ws.rw.Write(hdr)
+	ws.rw.Write(payload)
+	return ws.rw.Flush()
+}
+
+func (ws *wsConn) writeText(b []byte) error {
+	return ws.writeFrame(wsText, b)
+}
+
+func (ws *wsConn) close() {
+	ws.writeFrame(wsClose, nil)
+}
+
+// discardFrames reads and ignores what the client sends until it closes the
+// connection or sends a close frame.
+func (ws *wsConn) discardFrames() {
+	var hdr [2]byte
+	for {
+		if _, err := io.ReadFull(ws.rw, hdr[:]); err != nil {
+			return
+		}
+		if hdr[0]&0x0f == wsClose {
+			return
+		}
+		n := uint64(hdr[1] & 0x7f)
+		switch n {
+		case 126:
+			var b [2]byte
+			if _, err := io.ReadFull(ws.rw, b[:]); err != nil {
+				return
+			}
+			n = uint64(binary.BigEndian.Uint16(b[:]))
+		case 127:
+			var b [8]byte
+			if _, err := io.ReadFull(ws.rw, b[:]); err != nil {
+				return
+			}
+			n = binary.BigEndian.Uint64(b[:])
+		}
+		if hdr[1]&0x80 != 0 {
+			n += 4 // masking key
+		}
+		if _, err := io.CopyN(io.Discard, ws.rw, int64(n)); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,354 @@
+// Package dbtimermigrate times the migrations run by golang-migrate and
+// goose, for auditing slow deploys. Both tools take a *sql.DB, so open it
+// with Open and pass it in:
+//
+//	tracker := &dbtimermigrate.Tracker{Next: dbtimer.GetTimerLogger()}
+//	db, err := dbtimermigrate.Open("postgres", dsn, tracker)
+//	// ...
+//	err = goose.Up(db, "migrations")
+//	tracker.Flush()
+//	for _, m := range tracker.Migrations() {
+//		log.Printf("migration %d: %v, %d statements, %d rows", m.Version, m.Duration, m.Statements, m.RowsAffected)
+//	}
+//
+// The Tracker follows each tool's writes to its version table to tell which
+// migration a statement belongs to, tags the statement with the version in
+// the "migration.version" tag, and passes it on to Next. The version is read
+// from the arguments of those writes, so don't redact the driver's
+// arguments.
+package dbtimermigrate
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// Open opens the database through dbtimer.OpenDB, with opts, sending its
+// events to t.
+func Open(driverName, dsn string, t *Tracker, opts ...dbtimer.Option) (*sql.DB, error) {
+	return dbtimer.OpenDB(driverName, dsn, append(opts, dbtimer.WithTimerLogger(t))...)
+}
+
+// Migration summarizes one migration.
+type Migration struct {
+	// Tool is "golang-migrate" or "goose".
+	Tool string
+
+	// Version is the migration's version, as the tool recorded it. For a
+	// golang-migrate down migration, that is the version migrated to. It is
+	// -1 for a goose migration that failed before goose recorded it.
+	Version int64
+
+	Start    time.Time
+	Duration time.Duration
+
+	// Statements is the number of statements the migration ran,
+	// RowsAffected the rows they reported affecting, and Errors the number
+	// that failed.
+	Statements   int
+	RowsAffected int64
+	Errors       int
+
+	// Finished reports whether the tool recorded the migration as done.
+	Finished bool
+}
+
+// Tracker is a TimerLogger that attributes the statements of migrations to
+// their versions, and summarizes each migration.
+//
+// golang-migrate marks a version dirty in its table before it runs a
+// migration, and clean after, so the statements in between are tagged as
+// they run. goose records a version after its migration has run, so the
+// Tracker holds the migration's events until then, and tags them when it
+// passes them on. Statements that mention a version table are the tools'
+// own, and are passed on untagged.
+type Tracker struct {
+	// Next is the logger events are passed on to. If it is nil, they are
+	// only summarized.
+	Next dbtimer.TimerLogger
+
+	// MigrateTable and GooseTable are the version tables of golang-migrate
+	// and goose. The defaults are "schema_migrations" and
+	// "goose_db_version".
+	MigrateTable string
+	GooseTable   string
+
+	// MaxPending is the number of events held for a goose migration that
+	// hasn't been recorded yet. Past it, events are passed on untagged,
+	// though they are still summarized. The default is 10000.
+	MaxPending int
+
+	// OnMigration, if set, is called with the summary of each migration as
+	// it finishes.
+	OnMigration func(Migration)
+
+	mu      sync.Mutex
+	current *Migration
+	pending []dbtimer.TimerInfo
+	held    Migration
+	done    []Migration
+}
+
+// Log passes ti on to Next, tagged with the version of the migration it
+// belongs to, and adds it to the migration's summary.
+func (t *Tracker) Log(ti dbtimer.TimerInfo) {
+	t.mu.Lock()
+	out, finished := t.track(ti)
+	t.mu.Unlock()
+	t.emit(out, finished)
+}
+
+// emit passes out on to Next, followed by a "migration.Done" event for each
+// finished migration, and calls OnMigration with them.
+func (t *Tracker) emit(out []dbtimer.TimerInfo, finished []Migration) {
+	if t.Next != nil {
+		for _, ti := range out {
+			t.Next.Log(ti)
+		}
+		for _, m := range finished {
+			t.Next.Log(dbtimer.TimerInfo{
+				Method: "migration.Done",
+				Start:  m.Start,
+				End:    m.Start.Add(m.Duration),
+				Tags: map[string]string{
+					"migration.tool":          m.Tool,
+					"migration.version":       strconv.FormatInt(m.Version, 10),
+					"migration.statements":    strconv.Itoa(m.Statements),
+					"migration.rows_affected": strconv.FormatInt(m.RowsAffected, 10),
+					"migration.finished":      strconv.FormatBool(m.Finished),
+				},
+			})
+		}
+	}
+	if t.OnMigration != nil {
+		for _, m := range finished {
+			t.OnMigration(m)
+		}
+	}
+}
+
+func (t *Tracker) track(ti dbtimer.TimerInfo) ([]dbtimer.TimerInfo, []Migration) {
+	query := strings.ToLower(ti.Query)
+	if migrate := orDefault(t.MigrateTable, "schema_migrations"); strings.Contains(query, migrate) {
+		return t.migrateVersion(ti)
+	}
+	if goose := orDefault(t.GooseTable, "goose_db_version"); strings.Contains(query, goose) {
+		return t.gooseVersion(ti)
+	}
+	if t.current != nil {
+		add(t.current, ti)
+		return []dbtimer.TimerInfo{tag(ti, t.current.Version)}, nil
+	}
+	if len(t.pending) == 0 && t.held.Statements == 0 {
+		if !runsStatement(ti.Method) {
+			return []dbtimer.TimerInfo{ti}, nil
+		}
+		t.held = Migration{Tool: "goose", Version: -1, Start: ti.Start}
+	}
+	add(&t.held, ti)
+	max := t.MaxPending
+	if max <= 0 {
+		max = 10000
+	}
+	if len(t.pending) >= max {
+		return []dbtimer.TimerInfo{ti}, nil
+	}
+	t.pending = append(t.pending, ti)
+	return nil, nil
+}
+
+// migrateVersion follows golang-migrate's writes of
+//
+//	INSERT INTO schema_migrations (version, dirty) VALUES ($1, $2)
+//
+// A dirty version starts a migration, and the same version clean ends it.
+func (t *Tracker) migrateVersion(ti dbtimer.TimerInfo) ([]dbtimer.TimerInfo, []Migration) {
+	// Anything held for goose before a golang-migrate migration was the
+	// tool's setup, such as taking its lock.
+	out := t.release(false)
+	out = append(out, ti)
+	version, flag, ok := versionArgs(ti, 2)
+	if !ok || ti.Err != nil {
+		return out, nil
+	}
+	var finished []Migration
+	if flag {
+		if t.current != nil {
+			finished = append(finished, *t.current)
+			t.done = append(t.done, *t.current)
+		}
+		t.current = &Migration{Tool: "golang-migrate", Version: version, Start: ti.End}
+		return out, finished
+	}
+	if t.current != nil && t.current.Version == version {
+		t.current.Finished = true
+		t.current.Duration = ti.Start.Sub(t.current.Start)
+		finished = append(finished, *t.current)
+		t.done = append(t.done, *t.current)
+		t.current = nil
+	}
+	return out, finished
+}
+
+// gooseVersion follows goose's writes of
+//
+//	INSERT INTO goose_db_version (version_id, is_applied) VALUES ($1, $2)
+//	DELETE FROM goose_db_version WHERE version_id=$1
+//
+// which end an up and a down migration, with the events held since the last
+// one.
+func (t *Tracker) gooseVersion(ti dbtimer.TimerInfo) ([]dbtimer.TimerInfo, []Migration) {
+	fp := dbtimer.Fingerprint(ti.Query)
+	if !strings.HasPrefix(fp, "insert ") && !strings.HasPrefix(fp, "delete ") {
+		// goose reads its versions before it runs a migration, so anything
+		// held until then was not part of one.
+		return append(t.release(false), ti), nil
+	}
+	version, _, ok := versionArgs(ti, 1)
+	// goose records version 0 when it creates its table.
+	if !ok || ti.Err != nil || t.held.Statements == 0 {
+		return []dbtimer.TimerInfo{ti}, nil
+	}
+	m := t.held
+	m.Version = version
+	m.Finished = true
+	m.Duration = ti.End.Sub(m.Start)
+	out := make([]dbtimer.TimerInfo, 0, len(t.pending)+1)
+	for _, p := range t.pending {
+		out = append(out, tag(p, version))
+	}
+	out = append(out, ti)
+	t.pending = nil
+	t.held = Migration{}
+	t.done = append(t.done, m)
+	return out, []Migration{m}
+}
+
+// release returns the events held for goose untagged, and forgets their
+// summary unless keep is set and one of them failed, which is how a goose
+// migration that failed looks.
+func (t *Tracker) release(keep bool) []dbtimer.TimerInfo {
+	out := t.pending
+	if keep && t.held.Errors > 0 {
+		m := t.held
+		if len(out) > 0 {
+			last := out[len(out)-1]
+			m.Duration = last.End.Sub(m.Start)
+		}
+		t.done = append(t.done, m)
+	}
+	t.pending = nil
+	t.held = Migration{}
+	return out
+}
+
+// Flush passes on the events still held, untagged, and ends the summaries
+// of migrations that didn't finish: a golang-migrate migration that never
+// marked its version clean, and a goose migration that failed. Call it once
+// the tool returns.
+func (t *Tracker) Flush() {
+	t.mu.Lock()
+	var finished []Migration
+	before := len(t.done)
+	out := t.release(true)
+	if t.current != nil {
+		t.done = append(t.done, *t.current)
+		t.current = nil
+	}
+	finished = append(finished, t.done[before:]...)
+	t.mu.Unlock()
+	t.emit(out, finished)
+}
+
+// Migrations returns the summaries of the migrations that have ended, in
+// the order they ran.
+func (t *Tracker) Migrations() []Migration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]Migration(nil), t.done...)
+}
+
+// add adds the statement run by ti, if it runs one, to m.
+func add(m *Migration, ti dbtimer.TimerInfo) {
+	if !runsStatement(ti.Method) {
+		return
+	}
+	m.Statements++
+	m.RowsAffected += ti.RowsAffected
+	if ti.Err != nil {
+		m.Errors++
+	}
+	if d := ti.End.Sub(m.Start); d > m.Duration {
+		m.Duration = d
+	}
+}
+
+func tag(ti dbtimer.TimerInfo, version int64) dbtimer.TimerInfo {
+	tags := make(map[string]string, len(ti.Tags)+1)
+	for k, v := range ti.Tags {
+		tags[k] = v
+	}
+	tags["migration.version"] = strconv.FormatInt(version, 10)
+	ti.Tags = tags
+	return ti
+}
+
+// versionArgs reads the version, and the flag after it if n is 2, from the
+// arguments of a write to a version table.
+func versionArgs(ti dbtimer.TimerInfo, n int) (int64, bool, bool) {
+	if len(ti.Args) < n {
+		return 0, false, false
+	}
+	version, ok := asInt(ti.Args[0])
+	if !ok {
+		return 0, false, false
+	}
+	if n < 2 {
+		return version, false, true
+	}
+	switch v := ti.Args[1].(type) {
+	case bool:
+		return version, v, true
+	case int64:
+		return version, v != 0, true
+	case []byte:
+		b, err := strconv.ParseBool(string(v))
+		return version, b, err == nil
+	case string:
+		b, err := strconv.ParseBool(v)
+		return version, b, err == nil
+	}
+	return 0, false, false
+}
+
+func asInt(v driver.Value) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case []byte:
+		n, err := strconv.ParseInt(string(v), 10, 64)
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func runsStatement(method string) bool {
+	return strings.HasSuffix(method, ".Exec") || strings.HasSuffix(method, ".Query") ||
+		method == "conn.CopyIn" || method == "conn.LoadData"
+}
+
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return strings.ToLower(s)
+}
@@ -0,0 +1,83 @@
+// Package dbtimersqlx opens sqlx databases through dbtimer, and tags calls
+// with the struct they scan into or bind from and the table they use, so
+// that sqlx users don't have to wire the timer up themselves:
+//
+//	db, err := dbtimersqlx.Open("postgres", dsn)
+//	// ...
+//	var users []User
+//	err = dbtimersqlx.Select(ctx, db, &users, "SELECT * FROM users WHERE team = $1", team)
+//
+// The tags are "sqlx.struct", the name of the struct's type, and
+// "sqlx.table", as dbtimer.Table finds it in the query.
+package dbtimersqlx
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jonbodner/dbtimer"
+)
+
+// Open opens the database through dbtimer.OpenDB, with opts, and wraps it
+// for sqlx, which uses driverName to choose its bind variables.
+func Open(driverName, dsn string, opts ...dbtimer.Option) (*sqlx.DB, error) {
+	db, err := dbtimer.OpenDB(driverName, dsn, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return sqlx.NewDb(db, driverName), nil
+}
+
+// WithStruct returns a context whose calls carry the name of v's type, after
+// any pointers, slices and arrays, in the "sqlx.struct" tag.
+func WithStruct(ctx context.Context, v interface{}) context.Context {
+	name := structName(v)
+	if name == "" {
+		return ctx
+	}
+	return dbtimer.WithTag(ctx, "sqlx.struct", name)
+}
+
+// Get runs sqlx.GetContext with the calls tagged with the type of dest and
+// the table of query.
+func Get(ctx context.Context, q sqlx.QueryerContext, dest interface{}, query string, args ...interface{}) error {
+	return sqlx.GetContext(tag(ctx, dest, query), q, dest, query, args...)
+}
+
+// Select runs sqlx.SelectContext with the calls tagged with the type of dest
+// and the table of query.
+func Select(ctx context.Context, q sqlx.QueryerContext, dest interface{}, query string, args ...interface{}) error {
+	return sqlx.SelectContext(tag(ctx, dest, query), q, dest, query, args...)
+}
+
+// NamedExec runs sqlx.NamedExecContext with the call tagged with the type of
+// arg and the table of query.
+func NamedExec(ctx context.Context, e sqlx.ExtContext, query string, arg interface{}) (sql.Result, error) {
+	return sqlx.NamedExecContext(tag(ctx, arg, query), e, query, arg)
+}
+
+func tag(ctx context.Context, v interface{}, query string) context.Context {
+	ctx = WithStruct(ctx, v)
+	if table := dbtimer.Table(query); table != "" {
+		ctx = dbtimer.WithTag(ctx, "sqlx.table", table)
+	}
+	return ctx
+}
+
+// structName returns the name of the struct type under v's pointers, slices
+// and arrays, or "" if there isn't one.
+func structName(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+	return t.Name()
+}
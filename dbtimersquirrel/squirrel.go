@@ -0,0 +1,78 @@
+// Package dbtimersquirrel runs squirrel statements through dbtimer, and tags
+// each call with the table it uses, so that squirrel users don't have to wire
+// the timer up themselves:
+//
+//	sb, db, err := dbtimersquirrel.Open("postgres", dsn)
+//	// ...
+//	rows, err := sb.Select("id", "name").From("users").Where(sq.Eq{"team": team}).QueryContext(ctx)
+//
+// The tag is "squirrel.table", as dbtimer.Table finds it in the statement.
+package dbtimersquirrel
+
+import (
+	"context"
+	"database/sql"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jonbodner/dbtimer"
+)
+
+// Open opens the database through dbtimer.OpenDB, with opts, and returns a
+// statement builder that runs its statements on it, along with the
+// database.
+func Open(driverName, dsn string, opts ...dbtimer.Option) (sq.StatementBuilderType, *sql.DB, error) {
+	db, err := dbtimer.OpenDB(driverName, dsn, opts...)
+	if err != nil {
+		return sq.StatementBuilder, nil, err
+	}
+	return StatementBuilder(db, driverName), db, nil
+}
+
+// StatementBuilder returns a statement builder that runs its statements on
+// db through a Runner, with the placeholders of driverName: $1 for Postgres
+// drivers, and ? for the others.
+func StatementBuilder(db *sql.DB, driverName string) sq.StatementBuilderType {
+	sb := sq.StatementBuilder.RunWith(Runner{db})
+	switch driverName {
+	case "postgres", "pgx", "cockroach", "cloudsqlpostgres":
+		sb = sb.PlaceholderFormat(sq.Dollar)
+	}
+	return sb
+}
+
+// Runner is a squirrel runner that tags each call on DB with the table it
+// uses.
+type Runner struct {
+	DB *sql.DB
+}
+
+func (r Runner) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return r.ExecContext(context.Background(), query, args...)
+}
+
+func (r Runner) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return r.DB.ExecContext(tag(ctx, query), query, args...)
+}
+
+func (r Runner) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return r.QueryContext(context.Background(), query, args...)
+}
+
+func (r Runner) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return r.DB.QueryContext(tag(ctx, query), query, args...)
+}
+
+func (r Runner) QueryRow(query string, args ...interface{}) sq.RowScanner {
+	return r.QueryRowContext(context.Background(), query, args...)
+}
+
+func (r Runner) QueryRowContext(ctx context.Context, query string, args ...interface{}) sq.RowScanner {
+	return r.DB.QueryRowContext(tag(ctx, query), query, args...)
+}
+
+func tag(ctx context.Context, query string) context.Context {
+	if table := dbtimer.Table(query); table != "" {
+		return dbtimer.WithTag(ctx, "squirrel.table", table)
+	}
+	return ctx
+}
@@ -0,0 +1,154 @@
+package dbtimertest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// An Expectation checks the events recorded by Capture. The events include
+// everything the timer logged, not just queries.
+type Expectation func(t testing.TB, events []dbtimer.TimerInfo)
+
+// Capture records every event logged by the timer from now until the returned
+// function is called or ctx is done, whichever comes first. It taps the
+// events with dbtimer.Tap, so it sees the calls of every driver, whichever
+// logger they go to, and leaves the loggers as they are. The returned
+// function stops the recording, checks expectations against t and returns
+// the captured queries:
+//
+//	done := dbtimertest.Capture(ctx, dbtimertest.MaxPerFingerprint(1))
+//	defer done(t)
+//
+// The events are those of the whole process, so tests run with t.Parallel
+// see each other's calls, unless ctx carries tags, set with dbtimer.WithTag.
+// Then only the events with the same tags are recorded: give each parallel
+// test a tag of its own and make its calls with that context. Calls made
+// without a context, such as Commit, don't carry its tags, so they are left
+// out.
+func Capture(ctx context.Context, expectations ...Expectation) func(t testing.TB) []dbtimer.TimerInfo {
+	c := &capture{tags: dbtimer.TagsFromContext(ctx)}
+	untap := dbtimer.Tap(c)
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.stop()
+		case <-stop:
+		}
+	}()
+	var once sync.Once
+	return func(t testing.TB) []dbtimer.TimerInfo {
+		t.Helper()
+		once.Do(func() {
+			close(stop)
+			c.stop()
+			untap()
+		})
+		events := c.rec.Events()
+		for _, e := range expectations {
+			e(t, events)
+		}
+		return queries(events)
+	}
+}
+
+type capture struct {
+	rec     RecordingLogger
+	tags    map[string]string
+	mu      sync.Mutex
+	stopped bool
+}
+
+func (c *capture) Log(ti dbtimer.TimerInfo) {
+	c.mu.Lock()
+	stopped := c.stopped
+	c.mu.Unlock()
+	if stopped {
+		return
+	}
+	for k, v := range c.tags {
+		if got, ok := ti.Tags[k]; !ok || got != v {
+			return
+		}
+	}
+	c.rec.Log(ti)
+}
+
+func (c *capture) stop() {
+	c.mu.Lock()
+	c.stopped = true
+	c.mu.Unlock()
+}
+
+// QueryCount expects exactly n queries.
+func QueryCount(n int) Expectation {
+	return func(t testing.TB, events []dbtimer.TimerInfo) {
+		t.Helper()
+		if qs := queries(events); len(qs) != n {
+			t.Errorf("expected %d queries, got %d", n, len(qs))
+		}
+	}
+}
+
+// MaxQueries expects no more than n queries.
+func MaxQueries(n int) Expectation {
+	return func(t testing.TB, events []dbtimer.TimerInfo) {
+		t.Helper()
+		assertMaxQueries(t, queries(events), n)
+	}
+}
+
+// MaxPerFingerprint expects no fingerprint to be run more than n times. A
+// fingerprint that runs once per row of an earlier query is the signature of
+// an N+1 query.
+func MaxPerFingerprint(n int) Expectation {
+	return func(t testing.TB, events []dbtimer.TimerInfo) {
+		t.Helper()
+		counts := map[string]int{}
+		for _, ti := range queries(events) {
+			counts[dbtimer.Fingerprint(ti.Query)]++
+		}
+		var over []string
+		for fp, count := range counts {
+			if count > n {
+				over = append(over, fmt.Sprintf("\n\t%d x %s", count, fp))
+			}
+		}
+		if len(over) > 0 {
+			sort.Strings(over)
+			t.Errorf("expected each fingerprint to run at most %d times:%s", n, strings.Join(over, ""))
+		}
+	}
+}
+
+// Fingerprints expects the queries to have the same fingerprints as qs, in
+// order. The elements of qs may be fingerprints or queries.
+func Fingerprints(qs ...string) Expectation {
+	matchers := make([]Matcher, len(qs))
+	for i, q := range qs {
+		matchers[i] = Fingerprint(q)
+	}
+	return Queries(matchers...)
+}
+
+// Queries expects the queries to match matchers one for one, in order.
+func Queries(matchers ...Matcher) Expectation {
+	return func(t testing.TB, events []dbtimer.TimerInfo) {
+		t.Helper()
+		expectQueries(t, queries(events), matchers)
+	}
+}
+
+// NoErrors expects every event to have a nil Err.
+func NoErrors() Expectation {
+	return func(t testing.TB, events []dbtimer.TimerInfo) {
+		t.Helper()
+		assertNoErrors(t, events)
+	}
+}
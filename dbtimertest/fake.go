@@ -0,0 +1,331 @@
+package dbtimertest
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// Fake is a driver.Driver that runs no database, for testing code, loggers and
+// timer features without one. Its responses are scripted with On: each
+// statement gets the response of the first rule that matches it, and a
+// statement no rule matches succeeds with no rows, or fails if Strict is set.
+// Register it with the sql package and use its name as the driver in a timer
+// DSN:
+//
+//	fake := dbtimertest.NewFake()
+//	fake.On("SELECT name FROM users WHERE id = ?").Rows([]string{"name"}, []driver.Value{"bob"})
+//	fake.On("UPDATE users SET name = ? WHERE id = ?").Delay(50 * time.Millisecond).RowsAffected(1)
+//	sql.Register("fake", fake)
+//	db, err := sql.Open("timer", "fake anything")
+//
+// Delays end early, with the context's error, when the call's context is
+// done. Set Sleep to replace them, for example to advance a fake clock set
+// with dbtimer.SetClock, so that tests of timings are deterministic.
+//
+// The DSN passed to Open is ignored.
+type Fake struct {
+	// Strict makes statements that match no rule fail.
+	Strict bool
+
+	// OpenErr, BeginErr, CommitErr and PingErr, if set, are returned by
+	// every Open, Begin, Commit and Ping.
+	OpenErr   error
+	BeginErr  error
+	CommitErr error
+	PingErr   error
+
+	// Sleep, if set, is called for each delay instead of waiting for it.
+	Sleep func(ctx context.Context, d time.Duration) error
+
+	mu    sync.Mutex
+	rules []*FakeRule
+	calls []FakeCall
+}
+
+// NewFake returns a Fake with no rules.
+func NewFake() *Fake {
+	return &Fake{}
+}
+
+// FakeCall is a statement a Fake was asked to run.
+type FakeCall struct {
+	Query string
+	Args  []driver.Value
+}
+
+// FakeRule is the scripted response to the statements with the fingerprint
+// of a query. Its methods set the response and return the rule, so that
+// they can be chained.
+type FakeRule struct {
+	fingerprint string
+	args        []driver.Value
+	matchArgs   bool
+	times       int
+	delay       time.Duration
+	err         error
+	columns     []string
+	rows        [][]driver.Value
+	affected    int64
+	insertID    int64
+}
+
+// On adds a rule for the statements with the same fingerprint as query, and
+// returns it. Rules are tried in the order they were added.
+func (f *Fake) On(query string) *FakeRule {
+	r := &FakeRule{fingerprint: dbtimer.Fingerprint(query)}
+	f.mu.Lock()
+	f.rules = append(f.rules, r)
+	f.mu.Unlock()
+	return r
+}
+
+// WithArgs limits the rule to statements run with args.
+func (r *FakeRule) WithArgs(args ...driver.Value) *FakeRule {
+	r.args = args
+	r.matchArgs = true
+	return r
+}
+
+// Times limits the rule to the next n statements it matches, after which
+// the rules after it are tried.
+func (r *FakeRule) Times(n int) *FakeRule {
+	r.times = n
+	return r
+}
+
+// Delay makes the statements take d before they respond.
+func (r *FakeRule) Delay(d time.Duration) *FakeRule {
+	r.delay = d
+	return r
+}
+
+// Err makes the statements fail with err after their delay.
+func (r *FakeRule) Err(err error) *FakeRule {
+	r.err = err
+	return r
+}
+
+// Rows makes queries return rows, with the names of their columns.
+func (r *FakeRule) Rows(columns []string, rows ...[]driver.Value) *FakeRule {
+	r.columns = columns
+	r.rows = rows
+	return r
+}
+
+// RowsAffected sets the RowsAffected of the statements' results.
+func (r *FakeRule) RowsAffected(n int64) *FakeRule {
+	r.affected = n
+	return r
+}
+
+// LastInsertID sets the LastInsertId of the statements' results.
+func (r *FakeRule) LastInsertID(id int64) *FakeRule {
+	r.insertID = id
+	return r
+}
+
+// Calls returns the statements run so far, in order.
+func (f *Fake) Calls() []FakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]FakeCall, len(f.calls))
+	copy(out, f.calls)
+	return out
+}
+
+// Reset forgets the rules and the calls.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	f.rules = nil
+	f.calls = nil
+	f.mu.Unlock()
+}
+
+// respond records a statement and returns the rule that answers it, or nil
+// if none does and f isn't Strict.
+func (f *Fake) respond(query string, args []driver.Value) (*FakeRule, error) {
+	fp := dbtimer.Fingerprint(query)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, FakeCall{Query: query, Args: args})
+	for _, r := range f.rules {
+		if r.fingerprint != fp || r.times < 0 || r.matchArgs && !reflect.DeepEqual(r.args, args) {
+			continue
+		}
+		if r.times > 0 {
+			r.times--
+			if r.times == 0 {
+				r.times = -1
+			}
+		}
+		return r, nil
+	}
+	if f.Strict {
+		return nil, fmt.Errorf("dbtimertest: no fake response for %q with args %v", query, args)
+	}
+	return nil, nil
+}
+
+// run answers a statement, after the delay of its rule.
+func (f *Fake) run(ctx context.Context, query string, args []driver.Value) (*FakeRule, error) {
+	r, err := f.respond(query, args)
+	if err != nil || r == nil {
+		return r, err
+	}
+	if r.delay > 0 {
+		if err := f.sleep(ctx, r.delay); err != nil {
+			return nil, err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r, nil
+}
+
+func (f *Fake) sleep(ctx context.Context, d time.Duration) error {
+	if f.Sleep != nil {
+		return f.Sleep(ctx, d)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *Fake) Open(name string) (driver.Conn, error) {
+	if f.OpenErr != nil {
+		return nil, f.OpenErr
+	}
+	return fakeConn{f}, nil
+}
+
+type fakeConn struct {
+	f *Fake
+}
+
+func (fc fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeStmt{fc.f, query}, nil
+}
+
+func (fc fakeConn) Close() error {
+	return nil
+}
+
+func (fc fakeConn) Begin() (driver.Tx, error) {
+	if fc.f.BeginErr != nil {
+		return nil, fc.f.BeginErr
+	}
+	return fakeTx{fc.f}, nil
+}
+
+func (fc fakeConn) Ping(ctx context.Context) error {
+	return fc.f.PingErr
+}
+
+func (fc fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return fakeExec(ctx, fc.f, query, namedValues(args))
+}
+
+func (fc fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return fakeQuery(ctx, fc.f, query, namedValues(args))
+}
+
+type fakeTx struct {
+	f *Fake
+}
+
+func (ft fakeTx) Commit() error {
+	return ft.f.CommitErr
+}
+
+func (ft fakeTx) Rollback() error {
+	return nil
+}
+
+type fakeStmt struct {
+	f     *Fake
+	query string
+}
+
+func (fs fakeStmt) Close() error {
+	return nil
+}
+
+func (fs fakeStmt) NumInput() int {
+	return -1
+}
+
+func (fs fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return fakeExec(context.Background(), fs.f, fs.query, args)
+}
+
+func (fs fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return fakeQuery(context.Background(), fs.f, fs.query, args)
+}
+
+func (fs fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return fakeExec(ctx, fs.f, fs.query, namedValues(args))
+}
+
+func (fs fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return fakeQuery(ctx, fs.f, fs.query, namedValues(args))
+}
+
+func fakeExec(ctx context.Context, f *Fake, query string, args []driver.Value) (driver.Result, error) {
+	r, err := f.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return fakeResult{}, nil
+	}
+	return fakeResult{r.insertID, r.affected}, nil
+}
+
+func fakeQuery(ctx context.Context, f *Fake, query string, args []driver.Value) (driver.Rows, error) {
+	r, err := f.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return &replayRows{}, nil
+	}
+	rows := make([][]driver.Value, len(r.rows))
+	copy(rows, r.rows)
+	return &replayRows{columns: r.columns, rows: rows}, nil
+}
+
+type fakeResult struct {
+	insertID int64
+	affected int64
+}
+
+func (r fakeResult) LastInsertId() (int64, error) {
+	return r.insertID, nil
+}
+
+func (r fakeResult) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
+
+func namedValues(args []driver.NamedValue) []driver.Value {
+	if len(args) == 0 {
+		return nil
+	}
+	out := make([]driver.Value, len(args))
+	for i, a := range args {
+		out[i] = a.Value
+	}
+	return out
+}
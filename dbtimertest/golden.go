@@ -0,0 +1,83 @@
+package dbtimertest
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// Golden records the queries run from now until the returned function is
+// called or ctx is done, and compares their fingerprints, one per line, to
+// the golden file at path. The test fails if the sequence has drifted.
+//
+// When the test binary is run with -update the golden file is rewritten
+// instead. Golden doesn't define that flag itself, so that it can't clash with
+// one the test package already has; declare it in the test package as usual:
+//
+//	var update = flag.Bool("update", false, "update golden files")
+func Golden(ctx context.Context, path string) func(t testing.TB) {
+	done := Capture(ctx)
+	return func(t testing.TB) {
+		t.Helper()
+		var sb strings.Builder
+		for _, ti := range done(t) {
+			sb.WriteString(dbtimer.Fingerprint(ti.Query))
+			sb.WriteByte('\n')
+		}
+		got := sb.String()
+		if updateGolden() {
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("can't create directory for golden file: %v", err)
+			}
+			if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+				t.Fatalf("can't write golden file: %v", err)
+			}
+			return
+		}
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("can't read golden file (run with -update to create it): %v", err)
+		}
+		want := string(b)
+		if got == want {
+			return
+		}
+		t.Errorf("queries differ from golden file %s (run with -update if the change is intended):%s", path, diffLines(want, got))
+	}
+}
+
+func updateGolden() bool {
+	f := flag.Lookup("update")
+	return f != nil && f.Value.String() == "true"
+}
+
+// diffLines describes the first line where want and got differ.
+func diffLines(want, got string) string {
+	wl, gl := lines(want), lines(got)
+	for i := 0; i < len(wl) || i < len(gl); i++ {
+		var w, g string
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if w != g {
+			return fmt.Sprintf("\n\tline %d:\n\t- %s\n\t+ %s\n\twant %d queries, got %d", i+1, w, g, len(wl), len(gl))
+		}
+	}
+	return ""
+}
+
+func lines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,211 @@
+// Package dbtimertest provides helpers for writing tests about the database
+// behavior of code that uses dbtimer.
+package dbtimertest
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// RecordingLogger is a dbtimer.TimerLogger that stores every event it is
+// given. The zero value is ready to use.
+type RecordingLogger struct {
+	mu     sync.Mutex
+	events []dbtimer.TimerInfo
+}
+
+// Log records ti.
+func (rl *RecordingLogger) Log(ti dbtimer.TimerInfo) {
+	rl.mu.Lock()
+	rl.events = append(rl.events, ti)
+	rl.mu.Unlock()
+}
+
+// Events returns a copy of every event recorded so far.
+func (rl *RecordingLogger) Events() []dbtimer.TimerInfo {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	out := make([]dbtimer.TimerInfo, len(rl.events))
+	copy(out, rl.events)
+	return out
+}
+
+// Queries returns the recorded events that executed a statement: the Exec and
+// Query calls on connections and statements. Prepares, transactions and
+// connection management are left out.
+func (rl *RecordingLogger) Queries() []dbtimer.TimerInfo {
+	return queries(rl.Events())
+}
+
+// Reset discards every recorded event.
+func (rl *RecordingLogger) Reset() {
+	rl.mu.Lock()
+	rl.events = nil
+	rl.mu.Unlock()
+}
+
+// ExpectQueries fails t unless the recorded queries match matchers one for
+// one, in order.
+func (rl *RecordingLogger) ExpectQueries(t testing.TB, matchers ...Matcher) {
+	t.Helper()
+	expectQueries(t, rl.Queries(), matchers)
+}
+
+// AssertMaxQueries fails t if more than n queries were recorded.
+func (rl *RecordingLogger) AssertMaxQueries(t testing.TB, n int) {
+	t.Helper()
+	assertMaxQueries(t, rl.Queries(), n)
+}
+
+// AssertNoErrors fails t if any recorded event has a non-nil Err.
+func (rl *RecordingLogger) AssertNoErrors(t testing.TB) {
+	t.Helper()
+	assertNoErrors(t, rl.Events())
+}
+
+func isQuery(ti dbtimer.TimerInfo) bool {
+	return strings.HasSuffix(ti.Method, ".Exec") || strings.HasSuffix(ti.Method, ".Query") ||
+		ti.Method == "conn.CopyIn" || ti.Method == "conn.LoadData"
+}
+
+func queries(events []dbtimer.TimerInfo) []dbtimer.TimerInfo {
+	var out []dbtimer.TimerInfo
+	for _, ti := range events {
+		if isQuery(ti) {
+			out = append(out, ti)
+		}
+	}
+	return out
+}
+
+func expectQueries(t testing.TB, qs []dbtimer.TimerInfo, matchers []Matcher) {
+	t.Helper()
+	for i, m := range matchers {
+		if i >= len(qs) {
+			t.Errorf("query %d: expected %v, but only %d queries were run", i, m, len(qs))
+			continue
+		}
+		if !m.Match(qs[i]) {
+			t.Errorf("query %d: expected %v, got %s %q [%v]", i, m, qs[i].Method, qs[i].Query, dbtimer.Args(qs[i].Args))
+		}
+	}
+	for i := len(matchers); i < len(qs); i++ {
+		t.Errorf("query %d: unexpected %s %q [%v]", i, qs[i].Method, qs[i].Query, dbtimer.Args(qs[i].Args))
+	}
+}
+
+func assertMaxQueries(t testing.TB, qs []dbtimer.TimerInfo, n int) {
+	t.Helper()
+	if len(qs) <= n {
+		return
+	}
+	var sb strings.Builder
+	for _, ti := range qs {
+		fmt.Fprintf(&sb, "\n\t%s %q", ti.Method, ti.Query)
+	}
+	t.Errorf("expected at most %d queries, got %d:%s", n, len(qs), sb.String())
+}
+
+func assertNoErrors(t testing.TB, events []dbtimer.TimerInfo) {
+	t.Helper()
+	for _, ti := range events {
+		if ti.Err != nil {
+			t.Errorf("%s %q failed: %v", ti.Method, ti.Query, ti.Err)
+		}
+	}
+}
+
+// A Matcher decides whether a recorded event is the one a test expects. Its
+// String method describes the expectation in failure messages.
+type Matcher interface {
+	Match(dbtimer.TimerInfo) bool
+	String() string
+}
+
+type matcher struct {
+	desc  string
+	match func(dbtimer.TimerInfo) bool
+}
+
+func (m matcher) Match(ti dbtimer.TimerInfo) bool {
+	return m.match(ti)
+}
+
+func (m matcher) String() string {
+	return m.desc
+}
+
+// Any matches every query.
+func Any() Matcher {
+	return matcher{"any query", func(dbtimer.TimerInfo) bool { return true }}
+}
+
+// Query matches a query whose text equals q, ignoring differences in
+// whitespace.
+func Query(q string) Matcher {
+	q = squash(q)
+	return matcher{fmt.Sprintf("query %q", q), func(ti dbtimer.TimerInfo) bool {
+		return squash(ti.Query) == q
+	}}
+}
+
+// QueryContaining matches a query whose text contains sub.
+func QueryContaining(sub string) Matcher {
+	return matcher{fmt.Sprintf("query containing %q", sub), func(ti dbtimer.TimerInfo) bool {
+		return strings.Contains(ti.Query, sub)
+	}}
+}
+
+// QueryMatching matches a query whose text matches the regular expression
+// pattern. It panics if pattern doesn't compile.
+func QueryMatching(pattern string) Matcher {
+	re := regexp.MustCompile(pattern)
+	return matcher{fmt.Sprintf("query matching %q", pattern), func(ti dbtimer.TimerInfo) bool {
+		return re.MatchString(ti.Query)
+	}}
+}
+
+// Fingerprint matches a query with the same dbtimer.Fingerprint as q.
+func Fingerprint(q string) Matcher {
+	fp := dbtimer.Fingerprint(q)
+	return matcher{fmt.Sprintf("fingerprint %q", fp), func(ti dbtimer.TimerInfo) bool {
+		return dbtimer.Fingerprint(ti.Query) == fp
+	}}
+}
+
+// Args matches a query run with exactly these arguments.
+func Args(args ...driver.Value) Matcher {
+	return matcher{fmt.Sprintf("args [%v]", dbtimer.Args(args)), func(ti dbtimer.TimerInfo) bool {
+		if len(args) == 0 && len(ti.Args) == 0 {
+			return true
+		}
+		return reflect.DeepEqual(args, ti.Args)
+	}}
+}
+
+// All matches a query that every one of ms matches.
+func All(ms ...Matcher) Matcher {
+	descs := make([]string, len(ms))
+	for i, m := range ms {
+		descs[i] = m.String()
+	}
+	return matcher{strings.Join(descs, " and "), func(ti dbtimer.TimerInfo) bool {
+		for _, m := range ms {
+			if !m.Match(ti) {
+				return false
+			}
+		}
+		return true
+	}}
+}
+
+func squash(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,679 @@
+package dbtimertest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// A Recording is a sequence of statements and the responses the database gave
+// to them. It is written by a Recorder and served by a Replayer.
+type Recording struct {
+	Entries []Entry `json:"entries"`
+}
+
+// Entry is one recorded statement. Queries have Columns and Rows; other
+// statements have RowsAffected and LastInsertID, if the driver reported them.
+// A statement that failed has its error's message in Err, and in Sentinel the
+// name of the standard error it was or wrapped, such as "driver.ErrBadConn",
+// so that the replayed error matches it with errors.Is. If ErrAfterRows is
+// set, the query itself succeeded and its rows failed with the error after
+// Rows were read.
+type Entry struct {
+	Fingerprint  string    `json:"fingerprint"`
+	Query        string    `json:"query"`
+	Args         []Value   `json:"args,omitempty"`
+	Columns      []string  `json:"columns,omitempty"`
+	Rows         [][]Value `json:"rows,omitempty"`
+	RowsAffected *int64    `json:"rows_affected,omitempty"`
+	LastInsertID *int64    `json:"last_insert_id,omitempty"`
+	Err          string    `json:"error,omitempty"`
+	Sentinel     string    `json:"sentinel,omitempty"`
+	ErrAfterRows bool      `json:"error_after_rows,omitempty"`
+}
+
+// sentinels are the errors that callers test for with errors.Is, by the name
+// an Entry's Sentinel records them under. A replayed error that was one of
+// them, or wrapped one, still is.
+var sentinels = []struct {
+	name string
+	err  error
+}{
+	{"driver.ErrBadConn", driver.ErrBadConn},
+	{"driver.ErrSkip", driver.ErrSkip},
+	{"driver.ErrRemoveArgument", driver.ErrRemoveArgument},
+	{"sql.ErrNoRows", sql.ErrNoRows},
+	{"sql.ErrConnDone", sql.ErrConnDone},
+	{"sql.ErrTxDone", sql.ErrTxDone},
+	{"context.Canceled", context.Canceled},
+	{"context.DeadlineExceeded", context.DeadlineExceeded},
+}
+
+// setErr records err in e.
+func (e *Entry) setErr(err error) {
+	e.Err = err.Error()
+	for _, s := range sentinels {
+		if errors.Is(err, s.err) {
+			e.Sentinel = s.name
+			return
+		}
+	}
+}
+
+// err returns the error recorded in e, or nil if there is none.
+func (e Entry) err() error {
+	if e.Err == "" {
+		return nil
+	}
+	for _, s := range sentinels {
+		if s.name != e.Sentinel {
+			continue
+		}
+		if s.err.Error() == e.Err {
+			return s.err
+		}
+		return replayError{e.Err, s.err}
+	}
+	return errors.New(e.Err)
+}
+
+// replayError is a recorded error that wrapped a sentinel.
+type replayError struct {
+	msg      string
+	sentinel error
+}
+
+func (re replayError) Error() string {
+	return re.msg
+}
+
+func (re replayError) Unwrap() error {
+	return re.sentinel
+}
+
+// Value is a driver.Value encoded so that its type survives the trip through
+// JSON.
+type Value struct {
+	Type  string `json:"type"`
+	Value string `json:"value,omitempty"`
+}
+
+func encodeValue(v driver.Value) Value {
+	switch v := v.(type) {
+	case nil:
+		return Value{Type: "nil"}
+	case int64:
+		return Value{"int64", strconv.FormatInt(v, 10)}
+	case float64:
+		return Value{"float64", strconv.FormatFloat(v, 'g', -1, 64)}
+	case bool:
+		return Value{"bool", strconv.FormatBool(v)}
+	case []byte:
+		return Value{"bytes", base64.StdEncoding.EncodeToString(v)}
+	case string:
+		return Value{"string", v}
+	case time.Time:
+		return Value{"time", v.Format(time.RFC3339Nano)}
+	default:
+		return Value{"string", fmt.Sprint(v)}
+	}
+}
+
+func (v Value) decode() (driver.Value, error) {
+	switch v.Type {
+	case "nil":
+		return nil, nil
+	case "int64":
+		return strconv.ParseInt(v.Value, 10, 64)
+	case "float64":
+		return strconv.ParseFloat(v.Value, 64)
+	case "bool":
+		return strconv.ParseBool(v.Value)
+	case "bytes":
+		return base64.StdEncoding.DecodeString(v.Value)
+	case "string":
+		return v.Value, nil
+	case "time":
+		return time.Parse(time.RFC3339Nano, v.Value)
+	}
+	return nil, fmt.Errorf("dbtimertest: unknown recorded value type %q", v.Type)
+}
+
+func encodeValues(vs []driver.Value) []Value {
+	if len(vs) == 0 {
+		return nil
+	}
+	out := make([]Value, len(vs))
+	for i, v := range vs {
+		out[i] = encodeValue(v)
+	}
+	return out
+}
+
+// LoadRecording reads a recording written by Recorder.Save.
+func LoadRecording(path string) (*Recording, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Recording
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, fmt.Errorf("dbtimertest: can't parse recording %s: %v", path, err)
+	}
+	return &r, nil
+}
+
+// Recorder is a driver.Driver that passes everything through to another
+// driver and records each statement and its response. Register it with the
+// sql package and use its name as the driver in a timer DSN:
+//
+//	rec := dbtimertest.NewRecorder(&pq.Driver{})
+//	sql.Register("pq-recorder", rec)
+//	db, err := sql.Open("timer", "pq-recorder postgres://localhost/test")
+//	// ... run the test ...
+//	err = rec.Save("testdata/users.json")
+type Recorder struct {
+	d       driver.Driver
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// NewRecorder returns a Recorder that wraps d.
+func NewRecorder(d driver.Driver) *Recorder {
+	return &Recorder{d: d}
+}
+
+// Open opens a connection with the wrapped driver.
+func (r *Recorder) Open(name string) (driver.Conn, error) {
+	c, err := r.d.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &recorderConn{c, r}, nil
+}
+
+// Recording returns everything recorded so far.
+func (r *Recorder) Recording() *Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entries := make([]Entry, len(r.entries))
+	copy(entries, r.entries)
+	return &Recording{Entries: entries}
+}
+
+// Save writes everything recorded so far to path as JSON.
+func (r *Recorder) Save(path string) error {
+	b, err := json.MarshalIndent(r.Recording(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+func (r *Recorder) record(e Entry) {
+	r.mu.Lock()
+	r.entries = append(r.entries, e)
+	r.mu.Unlock()
+}
+
+// recorderConn passes the optional interfaces of its connection through, so
+// that recording doesn't change how database/sql talks to the database.
+// When the connection doesn't implement one, it answers as database/sql
+// does without it.
+type recorderConn struct {
+	c driver.Conn
+	r *Recorder
+}
+
+func (rc *recorderConn) Prepare(query string) (driver.Stmt, error) {
+	s, err := rc.c.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return rc.r.stmt(s, rc.c, query), nil
+}
+
+func (rc *recorderConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	cpc, ok := rc.c.(driver.ConnPrepareContext)
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return rc.Prepare(query)
+	}
+	s, err := cpc.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return rc.r.stmt(s, rc.c, query), nil
+}
+
+func (rc *recorderConn) Close() error {
+	return rc.c.Close()
+}
+
+func (rc *recorderConn) Begin() (driver.Tx, error) {
+	return rc.c.Begin()
+}
+
+func (rc *recorderConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if cbt, ok := rc.c.(driver.ConnBeginTx); ok {
+		return cbt.BeginTx(ctx, opts)
+	}
+	// The same checks the sql package makes for drivers that don't
+	// support BeginTx.
+	if opts.Isolation != driver.IsolationLevel(sql.LevelDefault) {
+		return nil, errors.New("sql: driver does not support non-default isolation level")
+	}
+	if opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support read-only transactions")
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return rc.c.Begin()
+}
+
+func (rc *recorderConn) Ping(ctx context.Context) error {
+	if p, ok := rc.c.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (rc *recorderConn) IsValid() bool {
+	if v, ok := rc.c.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (rc *recorderConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := rc.c.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return rc.r.query(query, namedValues(args), func() (driver.Rows, error) {
+		return q.QueryContext(ctx, query, args)
+	})
+}
+
+func (rc *recorderConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := rc.c.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return rc.r.exec(query, namedValues(args), func() (driver.Result, error) {
+		return e.ExecContext(ctx, query, args)
+	})
+}
+
+func (rc *recorderConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nvc, ok := rc.c.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (rc *recorderConn) ResetSession(ctx context.Context) error {
+	if sr, ok := rc.c.(driver.SessionResetter); ok {
+		return sr.ResetSession(ctx)
+	}
+	return nil
+}
+
+// recorderStmt passes the optional interfaces of its statement through, as
+// recorderConn does.
+type recorderStmt struct {
+	s     driver.Stmt
+	c     driver.Conn
+	query string
+	r     *Recorder
+}
+
+// converterRecorderStmt is a recorderStmt whose statement is a
+// driver.ColumnConverter.
+type converterRecorderStmt struct {
+	*recorderStmt
+	cc driver.ColumnConverter
+}
+
+func (s converterRecorderStmt) ColumnConverter(idx int) driver.ValueConverter {
+	return s.cc.ColumnConverter(idx)
+}
+
+// stmt returns a statement that records what s runs, keeping its
+// ColumnConverter if it has one.
+func (r *Recorder) stmt(s driver.Stmt, c driver.Conn, query string) driver.Stmt {
+	rs := &recorderStmt{s, c, query, r}
+	if cc, ok := s.(driver.ColumnConverter); ok {
+		return converterRecorderStmt{rs, cc}
+	}
+	return rs
+}
+
+func (rs *recorderStmt) Close() error {
+	return rs.s.Close()
+}
+
+func (rs *recorderStmt) NumInput() int {
+	return rs.s.NumInput()
+}
+
+func (rs *recorderStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return rs.r.exec(rs.query, args, func() (driver.Result, error) {
+		return rs.s.Exec(args)
+	})
+}
+
+func (rs *recorderStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return rs.r.query(rs.query, args, func() (driver.Rows, error) {
+		return rs.s.Query(args)
+	})
+}
+
+func (rs *recorderStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	sec, ok := rs.s.(driver.StmtExecContext)
+	if !ok {
+		dargs, err := positionalValues(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		return rs.Exec(dargs)
+	}
+	return rs.r.exec(rs.query, namedValues(args), func() (driver.Result, error) {
+		return sec.ExecContext(ctx, args)
+	})
+}
+
+func (rs *recorderStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	sqc, ok := rs.s.(driver.StmtQueryContext)
+	if !ok {
+		dargs, err := positionalValues(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		return rs.Query(dargs)
+	}
+	return rs.r.query(rs.query, namedValues(args), func() (driver.Rows, error) {
+		return sqc.QueryContext(ctx, args)
+	})
+}
+
+// CheckNamedValue uses the statement's checker, or else the connection's,
+// since the sql package only asks the connection when the statement has
+// none.
+func (rs *recorderStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nvc, ok := rs.s.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	if nvc, ok := rs.c.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// positionalValues makes the checks the sql package makes before running a
+// statement that doesn't take a context, and returns the values of args.
+func positionalValues(ctx context.Context, args []driver.NamedValue) ([]driver.Value, error) {
+	for _, a := range args {
+		if a.Name != "" {
+			return nil, errors.New("sql: driver does not support the use of Named Parameters")
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return namedValues(args), nil
+}
+
+func entry(query string, args []driver.Value) Entry {
+	return Entry{
+		Fingerprint: dbtimer.Fingerprint(query),
+		Query:       query,
+		Args:        encodeValues(args),
+	}
+}
+
+// exec records the statement run by run.
+func (r *Recorder) exec(query string, args []driver.Value, run func() (driver.Result, error)) (driver.Result, error) {
+	e := entry(query, args)
+	res, err := run()
+	if err != nil {
+		e.setErr(err)
+		r.record(e)
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err == nil {
+		e.RowsAffected = &n
+	}
+	if id, err := res.LastInsertId(); err == nil {
+		e.LastInsertID = &id
+	}
+	r.record(e)
+	return res, nil
+}
+
+// query reads every row of the result of run into the recording, then
+// serves the rows from memory. Rows that fail part way are recorded up to
+// the failure, and served failing at the same place.
+func (r *Recorder) query(query string, args []driver.Value, run func() (driver.Rows, error)) (driver.Rows, error) {
+	e := entry(query, args)
+	rows, err := run()
+	if err != nil {
+		e.setErr(err)
+		r.record(e)
+		return nil, err
+	}
+	defer rows.Close()
+	e.Columns = rows.Columns()
+	for {
+		dest := make([]driver.Value, len(e.Columns))
+		err := rows.Next(dest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			e.setErr(err)
+			e.ErrAfterRows = true
+			r.record(e)
+			rr, derr := newReplayRows(e)
+			if derr != nil {
+				return nil, derr
+			}
+			rr.err = err
+			return rr, nil
+		}
+		e.Rows = append(e.Rows, encodeValues(dest))
+	}
+	r.record(e)
+	return newReplayRows(e)
+}
+
+// Replayer is a driver.Driver that answers statements from a Recording
+// instead of a database. Statements are matched by fingerprint and
+// arguments; when the same statement was recorded more than once, the
+// responses are served in the order they were recorded, and the last one is
+// repeated once they run out. A statement with no recorded response fails.
+//
+// The DSN passed to Open is ignored.
+type Replayer struct {
+	mu      sync.Mutex
+	entries map[string][]Entry
+}
+
+// NewReplayer returns a Replayer that serves the responses in r.
+func NewReplayer(r *Recording) *Replayer {
+	rp := &Replayer{entries: map[string][]Entry{}}
+	for _, e := range r.Entries {
+		k := replayKey(e.Fingerprint, e.Args)
+		rp.entries[k] = append(rp.entries[k], e)
+	}
+	return rp
+}
+
+// LoadReplayer returns a Replayer that serves the recording at path.
+func LoadReplayer(path string) (*Replayer, error) {
+	r, err := LoadRecording(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewReplayer(r), nil
+}
+
+func replayKey(fingerprint string, args []Value) string {
+	b, _ := json.Marshal(args)
+	return fingerprint + "\x00" + string(b)
+}
+
+func (rp *Replayer) Open(name string) (driver.Conn, error) {
+	return replayConn{rp}, nil
+}
+
+func (rp *Replayer) next(query string, args []driver.Value) (Entry, error) {
+	k := replayKey(dbtimer.Fingerprint(query), encodeValues(args))
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	es := rp.entries[k]
+	if len(es) == 0 {
+		return Entry{}, fmt.Errorf("dbtimertest: no recorded response for %q with args %v", query, args)
+	}
+	e := es[0]
+	if len(es) > 1 {
+		rp.entries[k] = es[1:]
+	}
+	if err := e.err(); err != nil && !e.ErrAfterRows {
+		return Entry{}, err
+	}
+	return e, nil
+}
+
+type replayConn struct {
+	rp *Replayer
+}
+
+func (rc replayConn) Prepare(query string) (driver.Stmt, error) {
+	return replayStmt{rc.rp, query}, nil
+}
+
+func (rc replayConn) Close() error {
+	return nil
+}
+
+func (rc replayConn) Begin() (driver.Tx, error) {
+	return replayTx{}, nil
+}
+
+type replayTx struct{}
+
+func (replayTx) Commit() error {
+	return nil
+}
+
+func (replayTx) Rollback() error {
+	return nil
+}
+
+type replayStmt struct {
+	rp    *Replayer
+	query string
+}
+
+func (rs replayStmt) Close() error {
+	return nil
+}
+
+func (rs replayStmt) NumInput() int {
+	return -1
+}
+
+func (rs replayStmt) Exec(args []driver.Value) (driver.Result, error) {
+	e, err := rs.rp.next(rs.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return replayResult{e}, nil
+}
+
+func (rs replayStmt) Query(args []driver.Value) (driver.Rows, error) {
+	e, err := rs.rp.next(rs.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return newReplayRows(e)
+}
+
+type replayResult struct {
+	e Entry
+}
+
+func (r replayResult) LastInsertId() (int64, error) {
+	if r.e.LastInsertID == nil {
+		return 0, errors.New("dbtimertest: no LastInsertId was recorded")
+	}
+	return *r.e.LastInsertID, nil
+}
+
+func (r replayResult) RowsAffected() (int64, error) {
+	if r.e.RowsAffected == nil {
+		return 0, errors.New("dbtimertest: no RowsAffected was recorded")
+	}
+	return *r.e.RowsAffected, nil
+}
+
+// replayRows serves recorded rows, then err, or io.EOF if there is none.
+type replayRows struct {
+	columns []string
+	rows    [][]driver.Value
+	err     error
+}
+
+func newReplayRows(e Entry) (*replayRows, error) {
+	rows := make([][]driver.Value, len(e.Rows))
+	for i, row := range e.Rows {
+		rows[i] = make([]driver.Value, len(row))
+		for j, v := range row {
+			dv, err := v.decode()
+			if err != nil {
+				return nil, err
+			}
+			rows[i][j] = dv
+		}
+	}
+	rr := &replayRows{columns: e.Columns, rows: rows}
+	if e.ErrAfterRows {
+		rr.err = e.err()
+	}
+	return rr, nil
+}
+
+func (rr *replayRows) Columns() []string {
+	return rr.columns
+}
+
+func (rr *replayRows) Close() error {
+	return nil
+}
+
+func (rr *replayRows) Next(dest []driver.Value) error {
+	if len(rr.rows) == 0 {
+		if rr.err != nil {
+			return rr.err
+		}
+		return io.EOF
+	}
+	copy(dest, rr.rows[0])
+	rr.rows = rr.rows[1:]
+	return nil
+}
@@ -0,0 +1,129 @@
+package dbtimer
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// dsnFormats describes the connection strings the timer driver accepts, for
+// error messages.
+const dsnFormats = `"<driver> <dsn>", "timer:<driver>:<dsn>" or "timer+<driver>://..."`
+
+// parseDSN splits a timer connection string into the underlying driver and its
+// DSN. Three forms are accepted:
+//
+//	postgres postgres://localhost/app
+//	timer:postgres:host=localhost dbname=app
+//	timer+postgres://localhost/app
+//
+// In the last form the DSN is the URL with "timer+" removed, which suits
+// drivers whose DSNs are URLs. The second form passes the DSN through
+// untouched, whatever it contains.
+func parseDSN(name string) (string, string, error) {
+	switch {
+	case strings.HasPrefix(name, "timer:"):
+		parts := strings.SplitN(strings.TrimPrefix(name, "timer:"), ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return "", "", dsnError("no driver name after timer:")
+		}
+		return parts[0], parts[1], nil
+	case strings.HasPrefix(name, "timer+"):
+		dsn := strings.TrimPrefix(name, "timer+")
+		i := strings.Index(dsn, "://")
+		if i <= 0 {
+			return "", "", dsnError("no scheme after timer+")
+		}
+		return dsn[:i], dsn, nil
+	}
+	parts := strings.SplitN(name, " ", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", dsnError("no driver name")
+	}
+	return parts[0], parts[1], nil
+}
+
+// dsnError leaves the connection string out, since it may hold a password.
+func dsnError(problem string) error {
+	return &Error{Kind: ErrConfig, Err: fmt.Errorf("bad timer connection string: %s; expected %s", problem, dsnFormats)}
+}
+
+// dsnShapes maps the shape of a DSN to the drivers commonly registered for it.
+var dsnShapes = []struct {
+	match   func(dsn string) bool
+	drivers []string
+}{
+	{hasPrefix("postgres://", "postgresql://"), []string{"postgres", "pgx"}},
+	{hasPrefix("mysql://"), []string{"mysql"}},
+	{isMySQL, []string{"mysql"}},
+	{hasPrefix("sqlserver://"), []string{"sqlserver"}},
+	{isSQLite, []string{"sqlite3", "sqlite"}},
+}
+
+func hasPrefix(prefixes ...string) func(string) bool {
+	return func(dsn string) bool {
+		for _, p := range prefixes {
+			if strings.HasPrefix(dsn, p) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// isMySQL matches go-sql-driver/mysql's [user[:password]@][net[(addr)]]/dbname
+// format with a tcp or unix network.
+func isMySQL(dsn string) bool {
+	return strings.Contains(dsn, "@tcp(") || strings.Contains(dsn, "@unix(") ||
+		strings.HasPrefix(dsn, "tcp(") || strings.HasPrefix(dsn, "unix(")
+}
+
+func isSQLite(dsn string) bool {
+	if strings.HasPrefix(dsn, "file:") || dsn == ":memory:" {
+		return true
+	}
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		dsn = dsn[:i]
+	}
+	return strings.HasSuffix(dsn, ".db") || strings.HasSuffix(dsn, ".sqlite") || strings.HasSuffix(dsn, ".sqlite3")
+}
+
+// detectDriver infers the underlying driver from the shape of dsn, choosing
+// among the drivers that are registered.
+func detectDriver(dsn string) (string, error) {
+	registered := sql.Drivers()
+	isRegistered := func(name string) bool {
+		for _, r := range registered {
+			if r == name {
+				return true
+			}
+		}
+		return false
+	}
+	for _, shape := range dsnShapes {
+		if !shape.match(dsn) {
+			continue
+		}
+		var found []string
+		for _, name := range shape.drivers {
+			if isRegistered(name) {
+				found = append(found, name)
+			}
+		}
+		switch len(found) {
+		case 1:
+			return found[0], nil
+		case 0:
+			return "", dsnError(fmt.Sprintf("the DSN looks like one for %s, but that driver isn't registered", strings.Join(shape.drivers, " or ")))
+		default:
+			return "", dsnError(fmt.Sprintf("the DSN could be for any of %s", strings.Join(found, ", ")))
+		}
+	}
+	var candidates []string
+	for _, r := range registered {
+		if !strings.HasPrefix(r, "timer") {
+			candidates = append(candidates, r)
+		}
+	}
+	return "", dsnError(fmt.Sprintf("the driver can't be told from the DSN; name one of %s", strings.Join(candidates, ", ")))
+}
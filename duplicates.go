@@ -0,0 +1,163 @@
+package dbtimer
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DuplicateTracker is a TimerLogger that finds reads a request runs more than
+// once with the same query text and the same arguments, whose results it
+// could have kept instead of asking again. Requests are told apart by the
+// request tag, as set with WithTag; statements without one are ignored. The
+// tracker keeps the reads of its most recent MaxRequests requests, and
+// totals the repeats by fingerprint, with the time spent on them.
+//
+// Arguments are compared as the events carry them, so with SetRedactArgs or
+// compliance mode reads that differ only in their arguments look the same.
+type DuplicateTracker struct {
+	// RequestKey is the tag that identifies a request. The default is
+	// "request".
+	RequestKey string
+
+	// MaxRequests is the number of requests whose reads are remembered.
+	// The default is 10000.
+	MaxRequests int
+
+	// OnDuplicate, if set, is called each time a request repeats a read.
+	OnDuplicate func(Duplicate)
+
+	mu       sync.Mutex
+	requests map[string]map[string]*repeatedRead
+	order    []string
+	byFP     map[string]*DuplicateStats
+}
+
+// Duplicate is a read a request has now run Count times, which has spent
+// Wasted on the runs after the first.
+type Duplicate struct {
+	Request string
+	Query   string
+	Args    []driver.Value
+	Count   int
+	Wasted  time.Duration
+}
+
+// DuplicateStats is the total of the repeated reads of one fingerprint.
+// Requests is the number of requests that repeated one of its reads, Repeats
+// the runs after the first in each, and Wasted the time those took. Query
+// and Args are an example of a repeated read.
+type DuplicateStats struct {
+	Fingerprint string
+	Requests    int64
+	Repeats     int64
+	Wasted      time.Duration
+	Query       string
+	Args        []driver.Value
+}
+
+type repeatedRead struct {
+	count  int
+	wasted time.Duration
+}
+
+// Log records ti if it is a read with a request tag, and counts it as a
+// duplicate if its request already ran it.
+func (dt *DuplicateTracker) Log(ti TimerInfo) {
+	key := dt.RequestKey
+	if key == "" {
+		key = "request"
+	}
+	request := ti.Tags[key]
+	if request == "" || !runsStatement(ti.Method) || ti.Query == "" || ti.Err != nil || !isRead(ti.Query) {
+		return
+	}
+	read := readKey(ti.Query, ti.Args)
+	var dup *Duplicate
+	dt.mu.Lock()
+	if dt.requests == nil {
+		dt.requests = map[string]map[string]*repeatedRead{}
+		dt.byFP = map[string]*DuplicateStats{}
+	}
+	reads, ok := dt.requests[request]
+	if !ok {
+		max := dt.MaxRequests
+		if max <= 0 {
+			max = 10000
+		}
+		if len(dt.order) >= max {
+			delete(dt.requests, dt.order[0])
+			dt.order = dt.order[1:]
+		}
+		dt.order = append(dt.order, request)
+		reads = map[string]*repeatedRead{}
+		dt.requests[request] = reads
+	}
+	rr := reads[read]
+	if rr == nil {
+		reads[read] = &repeatedRead{count: 1}
+		dt.mu.Unlock()
+		return
+	}
+	d := ti.Elapsed()
+	rr.count++
+	rr.wasted += d
+	fp := Fingerprint(ti.Query)
+	ds := dt.byFP[fp]
+	if ds == nil {
+		ds = &DuplicateStats{Fingerprint: fp, Query: ti.Query, Args: ti.Args}
+		dt.byFP[fp] = ds
+	}
+	if rr.count == 2 {
+		ds.Requests++
+	}
+	ds.Repeats++
+	ds.Wasted += d
+	if dt.OnDuplicate != nil {
+		dup = &Duplicate{Request: request, Query: ti.Query, Args: ti.Args, Count: rr.count, Wasted: rr.wasted}
+	}
+	dt.mu.Unlock()
+	if dup != nil {
+		dt.OnDuplicate(*dup)
+	}
+}
+
+// readKey identifies a read by its query text and arguments.
+func readKey(query string, args []driver.Value) string {
+	var sb strings.Builder
+	sb.WriteString(query)
+	for _, a := range args {
+		fmt.Fprintf(&sb, "\x00%T:%v", a, a)
+	}
+	return sb.String()
+}
+
+// Duplicates returns the repeated reads of each fingerprint seen since the
+// tracker was created or last reset, the most wasted time first.
+func (dt *DuplicateTracker) Duplicates() []DuplicateStats {
+	dt.mu.Lock()
+	out := make([]DuplicateStats, 0, len(dt.byFP))
+	for _, ds := range dt.byFP {
+		out = append(out, *ds)
+	}
+	dt.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Wasted != out[j].Wasted {
+			return out[i].Wasted > out[j].Wasted
+		}
+		return out[i].Fingerprint < out[j].Fingerprint
+	})
+	return out
+}
+
+// Reset forgets all requests and duplicates.
+func (dt *DuplicateTracker) Reset() {
+	dt.mu.Lock()
+	dt.requests = nil
+	dt.order = nil
+	dt.byFP = nil
+	dt.mu.Unlock()
+}
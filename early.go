@@ -0,0 +1,86 @@
+package dbtimer
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// maxEarlyEvents bounds the events kept before a TimerLogger is set.
+const maxEarlyEvents = 1000
+
+// early holds the events logged before the first TimerLogger is set, such as
+// the "driver.Open" events of connections opened while a program starts, so
+// that they can be passed on to it rather than lost. Once the buffer is
+// full, or has been replayed or discarded, it stops accepting events, and
+// calls made with no logger set cost nothing again.
+var early struct {
+	accepting int32
+	mu        sync.Mutex
+	events    []TimerInfo
+	done      bool
+}
+
+func init() {
+	early.accepting = 1
+}
+
+// earlyBuffer is the TimerLogger that fills the buffer.
+type earlyBuffer struct{}
+
+// earlyLogger returns the buffer's logger, or nil if it no longer accepts
+// events.
+func earlyLogger() TimerLogger {
+	if atomic.LoadInt32(&early.accepting) == 0 {
+		return nil
+	}
+	return earlyBuffer{}
+}
+
+func (earlyBuffer) Log(ti TimerInfo) {
+	early.mu.Lock()
+	if early.done {
+		early.mu.Unlock()
+		// The buffer was replayed while the event was being made.
+		if tl := GetTimerLogger(); tl != nil {
+			logEvent(tl, ti)
+		}
+		return
+	}
+	early.events = append(early.events, ti)
+	full := len(early.events) >= maxEarlyEvents
+	if full {
+		atomic.StoreInt32(&early.accepting, 0)
+	}
+	early.mu.Unlock()
+	if full {
+		handleError(&Error{Kind: ErrDropped, Err: errors.New("no TimerLogger is set and the buffer of early events is full")})
+	}
+}
+
+// replayEarly passes the buffered events to tl and closes the buffer.
+func replayEarly(tl TimerLogger) {
+	for _, ti := range takeEarly() {
+		logEvent(tl, ti)
+	}
+}
+
+// takeEarly closes the buffer and returns what it held.
+func takeEarly() []TimerInfo {
+	early.mu.Lock()
+	defer early.mu.Unlock()
+	atomic.StoreInt32(&early.accepting, 0)
+	if early.done {
+		return nil
+	}
+	early.done = true
+	events := early.events
+	early.events = nil
+	return events
+}
+
+// DiscardEarlyEvents drops the events logged before a TimerLogger was set,
+// and stops keeping them, for programs that don't want them replayed.
+func DiscardEarlyEvents() {
+	takeEarly()
+}
@@ -0,0 +1,94 @@
+package dbtimer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The environment variables read by the driver registered as "timer", so
+// that it can be configured in a container without changing code. Drivers
+// registered with RegisterTimer ignore them.
+const (
+	// EnvSlowThreshold is a duration, such as "200ms": the events of calls
+	// that took less time, and didn't fail, are not logged. See Sampling.
+	EnvSlowThreshold = "DBTIMER_SLOW_THRESHOLD"
+
+	// EnvSampleRate is the fraction of events logged, greater than 0 and at
+	// most 1. 0 is rejected rather than taken as Sampling's "no rate", which
+	// would log every event; use EnvDisabled to log none. See Sampling.
+	EnvSampleRate = "DBTIMER_SAMPLE_RATE"
+
+	// EnvRedactArgs, if true, leaves the arguments of calls out of events.
+	// See SetRedactArgs.
+	EnvRedactArgs = "DBTIMER_REDACT_ARGS"
+
+	// EnvCompliance, if true, turns on compliance mode. See
+	// SetComplianceMode.
+	EnvCompliance = "DBTIMER_COMPLIANCE"
+
+	// EnvDisabled, if true, has the driver log no events at all, while
+	// still passing calls through to the underlying driver.
+	EnvDisabled = "DBTIMER_DISABLED"
+)
+
+// driverFromEnv returns the default driver, configured by the environment
+// variables that getenv returns. Invalid values are ignored, and reported to
+// the error handler when the driver first opens a connection, since no
+// handler can have been set yet.
+func driverFromEnv(getenv func(string) string) *Driver {
+	d := &Driver{}
+	var problems []string
+	parseBool := func(name string) bool {
+		s := getenv(name)
+		if s == "" {
+			return false
+		}
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s=%q is not a boolean", name, s))
+		}
+		return v
+	}
+	var s Sampling
+	if v := getenv(EnvSlowThreshold); v != "" {
+		t, err := time.ParseDuration(v)
+		if err != nil || t < 0 {
+			problems = append(problems, fmt.Sprintf("%s=%q is not a duration", EnvSlowThreshold, v))
+		} else {
+			s.SlowThreshold = t
+		}
+	}
+	if v := getenv(EnvSampleRate); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r <= 0 || r > 1 {
+			problems = append(problems, fmt.Sprintf("%s=%q is not a rate greater than 0 and at most 1", EnvSampleRate, v))
+		} else {
+			s.Rate = r
+		}
+	}
+	if s.SlowThreshold != 0 || s.Rate != 0 {
+		d.SetSampling(&s)
+	}
+	d.SetRedactArgs(parseBool(EnvRedactArgs))
+	if parseBool(EnvCompliance) {
+		SetComplianceMode(true)
+	}
+	d.disabled = parseBool(EnvDisabled)
+	if len(problems) > 0 {
+		d.envErr = &Error{Kind: ErrConfig, Err: fmt.Errorf("ignored environment: %s", strings.Join(problems, "; "))}
+	}
+	return d
+}
+
+// reportEnv reports the problems with the environment variables the driver
+// was configured from, once.
+func (d *Driver) reportEnv() {
+	if d.envErr == nil {
+		return
+	}
+	d.envOnce.Do(func() {
+		handleError(d.envErr)
+	})
+}
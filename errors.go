@@ -0,0 +1,106 @@
+package dbtimer
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// The kinds of problem the timer reports to the error handler. Use errors.Is
+// to tell them apart.
+var (
+	ErrSink          = errors.New("dbtimer: sink failed")
+	ErrDropped       = errors.New("dbtimer: event dropped")
+	ErrSerialization = errors.New("dbtimer: event could not be serialized")
+	ErrConfig        = errors.New("dbtimer: invalid configuration")
+	ErrDegraded      = errors.New("dbtimer: driver lacks an optional interface")
+)
+
+// Error is an internal problem in the timer or one of its sinks. Kind is one
+// of ErrSink, ErrDropped, ErrSerialization, ErrConfig or ErrDegraded, and Err
+// is the underlying cause.
+type Error struct {
+	Kind error
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Kind.Error()
+	}
+	return e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// PanicError is passed to the error handler when a TimerLogger panics while
+// logging an event. The panic is recovered so that it doesn't escape into the
+// database call that produced the event.
+type PanicError struct {
+	Value interface{}
+	Info  TimerInfo
+	Stack []byte
+}
+
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("dbtimer: TimerLogger panicked while logging %s: %v", pe.Info.Method, pe.Value)
+}
+
+// Is reports a PanicError as a sink failure.
+func (pe *PanicError) Is(target error) bool {
+	return target == ErrSink
+}
+
+var errorHandler atomic.Value
+
+type errorHandlerHolder struct {
+	eh func(error)
+}
+
+// SetErrorHandler sets the function that is called with problems in the
+// timer itself: sink failures, dropped events, serialization errors,
+// misconfiguration and underlying drivers that lack optional interfaces. The
+// timer never writes these to stderr on its own; if no handler is set they
+// are discarded.
+//
+// The handler may be called from any goroutine, including the one making a
+// database call, so it must be safe for concurrent use and should return
+// quickly. SetErrorHandler itself is safe to call at any time.
+func SetErrorHandler(eh func(error)) {
+	errorHandler.Store(errorHandlerHolder{eh})
+}
+
+// ReportError passes an internal problem to the error handler, wrapped in an
+// *Error of the given kind. It is meant for TimerLogger implementations that
+// can fail, so that all of the timer's problems end up in one place.
+func ReportError(kind error, err error) {
+	handleError(&Error{Kind: kind, Err: err})
+}
+
+func handleError(err error) {
+	if h, _ := errorHandler.Load().(errorHandlerHolder); h.eh != nil {
+		h.eh(err)
+	}
+}
+
+// logEvent passes ti to the TimerLogger, recovering any panic so that the
+// result of the database call is unaffected.
+func logEvent(tl TimerLogger, ti TimerInfo) {
+	if ti.Duration == 0 {
+		// Start and End still have their monotonic readings here.
+		ti.Duration = ti.End.Sub(ti.Start)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			handleError(&PanicError{Value: r, Info: ti, Stack: debug.Stack()})
+		}
+	}()
+	tl.Log(ti)
+}
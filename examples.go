@@ -0,0 +1,139 @@
+package dbtimer
+
+import (
+	"database/sql/driver"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SlowExamples is a TimerLogger that keeps a few concrete executions of each
+// fingerprint, so that a report can show real examples of its slow calls
+// rather than only aggregate numbers. The examples are a random sample
+// weighted by duration, so the slowest executions are the most likely to be
+// kept, yet a fingerprint that is slow for one customer or one argument
+// still shows its other cases.
+//
+// Arguments are kept as the events carry them, so a driver's SetRedactArgs
+// and compliance mode apply; DropArgs leaves them out here as well.
+type SlowExamples struct {
+	// PerFingerprint is the number of examples kept of each fingerprint.
+	// The default is 5.
+	PerFingerprint int
+
+	// MaxFingerprints is the number of fingerprints kept. Once it is
+	// reached, new fingerprints are ignored. The default is 1000.
+	MaxFingerprints int
+
+	// DropArgs leaves the arguments out of the examples.
+	DropArgs bool
+
+	mu   sync.Mutex
+	kept map[string][]weightedExample
+}
+
+// SlowExample is one execution of a fingerprint.
+type SlowExample struct {
+	Query    string
+	Start    time.Time
+	Duration time.Duration
+	Args     []driver.Value
+	Tags     map[string]string
+	Err      error
+}
+
+type weightedExample struct {
+	key float64
+	ex  SlowExample
+}
+
+// Log offers the statement run by ti as an example of its fingerprint.
+// Events that don't run a statement are ignored.
+func (se *SlowExamples) Log(ti TimerInfo) {
+	if !runsStatement(ti.Method) || ti.Query == "" {
+		return
+	}
+	per := se.PerFingerprint
+	if per <= 0 {
+		per = 5
+	}
+	max := se.MaxFingerprints
+	if max <= 0 {
+		max = 1000
+	}
+	d := ti.Elapsed()
+	// The key of the weighted reservoir of Efraimidis and Spirakis, u^(1/d),
+	// as its logarithm: the examples with the largest keys are a sample
+	// weighted by duration.
+	key := math.Inf(-1)
+	if d > 0 {
+		key = math.Log(rand.Float64()) / float64(d)
+	}
+	fp := Fingerprint(ti.Query)
+	se.mu.Lock()
+	defer se.mu.Unlock()
+	if se.kept == nil {
+		se.kept = map[string][]weightedExample{}
+	}
+	kept, ok := se.kept[fp]
+	if !ok && len(se.kept) >= max {
+		return
+	}
+	low := -1
+	if len(kept) == per {
+		low = 0
+		for i, we := range kept {
+			if we.key < kept[low].key {
+				low = i
+			}
+		}
+		if key <= kept[low].key {
+			return
+		}
+	}
+	ex := SlowExample{Query: ti.Query, Start: ti.Start, Duration: d, Tags: ti.Tags, Err: ti.Err}
+	if !se.DropArgs {
+		ex.Args = ti.Args
+	}
+	if low < 0 {
+		se.kept[fp] = append(kept, weightedExample{key, ex})
+	} else {
+		kept[low] = weightedExample{key, ex}
+	}
+}
+
+// Examples returns the examples kept of the fingerprint fp, which is passed
+// through Fingerprint so that it may be written as a query, the slowest
+// first.
+func (se *SlowExamples) Examples(fp string) []SlowExample {
+	se.mu.Lock()
+	kept := se.kept[Fingerprint(fp)]
+	out := make([]SlowExample, len(kept))
+	for i, we := range kept {
+		out[i] = we.ex
+	}
+	se.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Duration > out[j].Duration })
+	return out
+}
+
+// Fingerprints returns the fingerprints that have examples, in order.
+func (se *SlowExamples) Fingerprints() []string {
+	se.mu.Lock()
+	out := make([]string, 0, len(se.kept))
+	for fp := range se.kept {
+		out = append(out, fp)
+	}
+	se.mu.Unlock()
+	sort.Strings(out)
+	return out
+}
+
+// Reset forgets the examples kept so far.
+func (se *SlowExamples) Reset() {
+	se.mu.Lock()
+	se.kept = nil
+	se.mu.Unlock()
+}
@@ -0,0 +1,126 @@
+package dbtimer
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// A Fault is an artificial problem injected into calls made through a Driver,
+// for testing how an application copes with a slow or failing database. The
+// real driver is still used for every call the fault doesn't affect.
+//
+// Set the faults for a Driver with SetFaults. The first fault that matches a
+// call is applied to it.
+type Fault struct {
+	// Methods limits the fault to calls to these methods, such as "conn.Exec"
+	// or "stmt.Query". If it is empty, the fault applies to the Exec and Query
+	// methods of connections and statements.
+	Methods []string
+
+	// Fingerprint limits the fault to statements with this fingerprint. The
+	// query is passed through Fingerprint, so it may be written as a plain
+	// query. If it is empty, the fault applies to every statement.
+	Fingerprint string
+
+	// Rate is the fraction of matching calls, between 0 and 1, that the fault
+	// affects. Set it to 1 to affect every matching call; a fault whose Rate
+	// is 0 affects none.
+	Rate float64
+
+	// Delay is added to the call before it is made. It ends early, failing
+	// the call with the context's error, if the call's context is done
+	// first, as a slow database would.
+	Delay time.Duration
+
+	// Latency, if not nil, adds a delay that varies over time to the call,
+	// on top of Delay. The profile's clock starts when SetFaults is called.
+	Latency LatencyProfile
+
+	// Err, if not nil, is returned instead of making the call, after Delay.
+	// Useful errors include driver.ErrBadConn and context.DeadlineExceeded.
+	Err error
+}
+
+func (f Fault) matches(method string, fingerprint func() string) bool {
+	if len(f.Methods) == 0 {
+		if !runsStatement(method) {
+			return false
+		}
+	} else if !contains(f.Methods, method) {
+		return false
+	}
+	if f.Fingerprint != "" && Fingerprint(f.Fingerprint) != fingerprint() {
+		return false
+	}
+	return f.Rate >= 1 || rand.Float64() < f.Rate
+}
+
+// SetFaults replaces the faults injected into calls made through d. Calling
+// it with no faults turns fault injection off. It is safe to call while d is
+// in use.
+func (d *Driver) SetFaults(faults ...Fault) {
+	fs := make([]Fault, len(faults))
+	copy(fs, faults)
+	d.faults.Store(faultSet{fs, d.now()})
+}
+
+type faultSet struct {
+	faults []Fault
+	start  time.Time
+}
+
+// injectFault applies the first fault that matches the call, returning the
+// error to report in place of making the call, if any. A delay ends early,
+// with ctx's error, when ctx is done.
+func (d *Driver) injectFault(ctx context.Context, method string, query string) error {
+	set, _ := d.faults.Load().(faultSet)
+	if len(set.faults) == 0 {
+		return nil
+	}
+	var fp string
+	fingerprint := func() string {
+		if fp == "" {
+			fp = Fingerprint(query)
+		}
+		return fp
+	}
+	for _, f := range set.faults {
+		if !f.matches(method, fingerprint) {
+			continue
+		}
+		delay := f.Delay
+		if f.Latency != nil {
+			delay += f.Latency.Latency(d.now().Sub(set.start))
+		}
+		if delay > 0 {
+			t := time.NewTimer(delay)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			}
+		}
+		return f.Err
+	}
+	return nil
+}
+
+// runsStatement reports whether method executes a statement, as opposed to
+// preparing one or managing connections and transactions. Bulk loads count as
+// statements.
+func runsStatement(method string) bool {
+	return strings.HasSuffix(method, ".Exec") || strings.HasSuffix(method, ".Query") ||
+		method == "conn.CopyIn" || method == "conn.LoadData"
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
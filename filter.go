@@ -0,0 +1,117 @@
+package dbtimer
+
+import (
+	"context"
+	"regexp"
+)
+
+// QueryFilter decides which statements are logged at all, for example to
+// leave out a health check's SELECT 1, or to log only the statements that
+// touch one table.
+//
+// Allow and Deny are regular expressions matched against the query text, and
+// AllowFingerprints and DenyFingerprints are compared with the query's
+// fingerprint (they are passed through Fingerprint, so they may be written as
+// plain queries). A statement matching any deny rule is not logged. If there
+// are allow rules, a statement must match one of them to be logged. Events
+// that have no query, such as "tx.Commit", are always logged.
+type QueryFilter struct {
+	Allow             []string
+	Deny              []string
+	AllowFingerprints []string
+	DenyFingerprints  []string
+}
+
+type compiledFilter struct {
+	allow, deny     []*regexp.Regexp
+	allowFP, denyFP map[string]bool
+}
+
+// SetQueryFilter replaces the filter that decides which of the statements
+// run through d are logged. It returns an error, and leaves the current
+// filter in place, if one of the regular expressions doesn't compile. The
+// zero QueryFilter logs everything. It is safe to call while d is in use.
+func (d *Driver) SetQueryFilter(qf QueryFilter) error {
+	var cf compiledFilter
+	var err error
+	if cf.allow, err = compileAll(qf.Allow); err != nil {
+		return &Error{Kind: ErrConfig, Err: err}
+	}
+	if cf.deny, err = compileAll(qf.Deny); err != nil {
+		return &Error{Kind: ErrConfig, Err: err}
+	}
+	cf.allowFP = fingerprintSet(qf.AllowFingerprints)
+	cf.denyFP = fingerprintSet(qf.DenyFingerprints)
+	d.filter.Store(&cf)
+	return nil
+}
+
+// WithQueryFilter sets the filter of the driver's logged statements, as
+// SetQueryFilter does.
+func WithQueryFilter(qf QueryFilter) Option {
+	return func(d *Driver) error {
+		return d.SetQueryFilter(qf)
+	}
+}
+
+func compileAll(patterns []string) ([]*regexp.Regexp, error) {
+	var out []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, re)
+	}
+	return out, nil
+}
+
+func fingerprintSet(queries []string) map[string]bool {
+	if len(queries) == 0 {
+		return nil
+	}
+	out := make(map[string]bool, len(queries))
+	for _, q := range queries {
+		out[Fingerprint(q)] = true
+	}
+	return out
+}
+
+// shouldLog reports whether an event for query should be logged, given d's
+// filter and whether ctx was silenced or forced.
+func (d *Driver) shouldLog(ctx context.Context, query string) bool {
+	switch logModeFrom(ctx) {
+	case logSilenced:
+		return false
+	case logForced:
+		return true
+	}
+	cf, _ := d.filter.Load().(*compiledFilter)
+	if cf == nil || query == "" {
+		return true
+	}
+	var fp string
+	if cf.allowFP != nil || cf.denyFP != nil {
+		fp = Fingerprint(query)
+	}
+	if cf.denyFP[fp] {
+		return false
+	}
+	for _, re := range cf.deny {
+		if re.MatchString(query) {
+			return false
+		}
+	}
+	if len(cf.allow) == 0 && cf.allowFP == nil {
+		return true
+	}
+	if cf.allowFP[fp] {
+		return true
+	}
+	for _, re := range cf.allow {
+		if re.MatchString(query) {
+			return true
+		}
+	}
+	return false
+}
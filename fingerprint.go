@@ -0,0 +1,360 @@
+package dbtimer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Fingerprint returns a normalized form of query that is the same for every
+// execution of the same statement, no matter what values it was run with.
+//
+// Comments are removed, string and numeric literals and placeholders ($1,
+// :name, @p1) are replaced with ?, whitespace is collapsed, and unquoted
+// keywords and identifiers are lower-cased. The list in an IN (...) of only
+// values becomes (?+), and repeated rows after VALUES are reduced to the
+// first one, so that statements that differ only in how many values they
+// pass share a fingerprint.
+func Fingerprint(query string) string {
+	toks := tokenize(query)
+	toks = collapseLists(toks)
+	for len(toks) > 0 && toks[len(toks)-1].text == ";" {
+		toks = toks[:len(toks)-1]
+	}
+	return render(toks)
+}
+
+type tokenKind int
+
+const (
+	wordToken tokenKind = iota
+	valueToken
+	punctToken
+)
+
+type token struct {
+	kind        tokenKind
+	text        string
+	space       bool   // whitespace or a comment came before the token
+	literal     string // the original text of a literal value
+	placeholder bool
+}
+
+var operators = []string{"->>", "<=", ">=", "<>", "!=", "||", "::", "->", ":="}
+
+func tokenize(q string) []token {
+	var toks []token
+	space := false
+	emit := func(kind tokenKind, text string) {
+		toks = append(toks, token{kind: kind, text: text, space: space})
+		space = false
+	}
+	emitLiteral := func(literal string) {
+		toks = append(toks, token{kind: valueToken, text: "?", space: space, literal: literal})
+		space = false
+	}
+	emitPlaceholder := func() {
+		toks = append(toks, token{kind: valueToken, text: "?", space: space, placeholder: true})
+		space = false
+	}
+	for i := 0; i < len(q); {
+		c := q[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			space = true
+			i++
+		case c == '-' && strings.HasPrefix(q[i:], "--"):
+			end := strings.IndexByte(q[i:], '\n')
+			if end == -1 {
+				end = len(q) - i
+			}
+			i += end
+			space = true
+		case c == '/' && strings.HasPrefix(q[i:], "/*"):
+			end := strings.Index(q[i+2:], "*/")
+			if end == -1 {
+				i = len(q)
+			} else {
+				i += end + 4
+			}
+			space = true
+		case c == '\'':
+			start := i
+			i = skipString(q, i)
+			emitLiteral(q[start:i])
+		case c == '"' || c == '`':
+			end := strings.IndexByte(q[i+1:], c)
+			if end == -1 {
+				end = len(q) - i - 1
+			} else {
+				end++
+			}
+			emit(wordToken, q[i:i+end+1])
+			i += end + 1
+		case isDigit(c) || (c == '.' && i+1 < len(q) && isDigit(q[i+1])):
+			start := i
+			i = skipNumber(q, i)
+			emitLiteral(q[start:i])
+		case c == '?':
+			emitPlaceholder()
+			i++
+		case c == '$' && i+1 < len(q) && isDigit(q[i+1]):
+			i++
+			for i < len(q) && isDigit(q[i]) {
+				i++
+			}
+			emitPlaceholder()
+		case c == '$' && dollarTag(q[i:]) != "":
+			start := i
+			tag := dollarTag(q[i:])
+			end := strings.Index(q[i+len(tag):], tag)
+			if end == -1 {
+				i = len(q)
+			} else {
+				i += len(tag) + end + len(tag)
+			}
+			emitLiteral(q[start:i])
+		case (c == ':' || c == '@') && i+1 < len(q) && isIdentStart(q[i+1]) && !(i > 0 && q[i-1] == ':'):
+			i++
+			for i < len(q) && isIdentPart(q[i]) {
+				i++
+			}
+			emitPlaceholder()
+		case isIdentStart(c):
+			start := i
+			for i < len(q) && isIdentPart(q[i]) {
+				i++
+			}
+			// E'...', N'...', X'...' and B'...' are prefixed string literals.
+			if i-start == 1 && i < len(q) && q[i] == '\'' && strings.IndexByte("eEnNxXbB", c) != -1 {
+				i = skipString(q, i)
+				emitLiteral(q[start:i])
+				continue
+			}
+			emit(wordToken, strings.ToLower(q[start:i]))
+		default:
+			op := q[i : i+1]
+			for _, o := range operators {
+				if strings.HasPrefix(q[i:], o) {
+					op = o
+					break
+				}
+			}
+			emit(punctToken, op)
+			i += len(op)
+		}
+	}
+	return toks
+}
+
+// skipString returns the index just past the quoted string starting at q[i].
+func skipString(q string, i int) int {
+	for i++; i < len(q); i++ {
+		switch q[i] {
+		case '\\':
+			i++
+		case '\'':
+			if i+1 < len(q) && q[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(q)
+}
+
+// skipNumber returns the index just past the numeric literal starting at q[i].
+func skipNumber(q string, i int) int {
+	if strings.HasPrefix(q[i:], "0x") || strings.HasPrefix(q[i:], "0X") {
+		i += 2
+		for i < len(q) && strings.IndexByte("0123456789abcdefABCDEF", q[i]) != -1 {
+			i++
+		}
+		return i
+	}
+	for i < len(q) && (isDigit(q[i]) || q[i] == '.') {
+		i++
+	}
+	if i < len(q) && (q[i] == 'e' || q[i] == 'E') {
+		j := i + 1
+		if j < len(q) && (q[j] == '+' || q[j] == '-') {
+			j++
+		}
+		if j < len(q) && isDigit(q[j]) {
+			i = j
+			for i < len(q) && isDigit(q[i]) {
+				i++
+			}
+		}
+	}
+	return i
+}
+
+// dollarTag returns the opening tag of a PostgreSQL dollar-quoted string
+// ($$ or $name$) at the start of q, or "" if there isn't one.
+func dollarTag(q string) string {
+	for i := 1; i < len(q); i++ {
+		if q[i] == '$' {
+			return q[:i+1]
+		}
+		if !isIdentPart(q[i]) {
+			return ""
+		}
+	}
+	return ""
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c) || c == '$'
+}
+
+// collapseLists rewrites IN lists of values to (?+) and drops VALUES rows
+// that repeat the first row.
+func collapseLists(toks []token) []token {
+	out := make([]token, 0, len(toks))
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		out = append(out, t)
+		if t.kind != wordToken || i+1 >= len(toks) || toks[i+1].text != "(" {
+			continue
+		}
+		switch t.text {
+		case "in":
+			end := valueListEnd(toks, i+1)
+			if end == -1 {
+				continue
+			}
+			out = append(out, toks[i+1], token{kind: valueToken, text: "?+"}, toks[end])
+			i = end
+		case "values":
+			end := groupEnd(toks, i+1)
+			if end == -1 {
+				continue
+			}
+			row := toks[i+1 : end+1]
+			out = append(out, row...)
+			i = end
+			for i+1 < len(toks) && toks[i+1].text == "," {
+				next := groupEnd(toks, i+2)
+				if next == -1 || !sameTokens(row, toks[i+2:next+1]) {
+					break
+				}
+				i = next
+			}
+		}
+	}
+	return out
+}
+
+// valueListEnd returns the index of the ) closing the ( at toks[start] if
+// everything between them is values separated by commas, or -1.
+func valueListEnd(toks []token, start int) int {
+	want := valueToken
+	for i := start + 1; i < len(toks); i++ {
+		t := toks[i]
+		switch {
+		case t.text == ")" && want == punctToken:
+			return i
+		case want == valueToken && t.kind == valueToken:
+			want = punctToken
+		case want == punctToken && t.text == ",":
+			want = valueToken
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// groupEnd returns the index of the ) matching the ( at toks[start], or -1.
+func groupEnd(toks []token, start int) int {
+	if start >= len(toks) || toks[start].text != "(" {
+		return -1
+	}
+	depth := 0
+	for i := start; i < len(toks); i++ {
+		switch toks[i].text {
+		case "(":
+			depth++
+		case ")":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func sameTokens(a, b []token) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].text != b[i].text {
+			return false
+		}
+	}
+	return true
+}
+
+func isComparison(t token) bool {
+	switch t.text {
+	case "=", "<", ">", "<=", ">=", "<>", "!=":
+		return t.kind == punctToken
+	}
+	return false
+}
+
+func render(toks []token) string {
+	var sb strings.Builder
+	for i, t := range toks {
+		if i > 0 && needSpace(toks[i-1], t) {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(t.text)
+	}
+	return sb.String()
+}
+
+func needSpace(prev, t token) bool {
+	switch {
+	case prev.text == "(" || prev.text == ".":
+		return false
+	case t.text == ")" || t.text == "," || t.text == "." || t.text == ";":
+		return false
+	case prev.text == ",":
+		return true
+	case isComparison(prev) || isComparison(t):
+		return true
+	}
+	return t.space
+}
+
+// Table returns the first table named in query, after FROM, INTO, UPDATE,
+// JOIN or TABLE, or "" if it names none. It is read from the query's
+// fingerprint, so it is lower case and unquoted, and keeps its schema if it
+// has one.
+func Table(query string) string {
+	return statementTable(Fingerprint(query))
+}
+
+var tableRE = regexp.MustCompile(`\b(?:from|into|update|join|table)\s+((?:[\w"` + "`" + `]+\.)?["` + "`" + `]?\w+)`)
+
+// statementTable returns the first table named in the fingerprint fp, or ""
+// if it names none.
+func statementTable(fp string) string {
+	m := tableRE.FindStringSubmatch(fp)
+	if m == nil {
+		return ""
+	}
+	return strings.NewReplacer(`"`, "", "`", "").Replace(m[1])
+}
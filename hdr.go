@@ -0,0 +1,223 @@
+package dbtimer
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"sync"
+	"time"
+)
+
+// HDRLog is a TimerLogger that writes the latency of the statements that run
+// as an HdrHistogram interval log, the format written by Java's
+// HistogramLogWriter. Each line holds a compressed histogram of one interval,
+// so the log can be fed to HistogramLogProcessor, HdrHistogram's plotter or
+// any other hdrhistogram tooling.
+//
+// Latencies are recorded in nanoseconds with three significant digits, up to
+// an hour; Interval_Max is written in milliseconds. An interval is written
+// when the first event of a later interval arrives, and by Flush.
+type HDRLog struct {
+	// Writer is where the log is written.
+	Writer io.Writer
+
+	// Interval is the length of each histogram. The default is one second.
+	Interval time.Duration
+
+	// Tag, if set, is written on every line. It can't contain commas or
+	// whitespace.
+	Tag string
+
+	mu       sync.Mutex
+	base     time.Time
+	curStart time.Time
+	cur      *hdrHistogram
+}
+
+// Log records the latency of ti. Events that don't run a statement are
+// ignored.
+func (hl *HDRLog) Log(ti TimerInfo) {
+	if !runsStatement(ti.Method) {
+		return
+	}
+	interval := hl.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	start := ti.Start.Truncate(interval)
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+	if hl.cur != nil && start.After(hl.curStart) {
+		if err := hl.flush(); err != nil {
+			handleError(&Error{Kind: ErrSink, Err: err})
+		}
+	}
+	if hl.cur == nil {
+		hl.cur = newHDRHistogram()
+		hl.curStart = start
+	}
+	hl.cur.record(int64(ti.Elapsed()))
+}
+
+// Flush writes the current interval, if anything was recorded in it.
+func (hl *HDRLog) Flush() error {
+	hl.mu.Lock()
+	defer hl.mu.Unlock()
+	return hl.flush()
+}
+
+func (hl *HDRLog) flush() error {
+	h := hl.cur
+	if h == nil {
+		return nil
+	}
+	hl.cur = nil
+	if hl.base.IsZero() {
+		hl.base = hl.curStart
+		secs := float64(hl.base.UnixNano()) / 1e9
+		_, err := fmt.Fprintf(hl.Writer, "#[Histogram log format version 1.3]\n"+
+			"#[StartTime: %.3f (seconds since epoch), %s]\n"+
+			"#[BaseTime: %.3f (seconds since epoch)]\n"+
+			"\"StartTimestamp\",\"Interval_Length\",\"Interval_Max\",\"Interval_Compressed_Histogram\"\n",
+			secs, hl.base.Format(time.UnixDate), secs)
+		if err != nil {
+			return err
+		}
+	}
+	enc, err := h.encodeCompressed()
+	if err != nil {
+		return err
+	}
+	interval := hl.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	tag := ""
+	if hl.Tag != "" {
+		tag = "Tag=" + hl.Tag + ","
+	}
+	_, err = fmt.Fprintf(hl.Writer, "%s%.3f,%.3f,%.3f,%s\n", tag,
+		hl.curStart.Sub(hl.base).Seconds(), interval.Seconds(),
+		float64(h.max)/1e6, base64.StdEncoding.EncodeToString(enc))
+	return err
+}
+
+// hdrHistogram is the subset of an HdrHistogram needed to record values and
+// write them in the V2 compressed encoding. It tracks values from 1 to an
+// hour in nanoseconds with three significant digits.
+type hdrHistogram struct {
+	counts []int64
+	max    int64
+}
+
+const (
+	hdrSignificantDigits     = 3
+	hdrHighest               = int64(time.Hour)
+	hdrSubBucketCountMag     = 11 // ceil(log2(2 * 10^hdrSignificantDigits))
+	hdrSubBucketHalfCountMag = hdrSubBucketCountMag - 1
+	hdrSubBucketCount        = 1 << hdrSubBucketCountMag
+	hdrSubBucketHalfCount    = hdrSubBucketCount / 2
+	hdrSubBucketMask         = hdrSubBucketCount - 1
+
+	hdrEncodingCookie           = 0x1c849303 | 0x10
+	hdrCompressedEncodingCookie = 0x1c849304 | 0x10
+)
+
+func newHDRHistogram() *hdrHistogram {
+	buckets := 1
+	for v := int64(hdrSubBucketCount); v <= hdrHighest; v <<= 1 {
+		buckets++
+	}
+	return &hdrHistogram{counts: make([]int64, (buckets+1)*hdrSubBucketHalfCount)}
+}
+
+func hdrIndex(v int64) int {
+	bucket := 64 - hdrSubBucketCountMag - bits.LeadingZeros64(uint64(v|hdrSubBucketMask))
+	sub := int(v >> uint(bucket))
+	return (bucket+1)<<hdrSubBucketHalfCountMag + sub - hdrSubBucketHalfCount
+}
+
+func (h *hdrHistogram) record(v int64) {
+	if v < 0 {
+		v = 0
+	}
+	if v > hdrHighest {
+		v = hdrHighest
+	}
+	h.counts[hdrIndex(v)]++
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// encodeCompressed returns the histogram in HdrHistogram's V2 compressed
+// encoding: a zlib-compressed V2 encoding behind an eight-byte header.
+func (h *hdrHistogram) encodeCompressed() ([]byte, error) {
+	var payload bytes.Buffer
+	limit := hdrIndex(h.max) + 1
+	var buf [binary.MaxVarintLen64]byte
+	for i := 0; i < limit; {
+		c := h.counts[i]
+		i++
+		if c == 0 {
+			zeros := int64(1)
+			for i < limit && h.counts[i] == 0 {
+				zeros++
+				i++
+			}
+			if zeros > 1 {
+				c = -zeros
+			}
+		}
+		payload.Write(buf[:putZigZag(buf[:], c)])
+	}
+
+	var enc bytes.Buffer
+	hdr := []interface{}{
+		int32(hdrEncodingCookie),
+		int32(payload.Len()),
+		int32(0), // normalizing index offset
+		int32(hdrSignificantDigits),
+		int64(1), // lowest discernible value
+		hdrHighest,
+		math.Float64bits(1), // integer to double value conversion ratio
+	}
+	for _, v := range hdr {
+		binary.Write(&enc, binary.BigEndian, v)
+	}
+	payload.WriteTo(&enc)
+
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(enc.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	out := make([]byte, 8, 8+compressed.Len())
+	binary.BigEndian.PutUint32(out, hdrCompressedEncodingCookie)
+	binary.BigEndian.PutUint32(out[4:], uint32(compressed.Len()))
+	return append(out, compressed.Bytes()...), nil
+}
+
+// putZigZag writes v to buf as HdrHistogram's ZigZag LEB128, which uses at
+// most nine bytes, and returns the number of bytes written.
+func putZigZag(buf []byte, v int64) int {
+	u := uint64(v<<1) ^ uint64(v>>63)
+	for i := 0; i < 8; i++ {
+		if u>>7 == 0 {
+			buf[i] = byte(u)
+			return i + 1
+		}
+		buf[i] = byte(u&0x7f | 0x80)
+		u >>= 7
+	}
+	buf[8] = byte(u)
+	return 9
+}
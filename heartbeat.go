@@ -0,0 +1,240 @@
+package dbtimer
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Heartbeat runs a lightweight query against each of its targets on an
+// interval, and records their availability and latency apart from the
+// application's own calls. Workload latency rises and falls with what the
+// application asks for; a heartbeat asks for the same thing every time, so
+// it shows the health of the database and the path to it, and it keeps
+// measuring while the application is idle.
+//
+// Heartbeats are silenced, so they stay out of the loggers and stats of the
+// workload, unless LogBeats is set.
+type Heartbeat struct {
+	Targets []HeartbeatTarget
+
+	// Buckets are the upper bounds of the latency histograms. If it is
+	// empty, DefaultBuckets is used.
+	Buckets []time.Duration
+
+	// LogBeats logs the heartbeats like any other call, with the target's
+	// name in the "heartbeat" tag.
+	LogBeats bool
+
+	// OnBeat, if set, is called with the result of each heartbeat.
+	OnBeat func(Beat)
+
+	mu      sync.Mutex
+	targets map[string]*heartbeatStats
+}
+
+// HeartbeatTarget is one database a Heartbeat probes.
+type HeartbeatTarget struct {
+	// Name identifies the target in reports and metrics.
+	Name string
+
+	DB *sql.DB
+
+	// Query is run for each heartbeat. If it is empty, the database is
+	// pinged instead.
+	Query string
+
+	// Interval is the time between heartbeats. The default is ten seconds.
+	Interval time.Duration
+
+	// Timeout limits how long a heartbeat may take before it counts as a
+	// failure. The default is five seconds.
+	Timeout time.Duration
+}
+
+// Beat is the result of one heartbeat.
+type Beat struct {
+	Target  string
+	Start   time.Time
+	Latency time.Duration
+	Err     error
+}
+
+// HeartbeatReport is the results of the heartbeats of one target so far.
+// Availability is the fraction of them that succeeded, and Latency counts
+// the ones that did.
+type HeartbeatReport struct {
+	Target       string
+	Beats        int64
+	Failed       int64
+	Availability float64
+	Last         Beat
+	Latency      Histogram
+	total        time.Duration
+}
+
+type heartbeatStats struct {
+	beats   int64
+	failed  int64
+	last    Beat
+	latency Histogram
+	total   time.Duration
+}
+
+// Run sends heartbeats to every target, each on its own interval, until ctx
+// is done, and returns ctx's error. It is an ErrConfig error if a target has
+// no name or no DB, or two targets have the same name.
+func (hb *Heartbeat) Run(ctx context.Context) error {
+	seen := map[string]bool{}
+	for _, t := range hb.Targets {
+		if t.Name == "" || t.DB == nil {
+			return &Error{Kind: ErrConfig, Err: errors.New("heartbeat target needs a Name and a DB")}
+		}
+		if seen[t.Name] {
+			return &Error{Kind: ErrConfig, Err: fmt.Errorf("heartbeat target %q is listed twice", t.Name)}
+		}
+		seen[t.Name] = true
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(hb.Targets))
+	for _, t := range hb.Targets {
+		go func(t HeartbeatTarget) {
+			defer wg.Done()
+			hb.run(ctx, t)
+		}(t)
+	}
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (hb *Heartbeat) run(ctx context.Context, t HeartbeatTarget) {
+	interval := t.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		hb.Beat(ctx, t)
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Beat sends one heartbeat to t, records it, and returns its result.
+func (hb *Heartbeat) Beat(ctx context.Context, t HeartbeatTarget) Beat {
+	timeout := t.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	if hb.LogBeats {
+		ctx = WithTag(ctx, "heartbeat", t.Name)
+	} else {
+		ctx = Silence(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	b := Beat{Target: t.Name, Start: time.Now()}
+	if t.Query == "" {
+		b.Err = t.DB.PingContext(ctx)
+	} else {
+		var rows *sql.Rows
+		rows, b.Err = t.DB.QueryContext(ctx, t.Query)
+		if b.Err == nil {
+			for rows.Next() {
+			}
+			b.Err = rows.Err()
+			rows.Close()
+		}
+	}
+	b.Latency = time.Since(b.Start)
+
+	hb.mu.Lock()
+	if hb.targets == nil {
+		hb.targets = map[string]*heartbeatStats{}
+	}
+	hs := hb.targets[t.Name]
+	if hs == nil {
+		hs = &heartbeatStats{latency: NewHistogram(hb.Buckets)}
+		hb.targets[t.Name] = hs
+	}
+	hs.beats++
+	if b.Err != nil {
+		hs.failed++
+	} else {
+		hs.latency.Observe(b.Latency)
+		hs.total += b.Latency
+	}
+	hs.last = b
+	hb.mu.Unlock()
+	if hb.OnBeat != nil {
+		hb.OnBeat(b)
+	}
+	return b
+}
+
+// Report returns the results of the heartbeats of each target so far, by
+// name.
+func (hb *Heartbeat) Report() []HeartbeatReport {
+	hb.mu.Lock()
+	out := make([]HeartbeatReport, 0, len(hb.targets))
+	for name, hs := range hb.targets {
+		out = append(out, HeartbeatReport{
+			Target:       name,
+			Beats:        hs.beats,
+			Failed:       hs.failed,
+			Availability: float64(hs.beats-hs.failed) / float64(hs.beats),
+			Last:         hs.last,
+			Latency:      hs.latency.clone(),
+			total:        hs.total,
+		})
+	}
+	hb.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Target < out[j].Target })
+	return out
+}
+
+// WritePrometheus writes the heartbeats' results in the Prometheus text
+// exposition format, labelled by target: a gauge dbtimer_heartbeat_up that
+// is 1 if the last heartbeat succeeded, counters dbtimer_heartbeat_total and
+// dbtimer_heartbeat_failures_total, and a histogram
+// dbtimer_heartbeat_duration_seconds of the latency of the heartbeats that
+// succeeded.
+func (hb *Heartbeat) WritePrometheus(w io.Writer) error {
+	report := hb.Report()
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# HELP dbtimer_heartbeat_up Whether the last heartbeat to the database succeeded.")
+	fmt.Fprintln(bw, "# TYPE dbtimer_heartbeat_up gauge")
+	for _, r := range report {
+		up := 1
+		if r.Last.Err != nil {
+			up = 0
+		}
+		fmt.Fprintf(bw, "dbtimer_heartbeat_up{target=\"%s\"} %d\n", promLabel(r.Target), up)
+	}
+	fmt.Fprintln(bw, "# HELP dbtimer_heartbeat_total Heartbeats sent to the database.")
+	fmt.Fprintln(bw, "# TYPE dbtimer_heartbeat_total counter")
+	for _, r := range report {
+		fmt.Fprintf(bw, "dbtimer_heartbeat_total{target=\"%s\"} %d\n", promLabel(r.Target), r.Beats)
+	}
+	fmt.Fprintln(bw, "# HELP dbtimer_heartbeat_failures_total Heartbeats to the database that failed.")
+	fmt.Fprintln(bw, "# TYPE dbtimer_heartbeat_failures_total counter")
+	for _, r := range report {
+		fmt.Fprintf(bw, "dbtimer_heartbeat_failures_total{target=\"%s\"} %d\n", promLabel(r.Target), r.Failed)
+	}
+	fmt.Fprintln(bw, "# HELP dbtimer_heartbeat_duration_seconds Latency of heartbeats to the database that succeeded.")
+	fmt.Fprintln(bw, "# TYPE dbtimer_heartbeat_duration_seconds histogram")
+	for _, r := range report {
+		writePromHistogram(bw, "dbtimer_heartbeat_duration_seconds", "target=\""+promLabel(r.Target)+"\"", r.Latency, r.Beats-r.Failed, r.total)
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,180 @@
+package dbtimer
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"time"
+)
+
+// Heatmap is a sequence of interval latency histograms that can be written as
+// a self-contained HTML page, with time across and latency buckets up the
+// side, for sharing in an incident review.
+type Heatmap struct {
+	Title    string
+	Interval time.Duration
+	Columns  []IntervalStats
+}
+
+// HeatmapFromStats returns a heatmap of the intervals recorded by s, which
+// must have its Interval set.
+func HeatmapFromStats(s *Stats) *Heatmap {
+	return &Heatmap{Interval: s.Interval, Columns: s.Intervals()}
+}
+
+// ReadHeatmap returns a heatmap of the statements in a log written by a JSON
+// logger, with the given interval length and histogram buckets. If buckets is
+// empty, DefaultBuckets is used.
+func ReadHeatmap(r io.Reader, interval time.Duration, buckets []time.Duration) (*Heatmap, error) {
+	if interval <= 0 {
+		return nil, &Error{Kind: ErrConfig, Err: fmt.Errorf("heatmap interval must be positive, not %v", interval)}
+	}
+	s := &Stats{Buckets: buckets, Interval: interval}
+	if err := ReadJSONLog(r, s.Log); err != nil {
+		return nil, err
+	}
+	return HeatmapFromStats(s), nil
+}
+
+const (
+	heatmapCellHeight = 18
+	heatmapLeft       = 80
+	heatmapTop        = 10
+	heatmapWidth      = 1200
+)
+
+type heatmapCell struct {
+	X, Y, W, H int
+	Fill       string
+	Title      string
+}
+
+type heatmapLabel struct {
+	X, Y int
+	Text string
+}
+
+// WriteHTML writes the heatmap as an HTML page with no external resources.
+// Each cell is shaded by the number of statements in it on a log scale, and
+// shows its count when hovered over.
+func (h *Heatmap) WriteHTML(w io.Writer) error {
+	data := struct {
+		Title         string
+		Width, Height int
+		Cells         []heatmapCell
+		XLabels       []heatmapLabel
+		YLabels       []heatmapLabel
+		Summary       string
+	}{Title: h.Title}
+	if data.Title == "" {
+		data.Title = "Query latency"
+	}
+	if len(h.Columns) == 0 || h.Interval <= 0 {
+		data.Summary = "No statements were recorded."
+		return heatmapTemplate.Execute(w, data)
+	}
+
+	first := h.Columns[0].Start
+	ncols := int(h.Columns[len(h.Columns)-1].Start.Sub(first)/h.Interval) + 1
+	cellW := heatmapWidth / ncols
+	if cellW < 2 {
+		cellW = 2
+	}
+	if cellW > 40 {
+		cellW = 40
+	}
+	bounds := h.Columns[0].Latency.Bounds
+	nrows := len(bounds) + 1
+	var max, total int64
+	for _, c := range h.Columns {
+		for _, n := range c.Latency.Counts {
+			total += n
+			if n > max {
+				max = n
+			}
+		}
+	}
+
+	for _, c := range h.Columns {
+		col := int(c.Start.Sub(first) / h.Interval)
+		for i, n := range c.Latency.Counts {
+			if n == 0 {
+				continue
+			}
+			shade := math.Log1p(float64(n)) / math.Log1p(float64(max))
+			data.Cells = append(data.Cells, heatmapCell{
+				X:     heatmapLeft + col*cellW,
+				Y:     heatmapTop + (nrows-1-i)*heatmapCellHeight,
+				W:     cellW,
+				H:     heatmapCellHeight,
+				Fill:  heatmapColor(shade),
+				Title: fmt.Sprintf("%s, %s: %d", c.Start.Format(time.RFC3339), bucketName(bounds, i), n),
+			})
+		}
+	}
+	for i := range bounds {
+		data.YLabels = append(data.YLabels, heatmapLabel{
+			X:    heatmapLeft - 6,
+			Y:    heatmapTop + (nrows-1-i)*heatmapCellHeight + heatmapCellHeight/2 + 4,
+			Text: "≤ " + bounds[i].String(),
+		})
+	}
+	data.YLabels = append(data.YLabels, heatmapLabel{
+		X:    heatmapLeft - 6,
+		Y:    heatmapTop + heatmapCellHeight/2 + 4,
+		Text: "> " + bounds[len(bounds)-1].String(),
+	})
+	step := (ncols + 9) / 10
+	for col := 0; col < ncols; col += step {
+		data.XLabels = append(data.XLabels, heatmapLabel{
+			X:    heatmapLeft + col*cellW,
+			Y:    heatmapTop + nrows*heatmapCellHeight + 16,
+			Text: first.Add(time.Duration(col) * h.Interval).Format("15:04:05"),
+		})
+	}
+	data.Width = heatmapLeft + ncols*cellW + 80
+	data.Height = heatmapTop + nrows*heatmapCellHeight + 30
+	data.Summary = fmt.Sprintf("%d statements from %s to %s in %v intervals.", total,
+		first.Format(time.RFC3339), first.Add(time.Duration(ncols)*h.Interval).Format(time.RFC3339), h.Interval)
+	return heatmapTemplate.Execute(w, data)
+}
+
+func bucketName(bounds []time.Duration, i int) string {
+	switch {
+	case i == len(bounds):
+		return "> " + bounds[i-1].String()
+	case i == 0:
+		return "≤ " + bounds[0].String()
+	}
+	return bounds[i-1].String() + "–" + bounds[i].String()
+}
+
+// heatmapColor shades from pale yellow (0) to dark red (1).
+func heatmapColor(shade float64) string {
+	lerp := func(a, b float64) int { return int(a + (b-a)*shade) }
+	return fmt.Sprintf("rgb(%d,%d,%d)", lerp(255, 140), lerp(237, 0), lerp(160, 20))
+}
+
+var heatmapTemplate = template.Must(template.New("heatmap").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 20px; }
+svg text { font-size: 11px; fill: #333; }
+rect:hover { stroke: #000; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>{{.Summary}}</p>
+{{if .Cells}}<svg width="{{.Width}}" height="{{.Height}}" xmlns="http://www.w3.org/2000/svg">
+{{range .Cells}}<rect x="{{.X}}" y="{{.Y}}" width="{{.W}}" height="{{.H}}" fill="{{.Fill}}"><title>{{.Title}}</title></rect>
+{{end}}{{range .YLabels}}<text x="{{.X}}" y="{{.Y}}" text-anchor="end">{{.Text}}</text>
+{{end}}{{range .XLabels}}<text x="{{.X}}" y="{{.Y}}">{{.Text}}</text>
+{{end}}</svg>{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,113 @@
+package dbtimer
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// DefaultBuckets returns the histogram bounds used when none are given: 100µs
+// to 10s in 1-2.5-5 steps, which covers most OLTP workloads.
+func DefaultBuckets() []time.Duration {
+	return []time.Duration{
+		100 * time.Microsecond, 250 * time.Microsecond, 500 * time.Microsecond,
+		time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+		10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+		100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+		time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second,
+	}
+}
+
+// LinearBuckets returns count bounds, the first at start and each one width
+// more than the last.
+func LinearBuckets(start, width time.Duration, count int) []time.Duration {
+	out := make([]time.Duration, count)
+	for i := range out {
+		out[i] = start + time.Duration(i)*width
+	}
+	return out
+}
+
+// ExponentialBuckets returns count bounds, the first at start and each one
+// factor times the last. factor must be greater than 1.
+func ExponentialBuckets(start time.Duration, factor float64, count int) []time.Duration {
+	out := make([]time.Duration, count)
+	b := float64(start)
+	for i := range out {
+		out[i] = time.Duration(b)
+		b *= factor
+	}
+	return out
+}
+
+// Histogram counts durations in buckets. Counts[i] is the number of durations
+// no greater than Bounds[i] and greater than Bounds[i-1]; the last count, one
+// past the end of Bounds, is the number greater than every bound.
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []int64
+}
+
+// NewHistogram returns an empty histogram with the given bounds, which are
+// sorted. If bounds is empty, DefaultBuckets is used.
+func NewHistogram(bounds []time.Duration) Histogram {
+	if len(bounds) == 0 {
+		bounds = DefaultBuckets()
+	}
+	b := make([]time.Duration, len(bounds))
+	copy(b, bounds)
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	return Histogram{Bounds: b, Counts: make([]int64, len(b)+1)}
+}
+
+// Observe counts d.
+func (h Histogram) Observe(d time.Duration) {
+	i := sort.Search(len(h.Bounds), func(i int) bool { return d <= h.Bounds[i] })
+	h.Counts[i]++
+}
+
+// Count returns the number of durations counted.
+func (h Histogram) Count() int64 {
+	var n int64
+	for _, c := range h.Counts {
+		n += c
+	}
+	return n
+}
+
+// Quantile estimates the q-quantile (0 <= q <= 1) by interpolating within the
+// bucket that holds it. Durations above the last bound are reported as the
+// last bound.
+func (h Histogram) Quantile(q float64) time.Duration {
+	n := h.Count()
+	if n == 0 {
+		return 0
+	}
+	rank := q * float64(n)
+	var seen float64
+	for i, c := range h.Counts {
+		if c == 0 || seen+float64(c) < rank {
+			seen += float64(c)
+			continue
+		}
+		if i == len(h.Bounds) {
+			break
+		}
+		var lo time.Duration
+		if i > 0 {
+			lo = h.Bounds[i-1]
+		}
+		frac := (rank - seen) / float64(c)
+		return lo + time.Duration(math.Round(frac*float64(h.Bounds[i]-lo)))
+	}
+	if len(h.Bounds) == 0 {
+		return 0
+	}
+	return h.Bounds[len(h.Bounds)-1]
+}
+
+func (h Histogram) clone() Histogram {
+	c := make([]int64, len(h.Counts))
+	copy(c, h.Counts)
+	return Histogram{Bounds: h.Bounds, Counts: c}
+}
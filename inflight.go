@@ -0,0 +1,81 @@
+package dbtimer
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// InFlightQuery is a call that has started and not yet returned.
+type InFlightQuery struct {
+	ConnID uint64
+	Method string
+	Query  string
+	Start  time.Time
+	Tags   map[string]string
+}
+
+var inFlight struct {
+	tracking int32
+	mu       sync.Mutex
+	next     uint64
+	calls    map[uint64]InFlightQuery
+}
+
+// TrackInFlight turns tracking of in-flight calls on or off. Tracking costs a
+// lock per call, so it is off until something, such as a debug handler, asks
+// for it. Calls each add to a count, so tracking stays on until every caller
+// that turned it on has turned it off.
+func TrackInFlight(on bool) {
+	if on {
+		atomic.AddInt32(&inFlight.tracking, 1)
+	} else {
+		atomic.AddInt32(&inFlight.tracking, -1)
+	}
+}
+
+// InFlight returns the calls that are running now, oldest first. It is empty
+// unless TrackInFlight is on.
+func InFlight() []InFlightQuery {
+	inFlight.mu.Lock()
+	out := make([]InFlightQuery, 0, len(inFlight.calls))
+	for _, q := range inFlight.calls {
+		out = append(out, q)
+	}
+	inFlight.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+// startInFlight records the start of a call if tracking is on, and returns the
+// function that records its end.
+func (cs *connState) startInFlight(ctx context.Context, method, query string) func() {
+	if atomic.LoadInt32(&inFlight.tracking) <= 0 {
+		return func() {}
+	}
+	tags := cs.statementTags(ctx, query)
+	query, _ = scrub(method, query, nil)
+	query, _ = cs.d.truncate(query)
+	q := InFlightQuery{
+		ConnID: cs.id,
+		Method: method,
+		Query:  query,
+		Start:  cs.d.now(),
+		Tags:   tags,
+	}
+	inFlight.mu.Lock()
+	if inFlight.calls == nil {
+		inFlight.calls = map[uint64]InFlightQuery{}
+	}
+	inFlight.next++
+	id := inFlight.next
+	inFlight.calls[id] = q
+	inFlight.mu.Unlock()
+	return func() {
+		inFlight.mu.Lock()
+		delete(inFlight.calls, id)
+		inFlight.mu.Unlock()
+	}
+}
@@ -0,0 +1,120 @@
+package dbtimer
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// InjectionDetector is a TimerLogger that looks for SQL built by
+// concatenating strings, which is prone to SQL injection. A statement whose
+// fingerprint has no placeholders, but whose literal values change from one
+// execution to the next, is almost certainly having its values pasted into
+// the query text rather than bound as arguments.
+//
+// Install it alongside any other logger with MultiLogger, and read the
+// suspects with Report or as they are found with OnSuspect.
+type InjectionDetector struct {
+	// Threshold is the number of different sets of literal values a
+	// fingerprint must be seen with before it is reported. The default is 3.
+	Threshold int
+
+	// OnSuspect is called once for each fingerprint when it is first
+	// reported.
+	OnSuspect func(InjectionSuspect)
+
+	mu      sync.Mutex
+	tracked map[string]*injectionStats
+}
+
+// InjectionSuspect is a fingerprint that appears to be built by string
+// concatenation. Example is one of the queries seen with it.
+type InjectionSuspect struct {
+	Fingerprint      string
+	Executions       int64
+	DistinctLiterals int
+	Example          string
+}
+
+type injectionStats struct {
+	suspect  InjectionSuspect
+	hashes   map[uint64]bool
+	reported bool
+}
+
+// Log examines the statement run by ti.
+func (id *InjectionDetector) Log(ti TimerInfo) {
+	if !runsStatement(ti.Method) || ti.Query == "" {
+		return
+	}
+	toks := tokenize(ti.Query)
+	h := fnv.New64a()
+	literals := 0
+	for _, t := range toks {
+		if t.placeholder {
+			return
+		}
+		if t.literal != "" {
+			literals++
+			h.Write([]byte(t.literal))
+			h.Write([]byte{0})
+		}
+	}
+	if literals == 0 {
+		return
+	}
+	threshold := id.Threshold
+	if threshold <= 0 {
+		threshold = 3
+	}
+	fp := render(collapseLists(toks))
+	var found *InjectionSuspect
+	id.mu.Lock()
+	if id.tracked == nil {
+		id.tracked = map[string]*injectionStats{}
+	}
+	st := id.tracked[fp]
+	if st == nil {
+		st = &injectionStats{
+			suspect: InjectionSuspect{Fingerprint: fp, Example: ti.Query},
+			hashes:  map[uint64]bool{},
+		}
+		id.tracked[fp] = st
+	}
+	st.suspect.Executions++
+	// Once a fingerprint is reported there's no need to keep counting how
+	// many different values it has been seen with.
+	if !st.reported {
+		st.hashes[h.Sum64()] = true
+		st.suspect.DistinctLiterals = len(st.hashes)
+		if len(st.hashes) >= threshold {
+			st.reported = true
+			st.hashes = nil
+			s := st.suspect
+			found = &s
+		}
+	}
+	id.mu.Unlock()
+	if found != nil && id.OnSuspect != nil {
+		id.OnSuspect(*found)
+	}
+}
+
+// Report returns every fingerprint reported so far, most executed first.
+func (id *InjectionDetector) Report() []InjectionSuspect {
+	id.mu.Lock()
+	var out []InjectionSuspect
+	for _, st := range id.tracked {
+		if st.reported {
+			out = append(out, st.suspect)
+		}
+	}
+	id.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Executions != out[j].Executions {
+			return out[i].Executions > out[j].Executions
+		}
+		return out[i].Fingerprint < out[j].Fingerprint
+	})
+	return out
+}
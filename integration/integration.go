@@ -0,0 +1,343 @@
+// Package integration checks the timer end to end against real databases
+// and drivers: that contexts reach the driver and come back in events, that
+// the optional driver interfaces pass through, and that rows, execs,
+// prepared statements and transactions are instrumented. Changes to the
+// wrapper can break one driver while every other keeps working, so run it
+// against each driver you support. The dbtimer-integration command runs it
+// against postgres and mysql in containers.
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// Target is a database to check, reached through a registered driver.
+type Target struct {
+	Name       string
+	DriverName string
+	DSN        string
+
+	// SleepQuery is a statement that takes a few seconds, such as
+	// "SELECT pg_sleep(5)", for checking that canceling a call's context
+	// stops it. If it is empty, that check is skipped.
+	SleepQuery string
+}
+
+// Result is the outcome of one check against a target. Err is nil if the
+// check passed.
+type Result struct {
+	Target string
+	Check  string
+	Err    error
+}
+
+func (r Result) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("FAIL %s %s: %v", r.Target, r.Check, r.Err)
+	}
+	return fmt.Sprintf("ok   %s %s", r.Target, r.Check)
+}
+
+// Failed reports whether any of results failed.
+func Failed(results []Result) bool {
+	for _, r := range results {
+		if r.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// check is one end-to-end check. It runs on a connection of its own, through
+// a timer whose events go to rec.
+type check struct {
+	name string
+	run  func(ctx context.Context, t Target, db *sql.DB, conn *sql.Conn, rec *recorder) error
+}
+
+var checks = []check{
+	{"context", checkContext},
+	{"cancel", checkCancel},
+	{"interfaces", checkInterfaces},
+	{"rows", checkRows},
+	{"exec", checkExec},
+	{"prepare", checkPrepare},
+	{"tx", checkTx},
+}
+
+// Run runs every check against t, each through a timer of its own.
+func Run(ctx context.Context, t Target) []Result {
+	out := make([]Result, 0, len(checks))
+	for _, c := range checks {
+		out = append(out, Result{Target: t.Name, Check: c.name, Err: runCheck(ctx, t, c)})
+	}
+	return out
+}
+
+func runCheck(ctx context.Context, t Target, c check) error {
+	rec := &recorder{}
+	db, err := dbtimer.OpenDB(t.DriverName, t.DSN, dbtimer.WithTimerLogger(rec), dbtimer.WithResponseSize())
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return c.run(ctx, t, db, conn, rec)
+}
+
+// recorder keeps the events of a check.
+type recorder struct {
+	mu     sync.Mutex
+	events []dbtimer.TimerInfo
+}
+
+func (r *recorder) Log(ti dbtimer.TimerInfo) {
+	r.mu.Lock()
+	r.events = append(r.events, ti)
+	r.mu.Unlock()
+}
+
+// find returns the last event of method, or an error if there is none.
+func (r *recorder) find(method string) (dbtimer.TimerInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := len(r.events) - 1; i >= 0; i-- {
+		if r.events[i].Method == method {
+			return r.events[i], nil
+		}
+	}
+	return dbtimer.TimerInfo{}, fmt.Errorf("no %s event was logged", method)
+}
+
+// checkContext checks that tags set on a call's context reach its event.
+func checkContext(ctx context.Context, t Target, db *sql.DB, conn *sql.Conn, rec *recorder) error {
+	var n int
+	if err := conn.QueryRowContext(dbtimer.WithTag(ctx, "check", "context"), "SELECT 1").Scan(&n); err != nil {
+		return err
+	}
+	ti, err := rec.find("conn.Query")
+	if err != nil {
+		return err
+	}
+	if ti.Tags["check"] != "context" {
+		return fmt.Errorf("the event's tags are %v, without the context's", ti.Tags)
+	}
+	return nil
+}
+
+// checkCancel checks that canceling a call's context stops the statement,
+// and that its event has the error and the cancellation.
+func checkCancel(ctx context.Context, t Target, db *sql.DB, conn *sql.Conn, rec *recorder) error {
+	if t.SleepQuery == "" {
+		return nil
+	}
+	cctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := conn.ExecContext(cctx, t.SleepQuery)
+	if err == nil {
+		return errors.New("the statement wasn't canceled")
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		return fmt.Errorf("the statement took %v to stop after being canceled", d)
+	}
+	ti, ferr := rec.find("conn.Exec")
+	if ferr != nil {
+		return ferr
+	}
+	if ti.Err == nil {
+		return errors.New("the event of the canceled statement has no error")
+	}
+	if !ti.Canceled {
+		return errors.New("the event of the canceled statement isn't marked Canceled")
+	}
+	return nil
+}
+
+// checkInterfaces checks that the timer's connection unwraps to the driver's,
+// that Capabilities reports what the driver's connection implements, and
+// that the timer's connection only claims to exec directly if the driver's
+// does.
+func checkInterfaces(ctx context.Context, t Target, db *sql.DB, conn *sql.Conn, rec *recorder) error {
+	var wrapped, raw driver.Conn
+	if err := conn.Raw(func(dc interface{}) error {
+		wrapped = dc.(driver.Conn)
+		raw = dbtimer.UnwrapConn(wrapped)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if raw == wrapped {
+		return errors.New("the timer's connection doesn't unwrap to the driver's")
+	}
+	d, ok := db.Driver().(*dbtimer.Driver)
+	if !ok {
+		return fmt.Errorf("the database's driver is a %T, not the timer", db.Driver())
+	}
+	caps, ok := d.Capabilities(t.DriverName)
+	if !ok {
+		return errors.New("no capabilities were recorded for the driver")
+	}
+	_, rawQueryer := raw.(driver.Queryer)
+	_, rawQueryerContext := raw.(driver.QueryerContext)
+	_, rawExecer := raw.(driver.Execer)
+	_, rawExecerContext := raw.(driver.ExecerContext)
+	_, rawConnPrepareContext := raw.(driver.ConnPrepareContext)
+	_, rawConnBeginTx := raw.(driver.ConnBeginTx)
+	_, rawPinger := raw.(driver.Pinger)
+	_, rawSessionResetter := raw.(driver.SessionResetter)
+	_, rawValidator := raw.(driver.Validator)
+	_, rawNamedValueChecker := raw.(driver.NamedValueChecker)
+	for _, c := range []struct {
+		name     string
+		reported bool
+		has      bool
+	}{
+		{"Queryer", caps.SupportsQueryer, rawQueryer},
+		{"QueryerContext", caps.SupportsQueryerContext, rawQueryerContext},
+		{"Execer", caps.SupportsExecer, rawExecer},
+		{"ExecerContext", caps.SupportsExecerContext, rawExecerContext},
+		{"ConnPrepareContext", caps.SupportsPrepareContext, rawConnPrepareContext},
+		{"ConnBeginTx", caps.SupportsTxOptions, rawConnBeginTx},
+		{"Pinger", caps.SupportsPing, rawPinger},
+		{"SessionResetter", caps.SupportsSessionReset, rawSessionResetter},
+		{"Validator", caps.SupportsValidation, rawValidator},
+		{"NamedValueChecker", caps.SupportsNamedValues, rawNamedValueChecker},
+	} {
+		if c.reported != c.has {
+			return fmt.Errorf("Capabilities reports %s as %v, but the driver's connection has it: %v", c.name, c.reported, c.has)
+		}
+	}
+	execs := rawExecer || rawExecerContext
+	if _, ok := wrapped.(driver.ExecerContext); ok != execs {
+		return fmt.Errorf("the timer's connection implements ExecerContext: %v, but the driver's execs directly: %v", !execs, execs)
+	}
+	return nil
+}
+
+// checkRows checks that the rows a query returns are counted and sized when
+// they are closed.
+func checkRows(ctx context.Context, t Target, db *sql.DB, conn *sql.Conn, rec *recorder) error {
+	rows, err := conn.QueryContext(ctx, "SELECT 1 UNION ALL SELECT 2 UNION ALL SELECT 3")
+	if err != nil {
+		return err
+	}
+	n := 0
+	for rows.Next() {
+		var v int
+		if err := rows.Scan(&v); err != nil {
+			rows.Close()
+			return err
+		}
+		n++
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	ti, err := rec.find("rows.Close")
+	if err != nil {
+		return err
+	}
+	if ti.RowCount != n || ti.ResponseBytes == 0 {
+		return fmt.Errorf("the rows.Close event counts %d rows of %d bytes, after %d rows were read", ti.RowCount, ti.ResponseBytes, n)
+	}
+	return nil
+}
+
+// setUpTable creates a temporary table on conn for a check.
+func setUpTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, "CREATE TEMPORARY TABLE dbtimer_integration (id INT)")
+	return err
+}
+
+// checkExec checks that an exec's event has the rows it inserted and the
+// rows the driver reported it affected.
+func checkExec(ctx context.Context, t Target, db *sql.DB, conn *sql.Conn, rec *recorder) error {
+	if err := setUpTable(ctx, conn); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, "INSERT INTO dbtimer_integration (id) VALUES (1), (2)"); err != nil {
+		return err
+	}
+	ti, err := rec.find("conn.Exec")
+	if err != nil {
+		return err
+	}
+	if ti.BatchSize != 2 || ti.RowsAffected != 2 {
+		return fmt.Errorf("the insert's event has BatchSize %d and RowsAffected %d, not 2", ti.BatchSize, ti.RowsAffected)
+	}
+	return nil
+}
+
+// checkPrepare checks that preparing a statement and running it are both
+// logged.
+func checkPrepare(ctx context.Context, t Target, db *sql.DB, conn *sql.Conn, rec *recorder) error {
+	if err := setUpTable(ctx, conn); err != nil {
+		return err
+	}
+	stmt, err := conn.PrepareContext(ctx, "SELECT id FROM dbtimer_integration")
+	if err != nil {
+		return err
+	}
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		stmt.Close()
+		return err
+	}
+	rows.Close()
+	stmt.Close()
+	for _, m := range []string{"conn.Prepare", "stmt.Query"} {
+		ti, err := rec.find(m)
+		if err != nil {
+			return err
+		}
+		if ti.Query != "SELECT id FROM dbtimer_integration" {
+			return fmt.Errorf("the %s event has query %q", m, ti.Query)
+		}
+	}
+	return nil
+}
+
+// checkTx checks that a transaction's begin and commit are logged, and that
+// the statements in it have its TxID.
+func checkTx(ctx context.Context, t Target, db *sql.DB, conn *sql.Conn, rec *recorder) error {
+	if err := setUpTable(ctx, conn); err != nil {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO dbtimer_integration (id) VALUES (3)"); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, m := range []string{"conn.Begin", "tx.Commit"} {
+		if _, err := rec.find(m); err != nil {
+			return err
+		}
+	}
+	ti, err := rec.find("conn.Exec")
+	if err != nil {
+		return err
+	}
+	if ti.TxID == 0 {
+		return errors.New("the statement in the transaction has no TxID")
+	}
+	return nil
+}
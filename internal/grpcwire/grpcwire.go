@@ -0,0 +1,132 @@
+// Package grpcwire implements the parts of the gRPC protocol that dbtimer's
+// services need on top of net/http's HTTP/2 support: length-prefixed
+// messages, status codes and trailers. It lets the collector and admin
+// services interoperate with standard gRPC clients and servers without
+// depending on the gRPC module.
+package grpcwire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MaxMessage limits the size of a message either side will read.
+const MaxMessage = 16 << 20
+
+// gRPC status codes.
+const (
+	CodeOK              = 0
+	CodeInvalidArgument = 3
+	CodeUnimplemented   = 12
+	CodeInternal        = 13
+	CodeUnavailable     = 14
+)
+
+// NewHTTPServer returns an http.Server that serves h at addr over HTTP/2,
+// both with TLS (if started with ListenAndServeTLS) and unencrypted. Requests
+// that aren't gRPC are passed to other, if it isn't nil, so that metrics can
+// be served from the same port.
+func NewHTTPServer(addr string, h http.Handler, other http.Handler) *http.Server {
+	var p http.Protocols
+	p.SetHTTP1(true)
+	p.SetHTTP2(true)
+	p.SetUnencryptedHTTP2(true)
+	if other != nil {
+		grpc := h
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if IsGRPC(r) {
+				grpc.ServeHTTP(w, r)
+				return
+			}
+			other.ServeHTTP(w, r)
+		})
+	}
+	return &http.Server{Addr: addr, Handler: h, Protocols: &p}
+}
+
+// IsGRPC reports whether r is a gRPC call.
+func IsGRPC(r *http.Request) bool {
+	return r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc")
+}
+
+// WriteMessage writes msg as a gRPC length-prefixed message.
+func WriteMessage(w io.Writer, msg []byte) error {
+	var hdr [5]byte
+	binary.BigEndian.PutUint32(hdr[1:], uint32(len(msg)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(msg)
+	return err
+}
+
+// ReadMessage reads a gRPC length-prefixed message. It returns io.EOF at the
+// end of the stream.
+func ReadMessage(r io.Reader) ([]byte, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("truncated gRPC message")
+		}
+		return nil, err
+	}
+	if hdr[0] != 0 {
+		return nil, errors.New("compressed gRPC messages are not supported")
+	}
+	n := binary.BigEndian.Uint32(hdr[1:])
+	if n > MaxMessage {
+		return nil, fmt.Errorf("gRPC message of %d bytes is too large", n)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, errors.New("truncated gRPC message")
+	}
+	return msg, nil
+}
+
+// WriteStatus sends a trailers-only response, which carries the status in
+// the headers.
+func WriteStatus(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set("Grpc-Message", percentEncode(msg))
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// SetTrailer sets the status sent in the trailers once the handler returns.
+func SetTrailer(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", percentEncode(msg))
+	}
+}
+
+// Status returns the gRPC status in h as an error, or nil if it is OK or
+// missing. prefix starts the error's message.
+func Status(prefix string, h http.Header) error {
+	code := h.Get("Grpc-Status")
+	if code == "" || code == "0" {
+		return nil
+	}
+	return fmt.Errorf("%s: gRPC status %s: %s", prefix, code, h.Get("Grpc-Message"))
+}
+
+// percentEncode encodes a grpc-message as the gRPC protocol requires.
+func percentEncode(msg string) string {
+	var sb strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&sb, "%%%02X", c)
+			continue
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
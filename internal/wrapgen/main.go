@@ -0,0 +1,290 @@
+// Command wrapgen writes wrappers_gen.go, the wrapper types of the timer
+// driver for each combination of the optional database/sql/driver interfaces
+// that it must implement exactly when the wrapped value does, and the
+// functions that choose among them. Run it with go generate in the dbtimer
+// package.
+//
+// A wrapper that claims an interface the wrapped value lacks changes what the
+// sql package does, and one that lacks an interface the wrapped value has
+// hides it. Interfaces the timer can always implement by falling back to what
+// the sql package would do itself, such as ConnBeginTx or StmtExecContext,
+// are left out of the combinations. Choosing a type is a switch on a bit
+// mask, so wrapping needs no reflection and no allocation beyond the wrapper
+// itself.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// iface is an optional interface that is part of the combinations.
+type iface struct {
+	// Name is the interface in the driver package, and Field the field of
+	// rowsInterfaces that holds it.
+	Name  string
+	Field string
+
+	// Methods are the methods that forward to the wrapped value's, as Go
+	// source with %[1]s for the receiver's field.
+	Methods []string
+}
+
+var rowsIfaces = []iface{
+	{"RowsNextResultSet", "next", []string{
+		"HasNextResultSet() bool {\n\treturn r.%[1]s.HasNextResultSet()\n}",
+		"NextResultSet() error {\n\treturn r.%[1]s.NextResultSet()\n}",
+	}},
+	{"RowsColumnTypeScanType", "scanType", []string{
+		"ColumnTypeScanType(index int) reflect.Type {\n\treturn r.%[1]s.ColumnTypeScanType(index)\n}",
+	}},
+	{"RowsColumnTypeDatabaseTypeName", "databaseType", []string{
+		"ColumnTypeDatabaseTypeName(index int) string {\n\treturn r.%[1]s.ColumnTypeDatabaseTypeName(index)\n}",
+	}},
+	{"RowsColumnTypeLength", "length", []string{
+		"ColumnTypeLength(index int) (int64, bool) {\n\treturn r.%[1]s.ColumnTypeLength(index)\n}",
+	}},
+	{"RowsColumnTypeNullable", "nullable", []string{
+		"ColumnTypeNullable(index int) (bool, bool) {\n\treturn r.%[1]s.ColumnTypeNullable(index)\n}",
+	}},
+	{"RowsColumnTypePrecisionScale", "precisionScale", []string{
+		"ColumnTypePrecisionScale(index int) (int64, int64, bool) {\n\treturn r.%[1]s.ColumnTypePrecisionScale(index)\n}",
+	}},
+}
+
+// connType is a combination of whether the underlying connection execs and
+// queries directly.
+type connType struct {
+	Name  string
+	Exec  bool
+	Query bool
+}
+
+var connTypes = []connType{
+	{"Conn", true, true},
+	{"NoExecConn", false, true},
+	{"NoQueryConn", true, false},
+	{"NoExecNoQueryConn", false, false},
+}
+
+var connTemplate = template.Must(template.New("conn").Parse(`
+{{- range .}}
+// {{.Name}} is a timed connection whose underlying connection
+{{- if and .Exec .Query}} execs and queries directly.
+{{- else if .Query}} queries directly but doesn't exec, so the sql package prepares each exec.
+{{- else if .Exec}} execs directly but doesn't query, so the sql package prepares each query.
+{{- else}} neither execs nor queries directly, so the sql package prepares every statement.
+{{- end}}
+type {{.Name}} struct {
+	c driver.Conn
+	*connState
+}
+
+// Prepare returns a prepared statement, bound to this connection.
+func (c *{{.Name}}) Prepare(query string) (driver.Stmt, error) {
+	return c.prepare(c.c, query)
+}
+
+// PrepareContext returns a prepared statement, bound to this connection.
+// context is for the preparation of the statement,
+// it must not store the context within the statement itself.
+func (c *{{.Name}}) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.prepareContext(ctx, c.c, query)
+}
+{{if .Exec}}
+func (c *{{.Name}}) Exec(query string, args []driver.Value) (driver.Result, error) {
+	return c.exec(c.c, query, args)
+}
+
+// ExecContext executes a query that doesn't return rows, such
+// as an INSERT or UPDATE.
+//
+// ExecContext must honor the context timeout and return when it is canceled.
+func (c *{{.Name}}) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.execContext(ctx, c.c, query, args)
+}
+{{end}}
+{{- if .Query}}
+// QueryContext executes a query that may return rows, such as a
+// SELECT.
+//
+// QueryContext must honor the context timeout and return when it is canceled.
+func (c *{{.Name}}) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.queryContext(ctx, c.c, query, args)
+}
+{{end}}
+// Close invalidates and potentially stops any current
+// prepared statements and transactions, marking this
+// connection as no longer in use.
+//
+// Because the sql package maintains a free pool of
+// connections and only calls Close when there's a surplus of
+// idle connections, it shouldn't be necessary for drivers to
+// do their own connection caching.
+func (c *{{.Name}}) Close() error {
+	return c.close(c.c)
+}
+
+// Begin starts and returns a new transaction.
+func (c *{{.Name}}) Begin() (driver.Tx, error) {
+	return c.begin(c.c)
+}
+
+// BeginTx starts and returns a new transaction.
+// If the context is canceled by the user the sql package will
+// call Tx.Rollback before discarding and closing the connection.
+func (c *{{.Name}}) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.beginTx(ctx, c.c, opts)
+}
+
+// Ping verifies a connection to the database is still alive.
+func (c *{{.Name}}) Ping(ctx context.Context) error {
+	return c.ping(ctx, c.c)
+}
+
+// ResetSession is called prior to executing a query on the connection
+// if the connection has been used before.
+func (c *{{.Name}}) ResetSession(ctx context.Context) error {
+	return resetSession(ctx, c.c)
+}
+
+// IsValid is called prior to placing the connection into the
+// connection pool. The connection will be discarded if false is returned.
+func (c *{{.Name}}) IsValid() bool {
+	return isValid(c.c)
+}
+
+// CheckNamedValue is called before passing arguments to the driver
+// and is called in place of any ColumnConverter.
+func (c *{{.Name}}) CheckNamedValue(nv *driver.NamedValue) error {
+	return checkNamedValue(nv, c.c)
+}
+
+// Unwrap returns the underlying driver's connection.
+func (c *{{.Name}}) Unwrap() driver.Conn {
+	return c.c
+}
+{{end}}
+// wrapConn returns the timed connection for c, of the type that execs and
+// queries directly exactly when c does.
+func wrapConn(c driver.Conn, cs *connState) driver.Conn {
+	_, execer := c.(driver.Execer)
+	_, execerContext := c.(driver.ExecerContext)
+	_, queryer := c.(driver.Queryer)
+	_, queryerContext := c.(driver.QueryerContext)
+	exec := execer || execerContext
+	query := queryer || queryerContext
+	switch {
+{{- range .}}
+	case {{if not .Exec}}!{{end}}exec && {{if not .Query}}!{{end}}query:
+		return &{{.Name}}{c, cs}
+{{- end}}
+	}
+	panic("unreachable")
+}
+`))
+
+func main() {
+	out := flag.String("o", "wrappers_gen.go", "the file to write")
+	flag.Parse()
+	src, err := generate()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*out, src, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func generate() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(`// Code generated by wrapgen; DO NOT EDIT.
+
+package dbtimer
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+)
+`)
+	if err := connTemplate.Execute(&b, connTypes); err != nil {
+		return nil, err
+	}
+	writeStmts(&b)
+	writeRows(&b)
+	return format.Source(b.Bytes())
+}
+
+// writeStmts writes the statement that keeps a ColumnConverter. Stmt itself
+// implements every other optional interface, falling back to what the sql
+// package does when the underlying statement lacks it.
+func writeStmts(b *bytes.Buffer) {
+	b.WriteString(`
+// converterStmt is a Stmt whose underlying statement is a
+// driver.ColumnConverter.
+type converterStmt struct {
+	*Stmt
+	cc driver.ColumnConverter
+}
+
+// ColumnConverter returns the underlying statement's converter for the
+// argument at idx.
+func (s converterStmt) ColumnConverter(idx int) driver.ValueConverter {
+	return s.cc.ColumnConverter(idx)
+}
+
+// wrapStmt returns s as a driver.Stmt, keeping the underlying statement's
+// ColumnConverter if it has one.
+func wrapStmt(s *Stmt) driver.Stmt {
+	if cc, ok := s.s.(driver.ColumnConverter); ok {
+		return converterStmt{s, cc}
+	}
+	return s
+}
+`)
+}
+
+// writeRows writes a rows type for each combination of rowsIfaces, and
+// wrapRows, which chooses among them.
+func writeRows(b *bytes.Buffer) {
+	b.WriteString("\n// rowsInterfaces are the optional interfaces of wrapped rows.\ntype rowsInterfaces struct {\n")
+	for _, in := range rowsIfaces {
+		fmt.Fprintf(b, "\t%s driver.%s\n", in.Field, in.Name)
+	}
+	b.WriteString("}\n")
+	n := 1 << len(rowsIfaces)
+	for mask := 1; mask < n; mask++ {
+		var names []string
+		for i, in := range rowsIfaces {
+			if mask&(1<<i) != 0 {
+				names = append(names, "driver."+in.Name)
+			}
+		}
+		fmt.Fprintf(b, "\n// rows%d is rows with %s.\ntype rows%d struct {\n\tdriver.Rows\n\trowsInterfaces\n}\n", mask, strings.Join(names, ", "), mask)
+		for i, in := range rowsIfaces {
+			if mask&(1<<i) == 0 {
+				continue
+			}
+			for _, m := range in.Methods {
+				fmt.Fprintf(b, "\nfunc (r *rows%d) %s\n", mask, fmt.Sprintf(m, in.Field))
+			}
+		}
+	}
+	b.WriteString("\n// wrapRows returns rows with the interfaces in i that aren't nil.\nfunc wrapRows(rows driver.Rows, i rowsInterfaces) driver.Rows {\n\tmask := 0\n")
+	for bit, in := range rowsIfaces {
+		fmt.Fprintf(b, "\tif i.%s != nil {\n\t\tmask |= %d\n\t}\n", in.Field, 1<<bit)
+	}
+	b.WriteString("\tswitch mask {\n")
+	for mask := 1; mask < n; mask++ {
+		fmt.Fprintf(b, "\tcase %d:\n\t\treturn &rows%d{rows, i}\n", mask, mask)
+	}
+	b.WriteString("\t}\n\treturn rows\n}\n")
+}
@@ -0,0 +1,203 @@
+package dbtimer
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dialect is the SQL dialect that Interpolate quotes literals for.
+type Dialect int
+
+const (
+	PostgreSQL Dialect = iota
+	MySQL
+	SQLite
+	SQLServer
+)
+
+var dialectNames = map[Dialect]string{
+	PostgreSQL: "postgres",
+	MySQL:      "mysql",
+	SQLite:     "sqlite",
+	SQLServer:  "sqlserver",
+}
+
+func (d Dialect) String() string {
+	if s, ok := dialectNames[d]; ok {
+		return s
+	}
+	return fmt.Sprintf("Dialect(%d)", int(d))
+}
+
+// DebugMarker begins every statement returned by Interpolate.
+const DebugMarker = "/* dbtimer debug output, not for execution */ "
+
+// Interpolate returns query with args substituted for its placeholders as
+// literals quoted for the dialect, so that a statement can be copied into
+// psql, mysql or another client while debugging. Placeholders are numbered
+// ($1, @p1) or positional (?, :name, @name); in PostgreSQL, ? is an operator
+// and is left alone. Placeholders without an argument are left as they are.
+//
+// The quoting is best effort, and the result starts with DebugMarker to make
+// that clear. Never execute it from a program, and keep it out of logs that
+// must not hold application data.
+func Interpolate(dialect Dialect, query string, args []driver.Value) string {
+	var sb strings.Builder
+	sb.WriteString(DebugMarker)
+	next := 0
+	positional := func(placeholder string) {
+		if next < len(args) {
+			sb.WriteString(quoteLiteral(dialect, args[next]))
+		} else {
+			sb.WriteString(placeholder)
+		}
+		next++
+	}
+	numbered := func(placeholder, number string) {
+		n, err := strconv.Atoi(number)
+		if err != nil || n < 1 || n > len(args) {
+			sb.WriteString(placeholder)
+			return
+		}
+		sb.WriteString(quoteLiteral(dialect, args[n-1]))
+	}
+	for i := 0; i < len(query); {
+		c := query[i]
+		start := i
+		switch {
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end == -1 {
+				end = len(query) - i
+			}
+			i += end
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end == -1 {
+				i = len(query)
+			} else {
+				i += end + 4
+			}
+		case c == '\'':
+			i = skipString(query, i)
+		case c == '"' || c == '`':
+			end := strings.IndexByte(query[i+1:], c)
+			if end == -1 {
+				i = len(query)
+			} else {
+				i += end + 2
+			}
+		case c == '?' && dialect != PostgreSQL:
+			i++
+			positional(query[start:i])
+			continue
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			i++
+			for i < len(query) && isDigit(query[i]) {
+				i++
+			}
+			numbered(query[start:i], query[start+1:i])
+			continue
+		case c == '$' && dollarTag(query[i:]) != "":
+			tag := dollarTag(query[i:])
+			end := strings.Index(query[i+len(tag):], tag)
+			if end == -1 {
+				i = len(query)
+			} else {
+				i += len(tag) + end + len(tag)
+			}
+		case c == '@' && i+2 < len(query) && (query[i+1] == 'p' || query[i+1] == 'P') && isDigit(query[i+2]):
+			i += 2
+			for i < len(query) && isDigit(query[i]) {
+				i++
+			}
+			numbered(query[start:i], query[start+2:i])
+			continue
+		case (c == ':' || c == '@') && i+1 < len(query) && isIdentStart(query[i+1]) && !(i > 0 && query[i-1] == ':'):
+			i++
+			for i < len(query) && isIdentPart(query[i]) {
+				i++
+			}
+			positional(query[start:i])
+			continue
+		case isIdentStart(c):
+			for i < len(query) && isIdentPart(query[i]) {
+				i++
+			}
+		default:
+			i++
+		}
+		sb.WriteString(query[start:i])
+	}
+	return sb.String()
+}
+
+// quoteLiteral renders v as a literal in the dialect.
+func quoteLiteral(dialect Dialect, v driver.Value) string {
+	if valuer, ok := v.(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		if err != nil {
+			return quoteString(dialect, fmt.Sprintf("<%T: %v>", v, err))
+		}
+		if _, again := dv.(driver.Valuer); !again {
+			v = dv
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return quoteString(dialect, v)
+	case []byte:
+		switch dialect {
+		case PostgreSQL:
+			return `'\x` + hex.EncodeToString(v) + `'::bytea`
+		case SQLServer:
+			return "0x" + hex.EncodeToString(v)
+		}
+		return "X'" + hex.EncodeToString(v) + "'"
+	case time.Time:
+		switch dialect {
+		case MySQL:
+			return "'" + v.Format("2006-01-02 15:04:05.999999") + "'"
+		case SQLServer:
+			return "'" + v.Format("2006-01-02T15:04:05.9999999-07:00") + "'"
+		}
+		return "'" + v.Format("2006-01-02 15:04:05.999999999-07:00") + "'"
+	case bool:
+		if dialect == SQLite || dialect == SQLServer {
+			if v {
+				return "1"
+			}
+			return "0"
+		}
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case OutParam:
+		return quoteLiteral(dialect, v.Value)
+	}
+	return quoteString(dialect, fmt.Sprint(v))
+}
+
+var mysqlEscaper = strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\x00", `\0`, "\x1a", `\Z`)
+
+// quoteString quotes s as a string literal in the dialect.
+func quoteString(dialect Dialect, s string) string {
+	switch dialect {
+	case MySQL:
+		return "'" + mysqlEscaper.Replace(s) + "'"
+	case SQLServer:
+		return "N'" + strings.Replace(s, "'", "''", -1) + "'"
+	}
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
@@ -0,0 +1,171 @@
+package dbtimer
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// jsonEvent is the form a TimerInfo takes in a JSON log.
+type jsonEvent struct {
+	Method string            `json:"method"`
+	Query  string            `json:"query,omitempty"`
+	Start  time.Time         `json:"start"`
+	End    time.Time         `json:"end"`
+	Dur    time.Duration     `json:"duration_nanos,omitempty"`
+	Args   []interface{}     `json:"args,omitempty"`
+	Err    string            `json:"error,omitempty"`
+	ConnID uint64            `json:"conn_id,omitempty"`
+	Tags   map[string]string `json:"tags,omitempty"`
+	Wait   time.Duration     `json:"wait_nanos,omitempty"`
+	Batch  int               `json:"batch_size,omitempty"`
+	Set    int               `json:"result_set,omitempty"`
+	Count  int               `json:"row_count,omitempty"`
+	Cols   []jsonColumn      `json:"columns,omitempty"`
+	Bytes  int64             `json:"response_bytes,omitempty"`
+	Base   time.Duration     `json:"baseline_nanos,omitempty"`
+	TxID   uint64            `json:"tx_id,omitempty"`
+	Rows   int64             `json:"rows_affected,omitempty"`
+	Warm   bool              `json:"warmup,omitempty"`
+	Mem    *jsonMem          `json:"memory,omitempty"`
+	DLSrc  string            `json:"deadline_source,omitempty"`
+	DL     time.Duration     `json:"deadline_nanos,omitempty"`
+	Cancel bool              `json:"canceled,omitempty"`
+	CLat   time.Duration     `json:"cancel_latency_nanos,omitempty"`
+	Hit    bool              `json:"cache_hit,omitempty"`
+}
+
+type jsonMem struct {
+	Bytes   uint64        `json:"alloc_bytes"`
+	Objects uint64        `json:"alloc_objects"`
+	Cycles  uint64        `json:"gc_cycles"`
+	Pause   time.Duration `json:"gc_pause_nanos"`
+}
+
+type jsonColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+// NewJSONLogger returns a TimerLogger that writes each event to w as one line
+// of JSON (NDJSON). Events that can't be encoded are reported to the error
+// handler as ErrSerialization, and failed writes as ErrSink. Read the log back
+// with ReadJSONLog.
+func NewJSONLogger(w io.Writer) TimerLogger {
+	return &jsonLogger{w: w}
+}
+
+type jsonLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (jl *jsonLogger) Log(ti TimerInfo) {
+	e := jsonEvent{
+		Method: ti.Method,
+		Query:  ti.Query,
+		Start:  ti.Start,
+		End:    ti.End,
+		Dur:    ti.Elapsed(),
+		ConnID: ti.ConnID,
+		Tags:   ti.Tags,
+		Wait:   ti.Wait,
+		Batch:  ti.BatchSize,
+		Set:    ti.ResultSet,
+		Count:  ti.RowCount,
+		Bytes:  ti.ResponseBytes,
+		Base:   ti.Baseline,
+		TxID:   ti.TxID,
+		Rows:   ti.RowsAffected,
+		Warm:   ti.Warmup,
+		DLSrc:  ti.DeadlineSource,
+		DL:     ti.Deadline,
+		Cancel: ti.Canceled,
+		CLat:   ti.CancelLatency,
+		Hit:    ti.CacheHit,
+	}
+	if m := ti.Memory; m != (MemDelta{}) {
+		e.Mem = &jsonMem{Bytes: m.AllocBytes, Objects: m.AllocObjects, Cycles: m.GCCycles, Pause: m.GCPause}
+	}
+	for _, a := range ti.Args {
+		e.Args = append(e.Args, a)
+	}
+	for _, c := range ti.Columns {
+		e.Cols = append(e.Cols, jsonColumn{Name: c.Name, Type: c.DatabaseType})
+	}
+	if ti.Err != nil {
+		e.Err = ti.Err.Error()
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		handleError(&Error{Kind: ErrSerialization, Err: err})
+		return
+	}
+	b = append(b, '\n')
+	jl.mu.Lock()
+	_, err = jl.w.Write(b)
+	jl.mu.Unlock()
+	if err != nil {
+		handleError(&Error{Kind: ErrSink, Err: err})
+	}
+}
+
+// ReadJSONLog reads a log written by a JSON logger and calls f with each
+// event. Arguments come back as the types JSON decodes them to: numbers are
+// float64 and []byte values are base64 strings.
+func ReadJSONLog(r io.Reader, f func(TimerInfo)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(nil, 16*1024*1024)
+	line := 0
+	for sc.Scan() {
+		line++
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		var e jsonEvent
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return fmt.Errorf("dbtimer: line %d of JSON log: %v", line, err)
+		}
+		ti := TimerInfo{
+			Method:         e.Method,
+			Query:          e.Query,
+			Start:          e.Start,
+			End:            e.End,
+			Duration:       e.Dur,
+			ConnID:         e.ConnID,
+			Tags:           e.Tags,
+			Wait:           e.Wait,
+			BatchSize:      e.Batch,
+			ResultSet:      e.Set,
+			RowCount:       e.Count,
+			ResponseBytes:  e.Bytes,
+			Baseline:       e.Base,
+			TxID:           e.TxID,
+			RowsAffected:   e.Rows,
+			Warmup:         e.Warm,
+			DeadlineSource: e.DLSrc,
+			Deadline:       e.DL,
+			Canceled:       e.Cancel,
+			CancelLatency:  e.CLat,
+			CacheHit:       e.Hit,
+		}
+		if m := e.Mem; m != nil {
+			ti.Memory = MemDelta{AllocBytes: m.Bytes, AllocObjects: m.Objects, GCCycles: m.Cycles, GCPause: m.Pause}
+		}
+		for _, a := range e.Args {
+			ti.Args = append(ti.Args, a)
+		}
+		for _, c := range e.Cols {
+			ti.Columns = append(ti.Columns, Column{Name: c.Name, DatabaseType: c.Type})
+		}
+		if e.Err != "" {
+			ti.Err = errors.New(e.Err)
+		}
+		f(ti)
+	}
+	return sc.Err()
+}
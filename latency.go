@@ -0,0 +1,96 @@
+package dbtimer
+
+import (
+	"math/rand"
+	"time"
+)
+
+// A LatencyProfile decides how much latency a Fault injects, given how long
+// the faults have been in place. Profiles make it possible to check that
+// alerting and autoscaling react to latency that builds up or comes and goes.
+type LatencyProfile interface {
+	Latency(elapsed time.Duration) time.Duration
+}
+
+// LatencyProfileFunc adapts a function to the LatencyProfile interface.
+type LatencyProfileFunc func(elapsed time.Duration) time.Duration
+
+func (lpf LatencyProfileFunc) Latency(elapsed time.Duration) time.Duration {
+	return lpf(elapsed)
+}
+
+// Constant injects the same latency all the time.
+func Constant(latency time.Duration) LatencyProfile {
+	return LatencyProfileFunc(func(time.Duration) time.Duration {
+		return latency
+	})
+}
+
+// Ramp injects latency that grows steadily from from to to over the given
+// duration, and stays at to afterwards. Combined with a Fault Rate of 0.01,
+// it ramps up the p99.
+func Ramp(from, to, over time.Duration) LatencyProfile {
+	return LatencyProfileFunc(func(elapsed time.Duration) time.Duration {
+		if elapsed >= over || over <= 0 {
+			return to
+		}
+		return from + time.Duration(float64(to-from)*float64(elapsed)/float64(over))
+	})
+}
+
+// Spikes injects spike latency for length at the start of every period, and
+// no latency the rest of the time.
+func Spikes(spike, period, length time.Duration) LatencyProfile {
+	return LatencyProfileFunc(func(elapsed time.Duration) time.Duration {
+		if period <= 0 || elapsed%period < length {
+			return spike
+		}
+		return 0
+	})
+}
+
+// Jitter injects a random latency between min and max.
+func Jitter(min, max time.Duration) LatencyProfile {
+	return LatencyProfileFunc(func(time.Duration) time.Duration {
+		if max <= min {
+			return min
+		}
+		return min + time.Duration(rand.Int63n(int64(max-min)))
+	})
+}
+
+// Sum injects the total of the latencies of profiles, for example a Ramp with
+// Jitter on top.
+func Sum(profiles ...LatencyProfile) LatencyProfile {
+	return LatencyProfileFunc(func(elapsed time.Duration) time.Duration {
+		var total time.Duration
+		for _, p := range profiles {
+			total += p.Latency(elapsed)
+		}
+		return total
+	})
+}
+
+// A Stage is one step of a Schedule.
+type Stage struct {
+	For     time.Duration
+	Profile LatencyProfile
+}
+
+// Schedule runs each stage's profile for the stage's duration, one after the
+// other. Each profile sees the time elapsed since its own stage started. The
+// last stage carries on once the schedule is over.
+func Schedule(stages ...Stage) LatencyProfile {
+	return LatencyProfileFunc(func(elapsed time.Duration) time.Duration {
+		for i, s := range stages {
+			if elapsed < s.For || i == len(stages)-1 {
+				if s.Profile == nil {
+					return 0
+				}
+				return s.Profile.Latency(elapsed)
+			}
+			elapsed -= s.For
+		}
+		return 0
+	})
+}
@@ -0,0 +1,172 @@
+package dbtimer
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Linter is a TimerLogger that looks for SQL anti-patterns in the statements
+// that run, and reports each one once per fingerprint to OnFinding. Install
+// it alongside any other logger with MultiLogger.
+type Linter struct {
+	// Rules are the anti-patterns to look for. If it is nil,
+	// DefaultLintRules is used.
+	Rules []LintRule
+
+	// OnFinding is called the first time a fingerprint breaks a rule.
+	OnFinding func(LintFinding)
+
+	mu       sync.Mutex
+	seen     map[string]bool
+	findings []LintFinding
+}
+
+// LintRule is an anti-pattern. Match is given the event and the fingerprint
+// of its query.
+type LintRule struct {
+	Name        string
+	Description string
+	Match       func(ti TimerInfo, fingerprint string) bool
+}
+
+// LintFinding reports a fingerprint that breaks a rule, with the first query
+// that was seen breaking it.
+type LintFinding struct {
+	Rule        string
+	Description string
+	Fingerprint string
+	Query       string
+}
+
+// DefaultLintRules returns the rules that need no configuration: SelectStar,
+// LeadingWildcardLike and ImplicitCrossJoin.
+func DefaultLintRules() []LintRule {
+	return []LintRule{SelectStar(), LeadingWildcardLike(), ImplicitCrossJoin()}
+}
+
+var selectStarRE = regexp.MustCompile(`\bselect (distinct )?([\w"` + "`" + `]+\.)?\*`)
+
+// SelectStar flags queries that select every column, which breaks when
+// columns are added and reads more data than needed.
+func SelectStar() LintRule {
+	return LintRule{
+		Name:        "select-star",
+		Description: "SELECT * reads every column; list the columns you need",
+		Match: func(_ TimerInfo, fp string) bool {
+			return selectStarRE.MatchString(fp)
+		},
+	}
+}
+
+var (
+	likeLiteralRE     = regexp.MustCompile(`(?i)\blike\s+[en]?'%`)
+	likePlaceholderRE = regexp.MustCompile(`\blike \?`)
+)
+
+// LeadingWildcardLike flags LIKE patterns that start with %, which can't use
+// an index. Both literal patterns and string arguments bound to a LIKE are
+// checked.
+func LeadingWildcardLike() LintRule {
+	return LintRule{
+		Name:        "leading-wildcard-like",
+		Description: "LIKE with a leading % can't use an index",
+		Match: func(ti TimerInfo, fp string) bool {
+			if likeLiteralRE.MatchString(ti.Query) {
+				return true
+			}
+			if !likePlaceholderRE.MatchString(fp) {
+				return false
+			}
+			for _, a := range ti.Args {
+				var s string
+				switch v := a.(type) {
+				case string:
+					s = v
+				case []byte:
+					s = string(v)
+				}
+				if strings.HasPrefix(s, "%") {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+var commaJoinRE = regexp.MustCompile(`\bfrom [\w."` + "`" + `]+( as)?( [\w"` + "`" + `]+)?, [\w."` + "`" + `]+`)
+
+// ImplicitCrossJoin flags tables joined with a comma in the FROM clause. Unless
+// the WHERE clause relates them, that is a cross join, and even when it does
+// the join condition is easy to lose.
+func ImplicitCrossJoin() LintRule {
+	return LintRule{
+		Name:        "implicit-cross-join",
+		Description: "tables joined with a comma are a cross join unless the WHERE clause relates them; use JOIN ... ON",
+		Match: func(_ TimerInfo, fp string) bool {
+			return commaJoinRE.MatchString(fp)
+		},
+	}
+}
+
+var limitRE = regexp.MustCompile(`\blimit\b|\bfetch (first|next)\b|\btop\b`)
+
+// MissingLimit flags SELECTs from any of tables that have no LIMIT, since an
+// unbounded read of a large table can return millions of rows.
+func MissingLimit(tables ...string) LintRule {
+	quoted := make([]string, len(tables))
+	for i, t := range tables {
+		quoted[i] = regexp.QuoteMeta(strings.ToLower(t))
+	}
+	tableRE := regexp.MustCompile(`\b(from|join) ([\w"` + "`" + `]+\.)?["` + "`" + `]?(` + strings.Join(quoted, "|") + `)\b`)
+	return LintRule{
+		Name:        "missing-limit",
+		Description: "SELECT from a large table without a LIMIT",
+		Match: func(_ TimerInfo, fp string) bool {
+			return len(tables) > 0 && strings.HasPrefix(fp, "select ") && tableRE.MatchString(fp) && !limitRE.MatchString(fp)
+		},
+	}
+}
+
+// Log checks the statement run by ti against the rules.
+func (l *Linter) Log(ti TimerInfo) {
+	if !runsStatement(ti.Method) || ti.Query == "" {
+		return
+	}
+	rules := l.Rules
+	if rules == nil {
+		rules = DefaultLintRules()
+	}
+	fp := Fingerprint(ti.Query)
+	var found []LintFinding
+	l.mu.Lock()
+	if l.seen == nil {
+		l.seen = map[string]bool{}
+	}
+	for _, r := range rules {
+		key := r.Name + "\x00" + fp
+		if l.seen[key] || !r.Match(ti, fp) {
+			continue
+		}
+		l.seen[key] = true
+		f := LintFinding{Rule: r.Name, Description: r.Description, Fingerprint: fp, Query: ti.Query}
+		l.findings = append(l.findings, f)
+		found = append(found, f)
+	}
+	l.mu.Unlock()
+	if l.OnFinding != nil {
+		for _, f := range found {
+			l.OnFinding(f)
+		}
+	}
+}
+
+// Findings returns everything found so far.
+func (l *Linter) Findings() []LintFinding {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]LintFinding, len(l.findings))
+	copy(out, l.findings)
+	return out
+}
@@ -0,0 +1,40 @@
+package dbtimer
+
+import (
+	"errors"
+	"strings"
+)
+
+// IsLockError reports whether err is a deadlock or a lock timeout reported by
+// the database. Errors with a SQLState method, such as those of lib/pq and
+// pgx, are matched by their SQLSTATE; other errors by their message, which
+// covers MySQL, SQL Server, Oracle and SQLite.
+func IsLockError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var se interface{ SQLState() string }
+	if errors.As(err, &se) {
+		switch se.SQLState() {
+		case "40P01", "55P03":
+			return true
+		}
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range lockErrorMessages {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
+
+var lockErrorMessages = []string{
+	"deadlock",
+	"lock wait timeout",
+	"lock timeout",
+	"could not obtain lock",
+	"lock request time out",
+	"database is locked",
+	"acquire with wait timeout",
+}
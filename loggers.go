@@ -0,0 +1,163 @@
+package dbtimer
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// LoggerRegistry holds TimerLoggers by name, so that the subsystems of a
+// large application can send the events of their calls to different sinks
+// while sharing one timer driver and one *sql.DB. A subsystem makes its
+// calls with a context from WithLogger, and their events go to the logger
+// registered under its name.
+type LoggerRegistry struct {
+	mu      sync.RWMutex
+	loggers map[string]TimerLogger
+}
+
+var loggers = &LoggerRegistry{}
+
+// Loggers returns the process's registry of named loggers.
+func Loggers() *LoggerRegistry {
+	return loggers
+}
+
+// Get returns the logger registered under name, or nil if there is none.
+func (lr *LoggerRegistry) Get(name string) TimerLogger {
+	lr.mu.RLock()
+	defer lr.mu.RUnlock()
+	return lr.loggers[name]
+}
+
+// Set registers tl under name, replacing any logger already there. Passing
+// nil removes the logger registered under name.
+func (lr *LoggerRegistry) Set(name string, tl TimerLogger) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	if tl == nil {
+		delete(lr.loggers, name)
+		return
+	}
+	if lr.loggers == nil {
+		lr.loggers = map[string]TimerLogger{}
+	}
+	lr.loggers[name] = tl
+}
+
+// all returns the registered loggers, in the order of their names.
+func (lr *LoggerRegistry) all() []TimerLogger {
+	names := lr.Names()
+	lr.mu.RLock()
+	defer lr.mu.RUnlock()
+	out := make([]TimerLogger, 0, len(names))
+	for _, name := range names {
+		if tl, ok := lr.loggers[name]; ok {
+			out = append(out, tl)
+		}
+	}
+	return out
+}
+
+// Names returns the names of the registered loggers, in order.
+func (lr *LoggerRegistry) Names() []string {
+	lr.mu.RLock()
+	names := make([]string, 0, len(lr.loggers))
+	for name := range lr.loggers {
+		names = append(names, name)
+	}
+	lr.mu.RUnlock()
+	sort.Strings(names)
+	return names
+}
+
+type loggerNameKeyType int
+
+const loggerNameKey loggerNameKeyType = 0
+
+// WithLogger returns a context whose calls send their events to the logger
+// registered under name in Loggers. If no logger is registered under name
+// when an event is logged, it goes to the driver's logger as usual. Calls
+// made without a context, such as Commit, always go to the driver's logger.
+func WithLogger(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, loggerNameKey, name)
+}
+
+// loggerFor returns the logger for events from calls made with ctx: the
+// named logger ctx selects, if it is registered, or else d's.
+func (d *Driver) loggerFor(ctx context.Context) TimerLogger {
+	if d.disabled {
+		return nil
+	}
+	if name, _ := ctx.Value(loggerNameKey).(string); name != "" {
+		if tl := loggers.Get(name); tl != nil {
+			return tapped(tl)
+		}
+	}
+	return d.timerLogger()
+}
+
+// taps holds the loggers added with Tap, as a []*tap that is replaced, never
+// changed, so that loggers can be read without a lock.
+var taps struct {
+	mu   sync.Mutex
+	list atomic.Value
+}
+
+type tap struct {
+	tl TimerLogger
+}
+
+// Tap passes the events of every Driver's calls to tl as well, whichever
+// logger they go to, or if they go to none, until the returned function is
+// called. It leaves the loggers, and the events kept before the first one is
+// set, as they are, so that tests and debugging tools can watch the calls of
+// a process without taking over its logging.
+func Tap(tl TimerLogger) func() {
+	t := &tap{tl}
+	taps.mu.Lock()
+	old, _ := taps.list.Load().([]*tap)
+	taps.list.Store(append(append([]*tap(nil), old...), t))
+	taps.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			taps.mu.Lock()
+			old, _ := taps.list.Load().([]*tap)
+			list := make([]*tap, 0, len(old))
+			for _, o := range old {
+				if o != t {
+					list = append(list, o)
+				}
+			}
+			taps.list.Store(list)
+			taps.mu.Unlock()
+		})
+	}
+}
+
+// tapped returns tl, passing its events to the taps as well if there are any.
+func tapped(tl TimerLogger) TimerLogger {
+	list, _ := taps.list.Load().([]*tap)
+	if len(list) == 0 {
+		return tl
+	}
+	return tapLogger{tl, list}
+}
+
+type tapLogger struct {
+	tl   TimerLogger
+	taps []*tap
+}
+
+// Log passes ti to the logger and then to each tap, each through logEvent so
+// that one that panics doesn't keep ti from the others.
+func (tl tapLogger) Log(ti TimerInfo) {
+	if tl.tl != nil {
+		logEvent(tl.tl, ti)
+	}
+	for _, t := range tl.taps {
+		logEvent(t.tl, ti)
+	}
+}
@@ -0,0 +1,125 @@
+package dbtimer
+
+import (
+	"math"
+	"runtime/metrics"
+	"time"
+)
+
+// MemDelta is what the Go runtime did while a call ran: the bytes and
+// objects allocated on the heap, the garbage collections that finished and
+// the time the world was stopped for them. It tells a statement that was
+// slow in the database from one that was slow because a collection paused it
+// or because reading its results allocated heavily.
+//
+// The counts are for the whole process, not the goroutine that made the
+// call, so under concurrency they include what other goroutines did
+// meanwhile. GCPause is estimated from the runtime's histogram of pauses.
+type MemDelta struct {
+	AllocBytes   uint64
+	AllocObjects uint64
+	GCCycles     uint64
+	GCPause      time.Duration
+}
+
+// SetMemStats sets whether d records the MemDelta of each call in its event,
+// and of reading the results of each query in its "rows.Close" event if it
+// estimates response sizes. It is a debugging aid with a high overhead: it
+// reads the runtime's metrics twice per call, which allocates and takes
+// locks in the runtime, so don't leave it on in production.
+func (d *Driver) SetMemStats(on bool) {
+	d.memStats.Store(on)
+}
+
+// WithMemStats has the driver record the MemDelta of each call, as
+// SetMemStats does.
+func WithMemStats() Option {
+	return func(d *Driver) error {
+		d.SetMemStats(true)
+		return nil
+	}
+}
+
+// memMetrics are the runtime metrics a memSample reads, in the order of its
+// fields.
+var memMetrics = []string{
+	"/gc/heap/allocs:bytes",
+	"/gc/heap/allocs:objects",
+	"/gc/cycles/total:gc-cycles",
+	"/sched/pauses/total/gc:seconds",
+}
+
+// memSample is a reading of the runtime's cumulative memory metrics.
+type memSample struct {
+	bytes   uint64
+	objects uint64
+	cycles  uint64
+	pause   float64
+}
+
+// sampleMem reads the runtime's memory metrics if d records MemDeltas, and
+// returns nil otherwise.
+func (d *Driver) sampleMem() *memSample {
+	if on, _ := d.memStats.Load().(bool); !on {
+		return nil
+	}
+	return readMem()
+}
+
+func readMem() *memSample {
+	samples := make([]metrics.Sample, len(memMetrics))
+	for i, name := range memMetrics {
+		samples[i].Name = name
+	}
+	metrics.Read(samples)
+	ms := &memSample{}
+	if v := samples[0].Value; v.Kind() == metrics.KindUint64 {
+		ms.bytes = v.Uint64()
+	}
+	if v := samples[1].Value; v.Kind() == metrics.KindUint64 {
+		ms.objects = v.Uint64()
+	}
+	if v := samples[2].Value; v.Kind() == metrics.KindUint64 {
+		ms.cycles = v.Uint64()
+	}
+	if v := samples[3].Value; v.Kind() == metrics.KindFloat64Histogram {
+		ms.pause = histogramSum(v.Float64Histogram())
+	}
+	return ms
+}
+
+// histogramSum estimates the sum of the values in h from the midpoints of
+// its buckets.
+func histogramSum(h *metrics.Float64Histogram) float64 {
+	var sum float64
+	for i, c := range h.Counts {
+		if c == 0 {
+			continue
+		}
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+		mid := (lo + hi) / 2
+		switch {
+		case math.IsInf(lo, -1):
+			mid = hi
+		case math.IsInf(hi, 1):
+			mid = lo
+		}
+		sum += float64(c) * mid
+	}
+	return sum
+}
+
+// since returns what the runtime did since ms was read, or the zero MemDelta
+// if ms is nil.
+func (ms *memSample) since() MemDelta {
+	if ms == nil {
+		return MemDelta{}
+	}
+	now := readMem()
+	return MemDelta{
+		AllocBytes:   now.bytes - ms.bytes,
+		AllocObjects: now.objects - ms.objects,
+		GCCycles:     now.cycles - ms.cycles,
+		GCPause:      time.Duration((now.pause - ms.pause) * float64(time.Second)),
+	}
+}
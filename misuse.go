@@ -0,0 +1,185 @@
+package dbtimer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// SetMisuseDetection sets whether d checks that its statements and
+// transactions are used by one goroutine at a time, and that no transaction
+// is begun on a connection that already has one open. Each *Stmt and *Tx
+// records the goroutine that created it, and is marked in use while one of
+// its methods runs; a call that finds it already in use logs a
+// "misuse.Concurrent" event whose Err is a *MisuseError. The sql package
+// serializes the calls it makes itself, so these come from code that holds
+// on to driver values, through UnwrapConn or (*sql.Conn).Raw, and shares them
+// between goroutines: misuse the race detector only finds in the runs it
+// watches.
+//
+// Beginning a transaction on a connection whose last transaction was neither
+// committed nor rolled back logs a "misuse.NestedTx" event whose Err is a
+// *NestedTxError with the call sites of both Begins. It usually means a
+// helper layer that begins its own transaction without checking for one
+// already in progress.
+//
+// Finding the goroutine and call site costs a stack trace per statement
+// prepared and transaction begun, and per conflict.
+func (d *Driver) SetMisuseDetection(on bool) {
+	d.misuse.Store(on)
+}
+
+// WithMisuseDetection has the driver check that its statements and
+// transactions are used by one goroutine at a time, as SetMisuseDetection
+// does.
+func WithMisuseDetection() Option {
+	return func(d *Driver) error {
+		d.SetMisuseDetection(true)
+		return nil
+	}
+}
+
+// ErrMisuse matches every *MisuseError and *NestedTxError with errors.Is.
+var ErrMisuse = errors.New("dbtimer: misuse of a connection")
+
+// MisuseError describes a statement or transaction that was used by two
+// goroutines at once. Object is "stmt" or "tx", Creator is the goroutine that
+// created it and Goroutine the one that tried to use it while another
+// goroutine was.
+type MisuseError struct {
+	Object    string
+	Creator   uint64
+	Goroutine uint64
+}
+
+func (me *MisuseError) Error() string {
+	return fmt.Sprintf("%v: %s created by goroutine %d used by goroutine %d while another goroutine was using it",
+		ErrMisuse, me.Object, me.Creator, me.Goroutine)
+}
+
+func (me *MisuseError) Is(target error) bool {
+	return target == ErrMisuse
+}
+
+// NestedTxError describes a transaction begun on a connection that already
+// had one open. TxID is the ID of the open transaction, OpenedAt the call
+// site that began it and BegunAt the call site of the new Begin.
+type NestedTxError struct {
+	TxID     uint64
+	OpenedAt string
+	BegunAt  string
+}
+
+func (ne *NestedTxError) Error() string {
+	return fmt.Sprintf("%v: transaction begun at %s while transaction %d, begun at %s, is open",
+		ErrMisuse, ne.BegunAt, ne.TxID, ne.OpenedAt)
+}
+
+func (ne *NestedTxError) Is(target error) bool {
+	return target == ErrMisuse
+}
+
+// checkNestedTx logs a "misuse.NestedTx" event if the driver detects misuse
+// and a transaction is already open on the connection.
+func (cs *connState) checkNestedTx() {
+	if on, _ := cs.d.misuse.Load().(bool); !on {
+		return
+	}
+	txID := atomic.LoadUint64(&cs.txID)
+	if txID == 0 {
+		return
+	}
+	tl := cs.d.timerLogger()
+	if tl == nil {
+		return
+	}
+	opened, _ := cs.txSite.Load().(string)
+	now := cs.d.now()
+	logEvent(tl, TimerInfo{
+		Method: "misuse.NestedTx",
+		Start:  now,
+		End:    now,
+		Err:    &NestedTxError{TxID: txID, OpenedAt: opened, BegunAt: callSite()},
+		ConnID: cs.id,
+		Tags:   cs.labels,
+		TxID:   txID,
+	})
+}
+
+// callSite returns the file, line and function of the application code that
+// called into the sql package, skipping the frames of this package and of
+// database/sql.
+func callSite() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, "database/sql.") && !strings.HasPrefix(f.Function, "github.com/jonbodner/dbtimer.") {
+			return fmt.Sprintf("%s:%d (%s)", f.File, f.Line, f.Function)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// useGuard tracks the goroutine using a statement or transaction. A nil
+// *useGuard checks nothing.
+type useGuard struct {
+	object  string
+	creator uint64
+	inUse   int32
+}
+
+// newGuard returns a guard for a statement or transaction created on the
+// connection, or nil if d doesn't detect misuse.
+func (cs *connState) newGuard(object string) *useGuard {
+	if on, _ := cs.d.misuse.Load().(bool); !on {
+		return nil
+	}
+	return &useGuard{object: object, creator: goroutineID()}
+}
+
+// enter marks the guarded value in use by the calling goroutine, logging a
+// "misuse.Concurrent" event if another goroutine is using it, and returns the
+// function that marks it idle again.
+func (g *useGuard) enter(cs *connState, query string) func() {
+	if g == nil {
+		return func() {}
+	}
+	if atomic.CompareAndSwapInt32(&g.inUse, 0, 1) {
+		return func() { atomic.StoreInt32(&g.inUse, 0) }
+	}
+	if tl := cs.d.timerLogger(); tl != nil {
+		now := cs.d.now()
+		query, _ = scrub("misuse.Concurrent", query, nil)
+		query, _ = cs.d.truncate(query)
+		logEvent(tl, TimerInfo{
+			Method: "misuse.Concurrent",
+			Query:  query,
+			Start:  now,
+			End:    now,
+			Err:    &MisuseError{Object: g.object, Creator: g.creator, Goroutine: goroutineID()},
+			ConnID: cs.id,
+			Tags:   cs.labels,
+		})
+	}
+	return func() {}
+}
+
+// goroutineID returns the ID of the calling goroutine, as it appears in stack
+// traces.
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
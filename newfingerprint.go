@@ -0,0 +1,242 @@
+package dbtimer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// FingerprintWatch has a driver report each fingerprint the first time it
+// runs, to catch newly deployed queries, and optionally again when its
+// latency shifts, to catch plan regressions. The reports are events logged
+// to the driver's logger alongside the calls' own:
+//
+//   - "query.NewFingerprint", the first time a fingerprint is seen, with the
+//     fingerprint as its Query and the first call's Start and End.
+//   - "query.LatencyShift", when the moving average of a fingerprint's
+//     latency has changed by ShiftFactor since it was last reported, with
+//     the old and new averages in the "previous_mean" and "mean" tags.
+//   - "query.RateSurge", when a fingerprint runs SurgeFactor times as often
+//     in a minute as it did on average over the SurgeWindow before, with the
+//     two rates in calls per minute in the "previous_rate" and "rate" tags.
+//     Retry storms and bugs that bypass a cache show up as surges well
+//     before they show up as latency.
+//
+// Watching fingerprints costs a Fingerprint of every statement.
+type FingerprintWatch struct {
+	// CallSite adds the file, line and function of the application code
+	// that ran the statement to NewFingerprint events, in the "call_site"
+	// tag.
+	CallSite bool
+
+	// ShiftFactor, if not 0, is how many times slower or faster a
+	// fingerprint's average latency must become to be reported as a
+	// shift. It must be greater than 1.
+	ShiftFactor float64
+
+	// MinCalls is the number of calls a fingerprint must have before its
+	// average is compared, and again after each shift. The default is 100.
+	MinCalls int
+
+	// SurgeFactor, if not 0, is how many times its average rate a
+	// fingerprint must run at in a minute to be reported as a surge. It
+	// must be greater than 1. A minute needs MinCalls calls to be a surge,
+	// and a fingerprint is reported at most once a minute.
+	SurgeFactor float64
+
+	// SurgeWindow is the period before the current minute that a
+	// fingerprint's average rate is measured over, in whole minutes. The
+	// default is 30 minutes.
+	SurgeWindow time.Duration
+
+	// MaxFingerprints is the number of fingerprints tracked. Once it is
+	// reached, new fingerprints are not reported and ErrDropped is
+	// reported to the error handler once. The default is 10000.
+	MaxFingerprints int
+}
+
+// SetFingerprintWatch sets the watching of fingerprints by d. Passing nil
+// stops it. Setting it again forgets the fingerprints seen so far. It is an
+// ErrConfig error if ShiftFactor or SurgeFactor is neither 0 nor greater than
+// 1.
+func (d *Driver) SetFingerprintWatch(fw *FingerprintWatch) error {
+	if fw == nil {
+		d.fpWatch.Store((*fingerprintWatcher)(nil))
+		return nil
+	}
+	if fw.ShiftFactor != 0 && fw.ShiftFactor <= 1 {
+		return &Error{Kind: ErrConfig, Err: fmt.Errorf("fingerprint watch ShiftFactor %v is not greater than 1", fw.ShiftFactor)}
+	}
+	if fw.SurgeFactor != 0 && fw.SurgeFactor <= 1 {
+		return &Error{Kind: ErrConfig, Err: fmt.Errorf("fingerprint watch SurgeFactor %v is not greater than 1", fw.SurgeFactor)}
+	}
+	w := &fingerprintWatcher{cfg: *fw, seen: map[string]*fingerprintProfile{}}
+	if w.cfg.MinCalls <= 0 {
+		w.cfg.MinCalls = 100
+	}
+	if w.cfg.MaxFingerprints <= 0 {
+		w.cfg.MaxFingerprints = 10000
+	}
+	if w.cfg.SurgeWindow < time.Minute {
+		w.cfg.SurgeWindow = 30 * time.Minute
+	}
+	d.fpWatch.Store(w)
+	return nil
+}
+
+// WithFingerprintWatch sets the watching of fingerprints by the driver, as
+// SetFingerprintWatch does.
+func WithFingerprintWatch(fw *FingerprintWatch) Option {
+	return func(d *Driver) error {
+		return d.SetFingerprintWatch(fw)
+	}
+}
+
+// shiftAlpha is the weight of each call in a fingerprint's moving average.
+const shiftAlpha = 0.05
+
+type fingerprintWatcher struct {
+	cfg  FingerprintWatch
+	mu   sync.Mutex
+	seen map[string]*fingerprintProfile
+	full bool
+}
+
+type fingerprintProfile struct {
+	calls     int
+	mean      float64
+	reference float64
+	rate      *callRate
+}
+
+// callRate counts a fingerprint's calls in each minute of its surge window
+// and the current one.
+type callRate struct {
+	minutes []minuteCalls
+	first   int64
+	surged  int64
+}
+
+type minuteCalls struct {
+	epoch int64
+	n     int
+}
+
+// add counts a call in minute, and returns the calls in it so far and the
+// average calls per minute over the window before it, which is shortened to
+// the minutes since the first call. ok is false if there is no minute
+// before it to average.
+func (cr *callRate) add(minute int64) (n int, avg float64, ok bool) {
+	m := &cr.minutes[int(minute%int64(len(cr.minutes)))]
+	if m.epoch != minute {
+		*m = minuteCalls{epoch: minute}
+	}
+	m.n++
+	window := int64(len(cr.minutes) - 1)
+	if minute-cr.first < window {
+		window = minute - cr.first
+	}
+	if window <= 0 {
+		return m.n, 0, false
+	}
+	total := 0
+	for _, c := range cr.minutes {
+		if c.epoch < minute && c.epoch >= minute-window {
+			total += c.n
+		}
+	}
+	return m.n, float64(total) / float64(window), true
+}
+
+// watchFingerprint logs to tl the events for a call of query that ran from
+// s to e, if it is the first of its fingerprint or shifts its latency.
+func (cs *connState) watchFingerprint(ctx context.Context, tl TimerLogger, method, query string, s, e time.Time, warm bool) {
+	w, _ := cs.d.fpWatch.Load().(*fingerprintWatcher)
+	if w == nil || query == "" || method == "driver.Open" || method == "conn.Prepare" {
+		return
+	}
+	fp := Fingerprint(query)
+	dur := float64(e.Sub(s))
+	var first, shifted, surged, dropped bool
+	var previous, mean, usual, rate float64
+	w.mu.Lock()
+	p := w.seen[fp]
+	switch {
+	case p != nil && warm:
+	case p != nil:
+		p.calls++
+		if p.calls == 1 {
+			p.mean = dur
+		} else {
+			p.mean += shiftAlpha * (dur - p.mean)
+		}
+		if p.calls == w.cfg.MinCalls {
+			p.reference = p.mean
+		} else if p.calls > w.cfg.MinCalls && w.cfg.ShiftFactor != 0 &&
+			(p.mean > p.reference*w.cfg.ShiftFactor || p.mean*w.cfg.ShiftFactor < p.reference) {
+			shifted, previous, mean = true, p.reference, p.mean
+			p.calls, p.reference = 0, 0
+		}
+		surged, usual, rate = w.countCall(p, e)
+	case len(w.seen) < w.cfg.MaxFingerprints:
+		p = &fingerprintProfile{}
+		if w.cfg.SurgeFactor != 0 {
+			minute := e.UnixNano() / int64(time.Minute)
+			p.rate = &callRate{minutes: make([]minuteCalls, int(w.cfg.SurgeWindow/time.Minute)+1), first: minute, surged: -1}
+		}
+		if !warm {
+			p.calls, p.mean = 1, dur
+			w.countCall(p, e)
+		}
+		w.seen[fp] = p
+		first = true
+	case !w.full:
+		w.full, dropped = true, true
+	}
+	w.mu.Unlock()
+	switch {
+	case dropped:
+		handleError(&Error{Kind: ErrDropped, Err: errors.New("fingerprint watch is tracking MaxFingerprints fingerprints, new ones are not reported")})
+	case first:
+		tags := cs.statementTags(ctx, query)
+		if w.cfg.CallSite {
+			tags = withTag(tags, "call_site", callSite())
+		}
+		logEvent(tl, TimerInfo{Method: "query.NewFingerprint", Query: fp, Start: s, End: e, ConnID: cs.id, Tags: tags})
+	case shifted:
+		tags := withTag(withTag(cs.statementTags(ctx, query), "previous_mean", time.Duration(previous).String()), "mean", time.Duration(mean).String())
+		logEvent(tl, TimerInfo{Method: "query.LatencyShift", Query: fp, Start: s, End: e, ConnID: cs.id, Tags: tags})
+	}
+	if surged {
+		tags := withTag(withTag(cs.statementTags(ctx, query), "previous_rate", fmt.Sprintf("%.1f/min", usual)), "rate", fmt.Sprintf("%.0f/min", rate))
+		logEvent(tl, TimerInfo{Method: "query.RateSurge", Query: fp, Start: s, End: e, ConnID: cs.id, Tags: tags})
+	}
+}
+
+// countCall counts a call of p's fingerprint that ended at e, and reports
+// whether it makes its minute a surge, with the usual and current rates.
+// w.mu is held.
+func (w *fingerprintWatcher) countCall(p *fingerprintProfile, e time.Time) (bool, float64, float64) {
+	if p.rate == nil {
+		return false, 0, 0
+	}
+	minute := e.UnixNano() / int64(time.Minute)
+	n, usual, ok := p.rate.add(minute)
+	if !ok || n < w.cfg.MinCalls || p.rate.surged == minute || float64(n) <= usual*w.cfg.SurgeFactor {
+		return false, 0, 0
+	}
+	p.rate.surged = minute
+	return true, usual, float64(n)
+}
+
+// withTag returns a copy of tags with key=value added.
+func withTag(tags map[string]string, key, value string) map[string]string {
+	out := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		out[k] = v
+	}
+	out[key] = value
+	return out
+}
@@ -0,0 +1,320 @@
+package otlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// Config configures an Exporter.
+type Config struct {
+	// Endpoint is the base URL of the OTLP/HTTP receiver, such as
+	// "http://localhost:4318". Spans are sent to /v1/traces and metrics to
+	// /v1/metrics under it.
+	Endpoint string
+
+	// ServiceName is reported as the service.name resource attribute.
+	ServiceName string
+
+	// Headers are added to every request, for example for authentication.
+	Headers map[string]string
+
+	// Client sends the requests. If it is nil, a client with a ten second
+	// timeout is used.
+	Client *http.Client
+
+	// Buckets are the upper bounds of the latency histograms. If it is empty,
+	// dbtimer.DefaultBuckets is used.
+	Buckets []time.Duration
+
+	// Labels are tag keys to break the metrics down by as well as the
+	// fingerprint, as in dbtimer.Stats.
+	Labels []string
+
+	// BatchSize is the most spans sent in one request. The default is 512.
+	BatchSize int
+
+	// FlushInterval is how often queued spans and the metrics are sent. The
+	// default is ten seconds.
+	FlushInterval time.Duration
+
+	// QueueSize is the number of spans that can wait to be sent. The default
+	// is 4096.
+	QueueSize int
+
+	// Backpressure is what happens to a span when the queue is full. The
+	// default is dbtimer.DropNewest, which drops it and reports ErrDropped to
+	// the error handler. The metrics count every event either way.
+	Backpressure dbtimer.Backpressure
+
+	// BlockTimeout is how long a span waits for room under dbtimer.Block. The
+	// default is 100 milliseconds.
+	BlockTimeout time.Duration
+}
+
+// Exporter is a dbtimer.TimerLogger that sends events as OTLP spans and
+// metrics. Sending happens in the background, and problems are reported to
+// the error handler.
+type Exporter struct {
+	cfg      Config
+	resource resource
+	start    time.Time
+	stats    *dbtimer.Stats
+	queue    *dbtimer.Queue
+	flush    chan chan struct{}
+	quit     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewExporter returns an Exporter that sends to cfg.Endpoint.
+func NewExporter(cfg Config) (*Exporter, error) {
+	if !strings.HasPrefix(cfg.Endpoint, "http://") && !strings.HasPrefix(cfg.Endpoint, "https://") {
+		return nil, &dbtimer.Error{Kind: dbtimer.ErrConfig, Err: fmt.Errorf("OTLP endpoint %q is not an http or https URL", cfg.Endpoint)}
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 512
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 10 * time.Second
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 4096
+	}
+	attrs := []keyValue{stringAttr("telemetry.sdk.name", "dbtimer")}
+	if cfg.ServiceName != "" {
+		attrs = append(attrs, stringAttr("service.name", cfg.ServiceName))
+	}
+	e := &Exporter{
+		cfg:      cfg,
+		resource: resource{Attributes: attrs},
+		start:    time.Now(),
+		stats:    &dbtimer.Stats{Buckets: cfg.Buckets, Labels: cfg.Labels},
+		queue:    dbtimer.NewQueue("otlp exporter", cfg.QueueSize, cfg.Backpressure, cfg.BlockTimeout),
+		flush:    make(chan chan struct{}),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e, nil
+}
+
+// Log adds ti to the metrics and queues it to be sent as a span.
+func (e *Exporter) Log(ti dbtimer.TimerInfo) {
+	e.stats.Log(ti)
+	e.queue.Put(ti)
+}
+
+// QueueStats returns the counts of spans queued and lost.
+func (e *Exporter) QueueStats() dbtimer.QueueStats {
+	return e.queue.Stats()
+}
+
+// Flush sends the queued spans and the metrics without waiting for the flush
+// interval. Failures are reported to the error handler, as they are in the
+// background.
+func (e *Exporter) Flush() error {
+	req := make(chan struct{})
+	select {
+	case e.flush <- req:
+		<-req
+	case <-e.done:
+	}
+	return nil
+}
+
+// Close sends the queued spans and the metrics one last time, and stops the
+// exporter.
+func (e *Exporter) Close() error {
+	e.once.Do(func() {
+		e.queue.Close()
+		close(e.quit)
+	})
+	<-e.done
+	return nil
+}
+
+func (e *Exporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(e.cfg.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]dbtimer.TimerInfo, 0, e.cfg.BatchSize)
+	for {
+		select {
+		case ti := <-e.queue.Events():
+			batch = append(batch, ti)
+			if len(batch) >= e.cfg.BatchSize {
+				batch = e.sendSpans(batch)
+			}
+		case <-ticker.C:
+			batch = e.sendSpans(batch)
+			e.sendMetrics()
+		case req := <-e.flush:
+			batch = e.sendSpans(e.drain(batch))
+			e.sendMetrics()
+			close(req)
+		case <-e.quit:
+			e.sendSpans(e.drain(batch))
+			e.sendMetrics()
+			return
+		}
+	}
+}
+
+// drain adds the queued spans to batch, sending it whenever it is full.
+func (e *Exporter) drain(batch []dbtimer.TimerInfo) []dbtimer.TimerInfo {
+	for ti, ok := e.queue.Next(); ok; ti, ok = e.queue.Next() {
+		batch = append(batch, ti)
+		if len(batch) >= e.cfg.BatchSize {
+			batch = e.sendSpans(batch)
+		}
+	}
+	return batch
+}
+
+func (e *Exporter) scope() scope {
+	return scope{Name: "github.com/jonbodner/dbtimer"}
+}
+
+// sendSpans sends batch and returns it emptied for reuse.
+func (e *Exporter) sendSpans(batch []dbtimer.TimerInfo) []dbtimer.TimerInfo {
+	if len(batch) == 0 {
+		return batch
+	}
+	spans := make([]span, len(batch))
+	for i, ti := range batch {
+		spans[i] = toSpan(ti)
+	}
+	req := traceRequest{ResourceSpans: []resourceSpans{{
+		Resource:   e.resource,
+		ScopeSpans: []scopeSpans{{Scope: e.scope(), Spans: spans}},
+	}}}
+	if !e.post("/v1/traces", req) {
+		dbtimer.ReportError(dbtimer.ErrDropped, fmt.Errorf("otlp: dropped %d spans", len(batch)))
+	}
+	return batch[:0]
+}
+
+func toSpan(ti dbtimer.TimerInfo) span {
+	s := span{
+		TraceID:           randomID(16),
+		SpanID:            randomID(8),
+		Name:              ti.Method,
+		Kind:              spanKindClient,
+		StartTimeUnixNano: nanos(ti.Start),
+		EndTimeUnixNano:   nanos(ti.End),
+	}
+	if ti.Query != "" {
+		s.Attributes = append(s.Attributes, stringAttr("db.statement", ti.Query))
+	}
+	if ti.ConnID != 0 {
+		s.Attributes = append(s.Attributes, intAttr("dbtimer.conn_id", ti.ConnID))
+	}
+	for k, v := range ti.Tags {
+		s.Attributes = append(s.Attributes, stringAttr(k, v))
+	}
+	if ti.Err != nil {
+		s.Status = status{Code: statusCodeError, Message: ti.Err.Error()}
+	}
+	return s
+}
+
+// sendMetrics sends the cumulative stats of every fingerprint and stored
+// procedure seen so far.
+func (e *Exporter) sendMetrics() {
+	report := e.stats.Report()
+	if len(report) == 0 {
+		return
+	}
+	start, now := nanos(e.start), nanos(time.Now())
+	h := &histogram{AggregationTemporality: temporalityCumulative}
+	errs := &sum{AggregationTemporality: temporalityCumulative, IsMonotonic: true}
+	for _, qs := range report {
+		attrs := []keyValue{stringAttr("db.statement.fingerprint", qs.Fingerprint)}
+		if qs.Procedure != "" {
+			attrs = []keyValue{stringAttr("db.stored_procedure.name", qs.Procedure)}
+		}
+		for _, l := range e.cfg.Labels {
+			attrs = append(attrs, stringAttr(l, qs.Labels[l]))
+		}
+		dp := histogramDataPoint{
+			Attributes:        attrs,
+			StartTimeUnixNano: start,
+			TimeUnixNano:      now,
+			Count:             strconv.FormatInt(qs.Count, 10),
+			Sum:               qs.Total.Seconds(),
+			Max:               qs.Max.Seconds(),
+		}
+		for _, b := range qs.Latency.Bounds {
+			dp.ExplicitBounds = append(dp.ExplicitBounds, b.Seconds())
+		}
+		for _, c := range qs.Latency.Counts {
+			dp.BucketCounts = append(dp.BucketCounts, strconv.FormatInt(c, 10))
+		}
+		h.DataPoints = append(h.DataPoints, dp)
+		errs.DataPoints = append(errs.DataPoints, numberDataPoint{
+			Attributes:        attrs,
+			StartTimeUnixNano: start,
+			TimeUnixNano:      now,
+			AsInt:             strconv.FormatInt(qs.Errors, 10),
+		})
+	}
+	req := metricsRequest{ResourceMetrics: []resourceMetrics{{
+		Resource: e.resource,
+		ScopeMetrics: []scopeMetrics{{Scope: e.scope(), Metrics: []metric{
+			{Name: "db.client.operation.duration", Description: "Duration of database statements.", Unit: "s", Histogram: h},
+			{Name: "db.client.operation.errors", Description: "Database statements that failed.", Unit: "{statement}", Sum: errs},
+		}}},
+	}}}
+	e.post("/v1/metrics", req)
+}
+
+// post sends v to the collector's path and reports whether it was accepted.
+// A failure is reported to the error handler: as ErrSerialization if v
+// couldn't be encoded, and as ErrSink otherwise.
+func (e *Exporter) post(path string, v interface{}) bool {
+	body, err := json.Marshal(v)
+	if err != nil {
+		dbtimer.ReportError(dbtimer.ErrSerialization, fmt.Errorf("otlp: can't encode %s request: %v", path, err))
+		return false
+	}
+	if err := e.send(path, body); err != nil {
+		dbtimer.ReportError(dbtimer.ErrSink, err)
+		return false
+	}
+	return true
+}
+
+func (e *Exporter) send(path string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, e.cfg.Endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("otlp: %s returned %s: %s", path, resp.Status, bytes.TrimSpace(msg))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
@@ -0,0 +1,161 @@
+package dbtimer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+)
+
+// OwnerTag is the tag that holds the team that owns a statement.
+const OwnerTag = "owner"
+
+// Owners maps statements to the teams that own them, so that slow statements
+// and the alerts about them reach the right team in a large codebase. A
+// statement is owned by the owner of its fingerprint if it has one, or else
+// by the first of Tables that matches its table, or else by Default.
+type Owners struct {
+	// Default owns the statements nothing else does. It may be empty.
+	Default string
+
+	// Fingerprints are owners by statement. The keys can be any query
+	// with the same fingerprint.
+	Fingerprints map[string]string
+
+	// Tables are owners by table, tried in order.
+	Tables []TableOwner
+}
+
+// TableOwner owns the statements whose table, as Table returns it, matches
+// Pattern, a path.Match pattern such as "billing.*" or "order_*". Tables are
+// lower case.
+type TableOwner struct {
+	Pattern string
+	Owner   string
+}
+
+// SetOwners sets the owners of the statements run through d. The owner of
+// each statement is added to its events in the OwnerTag tag, unless the
+// call's context, the connection or the statement's comments already set
+// one, and so reaches Stats labels, RegressionDetector regressions and the
+// other loggers. Passing nil stops adding owners. It is an ErrConfig error if
+// a table pattern is malformed.
+func (d *Driver) SetOwners(o *Owners) error {
+	var h ownersHolder
+	if o != nil {
+		for _, t := range o.Tables {
+			if _, err := path.Match(t.Pattern, ""); err != nil {
+				return &Error{Kind: ErrConfig, Err: fmt.Errorf("owner table pattern %q: %w", t.Pattern, err)}
+			}
+		}
+		h.o = &Owners{Default: o.Default, Fingerprints: map[string]string{}, Tables: append([]TableOwner(nil), o.Tables...)}
+		for q, owner := range o.Fingerprints {
+			h.o.Fingerprints[Fingerprint(q)] = owner
+		}
+	}
+	d.owners.Store(h)
+	return nil
+}
+
+// WithOwners sets the owners of the driver's statements, as SetOwners does.
+func WithOwners(o *Owners) Option {
+	return func(d *Driver) error {
+		return d.SetOwners(o)
+	}
+}
+
+type ownersHolder struct {
+	o *Owners
+}
+
+// Owner returns the owner of query under the owners set on d, or "" if it
+// has none.
+func (d *Driver) Owner(query string) string {
+	h, _ := d.owners.Load().(ownersHolder)
+	if h.o == nil {
+		return ""
+	}
+	fp := Fingerprint(query)
+	if owner, ok := h.o.Fingerprints[fp]; ok {
+		return owner
+	}
+	if table := statementTable(fp); table != "" {
+		for _, t := range h.o.Tables {
+			if ok, _ := path.Match(t.Pattern, table); ok {
+				return t.Owner
+			}
+		}
+	}
+	return h.o.Default
+}
+
+// withOwner adds the owner of query to tags, unless they already have one.
+func (d *Driver) withOwner(tags map[string]string, query string) map[string]string {
+	if _, ok := tags[OwnerTag]; ok {
+		return tags
+	}
+	if owner := d.Owner(query); owner != "" {
+		return withTag(tags, OwnerTag, owner)
+	}
+	return tags
+}
+
+// OwnedBy returns a Match for an SLO that covers the statements owned by any
+// of owners, as their OwnerTag tag says.
+func OwnedBy(owners ...string) func(TimerInfo) bool {
+	return func(ti TimerInfo) bool {
+		owner := ti.Tags[OwnerTag]
+		for _, o := range owners {
+			if o == owner {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type jsonOwners struct {
+	Default      string            `json:"default"`
+	Fingerprints map[string]string `json:"fingerprints"`
+	Tables       []struct {
+		Pattern string `json:"pattern"`
+		Owner   string `json:"owner"`
+	} `json:"tables"`
+}
+
+func (jo *jsonOwners) owners() *Owners {
+	o := &Owners{Default: jo.Default, Fingerprints: jo.Fingerprints}
+	for _, t := range jo.Tables {
+		o.Tables = append(o.Tables, TableOwner{Pattern: t.Pattern, Owner: t.Owner})
+	}
+	return o
+}
+
+// ParseOwners parses Owners from JSON:
+//
+//	{
+//	  "default": "platform",
+//	  "fingerprints": {"SELECT * FROM orders WHERE id = ?": "checkout"},
+//	  "tables": [{"pattern": "billing.*", "owner": "payments"}]
+//	}
+//
+// It is an ErrConfig error if the JSON is malformed or has unknown fields.
+func ParseOwners(data []byte) (*Owners, error) {
+	var jo jsonOwners
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&jo); err != nil {
+		return nil, &Error{Kind: ErrConfig, Err: err}
+	}
+	return jo.owners(), nil
+}
+
+// LoadOwners reads and parses the Owners in the JSON file at path.
+func LoadOwners(path string) (*Owners, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, &Error{Kind: ErrConfig, Err: err}
+	}
+	return ParseOwners(data)
+}
@@ -0,0 +1,395 @@
+package dbtimer
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PlanWatcher is a TimerLogger that keeps an eye on the query plans of slow
+// statements. It tracks the fingerprints with calls at least SlowThreshold
+// long, and every Interval runs EXPLAIN on DB for an example of each, with
+// its arguments. It hashes the shape of the plan, the plan with its cost
+// and row estimates and literals left out, and reports a PlanChange when the
+// shape differs from the last, so that a dropped index or a change of
+// statistics is caught close to when it happens.
+//
+// EXPLAIN is run under Silence, so if DB is opened through a timer driver the
+// watcher's calls stay out of the events. Only SELECT, WITH, UPDATE and
+// DELETE statements are explained, and not those a Truncation cut short.
+// Arguments are those the events carry, so with SetRedactArgs EXPLAIN sees
+// the redacted values. Like anything that captures query plans, the watcher
+// stays off while compliance mode is on: it tracks nothing, and Sample and
+// Run return an ErrConfig error.
+type PlanWatcher struct {
+	DB *sql.DB
+
+	// Dialect is the dialect of DB's EXPLAIN: PostgreSQL, MySQL or
+	// SQLite. SQLServer plans can't be read with a statement of their own,
+	// so aren't supported.
+	Dialect Dialect
+
+	// SlowThreshold is how long a call must take for its fingerprint to be
+	// tracked. The default is 100ms.
+	SlowThreshold time.Duration
+
+	// Interval is the time between the samples Run takes. The default is
+	// ten minutes.
+	Interval time.Duration
+
+	// Timeout limits how long each EXPLAIN may take. The default is ten
+	// seconds.
+	Timeout time.Duration
+
+	// MaxFingerprints is the number of fingerprints tracked. Once it is
+	// reached, new fingerprints are ignored. The default is 100.
+	MaxFingerprints int
+
+	// LargeScan is the size of a full scan that the plan's Advice notes:
+	// the planner's estimated cost of the scan in PostgreSQL, 1000 by
+	// default, and the rows it examines in MySQL, 10000 by default. Other
+	// dialects get no advice.
+	LargeScan float64
+
+	// OnChange, if set, is called with each change of plan.
+	OnChange func(PlanChange)
+
+	// Logger, if set, is sent each change of plan as a "query.PlanChange"
+	// event, with the shapes' hashes in the previous_plan and plan tags, as
+	// well as the tags of the example's event, so that the change reaches
+	// any sink.
+	Logger TimerLogger
+
+	mu      sync.Mutex
+	tracked map[string]*plannedQuery
+}
+
+// Plan is the EXPLAIN output of an example of a fingerprint, which took
+// Duration, one line per row of output with the columns separated by tabs,
+// the hash of its shape, and the best-effort Advice of the watcher's
+// heuristics. If EXPLAIN failed, Err says why, and Text and Shape are empty.
+type Plan struct {
+	Fingerprint string
+	Query       string
+	Args        []driver.Value
+	Duration    time.Duration
+	Sampled     time.Time
+	Text        string
+	Shape       uint64
+	Advice      []Advice
+	Err         error
+}
+
+// PlanChange is a change in the shape of a fingerprint's plan between two
+// samples.
+type PlanChange struct {
+	Fingerprint string
+	Previous    Plan
+	Current     Plan
+}
+
+type plannedQuery struct {
+	query string
+	args  []driver.Value
+	dur   time.Duration
+	tags  map[string]string
+	plan  *Plan
+}
+
+// Log tracks the fingerprint of ti if it ran a statement that can be
+// explained, without error, for at least SlowThreshold. The last such call
+// is the example that is explained.
+func (pw *PlanWatcher) Log(ti TimerInfo) {
+	if ComplianceMode() {
+		return
+	}
+	threshold := pw.SlowThreshold
+	if threshold <= 0 {
+		threshold = 100 * time.Millisecond
+	}
+	if !runsStatement(ti.Method) || ti.Query == "" || ti.Err != nil || ti.Elapsed() < threshold || ti.FullQuery != nil || truncated(ti.Query) || !explainable(ti.Query) {
+		return
+	}
+	max := pw.MaxFingerprints
+	if max <= 0 {
+		max = 100
+	}
+	fp := Fingerprint(ti.Query)
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	if pw.tracked == nil {
+		pw.tracked = map[string]*plannedQuery{}
+	}
+	pq, ok := pw.tracked[fp]
+	if !ok {
+		if len(pw.tracked) >= max {
+			return
+		}
+		pq = &plannedQuery{}
+		pw.tracked[fp] = pq
+	}
+	pq.query, pq.args, pq.dur, pq.tags = ti.Query, ti.Args, ti.Elapsed(), ti.Tags
+}
+
+// explainable reports whether EXPLAIN can be run on query without side
+// effects in every supported dialect.
+func explainable(query string) bool {
+	fp := Fingerprint(query)
+	for _, p := range []string{"select ", "with ", "update ", "delete "} {
+		if strings.HasPrefix(fp, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Sample explains an example of each tracked fingerprint now, and returns
+// the changes of plan it found. A fingerprint's first plan, and plans that
+// couldn't be read, aren't changes.
+func (pw *PlanWatcher) Sample(ctx context.Context) ([]PlanChange, error) {
+	prefix, err := pw.explainPrefix()
+	if err != nil {
+		return nil, err
+	}
+	if pw.DB == nil {
+		return nil, &Error{Kind: ErrConfig, Err: errors.New("plan watcher needs a DB")}
+	}
+	type example struct {
+		fp, query string
+		args      []driver.Value
+		dur       time.Duration
+		tags      map[string]string
+	}
+	pw.mu.Lock()
+	examples := make([]example, 0, len(pw.tracked))
+	for fp, pq := range pw.tracked {
+		examples = append(examples, example{fp, pq.query, pq.args, pq.dur, pq.tags})
+	}
+	pw.mu.Unlock()
+	sort.Slice(examples, func(i, j int) bool { return examples[i].fp < examples[j].fp })
+	var changes []PlanChange
+	for _, ex := range examples {
+		if ctx.Err() != nil {
+			return changes, ctx.Err()
+		}
+		plan := pw.explain(ctx, prefix, ex.fp, ex.query, ex.args)
+		plan.Duration = ex.dur
+		pw.mu.Lock()
+		pq := pw.tracked[ex.fp]
+		if pq == nil {
+			// Reset since the examples were taken.
+			pw.mu.Unlock()
+			continue
+		}
+		previous := pq.plan
+		if plan.Err == nil || previous == nil {
+			pq.plan = &plan
+		}
+		pw.mu.Unlock()
+		if plan.Err != nil || previous == nil || previous.Err != nil || previous.Shape == plan.Shape {
+			continue
+		}
+		pc := PlanChange{Fingerprint: ex.fp, Previous: *previous, Current: plan}
+		changes = append(changes, pc)
+		if pw.OnChange != nil {
+			pw.OnChange(pc)
+		}
+		if pw.Logger != nil {
+			tags := withTag(withTag(ex.tags, "previous_plan", fmt.Sprintf("%016x", previous.Shape)), "plan", fmt.Sprintf("%016x", plan.Shape))
+			logEvent(pw.Logger, TimerInfo{Method: "query.PlanChange", Query: ex.fp, Start: plan.Sampled, End: plan.Sampled, Tags: tags})
+		}
+	}
+	return changes, nil
+}
+
+// explainPrefix returns the statement that explains a query in pw's dialect.
+// It is an ErrConfig error if the dialect isn't supported or compliance mode
+// is on.
+func (pw *PlanWatcher) explainPrefix() (string, error) {
+	if ComplianceMode() {
+		return "", &Error{Kind: ErrConfig, Err: errors.New("plan watcher is off in compliance mode")}
+	}
+	switch pw.Dialect {
+	case PostgreSQL, MySQL:
+		return "EXPLAIN ", nil
+	case SQLite:
+		return "EXPLAIN QUERY PLAN ", nil
+	}
+	return "", &Error{Kind: ErrConfig, Err: fmt.Errorf("plan watcher does not support %v", pw.Dialect)}
+}
+
+// explain runs EXPLAIN on query with args and reads its plan.
+func (pw *PlanWatcher) explain(ctx context.Context, prefix, fp, query string, args []driver.Value) Plan {
+	timeout := pw.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(Silence(ctx), timeout)
+	defer cancel()
+	plan := Plan{Fingerprint: fp, Query: query, Args: args, Sampled: time.Now()}
+	iargs := make([]interface{}, len(args))
+	for i, a := range args {
+		iargs[i] = a
+	}
+	rows, err := pw.DB.QueryContext(ctx, prefix+query, iargs...)
+	if err != nil {
+		plan.Err = err
+		return plan
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		plan.Err = err
+		return plan
+	}
+	vals := make([]sql.NullString, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range vals {
+		dest[i] = &vals[i]
+	}
+	var lines []string
+	var out [][]string
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			plan.Err = err
+			return plan
+		}
+		fields := make([]string, len(vals))
+		for i, v := range vals {
+			fields[i] = v.String
+			if !v.Valid {
+				fields[i] = "NULL"
+			}
+		}
+		lines = append(lines, strings.Join(fields, "\t"))
+		out = append(out, fields)
+	}
+	if err := rows.Err(); err != nil {
+		plan.Err = err
+		return plan
+	}
+	plan.Text = strings.Join(lines, "\n")
+	plan.Shape = planShape(plan.Text)
+	plan.Advice = advise(pw.Dialect, cols, out, pw.largeScan())
+	return plan
+}
+
+func (pw *PlanWatcher) largeScan() float64 {
+	switch {
+	case pw.LargeScan > 0:
+		return pw.LargeScan
+	case pw.Dialect == MySQL:
+		return 10000
+	}
+	return 1000
+}
+
+var (
+	planLiteralRE = regexp.MustCompile(`'(?:[^']|'')*'|\b\d+(?:\.\d+)?\b`)
+	planSpaceRE   = regexp.MustCompile(`[ \t]+`)
+)
+
+// planShape hashes the shape of a plan: its text with numbers, such as costs
+// and row estimates, and quoted literals replaced, so that only a change of
+// operators, indexes or join order changes it.
+func planShape(text string) uint64 {
+	shape := planSpaceRE.ReplaceAllString(planLiteralRE.ReplaceAllString(text, "?"), " ")
+	h := fnv.New64a()
+	h.Write([]byte(shape))
+	return h.Sum64()
+}
+
+// Run samples the plans every Interval until ctx is done, and returns ctx's
+// error. It is an ErrConfig error if DB is nil, the Dialect isn't supported or
+// compliance mode is on. Samples due while compliance mode is turned on later
+// are skipped.
+func (pw *PlanWatcher) Run(ctx context.Context) error {
+	if _, err := pw.explainPrefix(); err != nil {
+		return err
+	}
+	if pw.DB == nil {
+		return &Error{Kind: ErrConfig, Err: errors.New("plan watcher needs a DB")}
+	}
+	interval := pw.Interval
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			pw.Sample(ctx)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Plans returns the last plan of each tracked fingerprint that has been
+// sampled, in order of fingerprint.
+func (pw *PlanWatcher) Plans() []Plan {
+	pw.mu.Lock()
+	out := make([]Plan, 0, len(pw.tracked))
+	for _, pq := range pw.tracked {
+		if pq.plan != nil {
+			out = append(out, *pq.plan)
+		}
+	}
+	pw.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].Fingerprint < out[j].Fingerprint })
+	return out
+}
+
+// WriteTo writes a report of the slow statements whose plans have been
+// sampled, the slowest examples first, with each plan and its advice.
+func (pw *PlanWatcher) WriteTo(w io.Writer) (int64, error) {
+	plans := pw.Plans()
+	sort.SliceStable(plans, func(i, j int) bool { return plans[i].Duration > plans[j].Duration })
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for i, p := range plans {
+		if i > 0 {
+			fmt.Fprintln(bw)
+		}
+		fmt.Fprintf(bw, "%s\n  example took %v, explained %s\n", p.Fingerprint, p.Duration, p.Sampled.Format(time.RFC3339))
+		if p.Err != nil {
+			fmt.Fprintf(bw, "  EXPLAIN failed: %v\n", p.Err)
+			continue
+		}
+		for _, line := range strings.Split(p.Text, "\n") {
+			fmt.Fprintf(bw, "  | %s\n", line)
+		}
+		if len(p.Advice) > 0 {
+			fmt.Fprintln(bw, "  advice (best-effort, from the planner's estimates):")
+			for _, a := range p.Advice {
+				fmt.Fprintf(bw, "  - %s\n", a.Note)
+			}
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (pw *PlanWatcher) String() string {
+	var sb strings.Builder
+	pw.WriteTo(&sb)
+	return sb.String()
+}
+
+// Reset forgets the tracked fingerprints and their plans.
+func (pw *PlanWatcher) Reset() {
+	pw.mu.Lock()
+	pw.tracked = nil
+	pw.mu.Unlock()
+}
@@ -0,0 +1,202 @@
+package dbtimer
+
+import (
+	"compress/gzip"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryProfile is a TimerLogger that builds a profile of where database time
+// goes, in the format of pprof, so that its tools (top, flame graphs, the
+// web UI) can be used to explore it. Each statement is a sample weighted by
+// its duration, with a stack of three frames: the operation, such as select
+// or update, the table it works on, and its fingerprint. Calls of stored
+// procedures have the frames call and the procedure's name instead.
+//
+// The profile has two sample types, "calls" and "time" in nanoseconds, and
+// shows time by default. Serve it for go tool pprof with, for example:
+//
+//	http.HandleFunc("/debug/dbtimer/profile", func(w http.ResponseWriter, r *http.Request) {
+//		profile.WriteTo(w)
+//	})
+type QueryProfile struct {
+	mu      sync.Mutex
+	start   time.Time
+	samples map[[3]string]*profileSample
+}
+
+type profileSample struct {
+	calls int64
+	nanos int64
+}
+
+// Log adds the statement run by ti to the profile. Events that don't run a
+// statement are ignored.
+func (qp *QueryProfile) Log(ti TimerInfo) {
+	if !runsStatement(ti.Method) || ti.Query == "" {
+		return
+	}
+	var stack [3]string
+	if p := Procedure(ti.Query); p != "" {
+		stack = [3]string{"call", p}
+	} else {
+		fp := Fingerprint(ti.Query)
+		stack = [3]string{statementOperation(fp), statementTable(fp), fp}
+	}
+	qp.mu.Lock()
+	defer qp.mu.Unlock()
+	if qp.samples == nil {
+		qp.samples = map[[3]string]*profileSample{}
+		qp.start = ti.Start
+	}
+	ps := qp.samples[stack]
+	if ps == nil {
+		ps = &profileSample{}
+		qp.samples[stack] = ps
+	}
+	ps.calls++
+	ps.nanos += int64(ti.Elapsed())
+}
+
+// Reset forgets the statements profiled so far.
+func (qp *QueryProfile) Reset() {
+	qp.mu.Lock()
+	qp.samples = nil
+	qp.mu.Unlock()
+}
+
+// WriteTo writes the profile as a gzipped profile.proto message, the format
+// read by go tool pprof.
+func (qp *QueryProfile) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	zw := gzip.NewWriter(cw)
+	if _, err := zw.Write(qp.encode(time.Now())); err != nil {
+		return cw.n, err
+	}
+	err := zw.Close()
+	return cw.n, err
+}
+
+// encode builds the Profile message, with the frames' functions and
+// locations numbered alike.
+func (qp *QueryProfile) encode(now time.Time) []byte {
+	strs := map[string]int64{"": 0}
+	table := []string{""}
+	str := func(s string) int64 {
+		i, ok := strs[s]
+		if !ok {
+			i = int64(len(table))
+			strs[s] = i
+			table = append(table, s)
+		}
+		return i
+	}
+	frames := map[string]uint64{}
+	var names []string
+
+	qp.mu.Lock()
+	stacks := make([][3]string, 0, len(qp.samples))
+	for s := range qp.samples {
+		stacks = append(stacks, s)
+	}
+	sort.Slice(stacks, func(i, j int) bool {
+		a, b := stacks[i], stacks[j]
+		for k := range a {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return false
+	})
+	var b pprofBuf
+	b = b.message(1, pprofBuf(nil).int(1, str("calls")).int(2, str("count")))
+	b = b.message(1, pprofBuf(nil).int(1, str("time")).int(2, str("nanoseconds")))
+	for _, s := range stacks {
+		var ids []uint64
+		for k := len(s) - 1; k >= 0; k-- {
+			if s[k] == "" {
+				continue
+			}
+			key := string(rune('0'+k)) + s[k]
+			id, ok := frames[key]
+			if !ok {
+				names = append(names, s[k])
+				id = uint64(len(names))
+				frames[key] = id
+			}
+			ids = append(ids, id)
+		}
+		ps := qp.samples[s]
+		b = b.message(2, pprofBuf(nil).packed(1, ids).packed(2, []uint64{uint64(ps.calls), uint64(ps.nanos)}))
+	}
+	start := qp.start
+	qp.mu.Unlock()
+
+	for i := range names {
+		id := uint64(i + 1)
+		b = b.message(4, pprofBuf(nil).uint(1, id).message(4, pprofBuf(nil).uint(1, id)))
+	}
+	for i, name := range names {
+		n := str(name)
+		b = b.message(5, pprofBuf(nil).uint(1, uint64(i+1)).int(2, n).int(3, n))
+	}
+	timeType := str("time")
+	for _, s := range table {
+		b = b.tag(6, 2).varint(uint64(len(s)))
+		b = append(b, s...)
+	}
+	if !start.IsZero() {
+		b = b.int(9, start.UnixNano())
+		b = b.int(10, int64(now.Sub(start)))
+	}
+	return b.int(14, timeType)
+}
+
+type pprofBuf []byte
+
+func (b pprofBuf) tag(field, wireType int) pprofBuf {
+	return b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (b pprofBuf) varint(v uint64) pprofBuf {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func (b pprofBuf) uint(field int, v uint64) pprofBuf {
+	if v == 0 {
+		return b
+	}
+	return b.tag(field, 0).varint(v)
+}
+
+func (b pprofBuf) int(field int, v int64) pprofBuf {
+	return b.uint(field, uint64(v))
+}
+
+func (b pprofBuf) message(field int, m pprofBuf) pprofBuf {
+	b = b.tag(field, 2).varint(uint64(len(m)))
+	return append(b, m...)
+}
+
+func (b pprofBuf) packed(field int, vs []uint64) pprofBuf {
+	var m pprofBuf
+	for _, v := range vs {
+		m = m.varint(v)
+	}
+	return b.message(field, m)
+}
+
+// statementOperation returns the first word of the fingerprint fp.
+func statementOperation(fp string) string {
+	if i := strings.IndexAny(fp, " \t\n("); i > 0 {
+		return fp[:i]
+	}
+	return fp
+}
@@ -0,0 +1,145 @@
+package dbtimer
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// PrepareTracker is a TimerLogger that counts how often each fingerprint is
+// prepared and how often its prepared statements run. A statement that is
+// prepared for nearly every execution gains nothing from being prepared and
+// pays for an extra round trip each time: the application isn't reusing its
+// *sql.Stmt, or the driver can't run statements without preparing them, or
+// the pool opens new connections so often that each *sql.Stmt is prepared
+// again on every one.
+//
+// Install it alongside any other logger with MultiLogger, and read the
+// advisory with Advisory.
+type PrepareTracker struct {
+	// Ratio is the fraction of executions that must be preceded by a
+	// prepare for a fingerprint to be flagged. The default is 0.9.
+	Ratio float64
+
+	// MinExecutions is the number of executions a fingerprint must have
+	// before it can be flagged. The default is 100.
+	MinExecutions int64
+
+	mu      sync.Mutex
+	tracked map[string]*PrepareStats
+}
+
+// PrepareStats are the prepares and executions of one fingerprint.
+// PrepareTime is the total time spent preparing it.
+type PrepareStats struct {
+	Fingerprint string
+	Prepares    int64
+	Executions  int64
+	PrepareTime time.Duration
+}
+
+// PerExecution returns the number of prepares per execution.
+func (ps PrepareStats) PerExecution() float64 {
+	if ps.Executions == 0 {
+		return 0
+	}
+	return float64(ps.Prepares) / float64(ps.Executions)
+}
+
+// Log counts the prepare or execution of a statement in ti.
+func (pt *PrepareTracker) Log(ti TimerInfo) {
+	prepare := ti.Method == "conn.Prepare"
+	if (!prepare && ti.Method != "stmt.Exec" && ti.Method != "stmt.Query") || ti.Query == "" {
+		return
+	}
+	fp := Fingerprint(ti.Query)
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+	if pt.tracked == nil {
+		pt.tracked = map[string]*PrepareStats{}
+	}
+	ps := pt.tracked[fp]
+	if ps == nil {
+		ps = &PrepareStats{Fingerprint: fp}
+		pt.tracked[fp] = ps
+	}
+	if prepare {
+		ps.Prepares++
+		ps.PrepareTime += ti.Elapsed()
+	} else {
+		ps.Executions++
+	}
+}
+
+// Stats returns the counts of every fingerprint prepared or executed, the
+// most prepared first.
+func (pt *PrepareTracker) Stats() []PrepareStats {
+	pt.mu.Lock()
+	out := make([]PrepareStats, 0, len(pt.tracked))
+	for _, ps := range pt.tracked {
+		out = append(out, *ps)
+	}
+	pt.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Prepares != out[j].Prepares {
+			return out[i].Prepares > out[j].Prepares
+		}
+		return out[i].Fingerprint < out[j].Fingerprint
+	})
+	return out
+}
+
+// PrepareAdvisory lists the fingerprints that are prepared for nearly every
+// execution, the most prepared first.
+type PrepareAdvisory struct {
+	Fingerprints []PrepareStats
+}
+
+// Advisory returns the fingerprints with at least MinExecutions executions
+// and at least Ratio prepares per execution.
+func (pt *PrepareTracker) Advisory() *PrepareAdvisory {
+	ratio := pt.Ratio
+	if ratio <= 0 {
+		ratio = 0.9
+	}
+	min := pt.MinExecutions
+	if min <= 0 {
+		min = 100
+	}
+	adv := &PrepareAdvisory{}
+	for _, ps := range pt.Stats() {
+		if ps.Executions >= min && ps.PerExecution() >= ratio {
+			adv.Fingerprints = append(adv.Fingerprints, ps)
+		}
+	}
+	return adv
+}
+
+// WriteTo writes the advisory as a table, with one row per fingerprint.
+func (a *PrepareAdvisory) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	if len(a.Fingerprints) == 0 {
+		_, err := fmt.Fprintln(cw, "no fingerprints are prepared for nearly every execution")
+		return cw.n, err
+	}
+	tw := tabwriter.NewWriter(cw, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "prepares\texecutions\tper execution\tprepare time\tfingerprint\n")
+	for _, ps := range a.Fingerprints {
+		fmt.Fprintf(tw, "%d\t%d\t%.2f\t%v\t%s\n", ps.Prepares, ps.Executions, ps.PerExecution(), ps.PrepareTime, ps.Fingerprint)
+	}
+	err := tw.Flush()
+	if err == nil {
+		_, err = fmt.Fprintln(cw, "Reuse a *sql.Stmt for these statements, or check that the pool keeps enough idle connections for its statements to stay prepared.")
+	}
+	return cw.n, err
+}
+
+func (a *PrepareAdvisory) String() string {
+	var sb strings.Builder
+	a.WriteTo(&sb)
+	return sb.String()
+}
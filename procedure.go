@@ -0,0 +1,112 @@
+package dbtimer
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// Procedure returns the name of the stored procedure that query calls, or ""
+// if it doesn't call one. CALL name(...) (PostgreSQL, MySQL), the ODBC escape
+// {call name(...)} and EXEC or EXECUTE name ... (SQL Server, including
+// EXEC @status = name ...) are recognized. The name is lower-cased unless it
+// is quoted, and keeps its schema if it has one; SQL Server's brackets are
+// removed. In PostgreSQL, EXECUTE runs a prepared statement, whose name is
+// returned.
+func Procedure(query string) string {
+	if !startsWithCall(query) {
+		return ""
+	}
+	toks := tokenize(query)
+	i := 0
+	if i < len(toks) && toks[i].text == "{" {
+		i++
+	}
+	if i >= len(toks) || toks[i].kind != wordToken {
+		return ""
+	}
+	switch toks[i].text {
+	case "call":
+		i++
+	case "exec", "execute":
+		i++
+		if i+1 < len(toks) && toks[i].placeholder && toks[i+1].text == "=" {
+			i += 2
+		}
+	default:
+		return ""
+	}
+	var sb strings.Builder
+	for i < len(toks) {
+		// SQL Server quotes names in brackets: [dbo].[name].
+		bracketed := toks[i].text == "[" && i+2 < len(toks) && toks[i+2].text == "]"
+		if bracketed {
+			i++
+		}
+		if toks[i].kind != wordToken {
+			break
+		}
+		sb.WriteString(toks[i].text)
+		if bracketed {
+			i++
+		}
+		if i+1 >= len(toks) || toks[i+1].text != "." {
+			break
+		}
+		sb.WriteByte('.')
+		i += 2
+	}
+	return sb.String()
+}
+
+// startsWithCall is a cheap test that query could call a stored procedure, so
+// that other statements aren't tokenized.
+func startsWithCall(query string) bool {
+	query = strings.TrimLeft(query, " \t\r\n{")
+	return len(query) >= 4 && (strings.EqualFold(query[:4], "call") || strings.EqualFold(query[:4], "exec"))
+}
+
+// OutParam is an OUT or INOUT argument of a stored procedure, passed to the
+// call as a sql.Out, as it appears in an event's Args. Value is what the
+// procedure set it to.
+type OutParam struct {
+	Value interface{}
+	In    bool
+}
+
+func (p OutParam) String() string {
+	if p.In {
+		return "INOUT " + FormatArg(p.Value)
+	}
+	return "OUT " + FormatArg(p.Value)
+}
+
+// outParams replaces the sql.Out arguments of a call that has returned with
+// OutParams holding the values they were set to, so that loggers don't read
+// the caller's variables after the call.
+func outParams(args []driver.Value) []driver.Value {
+	var out []driver.Value
+	for i, a := range args {
+		o, ok := a.(sql.Out)
+		if !ok {
+			continue
+		}
+		if out == nil {
+			out = make([]driver.Value, len(args))
+			copy(out, args)
+		}
+		p := OutParam{In: o.In}
+		if v := reflect.ValueOf(o.Dest); v.Kind() == reflect.Ptr && !v.IsNil() {
+			p.Value = v.Elem().Interface()
+		}
+		out[i] = p
+	}
+	if out == nil {
+		return args
+	}
+	return out
+}
+
+var errOutUnsupported = errors.New("driver does not support OUT parameters")
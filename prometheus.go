@@ -0,0 +1,181 @@
+package dbtimer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// WritePrometheus writes the stats in the Prometheus text exposition format,
+// as a histogram dbtimer_query_duration_seconds and a counter
+// dbtimer_query_errors_total, both labelled by fingerprint and by the Stats'
+// Labels, and, for fingerprints of multi-row INSERTs, a histogram of latency
+// per row, dbtimer_insert_row_duration_seconds. Calls of stored procedures
+// are written separately, as dbtimer_procedure_duration_seconds and
+// dbtimer_procedure_errors_total labelled by procedure. If the driver
+// estimates response sizes, a counter dbtimer_response_bytes_total holds the
+// bytes read from the results of each, and if it measures a
+// RoundTripBaseline, dbtimer_roundtrip_seconds_total holds the part of their
+// time spent on round trips. Statements run with a context deadline are
+// counted in dbtimer_query_deadlines_total, those that missed it in
+// dbtimer_query_deadline_misses_total, and the time they had left in
+// dbtimer_query_deadline_budget_seconds_total. The time the driver took to
+// return after a statement's context was canceled is the histogram
+// dbtimer_query_cancel_latency_seconds. If the Stats has a Cost model, the
+// cost of each fingerprint's time is the counter dbtimer_query_cost_total,
+// labelled by unit as well. If the Stats has Windows, a summary
+// dbtimer_query_recent_duration_seconds holds the latency of each
+// fingerprint over each window, labelled by window, and if it has SLOs,
+// their compliance is written as well; see SLO. The histogram buckets are the Stats' Buckets.
+// Serve it from a metrics handler:
+//
+//	http.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+//		stats.WritePrometheus(w)
+//	})
+func (s *Stats) WritePrometheus(w io.Writer) error {
+	report := s.Report()
+	var queries, procs []QueryStats
+	for _, qs := range report {
+		if qs.Procedure != "" {
+			procs = append(procs, qs)
+		} else {
+			queries = append(queries, qs)
+		}
+	}
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "# HELP dbtimer_query_duration_seconds Latency of database statements by fingerprint.")
+	fmt.Fprintln(bw, "# TYPE dbtimer_query_duration_seconds histogram")
+	for _, qs := range queries {
+		writePromHistogram(bw, "dbtimer_query_duration_seconds", s.promLabels(qs), qs.Latency, qs.Count, qs.Total)
+	}
+	fmt.Fprintln(bw, "# HELP dbtimer_query_errors_total Failed database statements by fingerprint.")
+	fmt.Fprintln(bw, "# TYPE dbtimer_query_errors_total counter")
+	for _, qs := range queries {
+		fmt.Fprintf(bw, "dbtimer_query_errors_total{%s} %d\n", s.promLabels(qs), qs.Errors)
+	}
+	fmt.Fprintln(bw, "# HELP dbtimer_insert_row_duration_seconds Latency per row of multi-row INSERTs by fingerprint.")
+	fmt.Fprintln(bw, "# TYPE dbtimer_insert_row_duration_seconds histogram")
+	for _, qs := range queries {
+		if count := qs.RowLatency.Count(); count > 0 {
+			writePromHistogram(bw, "dbtimer_insert_row_duration_seconds", s.promLabels(qs), qs.RowLatency, count, qs.rowSum)
+		}
+	}
+	fmt.Fprintln(bw, "# HELP dbtimer_roundtrip_seconds_total Time of database statements spent on round trips to the server.")
+	fmt.Fprintln(bw, "# TYPE dbtimer_roundtrip_seconds_total counter")
+	for _, qs := range report {
+		if qs.Baseline > 0 {
+			fmt.Fprintf(bw, "dbtimer_roundtrip_seconds_total{%s} %s\n", s.promLabels(qs), promFloat(qs.Baseline.Seconds()))
+		}
+	}
+	fmt.Fprintln(bw, "# HELP dbtimer_query_deadlines_total Database statements run with a context deadline.")
+	fmt.Fprintln(bw, "# TYPE dbtimer_query_deadlines_total counter")
+	for _, qs := range report {
+		if qs.Deadlines > 0 {
+			fmt.Fprintf(bw, "dbtimer_query_deadlines_total{%s} %d\n", s.promLabels(qs), qs.Deadlines)
+		}
+	}
+	fmt.Fprintln(bw, "# HELP dbtimer_query_deadline_misses_total Database statements that didn't finish within their context deadline.")
+	fmt.Fprintln(bw, "# TYPE dbtimer_query_deadline_misses_total counter")
+	for _, qs := range report {
+		if qs.Deadlines > 0 {
+			fmt.Fprintf(bw, "dbtimer_query_deadline_misses_total{%s} %d\n", s.promLabels(qs), qs.DeadlineMisses)
+		}
+	}
+	fmt.Fprintln(bw, "# HELP dbtimer_query_deadline_budget_seconds_total Time database statements with a deadline had left when they started.")
+	fmt.Fprintln(bw, "# TYPE dbtimer_query_deadline_budget_seconds_total counter")
+	for _, qs := range report {
+		if qs.Deadlines > 0 {
+			fmt.Fprintf(bw, "dbtimer_query_deadline_budget_seconds_total{%s} %s\n", s.promLabels(qs), promFloat(qs.DeadlineBudget.Seconds()))
+		}
+	}
+	if s.Cost != nil {
+		fmt.Fprintln(bw, "# HELP dbtimer_query_cost_total Cost of the time of database statements under the Stats' cost model.")
+		fmt.Fprintln(bw, "# TYPE dbtimer_query_cost_total counter")
+		for _, qs := range report {
+			fmt.Fprintf(bw, "dbtimer_query_cost_total{%s,unit=\"%s\"} %s\n", s.promLabels(qs), promLabel(s.Cost.unit()), promFloat(s.Cost.Cost(qs.Total)))
+		}
+	}
+	fmt.Fprintln(bw, "# HELP dbtimer_query_cancel_latency_seconds Time the driver took to return after a database statement's context was canceled.")
+	fmt.Fprintln(bw, "# TYPE dbtimer_query_cancel_latency_seconds histogram")
+	for _, qs := range report {
+		if qs.Cancels > 0 {
+			writePromHistogram(bw, "dbtimer_query_cancel_latency_seconds", s.promLabels(qs), qs.CancelLatency, qs.Cancels, qs.cancelSum)
+		}
+	}
+	fmt.Fprintln(bw, "# HELP dbtimer_response_bytes_total Estimated bytes read from the results of database statements.")
+	fmt.Fprintln(bw, "# TYPE dbtimer_response_bytes_total counter")
+	for _, qs := range report {
+		if qs.ResponseBytes > 0 {
+			fmt.Fprintf(bw, "dbtimer_response_bytes_total{%s} %d\n", s.promLabels(qs), qs.ResponseBytes)
+		}
+	}
+	if len(procs) > 0 {
+		fmt.Fprintln(bw, "# HELP dbtimer_procedure_duration_seconds Latency of stored procedure calls by procedure.")
+		fmt.Fprintln(bw, "# TYPE dbtimer_procedure_duration_seconds histogram")
+		for _, qs := range procs {
+			writePromHistogram(bw, "dbtimer_procedure_duration_seconds", s.promLabels(qs), qs.Latency, qs.Count, qs.Total)
+		}
+		fmt.Fprintln(bw, "# HELP dbtimer_procedure_errors_total Failed stored procedure calls by procedure.")
+		fmt.Fprintln(bw, "# TYPE dbtimer_procedure_errors_total counter")
+		for _, qs := range procs {
+			fmt.Fprintf(bw, "dbtimer_procedure_errors_total{%s} %d\n", s.promLabels(qs), qs.Errors)
+		}
+	}
+	now := time.Now()
+	s.writeWindowPrometheus(bw, now)
+	s.writeSLOPrometheus(bw, now)
+	return bw.Flush()
+}
+
+// writePromHistogram writes the buckets, sum and count of one series of a
+// histogram.
+func writePromHistogram(w io.Writer, name, labels string, h Histogram, count int64, sum time.Duration) {
+	var cum int64
+	for i, b := range h.Bounds {
+		cum += h.Counts[i]
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, promFloat(b.Seconds()), cum)
+	}
+	fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, count)
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, promFloat(sum.Seconds()))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, count)
+}
+
+// promLabels returns the label pairs of qs: the fingerprint, or the procedure,
+// and the Stats' Labels.
+func (s *Stats) promLabels(qs QueryStats) string {
+	var sb strings.Builder
+	if qs.Procedure != "" {
+		fmt.Fprintf(&sb, "procedure=\"%s\"", promLabel(qs.Procedure))
+	} else {
+		fmt.Fprintf(&sb, "fingerprint=\"%s\"", promLabel(qs.Fingerprint))
+	}
+	for _, l := range s.Labels {
+		fmt.Fprintf(&sb, ",%s=\"%s\"", promLabelName(l), promLabel(qs.Labels[l]))
+	}
+	return sb.String()
+}
+
+// promLabelName replaces the characters Prometheus doesn't allow in a label
+// name with underscores.
+func promLabelName(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c != '_' && !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && !(i > 0 && c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+var promEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promLabel(s string) string {
+	return promEscaper.Replace(s)
+}
+
+func promFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
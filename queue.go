@@ -0,0 +1,213 @@
+package dbtimer
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Backpressure is what an asynchronous sink does with an event when its
+// queue is full. Every event that is lost is counted in the sink's
+// QueueStats.
+type Backpressure int
+
+const (
+	// DropNewest drops the event being logged and reports ErrDropped to the
+	// error handler. It is the default.
+	DropNewest Backpressure = iota
+
+	// DropOldest drops the oldest queued event to make room for the one being
+	// logged, and reports ErrDropped.
+	DropOldest
+
+	// Block makes the call being timed wait for room, up to the sink's
+	// BlockTimeout, and then drops the event as DropNewest does.
+	Block
+
+	// SummarizeDropped drops the event being logged, but instead of one
+	// ErrDropped per event, reports a single ErrDropped with the number of
+	// events dropped once the queue has room again, or when it is closed.
+	SummarizeDropped
+)
+
+var backpressureNames = map[Backpressure]string{
+	DropNewest:       "drop-newest",
+	DropOldest:       "drop-oldest",
+	Block:            "block",
+	SummarizeDropped: "summarize-dropped",
+}
+
+func (b Backpressure) String() string {
+	if s, ok := backpressureNames[b]; ok {
+		return s
+	}
+	return fmt.Sprintf("Backpressure(%d)", int(b))
+}
+
+// QueueStats counts what happened to the events logged to an asynchronous
+// sink.
+type QueueStats struct {
+	// Queued is the number of events that went into the queue.
+	Queued int64
+
+	// Dropped is the number of events dropped as they were logged, because
+	// the queue was full or closed, and Evicted the number of queued events
+	// dropped under DropOldest.
+	Dropped int64
+	Evicted int64
+
+	// Blocked is the number of events that waited for room under Block, and
+	// TimedOut the number of those that were dropped after BlockTimeout.
+	Blocked  int64
+	TimedOut int64
+
+	// Summaries is the number of reports made under SummarizeDropped.
+	Summaries int64
+}
+
+// Queue is the bounded queue between the Log method of an asynchronous sink
+// and the goroutine that writes or sends its events. Put applies the queue's
+// Backpressure when it is full. It is exported for TimerLogger
+// implementations in other packages.
+type Queue struct {
+	// The counters come first so that they are aligned for atomic access on
+	// 32-bit platforms.
+	pending  int64
+	queued   int64
+	dropped  int64
+	evicted  int64
+	blocked  int64
+	timedOut int64
+	reports  int64
+
+	name    string
+	ch      chan TimerInfo
+	policy  Backpressure
+	timeout time.Duration
+	closed  chan struct{}
+	once    sync.Once
+}
+
+// NewQueue returns a queue that holds size events and applies policy when it
+// is full. A blockTimeout of 0 under Block means 100 milliseconds. name names
+// the sink in the errors reported to the error handler, such as "collector
+// sink".
+func NewQueue(name string, size int, policy Backpressure, blockTimeout time.Duration) *Queue {
+	if blockTimeout <= 0 {
+		blockTimeout = 100 * time.Millisecond
+	}
+	return &Queue{
+		name:    name,
+		ch:      make(chan TimerInfo, size),
+		policy:  policy,
+		timeout: blockTimeout,
+		closed:  make(chan struct{}),
+	}
+}
+
+// Put adds ti to the queue. Once the queue is closed, events are dropped.
+func (q *Queue) Put(ti TimerInfo) {
+	select {
+	case <-q.closed:
+		atomic.AddInt64(&q.dropped, 1)
+		handleError(&Error{Kind: ErrDropped, Err: errors.New(q.name + " is closed")})
+		return
+	default:
+	}
+	if q.offer(ti) {
+		return
+	}
+	switch q.policy {
+	case DropOldest:
+		for {
+			select {
+			case <-q.ch:
+				atomic.AddInt64(&q.evicted, 1)
+				handleError(&Error{Kind: ErrDropped, Err: errors.New(q.name + ": queue is full, dropped the oldest event")})
+			default:
+			}
+			if q.offer(ti) {
+				return
+			}
+		}
+	case Block:
+		atomic.AddInt64(&q.blocked, 1)
+		t := time.NewTimer(q.timeout)
+		defer t.Stop()
+		select {
+		case q.ch <- ti:
+			atomic.AddInt64(&q.queued, 1)
+			return
+		case <-t.C:
+			atomic.AddInt64(&q.timedOut, 1)
+		case <-q.closed:
+		}
+	case SummarizeDropped:
+		atomic.AddInt64(&q.dropped, 1)
+		atomic.AddInt64(&q.pending, 1)
+		return
+	}
+	atomic.AddInt64(&q.dropped, 1)
+	handleError(&Error{Kind: ErrDropped, Err: errors.New(q.name + ": queue is full")})
+}
+
+// offer adds ti to the queue if there is room.
+func (q *Queue) offer(ti TimerInfo) bool {
+	select {
+	case q.ch <- ti:
+		atomic.AddInt64(&q.queued, 1)
+		q.summarize()
+		return true
+	default:
+		return false
+	}
+}
+
+// summarize reports the events dropped under SummarizeDropped since the last
+// report, if there were any.
+func (q *Queue) summarize() {
+	if atomic.LoadInt64(&q.pending) == 0 {
+		return
+	}
+	if n := atomic.SwapInt64(&q.pending, 0); n > 0 {
+		atomic.AddInt64(&q.reports, 1)
+		handleError(&Error{Kind: ErrDropped, Err: fmt.Errorf("%s: dropped %d events while the queue was full", q.name, n)})
+	}
+}
+
+// Events returns the channel the queued events are read from.
+func (q *Queue) Events() <-chan TimerInfo {
+	return q.ch
+}
+
+// Next returns the next queued event without waiting, or false if there is
+// none. It is for draining the queue after it is closed.
+func (q *Queue) Next() (TimerInfo, bool) {
+	select {
+	case ti := <-q.ch:
+		return ti, true
+	default:
+		return TimerInfo{}, false
+	}
+}
+
+// Close stops the queue from taking more events and reports any drops not yet
+// summarized. The events already queued can still be read.
+func (q *Queue) Close() {
+	q.once.Do(func() { close(q.closed) })
+	q.summarize()
+}
+
+// Stats returns the queue's counters.
+func (q *Queue) Stats() QueueStats {
+	return QueueStats{
+		Queued:    atomic.LoadInt64(&q.queued),
+		Dropped:   atomic.LoadInt64(&q.dropped),
+		Evicted:   atomic.LoadInt64(&q.evicted),
+		Blocked:   atomic.LoadInt64(&q.blocked),
+		TimedOut:  atomic.LoadInt64(&q.timedOut),
+		Summaries: atomic.LoadInt64(&q.reports),
+	}
+}
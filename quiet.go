@@ -0,0 +1,223 @@
+package dbtimer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// QuietWindow is a scheduled period, such as a nightly batch run, during
+// which a driver samples its events differently, so that bulk jobs don't
+// flood slow-query alerts that are tuned for interactive traffic.
+type QuietWindow struct {
+	// Start is when the window opens, as a cron spec of five fields:
+	// minute, hour, day of month, month and day of week. For example,
+	// "0 2 * * *" is 2am every day and "30 22 * * 1-5" is 10:30pm on
+	// weekdays. Each field is *, a number, a range such as 1-5, a step
+	// such as */15 or 0-30/10, or a list of those separated by commas.
+	// Days of the week run from 0, Sunday, to 6, and 7 is also Sunday.
+	Start string
+
+	// Duration is how long the window stays open. Windows open and close
+	// on the minute.
+	Duration time.Duration
+
+	// Sampling is used while the window is open in place of the driver's
+	// Sampling: raise SlowThreshold to log only the slowest calls, or
+	// lower Rate to log fewer. Failed calls are still logged, and the
+	// exemptions of the driver's Sampling still apply.
+	Sampling Sampling
+
+	// Location is the time zone of Start. The default is time.Local.
+	Location *time.Location
+}
+
+// SetQuietWindows sets the quiet windows of d, replacing any set before.
+// Passing none removes them. When windows overlap, the first one listed that
+// is open applies. It is an ErrConfig error if a window's Start can't be
+// parsed, its Duration isn't positive, or its Sampling is invalid.
+func (d *Driver) SetQuietWindows(windows ...QuietWindow) error {
+	if len(windows) == 0 {
+		d.quiet.Store((*quietHolder)(nil))
+		return nil
+	}
+	qh := &quietHolder{}
+	for _, w := range windows {
+		spec, err := parseCron(w.Start)
+		if err != nil {
+			return &Error{Kind: ErrConfig, Err: err}
+		}
+		if w.Duration <= 0 {
+			return &Error{Kind: ErrConfig, Err: fmt.Errorf("quiet window %q has a Duration of %v", w.Start, w.Duration)}
+		}
+		sh, err := newSamplingHolder(&w.Sampling)
+		if err != nil {
+			return err
+		}
+		loc := w.Location
+		if loc == nil {
+			loc = time.Local
+		}
+		qh.windows = append(qh.windows, quietWindow{spec: spec, dur: w.Duration, loc: loc, sampling: sh})
+	}
+	d.quiet.Store(qh)
+	return nil
+}
+
+// WithQuietWindows sets the quiet windows of the driver, as SetQuietWindows
+// does.
+func WithQuietWindows(windows ...QuietWindow) Option {
+	return func(d *Driver) error {
+		return d.SetQuietWindows(windows...)
+	}
+}
+
+type quietHolder struct {
+	windows []quietWindow
+
+	// state caches which window is open for the current minute, so that
+	// the schedule is only checked once a minute.
+	state atomic.Value
+}
+
+type quietWindow struct {
+	spec     cronSpec
+	dur      time.Duration
+	loc      *time.Location
+	sampling samplingHolder
+}
+
+type quietState struct {
+	minute int64
+	open   int
+}
+
+// quietSampling returns the sampling of the quiet window that is open, and
+// whether there is one.
+func (d *Driver) quietSampling() (samplingHolder, bool) {
+	qh, _ := d.quiet.Load().(*quietHolder)
+	if qh == nil {
+		return samplingHolder{}, false
+	}
+	minute := d.now().Unix() / 60
+	st, ok := qh.state.Load().(quietState)
+	if !ok || st.minute != minute {
+		st = quietState{minute: minute, open: qh.open(time.Unix(minute*60, 0))}
+		qh.state.Store(st)
+	}
+	if st.open < 0 {
+		return samplingHolder{}, false
+	}
+	return qh.windows[st.open].sampling, true
+}
+
+// open returns the index of the first window open at the minute t, or -1 if
+// none is.
+func (qh *quietHolder) open(t time.Time) int {
+	for i, w := range qh.windows {
+		lt := t.In(w.loc)
+		for back := time.Duration(0); back < w.dur; back += time.Minute {
+			if w.spec.matches(lt.Add(-back)) {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// cronSpec is a parsed cron spec. Each field is a bit set of the values it
+// matches.
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+
+	// domAny and dowAny record whether the day of month and day of week
+	// fields start with *. As in cron, when neither does, a day matches if
+	// either field matches it.
+	domAny, dowAny bool
+}
+
+func parseCron(spec string) (cronSpec, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return cronSpec{}, fmt.Errorf("cron spec %q does not have five fields", spec)
+	}
+	var c cronSpec
+	for i, f := range []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&c.minute, 0, 59},
+		{&c.hour, 0, 23},
+		{&c.dom, 1, 31},
+		{&c.month, 1, 12},
+		{&c.dow, 0, 7},
+	} {
+		bits, err := parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return cronSpec{}, fmt.Errorf("cron spec %q: %v", spec, err)
+		}
+		*f.bits = bits
+	}
+	if c.dow&(1<<7) != 0 {
+		c.dow = c.dow&^(1<<7) | 1
+	}
+	c.domAny = strings.HasPrefix(fields[2], "*")
+	c.dowAny = strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%q has an invalid step", part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := min, max
+		if rng != "*" {
+			var err error
+			if i := strings.IndexByte(rng, '-'); i >= 0 {
+				lo, err = strconv.Atoi(rng[:i])
+				if err == nil {
+					hi, err = strconv.Atoi(rng[i+1:])
+				}
+			} else if lo, err = strconv.Atoi(rng); step == 1 {
+				hi = lo
+			}
+			if err != nil {
+				return 0, fmt.Errorf("%q is not a number or range", part)
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// matches reports whether the minute t is in the spec.
+func (c cronSpec) matches(t time.Time) bool {
+	if c.minute&(1<<uint(t.Minute())) == 0 || c.hour&(1<<uint(t.Hour())) == 0 || c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	}
+	return dom || dow
+}
@@ -0,0 +1,144 @@
+package dbtimer
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Option configures a Driver registered with RegisterTimer.
+type Option func(*Driver) error
+
+// WithDriver fixes the underlying driver, so that the DSN passed to sql.Open
+// is the underlying driver's DSN alone, without the "<driverName> " prefix.
+func WithDriver(driverName string) Option {
+	return func(d *Driver) error {
+		d.target = driverName
+		return nil
+	}
+}
+
+// WithAutodetect lets the connection string be the underlying driver's DSN
+// alone, inferring the driver from its shape: postgres:// URLs, the mysql
+// driver's user@tcp(host)/db format, and file: or *.db paths for sqlite. Only
+// registered drivers are chosen; if the shape is unknown or ambiguous, Open
+// fails with an error listing the candidates, and the driver can still be
+// named with the timer:<driver>:<dsn> or timer+<driver>:// forms.
+func WithAutodetect() Option {
+	return func(d *Driver) error {
+		d.autodetect = true
+		return nil
+	}
+}
+
+// WithLabels attaches static labels describing the database, such as its
+// name, host, role or shard, to every event from the driver. They are added
+// to each event's Tags, where tags from the call's context win over labels
+// with the same key. To slice metrics by them, list their keys in
+// Stats.Labels.
+func WithLabels(labels map[string]string) Option {
+	return func(d *Driver) error {
+		d.labels = make(map[string]string, len(labels))
+		for k, v := range labels {
+			d.labels[k] = v
+		}
+		return nil
+	}
+}
+
+// WithClock sets the driver's clock, as SetClock does.
+func WithClock(c Clock) Option {
+	return func(d *Driver) error {
+		d.SetClock(c)
+		return nil
+	}
+}
+
+// WithCoarseClock has the driver read the time from a CoarseClock with the
+// given resolution, as SetClock does.
+func WithCoarseClock(resolution time.Duration) Option {
+	return func(d *Driver) error {
+		d.SetClock(NewCoarseClock(resolution))
+		return nil
+	}
+}
+
+// WithFaults sets the faults injected into the driver's calls, as SetFaults
+// does.
+func WithFaults(faults ...Fault) Option {
+	return func(d *Driver) error {
+		d.SetFaults(faults...)
+		return nil
+	}
+}
+
+// WithShadow mirrors the driver's read queries, as SetShadow does.
+func WithShadow(s *Shadow) Option {
+	return func(d *Driver) error {
+		return d.SetShadow(s)
+	}
+}
+
+// WithTimerLogger sends the driver's events to tl instead of the logger set
+// with SetTimerLogger.
+func WithTimerLogger(tl TimerLogger) Option {
+	return func(d *Driver) error {
+		d.logger = tl
+		return nil
+	}
+}
+
+// RegisterTimer registers a timer driver under name with its own state and
+// configuration, so that several underlying drivers can be timed in one
+// process:
+//
+//	dbtimer.RegisterTimer("timer-pg", dbtimer.WithDriver("postgres"))
+//	dbtimer.RegisterTimer("timer-mysql", dbtimer.WithDriver("mysql"))
+//	db, err := sql.Open("timer-pg", "postgres://localhost/app")
+//
+// The returned Driver can be reconfigured later with its Set methods. It is an
+// ErrConfig error if name is already registered.
+func RegisterTimer(name string, opts ...Option) (*Driver, error) {
+	for _, n := range sql.Drivers() {
+		if n == name {
+			return nil, &Error{Kind: ErrConfig, Err: fmt.Errorf("a driver named %q is already registered", name)}
+		}
+	}
+	d := &Driver{}
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+	sql.Register(name, d)
+	registered.mu.Lock()
+	registered.drivers = append(registered.drivers, d)
+	registered.mu.Unlock()
+	return d, nil
+}
+
+// OpenDB opens a database through a timer for the driver registered as
+// driverName, configured with opts, without registering the timer under a
+// name of its own. It suits libraries that take a *sql.DB, and code that
+// opens databases dynamically:
+//
+//	db, err := dbtimer.OpenDB("postgres", "postgres://localhost/app", dbtimer.WithLabels(labels))
+//
+// The timer's Driver is db.Driver().(*dbtimer.Driver), for reconfiguring it
+// with its Set methods.
+func OpenDB(driverName, dsn string, opts ...Option) (*sql.DB, error) {
+	d := &Driver{target: driverName}
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+	c, err := d.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	registered.mu.Lock()
+	registered.drivers = append(registered.drivers, d)
+	registered.mu.Unlock()
+	return sql.OpenDB(c), nil
+}
@@ -0,0 +1,191 @@
+package dbtimer
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// WriteSnapshot writes the report of s as JSON, to be kept with a release and
+// read back with ReadSnapshot as the baseline of a RegressionDetector for the
+// next one.
+func (s *Stats) WriteSnapshot(w io.Writer) error {
+	return json.NewEncoder(w).Encode(s.Report())
+}
+
+// ReadSnapshot reads the stats written by WriteSnapshot. It is an
+// ErrSerialization error if they can't be decoded.
+func ReadSnapshot(r io.Reader) ([]QueryStats, error) {
+	var out []QueryStats
+	if err := json.NewDecoder(r).Decode(&out); err != nil {
+		return nil, &Error{Kind: ErrSerialization, Err: err}
+	}
+	return out, nil
+}
+
+// RegressionDetector is a TimerLogger that compares the latency of each
+// fingerprint, or stored procedure, with a baseline from a previous release,
+// and reports those that have become slower: canary analysis of the
+// database calls of a new release. Load the baseline with ReadSnapshot from
+// a snapshot the previous release wrote with Stats.WriteSnapshot.
+//
+// Live latencies are counted in the buckets of the baseline's histograms, so
+// that their quantiles are comparable. Fingerprints that aren't in the
+// baseline are ignored; see FingerprintWatch for those.
+type RegressionDetector struct {
+	// Baseline is the stats of the previous release. Changing it after the
+	// first event has no effect.
+	Baseline []QueryStats
+
+	// Quantile is the quantile compared. The default is 0.99.
+	Quantile float64
+
+	// Threshold is how much slower, as a fraction of the baseline, the
+	// live quantile must be to be a regression. The default is 0.5, that
+	// is 50% slower.
+	Threshold float64
+
+	// MinCount is the number of live calls a fingerprint must have before
+	// it is compared. The default is 100.
+	MinCount int64
+
+	// OnRegression, if set, is called when a fingerprint regresses. It is
+	// called again for the fingerprint only after it has recovered and
+	// regressed once more.
+	OnRegression func(Regression)
+
+	once sync.Once
+	mu   sync.Mutex
+	live map[string]*liveLatency
+}
+
+// Regression is a fingerprint, or stored procedure, whose latency at
+// Quantile has gone from Baseline to Live over Count calls. Owner is the
+// OwnerTag of the call that made it a regression.
+type Regression struct {
+	Fingerprint string
+	Procedure   string
+	Owner       string
+	Quantile    float64
+	Baseline    time.Duration
+	Live        time.Duration
+	Count       int64
+}
+
+// Delta returns how much slower Live is than Baseline, as a fraction of
+// Baseline.
+func (r Regression) Delta() float64 {
+	if r.Baseline <= 0 {
+		return 0
+	}
+	return float64(r.Live-r.Baseline) / float64(r.Baseline)
+}
+
+type liveLatency struct {
+	fingerprint string
+	procedure   string
+	baseline    time.Duration
+	latency     Histogram
+	regressed   *Regression
+}
+
+// init indexes the baseline by fingerprint, or procedure. Entries for the
+// same one with different labels are merged when their buckets agree.
+func (rd *RegressionDetector) init() {
+	q := rd.quantile()
+	rd.live = map[string]*liveLatency{}
+	merged := map[string]Histogram{}
+	for _, qs := range rd.Baseline {
+		k := qs.Fingerprint
+		if qs.Procedure != "" {
+			k = "\x01" + qs.Procedure
+		}
+		h, ok := merged[k]
+		if !ok {
+			merged[k] = qs.Latency.clone()
+			rd.live[k] = &liveLatency{fingerprint: qs.Fingerprint, procedure: qs.Procedure, latency: NewHistogram(qs.Latency.Bounds)}
+			continue
+		}
+		if len(h.Counts) == len(qs.Latency.Counts) {
+			for i, c := range qs.Latency.Counts {
+				h.Counts[i] += c
+			}
+		}
+	}
+	for k, h := range merged {
+		rd.live[k].baseline = h.Quantile(q)
+	}
+}
+
+func (rd *RegressionDetector) quantile() float64 {
+	if rd.Quantile <= 0 || rd.Quantile > 1 {
+		return 0.99
+	}
+	return rd.Quantile
+}
+
+// Log adds ti to the live latency of its fingerprint, or procedure, and
+// calls OnRegression if that makes it a regression. Events of a driver's
+// warm-up are left out.
+func (rd *RegressionDetector) Log(ti TimerInfo) {
+	if !runsStatement(ti.Method) || ti.Query == "" || ti.Warmup {
+		return
+	}
+	rd.once.Do(rd.init)
+	k := (&Stats{}).key(ti).key
+	threshold := rd.Threshold
+	if threshold <= 0 {
+		threshold = 0.5
+	}
+	min := rd.MinCount
+	if min <= 0 {
+		min = 100
+	}
+	rd.mu.Lock()
+	ll := rd.live[k]
+	if ll == nil {
+		rd.mu.Unlock()
+		return
+	}
+	ll.latency.Observe(ti.Elapsed())
+	var found *Regression
+	if n := ll.latency.Count(); n >= min && ll.baseline > 0 {
+		live := ll.latency.Quantile(rd.quantile())
+		switch {
+		case float64(live) > float64(ll.baseline)*(1+threshold):
+			r := Regression{Fingerprint: ll.fingerprint, Procedure: ll.procedure, Owner: ti.Tags[OwnerTag], Quantile: rd.quantile(), Baseline: ll.baseline, Live: live, Count: n}
+			if ll.regressed == nil {
+				found = &r
+			}
+			ll.regressed = &r
+		default:
+			ll.regressed = nil
+		}
+	}
+	rd.mu.Unlock()
+	if found != nil && rd.OnRegression != nil {
+		rd.OnRegression(*found)
+	}
+}
+
+// Regressions returns the fingerprints and procedures that are regressed
+// now, the most regressed first.
+func (rd *RegressionDetector) Regressions() []Regression {
+	rd.mu.Lock()
+	var out []Regression
+	for _, ll := range rd.live {
+		if ll.regressed != nil {
+			out = append(out, *ll.regressed)
+		}
+	}
+	rd.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if di, dj := out[i].Delta(), out[j].Delta(); di != dj {
+			return di > dj
+		}
+		return out[i].Fingerprint < out[j].Fingerprint
+	})
+	return out
+}
@@ -0,0 +1,190 @@
+package dbtimer
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReplicaTracker is a TimerLogger for applications that send writes to a
+// primary and reads to replicas through separate DSNs. It aggregates
+// statements by the role label of the database they ran on (see WithLabels),
+// and correlates reads on a replica with the last write on the primary that
+// carried the same request tag, measuring the gap between them. Reads that
+// follow a write closely are the ones most likely to see stale data.
+type ReplicaTracker struct {
+	// RoleKey is the tag that holds the database's role. The default is
+	// "role".
+	RoleKey string
+
+	// Primary is the role of the primary. The default is "primary"; every
+	// other role is a replica.
+	Primary string
+
+	// RequestKey is the tag that identifies a request, as set with WithTag.
+	// The default is "request".
+	RequestKey string
+
+	// MaxRequests is the number of requests whose last write is remembered.
+	// The default is 10000.
+	MaxRequests int
+
+	// OnReadAfterWrite, if set, is called for each correlated read.
+	OnReadAfterWrite func(ReadAfterWrite)
+
+	mu      sync.Mutex
+	roles   map[string]*RoleStats
+	writes  map[string]TimerInfo
+	order   []string
+	gaps    Histogram
+	raCount int64
+}
+
+// RoleStats is the aggregate of every statement run on databases with one
+// role.
+type RoleStats struct {
+	Role    string
+	Reads   int64
+	Writes  int64
+	Errors  int64
+	DBTime  time.Duration
+	Latency Histogram
+}
+
+// ReadAfterWrite is a read on a replica made by a request that had already
+// written to the primary. Gap is the time from the end of the write to the
+// start of the read.
+type ReadAfterWrite struct {
+	Request string
+	Role    string
+	Write   TimerInfo
+	Read    TimerInfo
+	Gap     time.Duration
+}
+
+// ReplicaReport is a combined view of the primary and replicas.
+type ReplicaReport struct {
+	// Roles holds the primary first, then the replicas by role.
+	Roles []RoleStats
+
+	// ReadsAfterWrite is the number of correlated reads, and Gaps the
+	// histogram of their gaps.
+	ReadsAfterWrite int64
+	Gaps            Histogram
+}
+
+func (rt *ReplicaTracker) keys() (role, primary, request string) {
+	role, primary, request = rt.RoleKey, rt.Primary, rt.RequestKey
+	if role == "" {
+		role = "role"
+	}
+	if primary == "" {
+		primary = "primary"
+	}
+	if request == "" {
+		request = "request"
+	}
+	return role, primary, request
+}
+
+// Log adds ti to the stats of its role. Events that don't run a statement, or
+// have no role tag, are ignored.
+func (rt *ReplicaTracker) Log(ti TimerInfo) {
+	roleKey, primary, requestKey := rt.keys()
+	role, ok := ti.Tags[roleKey]
+	if !ok || !runsStatement(ti.Method) || ti.Query == "" {
+		return
+	}
+	read := isRead(ti.Query)
+	d := ti.Elapsed()
+	request := ti.Tags[requestKey]
+	var raw *ReadAfterWrite
+	rt.mu.Lock()
+	if rt.roles == nil {
+		rt.roles = map[string]*RoleStats{}
+		rt.writes = map[string]TimerInfo{}
+		rt.gaps = NewHistogram(nil)
+	}
+	rs := rt.roles[role]
+	if rs == nil {
+		rs = &RoleStats{Role: role, Latency: NewHistogram(nil)}
+		rt.roles[role] = rs
+	}
+	if read {
+		rs.Reads++
+	} else {
+		rs.Writes++
+	}
+	if ti.Err != nil {
+		rs.Errors++
+	}
+	rs.DBTime += d
+	rs.Latency.Observe(d)
+	if request != "" {
+		switch {
+		case role == primary && !read && ti.Err == nil:
+			rt.rememberWrite(request, ti)
+		case role != primary && read:
+			if w, ok := rt.writes[request]; ok {
+				raw = &ReadAfterWrite{Request: request, Role: role, Write: w, Read: ti, Gap: ti.Start.Sub(w.End)}
+				rt.raCount++
+				rt.gaps.Observe(raw.Gap)
+			}
+		}
+	}
+	rt.mu.Unlock()
+	if raw != nil && rt.OnReadAfterWrite != nil {
+		rt.OnReadAfterWrite(*raw)
+	}
+}
+
+// rememberWrite records ti as the last write of request, forgetting the
+// oldest request if there are too many.
+func (rt *ReplicaTracker) rememberWrite(request string, ti TimerInfo) {
+	if _, ok := rt.writes[request]; !ok {
+		max := rt.MaxRequests
+		if max <= 0 {
+			max = 10000
+		}
+		if len(rt.order) >= max {
+			delete(rt.writes, rt.order[0])
+			rt.order = rt.order[1:]
+		}
+		rt.order = append(rt.order, request)
+	}
+	rt.writes[request] = ti
+}
+
+// Report returns the stats of every role seen since the tracker was created
+// or last reset, and the gaps of the reads after writes.
+func (rt *ReplicaTracker) Report() ReplicaReport {
+	_, primary, _ := rt.keys()
+	rt.mu.Lock()
+	r := ReplicaReport{ReadsAfterWrite: rt.raCount, Gaps: NewHistogram(nil)}
+	if rt.roles != nil {
+		r.Gaps = rt.gaps.clone()
+	}
+	for _, rs := range rt.roles {
+		c := *rs
+		c.Latency = rs.Latency.clone()
+		r.Roles = append(r.Roles, c)
+	}
+	rt.mu.Unlock()
+	sort.Slice(r.Roles, func(i, j int) bool {
+		if pi, pj := r.Roles[i].Role == primary, r.Roles[j].Role == primary; pi != pj {
+			return pi
+		}
+		return r.Roles[i].Role < r.Roles[j].Role
+	})
+	return r
+}
+
+// Reset forgets all stats and writes.
+func (rt *ReplicaTracker) Reset() {
+	rt.mu.Lock()
+	rt.roles = nil
+	rt.writes = nil
+	rt.order = nil
+	rt.raCount = 0
+	rt.mu.Unlock()
+}
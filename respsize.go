@@ -0,0 +1,112 @@
+package dbtimer
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+	"time"
+)
+
+// SetResponseSize sets whether d estimates the bytes each query returns. The
+// estimate is the sum of the sizes of the values the application reads from
+// the rows, and is logged, with the number of rows read, as a "rows.Close"
+// event when the rows are closed, timed from when the query returned. It
+// finds the queries that move the most data even when they aren't slow, at
+// the cost of an extra event for every query.
+func (d *Driver) SetResponseSize(on bool) {
+	d.respSize.Store(on)
+}
+
+// WithResponseSize has the driver estimate the bytes each query returns, as
+// SetResponseSize does.
+func WithResponseSize() Option {
+	return func(d *Driver) error {
+		d.SetResponseSize(true)
+		return nil
+	}
+}
+
+// sizeRows adds up the sizes of the values read from rows.
+type sizeRows struct {
+	driver.Rows
+	cs    *connState
+	tl    TimerLogger
+	query string
+	tags  map[string]string
+	start time.Time
+	mem   *memSample
+	rows  int
+	bytes int64
+	once  sync.Once
+}
+
+// measureResponse wraps rows so that the size of the values read from them is
+// logged when they are closed, if d estimates response sizes.
+func (cs *connState) measureResponse(ctx context.Context, method string, query string, rows driver.Rows) driver.Rows {
+	on, _ := cs.d.respSize.Load().(bool)
+	if !on {
+		return rows
+	}
+	tl := cs.d.loggerFor(ctx)
+	if tl == nil || !cs.d.shouldLog(ctx, query) {
+		return rows
+	}
+	tags := cs.statementTags(ctx, query)
+	query, _ = scrub(method, query, nil)
+	query, _ = cs.d.truncate(query)
+	return keepRowsInterfaces(&sizeRows{
+		Rows:  rows,
+		cs:    cs,
+		tl:    tl,
+		query: query,
+		tags:  tags,
+		start: cs.d.now(),
+		mem:   cs.d.sampleMem(),
+	}, rows)
+}
+
+func (r *sizeRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.rows++
+		for _, v := range dest {
+			r.bytes += valueSize(v)
+		}
+	}
+	return err
+}
+
+func (r *sizeRows) Close() error {
+	err := r.Rows.Close()
+	r.once.Do(func() {
+		logEvent(r.tl, TimerInfo{
+			Method:        "rows.Close",
+			Query:         r.query,
+			Start:         r.start,
+			End:           r.cs.d.now(),
+			Err:           err,
+			ConnID:        r.cs.id,
+			Tags:          r.tags,
+			RowCount:      r.rows,
+			ResponseBytes: r.bytes,
+			Memory:        r.mem.since(),
+		})
+	})
+	return err
+}
+
+// valueSize estimates the bytes v took on the wire: the length of strings and
+// []byte, and 8 bytes for numbers and times.
+func valueSize(v driver.Value) int64 {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	case bool:
+		return 1
+	}
+	return 8
+}
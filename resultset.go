@@ -0,0 +1,127 @@
+package dbtimer
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"time"
+)
+
+// resultSetRows times each result set of a query whose rows have more than
+// one, such as those of a stored procedure. When the application moves to
+// the second set, the first is logged as a "rows.ResultSet" event, and each
+// later set is logged when the application moves past it or closes the rows.
+// An event runs from when its set became current to when its last row was
+// read, and carries the set's index and the number of rows read from it.
+// Queries with one result set log nothing more.
+type resultSetRows struct {
+	driver.Rows
+	next  driver.RowsNextResultSet
+	cs    *connState
+	tl    TimerLogger
+	query string
+	tags  map[string]string
+
+	index int
+	start time.Time
+	end   time.Time
+	rows  int
+	once  sync.Once
+}
+
+// timeResultSets wraps rows that can have more than one result set so that
+// each set is timed.
+func (cs *connState) timeResultSets(ctx context.Context, method string, query string, rows driver.Rows) driver.Rows {
+	next, ok := rows.(driver.RowsNextResultSet)
+	tl := cs.d.loggerFor(ctx)
+	if !ok || tl == nil || !cs.d.shouldLog(ctx, query) {
+		return rows
+	}
+	tags := cs.statementTags(ctx, query)
+	query, _ = scrub(method, query, nil)
+	query, _ = cs.d.truncate(query)
+	return keepRowsInterfaces(&resultSetRows{
+		Rows:  rows,
+		next:  next,
+		cs:    cs,
+		tl:    tl,
+		query: query,
+		tags:  tags,
+		start: cs.d.now(),
+	}, rows)
+}
+
+func (r *resultSetRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	switch {
+	case err == nil:
+		r.rows++
+	case err == io.EOF && r.end.IsZero():
+		r.end = r.cs.d.now()
+	}
+	return err
+}
+
+func (r *resultSetRows) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *resultSetRows) NextResultSet() error {
+	err := r.next.NextResultSet()
+	if err == nil {
+		r.logSet()
+		r.index++
+		r.start = r.cs.d.now()
+		r.end = time.Time{}
+		r.rows = 0
+	}
+	return err
+}
+
+func (r *resultSetRows) Close() error {
+	err := r.Rows.Close()
+	r.once.Do(func() {
+		if r.index > 0 {
+			r.logSet()
+		}
+	})
+	return err
+}
+
+// logSet logs the current result set.
+func (r *resultSetRows) logSet() {
+	end := r.end
+	if end.IsZero() {
+		end = r.cs.d.now()
+	}
+	logEvent(r.tl, TimerInfo{
+		Method:    "rows.ResultSet",
+		Query:     r.query,
+		Start:     r.start,
+		End:       end,
+		ConnID:    r.cs.id,
+		Tags:      r.tags,
+		ResultSet: r.index,
+		RowCount:  r.rows,
+	})
+}
+
+// keepRowsInterfaces returns wrapper, which wraps inner, with the optional
+// interfaces of inner, which a wrapper that embeds driver.Rows would
+// otherwise hide from the sql package. The interfaces wrapper implements
+// itself are kept in place of inner's.
+func keepRowsInterfaces(wrapper, inner driver.Rows) driver.Rows {
+	var i rowsInterfaces
+	if _, ok := inner.(driver.RowsNextResultSet); ok {
+		if i.next, ok = wrapper.(driver.RowsNextResultSet); !ok {
+			i.next = inner.(driver.RowsNextResultSet)
+		}
+	}
+	i.scanType, _ = inner.(driver.RowsColumnTypeScanType)
+	i.databaseType, _ = inner.(driver.RowsColumnTypeDatabaseTypeName)
+	i.length, _ = inner.(driver.RowsColumnTypeLength)
+	i.nullable, _ = inner.(driver.RowsColumnTypeNullable)
+	i.precisionScale, _ = inner.(driver.RowsColumnTypePrecisionScale)
+	return wrapRows(wrapper, i)
+}
@@ -0,0 +1,349 @@
+package dbtimer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rollup is the database time of one team, or any other value of a Stats
+// label, over a period: its total, the change on the period before, and the
+// statements that spent the most.
+type Rollup struct {
+	// Team is the value of the label the rollup is by, or "" for the
+	// statements that have none.
+	Team string
+
+	Start, End time.Time
+
+	Count  int64
+	Errors int64
+	Total  time.Duration
+
+	// Previous is the team's total over the period before, if HasPrevious
+	// is set.
+	Previous    time.Duration
+	HasPrevious bool
+
+	// Top are the statements with the most total time, the most first.
+	Top []QueryStats
+}
+
+// Change returns how much Total changed on Previous, as a fraction of
+// Previous, or 0 if there is no previous period or it had no time.
+func (r Rollup) Change() float64 {
+	if !r.HasPrevious || r.Previous <= 0 {
+		return 0
+	}
+	return float64(r.Total-r.Previous) / float64(r.Previous)
+}
+
+// Rollups groups the stats of a period by the value of the label by, such as
+// OwnerTag, which must be one of the Labels of the Stats they came from. Each
+// team's rollup keeps its top statements by total time, and is compared with
+// previous, the stats of the period before, if it isn't nil. The rollups
+// are ordered the most total time first.
+func Rollups(report, previous []QueryStats, by string, top int) []Rollup {
+	teams := map[string]*Rollup{}
+	for _, qs := range report {
+		team := qs.Labels[by]
+		r, ok := teams[team]
+		if !ok {
+			r = &Rollup{Team: team}
+			teams[team] = r
+		}
+		r.Count += qs.Count
+		r.Errors += qs.Errors
+		r.Total += qs.Total
+		r.Top = append(r.Top, qs)
+	}
+	if previous != nil {
+		prev := map[string]time.Duration{}
+		for _, qs := range previous {
+			prev[qs.Labels[by]] += qs.Total
+		}
+		for team, r := range teams {
+			r.Previous, r.HasPrevious = prev[team]
+		}
+	}
+	out := make([]Rollup, 0, len(teams))
+	for _, r := range teams {
+		sort.Slice(r.Top, func(i, j int) bool {
+			if r.Top[i].Total != r.Top[j].Total {
+				return r.Top[i].Total > r.Top[j].Total
+			}
+			return r.Top[i].Fingerprint < r.Top[j].Fingerprint
+		})
+		if top > 0 && len(r.Top) > top {
+			r.Top = r.Top[:top]
+		}
+		out = append(out, *r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Total != out[j].Total {
+			return out[i].Total > out[j].Total
+		}
+		return out[i].Team < out[j].Team
+	})
+	return out
+}
+
+// RollupReporter sends the rollups of a Stats every Period, such as a weekly
+// summary of each team's database time:
+//
+//	stats := &dbtimer.Stats{Labels: []string{dbtimer.OwnerTag}}
+//	rr := &dbtimer.RollupReporter{Stats: stats, OnRollup: func(rs []dbtimer.Rollup) {
+//		dbtimer.WriteRollupsMarkdown(reportFile(), rs)
+//	}}
+//	go rr.Run(ctx)
+//
+// Each period's rollups are of the difference between the Stats' report at
+// its end and at its start, so the Stats keeps counting for its other uses
+// and is never reset.
+type RollupReporter struct {
+	Stats *Stats
+
+	// Period is the time between rollups. The default is a week.
+	Period time.Duration
+
+	// By is the label the rollups are by. The default is OwnerTag.
+	By string
+
+	// Top is the number of statements kept in each rollup. The default is
+	// 10.
+	Top int
+
+	// OnRollup, if set, is called with the rollups of each period.
+	OnRollup func([]Rollup)
+
+	// Logger, if set, is sent each rollup as a "stats.Rollup" event, over
+	// the period from Start to End, with the team in the By tag and the
+	// counts and the previous total in tags of their own, so that the
+	// rollups reach any sink.
+	Logger TimerLogger
+
+	mu       sync.Mutex
+	start    time.Time
+	last     []QueryStats
+	previous []QueryStats
+}
+
+// Run sends rollups every Period until ctx is done, and returns ctx's error.
+// It is an ErrConfig error if Stats is nil.
+func (rr *RollupReporter) Run(ctx context.Context) error {
+	if rr.Stats == nil {
+		return &Error{Kind: ErrConfig, Err: errors.New("rollup reporter needs a Stats")}
+	}
+	period := rr.Period
+	if period <= 0 {
+		period = 7 * 24 * time.Hour
+	}
+	rr.mu.Lock()
+	if rr.start.IsZero() {
+		rr.start, rr.last = time.Now(), rr.Stats.Report()
+	}
+	rr.mu.Unlock()
+	tick := time.NewTicker(period)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			rr.Flush()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Flush ends the current period now, sends its rollups and returns them.
+func (rr *RollupReporter) Flush() []Rollup {
+	now := time.Now()
+	cur := rr.Stats.Report()
+	rr.mu.Lock()
+	period := diffReport(cur, rr.last)
+	rollups := Rollups(period, rr.previous, rr.by(), rr.top())
+	for i := range rollups {
+		rollups[i].Start, rollups[i].End = rr.start, now
+	}
+	rr.start, rr.last, rr.previous = now, cur, period
+	rr.mu.Unlock()
+	if rr.OnRollup != nil {
+		rr.OnRollup(rollups)
+	}
+	if rr.Logger != nil {
+		for _, r := range rollups {
+			tags := map[string]string{
+				rr.by():      r.Team,
+				"statements": fmt.Sprint(r.Count),
+				"errors":     fmt.Sprint(r.Errors),
+			}
+			if r.HasPrevious {
+				tags["previous_total"] = r.Previous.String()
+			}
+			logEvent(rr.Logger, TimerInfo{Method: "stats.Rollup", Start: r.Start, End: r.End, Duration: r.Total, Tags: tags})
+		}
+	}
+	return rollups
+}
+
+func (rr *RollupReporter) by() string {
+	if rr.By == "" {
+		return OwnerTag
+	}
+	return rr.By
+}
+
+func (rr *RollupReporter) top() int {
+	if rr.Top <= 0 {
+		return 10
+	}
+	return rr.Top
+}
+
+// diffReport returns the stats in cur that were added since last, an earlier
+// report of the same Stats. Only the counts and total time are subtracted;
+// the other fields are cur's.
+func diffReport(cur, last []QueryStats) []QueryStats {
+	before := make(map[string]QueryStats, len(last))
+	for _, qs := range last {
+		before[reportKey(qs)] = qs
+	}
+	out := make([]QueryStats, 0, len(cur))
+	for _, qs := range cur {
+		if b, ok := before[reportKey(qs)]; ok && qs.Count >= b.Count {
+			qs.Count -= b.Count
+			qs.Errors -= b.Errors
+			qs.Total -= b.Total
+		}
+		if qs.Count > 0 {
+			out = append(out, qs)
+		}
+	}
+	return out
+}
+
+// reportKey identifies the fingerprint, or procedure, and label values of
+// qs.
+func reportKey(qs QueryStats) string {
+	k := qs.Fingerprint
+	if qs.Procedure != "" {
+		k = "\x01" + qs.Procedure
+	}
+	labels := make([]string, 0, len(qs.Labels))
+	for l, v := range qs.Labels {
+		labels = append(labels, l+"="+v)
+	}
+	sort.Strings(labels)
+	return k + "\x00" + strings.Join(labels, "\x00")
+}
+
+// rollupTeam is how a rollup's team is written in reports.
+func rollupTeam(r Rollup) string {
+	if r.Team == "" {
+		return "(no owner)"
+	}
+	return r.Team
+}
+
+// rollupChange is how a rollup's change is written in reports.
+func rollupChange(r Rollup) string {
+	if !r.HasPrevious || r.Previous <= 0 {
+		return "new"
+	}
+	return fmt.Sprintf("%+.1f%%", r.Change()*100)
+}
+
+// rollupStatement is how a top statement is written in reports.
+func rollupStatement(qs QueryStats) string {
+	if qs.Procedure != "" {
+		return "CALL " + qs.Procedure
+	}
+	return qs.Fingerprint
+}
+
+// WriteRollupsMarkdown writes rollups as a Markdown report, a section per
+// team with its totals and a table of its top statements.
+func WriteRollupsMarkdown(w io.Writer, rollups []Rollup) error {
+	var b strings.Builder
+	b.WriteString("# Database time by team\n")
+	if len(rollups) > 0 && !rollups[0].Start.IsZero() {
+		fmt.Fprintf(&b, "\n%s to %s\n", rollups[0].Start.Format(time.RFC3339), rollups[0].End.Format(time.RFC3339))
+	}
+	for _, r := range rollups {
+		fmt.Fprintf(&b, "\n## %s\n\n", rollupTeam(r))
+		fmt.Fprintf(&b, "Total %v (%s on the previous period), %d statements, %d errors.\n\n", r.Total, rollupChange(r), r.Count, r.Errors)
+		b.WriteString("| Statement | Calls | Errors | Total | Mean |\n|---|---:|---:|---:|---:|\n")
+		for _, qs := range r.Top {
+			stmt := strings.NewReplacer("|", `\|`, "`", "'").Replace(rollupStatement(qs))
+			fmt.Fprintf(&b, "| `%s` | %d | %d | %v | %v |\n", stmt, qs.Count, qs.Errors, qs.Total, qs.Mean())
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteRollupsHTML writes rollups as an HTML page with no external resources.
+func WriteRollupsHTML(w io.Writer, rollups []Rollup) error {
+	type row struct {
+		Statement     string
+		Calls, Errors int64
+		Total, Mean   time.Duration
+	}
+	type section struct {
+		Team, Change  string
+		Count, Errors int64
+		Total         time.Duration
+		Top           []row
+	}
+	data := struct {
+		Period   string
+		Sections []section
+	}{}
+	if len(rollups) > 0 && !rollups[0].Start.IsZero() {
+		data.Period = rollups[0].Start.Format(time.RFC3339) + " to " + rollups[0].End.Format(time.RFC3339)
+	}
+	for _, r := range rollups {
+		s := section{Team: rollupTeam(r), Change: rollupChange(r), Count: r.Count, Errors: r.Errors, Total: r.Total}
+		for _, qs := range r.Top {
+			s.Top = append(s.Top, row{rollupStatement(qs), qs.Count, qs.Errors, qs.Total, qs.Mean()})
+		}
+		data.Sections = append(data.Sections, s)
+	}
+	return rollupTemplate.Execute(w, data)
+}
+
+var rollupTemplate = template.Must(template.New("rollup").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Database time by team</title>
+<style>
+body { font-family: sans-serif; margin: 20px; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; }
+td.n { text-align: right; }
+code { font-size: 12px; }
+</style>
+</head>
+<body>
+<h1>Database time by team</h1>
+{{if .Period}}<p>{{.Period}}</p>{{end}}
+{{range .Sections}}
+<h2>{{.Team}}</h2>
+<p>Total {{.Total}} ({{.Change}} on the previous period), {{.Count}} statements, {{.Errors}} errors.</p>
+<table>
+<tr><th>Statement</th><th>Calls</th><th>Errors</th><th>Total</th><th>Mean</th></tr>
+{{range .Top}}<tr><td><code>{{.Statement}}</code></td><td class="n">{{.Calls}}</td><td class="n">{{.Errors}}</td><td class="n">{{.Total}}</td><td class="n">{{.Mean}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>No statements were recorded.</p>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,122 @@
+package dbtimer
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// Sampling reduces the events a Driver logs for its calls, for services
+// whose call volume is too high to log every one. Calls that fail are always
+// logged, as are calls that are exempt, and calls made with a context from
+// Force. Loggers such as Stats only see the events that are kept, so their
+// counts are of sampled calls.
+type Sampling struct {
+	// SlowThreshold, if not 0, leaves out the events of calls that took less
+	// time.
+	SlowThreshold time.Duration
+
+	// Rate, if not 0, is the fraction of the remaining events that are
+	// logged, between 0 and 1, chosen at random.
+	Rate float64
+
+	// ExemptFingerprints are the statements that are always logged, such
+	// as payment writes. They are passed through Fingerprint, so they may
+	// be written as queries.
+	ExemptFingerprints []string
+
+	// ExemptTags are tags that exempt a call from sampling when its
+	// context carries any of them, as set with WithTag.
+	ExemptTags map[string]string
+}
+
+// SetSampling sets the sampling of the events of d's calls. Passing nil logs
+// every call. It is an ErrConfig error if SlowThreshold is negative or Rate
+// isn't between 0 and 1.
+//
+// Since the exemptions are part of the Sampling, they can be changed while
+// the driver is in use by calling SetSampling again, or from a
+// SettingsProvider with WatchSettings.
+func (d *Driver) SetSampling(s *Sampling) error {
+	h, err := newSamplingHolder(s)
+	if err != nil {
+		return err
+	}
+	d.sampling.Store(h)
+	return nil
+}
+
+func newSamplingHolder(s *Sampling) (samplingHolder, error) {
+	var h samplingHolder
+	if s == nil {
+		return h, nil
+	}
+	if s.SlowThreshold < 0 {
+		return h, &Error{Kind: ErrConfig, Err: fmt.Errorf("sampling SlowThreshold %v is negative", s.SlowThreshold)}
+	}
+	if s.Rate < 0 || s.Rate > 1 {
+		return h, &Error{Kind: ErrConfig, Err: fmt.Errorf("sampling Rate %v is not between 0 and 1", s.Rate)}
+	}
+	cfg := *s
+	cfg.ExemptFingerprints = append([]string(nil), s.ExemptFingerprints...)
+	cfg.ExemptTags = make(map[string]string, len(s.ExemptTags))
+	for k, v := range s.ExemptTags {
+		cfg.ExemptTags[k] = v
+	}
+	h.s = &cfg
+	h.exempt = fingerprintSet(s.ExemptFingerprints)
+	return h, nil
+}
+
+// WithSampling sets the sampling of the driver's events, as SetSampling does.
+func WithSampling(s *Sampling) Option {
+	return func(d *Driver) error {
+		return d.SetSampling(s)
+	}
+}
+
+type samplingHolder struct {
+	s      *Sampling
+	exempt map[string]bool
+}
+
+// sampled reports whether the event of a call of query made with ctx, that
+// took dur and returned err, is logged. While a quiet window is open, its
+// Sampling is used in place of the driver's, though the driver's exemptions
+// still apply.
+func (d *Driver) sampled(ctx context.Context, query string, dur time.Duration, err error) bool {
+	if err != nil {
+		return true
+	}
+	h, _ := d.sampling.Load().(samplingHolder)
+	active := h
+	qh, quiet := d.quietSampling()
+	if quiet {
+		active = qh
+	}
+	if active.s == nil || active.keeps(dur) {
+		return true
+	}
+	return active.exempted(ctx, query) || (quiet && h.s != nil && h.exempted(ctx, query))
+}
+
+// keeps reports whether the event of a call that took dur is kept, before
+// exemptions.
+func (h samplingHolder) keeps(dur time.Duration) bool {
+	return dur >= h.s.SlowThreshold && (h.s.Rate == 0 || rand.Float64() < h.s.Rate)
+}
+
+// exempted reports whether a call of query made with ctx is exempt from
+// sampling.
+func (h samplingHolder) exempted(ctx context.Context, query string) bool {
+	if logModeFrom(ctx) == logForced {
+		return true
+	}
+	for k, v := range TagsFromContext(ctx) {
+		if want, ok := h.s.ExemptTags[k]; ok && want == v {
+			return true
+		}
+	}
+	return len(h.exempt) > 0 && query != "" && h.exempt[Fingerprint(query)]
+}
@@ -0,0 +1,166 @@
+package dbtimer
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// SessionProbe is a query run on each new connection from a Driver to record
+// the server's version and settings. Each column of the row it returns
+// becomes a tag on the connection's events, named by the column, so that
+// latency can be broken down by server version or setting across a mixed
+// fleet.
+type SessionProbe struct {
+	// Query returns one row of settings, named by their columns.
+	Query string
+
+	// Prefix is put before each column name to make its tag key. The
+	// default is "session.".
+	Prefix string
+
+	// Timeout limits how long the probe may take. The default is a second.
+	Timeout time.Duration
+}
+
+// Probes for common databases.
+var (
+	PostgresSessionProbe = &SessionProbe{Query: "SELECT current_setting('server_version') AS server_version, " +
+		"current_setting('TimeZone') AS timezone, current_setting('work_mem') AS work_mem, " +
+		"current_setting('default_transaction_isolation') AS isolation"}
+	MySQLSessionProbe = &SessionProbe{Query: "SELECT @@version AS server_version, @@session.time_zone AS timezone, " +
+		"@@session.sql_mode AS sql_mode, @@session.transaction_isolation AS isolation"}
+)
+
+// SetSessionProbe sets the probe run on each new connection from d. Passing
+// nil stops probing. It is an ErrConfig error if Query is empty. A probe that
+// fails is reported to the error handler as ErrConfig, and the connection is
+// used without its tags.
+func (d *Driver) SetSessionProbe(p *SessionProbe) error {
+	var sp *SessionProbe
+	if p != nil {
+		if p.Query == "" {
+			return &Error{Kind: ErrConfig, Err: errors.New("session probe has no query")}
+		}
+		cfg := *p
+		if cfg.Prefix == "" {
+			cfg.Prefix = "session."
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = time.Second
+		}
+		sp = &cfg
+	}
+	d.probe.Store(probeHolder{sp})
+	return nil
+}
+
+// WithSessionProbe sets the probe run on each new connection from the driver,
+// as SetSessionProbe does.
+func WithSessionProbe(p *SessionProbe) Option {
+	return func(d *Driver) error {
+		return d.SetSessionProbe(p)
+	}
+}
+
+type probeHolder struct {
+	p *SessionProbe
+}
+
+// probeSession runs d's SessionProbe on c, a new connection, and adds the
+// settings it returns to the connection's labels.
+func (cs *connState) probeSession(ctx context.Context, c driver.Conn) {
+	h, _ := cs.d.probe.Load().(probeHolder)
+	if h.p == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.p.Timeout)
+	defer cancel()
+	settings, err := h.p.run(ctx, c)
+	if err != nil {
+		handleError(&Error{Kind: ErrConfig, Err: fmt.Errorf("session probe: %v", err)})
+		return
+	}
+	labels := make(map[string]string, len(cs.d.labels)+len(settings))
+	for k, v := range cs.d.labels {
+		labels[k] = v
+	}
+	for k, v := range settings {
+		labels[k] = v
+	}
+	cs.labels = labels
+}
+
+// run queries c and returns the columns of the first row, as tags.
+func (p *SessionProbe) run(ctx context.Context, c driver.Conn) (map[string]string, error) {
+	rows, closeStmt, err := probeQuery(ctx, c, p.Query)
+	if err != nil {
+		return nil, err
+	}
+	defer closeStmt()
+	defer rows.Close()
+	cols := rows.Columns()
+	dest := make([]driver.Value, len(cols))
+	if err := rows.Next(dest); err != nil {
+		if err == io.EOF {
+			err = errors.New("no rows returned")
+		}
+		return nil, err
+	}
+	settings := make(map[string]string, len(cols))
+	for i, col := range cols {
+		var s string
+		switch v := dest[i].(type) {
+		case nil:
+		case []byte:
+			s = string(v)
+		case time.Time:
+			s = v.Format(time.RFC3339Nano)
+		default:
+			s = fmt.Sprint(v)
+		}
+		settings[p.Prefix+col] = s
+	}
+	return settings, nil
+}
+
+// probeQuery runs query on c directly, or through a prepared statement if c
+// can't. The returned function closes the statement, if there is one.
+func probeQuery(ctx context.Context, c driver.Conn, query string) (driver.Rows, func(), error) {
+	noStmt := func() {}
+	if qc, ok := c.(driver.QueryerContext); ok {
+		rows, err := qc.QueryContext(ctx, query, nil)
+		if err != driver.ErrSkip {
+			return rows, noStmt, err
+		}
+	} else if q, ok := c.(driver.Queryer); ok {
+		rows, err := q.Query(query, nil)
+		if err != driver.ErrSkip {
+			return rows, noStmt, err
+		}
+	}
+	var s driver.Stmt
+	var err error
+	if cpc, ok := c.(driver.ConnPrepareContext); ok {
+		s, err = cpc.PrepareContext(ctx, query)
+	} else {
+		s, err = c.Prepare(query)
+	}
+	if err != nil {
+		return nil, noStmt, err
+	}
+	var rows driver.Rows
+	if sqc, ok := s.(driver.StmtQueryContext); ok {
+		rows, err = sqc.QueryContext(ctx, nil)
+	} else {
+		rows, err = s.Query(nil)
+	}
+	if err != nil {
+		s.Close()
+		return nil, noStmt, err
+	}
+	return rows, func() { s.Close() }, nil
+}
@@ -0,0 +1,150 @@
+package dbtimer
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// Settings are the settings of a driver that a SettingsProvider controls.
+// Nil fields turn their setting off.
+type Settings struct {
+	Sampling      *Sampling
+	Timeouts      *Timeouts
+	ColumnCapture *ColumnCapture
+	RedactArgs    bool
+}
+
+// SettingsProvider supplies the settings of drivers from a feature-flag
+// system, such as LaunchDarkly or flagd, so that sampling and thresholds can
+// be changed across a fleet in seconds. Implement it by reading the flags
+// for the service and returning them as Settings.
+type SettingsProvider interface {
+	Settings(ctx context.Context) (Settings, error)
+}
+
+// SettingsProviderFunc is a function that is a SettingsProvider.
+type SettingsProviderFunc func(ctx context.Context) (Settings, error)
+
+func (spf SettingsProviderFunc) Settings(ctx context.Context) (Settings, error) {
+	return spf(ctx)
+}
+
+// SettingsNotifier is implemented by SettingsProviders whose flag system
+// pushes changes. Changed returns a channel that receives a value whenever
+// the settings may have changed, so that they are read at once rather than
+// at the next poll.
+type SettingsNotifier interface {
+	Changed() <-chan struct{}
+}
+
+// SettingsWatcher keeps the settings from a SettingsProvider applied. See
+// WatchSettings.
+type SettingsWatcher struct {
+	p       SettingsProvider
+	drivers []*Driver
+	timeout time.Duration
+	cancel  context.CancelFunc
+	done    chan struct{}
+	once    sync.Once
+
+	// last is the Settings last applied. Only the watching goroutine
+	// touches it after WatchSettings returns.
+	last *Settings
+}
+
+// WatchSettings reads the settings from p, applies them to drivers, and then
+// reads them again every interval (a minute if it is 0), and whenever p
+// signals a change if it is a SettingsNotifier. Settings are only applied
+// when they change, so that the count behind ColumnCapture.Every isn't reset
+// by every poll.
+// Each read is given interval to finish.
+//
+// It returns an error if the first read or apply fails. Later failures are
+// reported to the error handler as ErrConfig errors, and the settings in
+// effect are kept. Call Close to stop watching.
+func WatchSettings(p SettingsProvider, interval time.Duration, drivers ...*Driver) (*SettingsWatcher, error) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	sw := &SettingsWatcher{
+		p:       p,
+		drivers: drivers,
+		timeout: interval,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	if err := sw.refresh(ctx); err != nil {
+		cancel()
+		return nil, err
+	}
+	var changed <-chan struct{}
+	if n, ok := p.(SettingsNotifier); ok {
+		changed = n.Changed()
+	}
+	go sw.run(ctx, changed, interval)
+	return sw, nil
+}
+
+func (sw *SettingsWatcher) run(ctx context.Context, changed <-chan struct{}, interval time.Duration) {
+	defer close(sw.done)
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+		case _, ok := <-changed:
+			if !ok {
+				changed = nil
+				continue
+			}
+		case <-ctx.Done():
+			return
+		}
+		if err := sw.refresh(ctx); err != nil && ctx.Err() == nil {
+			handleError(err)
+		}
+	}
+}
+
+// refresh reads the settings and applies them if they have changed.
+func (sw *SettingsWatcher) refresh(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, sw.timeout)
+	defer cancel()
+	s, err := sw.p.Settings(ctx)
+	if err != nil {
+		return &Error{Kind: ErrConfig, Err: err}
+	}
+	if sw.last != nil && reflect.DeepEqual(*sw.last, s) {
+		return nil
+	}
+	// Check every setting before changing any driver.
+	if err := (&Driver{}).applySettings(s); err != nil {
+		return err
+	}
+	for _, d := range sw.drivers {
+		d.applySettings(s)
+	}
+	sw.last = &s
+	return nil
+}
+
+func (d *Driver) applySettings(s Settings) error {
+	if err := d.SetSampling(s.Sampling); err != nil {
+		return err
+	}
+	if err := d.SetColumnCapture(s.ColumnCapture); err != nil {
+		return err
+	}
+	d.SetTimeouts(s.Timeouts)
+	d.SetRedactArgs(s.RedactArgs)
+	return nil
+}
+
+// Close stops watching. The settings in effect are kept.
+func (sw *SettingsWatcher) Close() {
+	sw.once.Do(sw.cancel)
+	<-sw.done
+}
@@ -0,0 +1,364 @@
+package dbtimer
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Shadow configures a second database that read queries are mirrored to, so
+// that its latency can be compared with the primary's before a migration or a
+// new index is relied on. Mirroring is asynchronous: the application never
+// waits for the shadow.
+type Shadow struct {
+	// DriverName and DSN identify the shadow database, as they would be passed
+	// to sql.Open.
+	DriverName string
+	DSN        string
+
+	// CountRows also compares the number of rows returned by the primary and
+	// the shadow. The primary's rows are counted as the application reads
+	// them, so the comparison is reported when the application closes them.
+	CountRows bool
+
+	// CompareResults compares the results of the primary and the shadow as
+	// well as their row counts, by hashing their rows, for migrating between
+	// databases or validating a new kind of replica. Values are normalized
+	// before they are hashed, so that a number reads the same whether the
+	// database returns it as an integer, a float or text, and times are
+	// compared in UTC. Rows are combined without regard to order, since
+	// databases may return the rows of a query without an ORDER BY in any
+	// order. Like CountRows, it relies on the application reading all of
+	// the primary's rows, and it only compares queries that return a single
+	// result set.
+	CompareResults bool
+
+	// Workers is the number of queries run on the shadow at once. The default
+	// is 1.
+	Workers int
+
+	// QueueSize is the number of mirrored queries that can wait for a worker.
+	// When the queue is full, queries are not mirrored and ErrDropped is
+	// reported to the error handler. The default is 100.
+	QueueSize int
+
+	// Timeout limits how long a query may run on the shadow. Zero means no
+	// limit.
+	Timeout time.Duration
+
+	// Compare is called with the result of each mirrored query.
+	Compare func(ShadowResult)
+}
+
+// ShadowResult compares one read query on the primary and the shadow. The row
+// counts are -1 unless Shadow.CountRows or Shadow.CompareResults is set, and
+// the hashes of the rows are 0 unless Shadow.CompareResults is set. Query and
+// Args are scrubbed in compliance mode, and Args is nil if the driver
+// redacts arguments, as in the driver's events.
+type ShadowResult struct {
+	Query       string
+	Args        []driver.Value
+	Primary     time.Duration
+	Shadow      time.Duration
+	PrimaryRows int
+	ShadowRows  int
+	PrimaryErr  error
+	ShadowErr   error
+	PrimaryHash uint64
+	ShadowHash  uint64
+}
+
+// Diverged reports whether the primary and the shadow disagree: one failed
+// and the other didn't, or they returned different numbers of rows or rows
+// that hash differently.
+func (sr ShadowResult) Diverged() bool {
+	return (sr.PrimaryErr == nil) != (sr.ShadowErr == nil) ||
+		sr.PrimaryRows != sr.ShadowRows ||
+		sr.PrimaryHash != sr.ShadowHash
+}
+
+// SetShadow starts mirroring the read queries made through d to the database
+// described by s, replacing any shadow that was already set. Passing nil stops
+// mirroring.
+func (d *Driver) SetShadow(s *Shadow) error {
+	var sh *shadow
+	if s != nil {
+		if s.Compare == nil {
+			return &Error{Kind: ErrConfig, Err: errors.New("shadow has no Compare function")}
+		}
+		db, err := sql.Open(s.DriverName, s.DSN)
+		if err != nil {
+			return err
+		}
+		sh = newShadow(*s, db)
+	}
+	old, _ := d.shadow.Swap(shadowHolder{sh}).(shadowHolder)
+	if old.sh != nil {
+		old.sh.stop()
+	}
+	return nil
+}
+
+type shadowHolder struct {
+	sh *shadow
+}
+
+func (d *Driver) getShadow() *shadow {
+	h, _ := d.shadow.Load().(shadowHolder)
+	return h.sh
+}
+
+type shadow struct {
+	cfg  Shadow
+	db   *sql.DB
+	jobs chan *shadowJob
+	quit chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newShadow(cfg Shadow, db *sql.DB) *shadow {
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 100
+	}
+	sh := &shadow{
+		cfg:  cfg,
+		db:   db,
+		jobs: make(chan *shadowJob, cfg.QueueSize),
+		quit: make(chan struct{}),
+	}
+	sh.wg.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go sh.work()
+	}
+	return sh
+}
+
+func (sh *shadow) stop() {
+	close(sh.quit)
+	sh.wg.Wait()
+	sh.db.Close()
+}
+
+func (sh *shadow) work() {
+	defer sh.wg.Done()
+	for {
+		select {
+		case j := <-sh.jobs:
+			sh.run(j)
+		case <-sh.quit:
+			return
+		}
+	}
+}
+
+func (sh *shadow) run(j *shadowJob) {
+	ctx := context.Background()
+	if sh.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sh.cfg.Timeout)
+		defer cancel()
+	}
+	args := make([]interface{}, len(j.args))
+	for i, v := range j.args {
+		args[i] = v
+	}
+	start := time.Now()
+	rows, err := sh.db.QueryContext(ctx, j.query, args...)
+	elapsed := time.Since(start)
+	count := -1
+	var sum uint64
+	if err == nil {
+		if sh.cfg.CountRows || sh.cfg.CompareResults {
+			count, sum, err = readShadowRows(rows, sh.cfg.CompareResults)
+		}
+		rows.Close()
+	}
+	j.finish(func(res *ShadowResult) {
+		res.Shadow = elapsed
+		res.ShadowRows = count
+		res.ShadowErr = err
+		res.ShadowHash = sum
+	})
+}
+
+// readShadowRows counts the rows of the shadow's result, and sums their
+// hashes if hash is set.
+func readShadowRows(rows *sql.Rows, hash bool) (int, uint64, error) {
+	var vals []interface{}
+	var ptrs []interface{}
+	if hash {
+		cols, err := rows.Columns()
+		if err != nil {
+			return 0, 0, err
+		}
+		vals = make([]interface{}, len(cols))
+		ptrs = make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+	}
+	count := 0
+	var sum uint64
+	for rows.Next() {
+		count++
+		if hash {
+			if err := rows.Scan(ptrs...); err != nil {
+				return count, sum, err
+			}
+			sum += rowHash(vals)
+		}
+	}
+	return count, sum, rows.Err()
+}
+
+// shadowJob collects both sides of a comparison and reports it once both
+// the shadow query and, when rows are counted, the primary's rows are done.
+type shadowJob struct {
+	query     string
+	args      []driver.Value
+	mu        sync.Mutex
+	remaining int
+	res       ShadowResult
+	compare   func(ShadowResult)
+}
+
+func (j *shadowJob) finish(f func(*ShadowResult)) {
+	j.mu.Lock()
+	f(&j.res)
+	j.remaining--
+	done := j.remaining == 0
+	j.mu.Unlock()
+	if done {
+		j.compare(j.res)
+	}
+}
+
+// mirror queues a read query that took elapsed on the primary to be run on
+// the shadow. The result leaves out args if redact is set, as the driver's
+// events do. It returns the rows the application should read.
+func (sh *shadow) mirror(query string, args []driver.Value, redact bool, elapsed time.Duration, err error, rows driver.Rows) driver.Rows {
+	if !isRead(query) {
+		return rows
+	}
+	resQuery, resArgs := scrub("shadow.Query", query, args)
+	if redact {
+		resArgs = nil
+	}
+	j := &shadowJob{
+		query:     query,
+		args:      args,
+		remaining: 1,
+		res: ShadowResult{
+			Query:       resQuery,
+			Args:        resArgs,
+			Primary:     elapsed,
+			PrimaryRows: -1,
+			PrimaryErr:  err,
+		},
+		compare: sh.cfg.Compare,
+	}
+	counting := (sh.cfg.CountRows || sh.cfg.CompareResults) && err == nil
+	if counting {
+		j.remaining++
+	}
+	select {
+	case sh.jobs <- j:
+	default:
+		handleError(&Error{Kind: ErrDropped, Err: errors.New("shadow queue is full")})
+		return rows
+	}
+	if counting {
+		return keepRowsInterfaces(&countingRows{Rows: rows, hash: sh.cfg.CompareResults, done: func(n int, sum uint64) {
+			j.finish(func(res *ShadowResult) {
+				res.PrimaryRows = n
+				res.PrimaryHash = sum
+			})
+		}}, rows)
+	}
+	return rows
+}
+
+func isRead(query string) bool {
+	fp := Fingerprint(query)
+	return strings.HasPrefix(fp, "select ") || strings.HasPrefix(fp, "with ")
+}
+
+// countingRows counts the rows the application reads, and sums their hashes
+// if hash is set, and reports them when the rows are closed.
+type countingRows struct {
+	driver.Rows
+	n    int
+	hash bool
+	sum  uint64
+	once sync.Once
+	done func(int, uint64)
+}
+
+func (cr *countingRows) Next(dest []driver.Value) error {
+	err := cr.Rows.Next(dest)
+	if err == nil {
+		cr.n++
+		if cr.hash {
+			vals := make([]interface{}, len(dest))
+			for i, v := range dest {
+				vals[i] = v
+			}
+			cr.sum += rowHash(vals)
+		}
+	}
+	return err
+}
+
+func (cr *countingRows) Close() error {
+	err := cr.Rows.Close()
+	cr.once.Do(func() {
+		cr.done(cr.n, cr.sum)
+	})
+	return err
+}
+
+// rowHash returns the FNV-1a hash of a row's values, normalized so that the
+// same row from two databases hashes alike.
+func rowHash(vals []interface{}) uint64 {
+	h := fnv.New64a()
+	for _, v := range vals {
+		h.Write([]byte(normalizeValue(v)))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// normalizeValue renders v as text: numbers in their shortest form, whether
+// they were integers, floats or text, times in UTC, and NULL apart from any
+// string.
+func normalizeValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return "\x00NULL"
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+	if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return s
+}
@@ -0,0 +1,141 @@
+package dbtimer
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ShardStats is the aggregate of every statement run on one shard.
+type ShardStats struct {
+	Shard     string
+	Count     int64
+	Errors    int64
+	Total     time.Duration
+	Latency   Histogram
+	P99       time.Duration
+	ErrorRate float64
+
+	// SlowOutlier and ErrorOutlier are set if the shard's p99 or error rate
+	// is more than the report's Factor times the median across shards.
+	SlowOutlier  bool
+	ErrorOutlier bool
+}
+
+// ShardReport compares the shards of a sharded deployment.
+type ShardReport struct {
+	Label           string
+	Factor          float64
+	MedianP99       time.Duration
+	MedianErrorRate float64
+
+	// Shards holds the outliers first, then the rest, slowest p99 first.
+	Shards []ShardStats
+}
+
+// CompareShards aggregates the stats by the value of the label tag, which
+// names the shard each event ran on, and flags the shards whose p99 latency
+// or error rate is more than factor times the median across shards. A factor
+// of 0 means 2. label must be one of the Stats' Labels, or CompareShards
+// returns an ErrConfig error.
+func (s *Stats) CompareShards(label string, factor float64) (*ShardReport, error) {
+	found := false
+	for _, l := range s.Labels {
+		found = found || l == label
+	}
+	if !found {
+		return nil, &Error{Kind: ErrConfig, Err: fmt.Errorf("stats aren't aggregated by %q; add it to Labels", label)}
+	}
+	if factor <= 0 {
+		factor = 2
+	}
+	byShard := map[string]*ShardStats{}
+	for _, qs := range s.Report() {
+		shard := qs.Labels[label]
+		ss := byShard[shard]
+		if ss == nil {
+			ss = &ShardStats{Shard: shard, Latency: NewHistogram(qs.Latency.Bounds)}
+			byShard[shard] = ss
+		}
+		ss.Count += qs.Count
+		ss.Errors += qs.Errors
+		ss.Total += qs.Total
+		for i, c := range qs.Latency.Counts {
+			ss.Latency.Counts[i] += c
+		}
+	}
+	r := &ShardReport{Label: label, Factor: factor}
+	p99s := make([]time.Duration, 0, len(byShard))
+	rates := make([]float64, 0, len(byShard))
+	for _, ss := range byShard {
+		ss.P99 = ss.Latency.Quantile(0.99)
+		ss.ErrorRate = float64(ss.Errors) / float64(ss.Count)
+		p99s = append(p99s, ss.P99)
+		rates = append(rates, ss.ErrorRate)
+		r.Shards = append(r.Shards, *ss)
+	}
+	if len(r.Shards) == 0 {
+		return r, nil
+	}
+	sort.Slice(p99s, func(i, j int) bool { return p99s[i] < p99s[j] })
+	sort.Float64s(rates)
+	r.MedianP99 = p99s[len(p99s)/2]
+	r.MedianErrorRate = rates[len(rates)/2]
+	for i := range r.Shards {
+		ss := &r.Shards[i]
+		ss.SlowOutlier = float64(ss.P99) > factor*float64(r.MedianP99)
+		ss.ErrorOutlier = ss.ErrorRate > factor*r.MedianErrorRate && ss.Errors > 0
+	}
+	sort.Slice(r.Shards, func(i, j int) bool {
+		a, b := r.Shards[i], r.Shards[j]
+		if oa, ob := a.SlowOutlier || a.ErrorOutlier, b.SlowOutlier || b.ErrorOutlier; oa != ob {
+			return oa
+		}
+		if a.P99 != b.P99 {
+			return a.P99 > b.P99
+		}
+		return a.Shard < b.Shard
+	})
+	return r, nil
+}
+
+// WriteTo writes the report as a table, with one row per shard. Outliers are
+// marked in the last column.
+func (r *ShardReport) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	tw := tabwriter.NewWriter(cw, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tcount\tp99\terrors\terror rate\toutlier\n", r.Label)
+	for _, ss := range r.Shards {
+		var why []string
+		if ss.SlowOutlier {
+			why = append(why, "p99")
+		}
+		if ss.ErrorOutlier {
+			why = append(why, "errors")
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%d\t%.2f%%\t%s\n", ss.Shard, ss.Count, ss.P99, ss.Errors, ss.ErrorRate*100, strings.Join(why, ","))
+	}
+	fmt.Fprintf(tw, "median\t\t%v\t\t%.2f%%\t\n", r.MedianP99, r.MedianErrorRate*100)
+	err := tw.Flush()
+	return cw.n, err
+}
+
+func (r *ShardReport) String() string {
+	var sb strings.Builder
+	r.WriteTo(&sb)
+	return sb.String()
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,106 @@
+package dbtimer
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// Flusher is implemented by TimerLoggers that buffer events or aggregate them
+// into snapshots. Flush writes out what is buffered, and finishes the current
+// snapshot, without stopping the logger.
+//
+// A TimerLogger that holds resources, such as a connection or a goroutine,
+// implements io.Closer as well. Close flushes the logger and stops it.
+type Flusher interface {
+	Flush() error
+}
+
+// registered holds the drivers made by RegisterTimer, so that Shutdown can
+// reach their loggers.
+var registered struct {
+	mu      sync.Mutex
+	drivers []*Driver
+}
+
+// Shutdown flushes and closes every logger the timer sends events to: the one
+// set with SetTimerLogger, the ones given to RegisterTimer with
+// WithTimerLogger, the ones registered by name in Loggers, and the loggers
+// inside them that were combined with
+// MultiLogger or wrapped by an AsyncLogger. Loggers that implement io.Closer
+// are closed, and loggers that only implement Flusher are flushed, so that
+// async buffers are drained, aggregation snapshots such as an HDRLog's last
+// interval are written and exporters send what they have. Call it before a
+// short-lived process, such as a batch job or a serverless function, exits.
+//
+// Shutdown returns when every logger is done or when ctx is done, whichever is
+// first; in the latter case it returns ctx.Err() and the loggers carry on in
+// the background. Otherwise every failure is reported to the error handler as
+// ErrSink, and the first one is returned. Loggers are closed, so events logged
+// after Shutdown are dropped. A logger reached in more than one of these ways
+// is shut down once.
+func Shutdown(ctx context.Context) error {
+	loggers := []TimerLogger{GetTimerLogger()}
+	registered.mu.Lock()
+	for _, d := range registered.drivers {
+		loggers = append(loggers, d.logger)
+	}
+	registered.mu.Unlock()
+	loggers = append(loggers, Loggers().all()...)
+	done := make(chan error, 1)
+	go func() {
+		s := shutdown{seen: map[TimerLogger]bool{}}
+		for _, tl := range loggers {
+			s.logger(tl)
+		}
+		done <- s.err
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type shutdown struct {
+	seen map[TimerLogger]bool
+	err  error
+}
+
+// logger shuts down tl, then the loggers it passes events to, so that events
+// drained from a buffer reach loggers that are still open.
+func (s *shutdown) logger(tl TimerLogger) {
+	if tl == nil {
+		return
+	}
+	if reflect.TypeOf(tl).Comparable() {
+		if s.seen[tl] {
+			return
+		}
+		s.seen[tl] = true
+	}
+	var err error
+	switch l := tl.(type) {
+	case multiLogger:
+		for _, child := range l {
+			s.logger(child)
+		}
+		return
+	case io.Closer:
+		err = l.Close()
+	case Flusher:
+		err = l.Flush()
+	}
+	if err != nil {
+		err = &Error{Kind: ErrSink, Err: err}
+		handleError(err)
+		if s.err == nil {
+			s.err = err
+		}
+	}
+	if al, ok := tl.(*AsyncLogger); ok {
+		s.logger(al.tl)
+	}
+}
@@ -0,0 +1,304 @@
+package dbtimer
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// SLO is a service level objective for database statements, such as 99% of
+// reads under 50ms over 30 days. Set a Stats' SLOs to track them: a
+// statement is good if it succeeds within Threshold, and the error budget is
+// the share of statements that may be bad, 1 - Objective.
+//
+// Burn rate is how fast the budget is being spent: a rate of 1 spends it
+// exactly over Window, and a rate of 14.4 spends 2% of a 30 day budget in an
+// hour. OnBurn is called when the rate over one of the BurnAlerts' windows
+// reaches its Rate, and again only once it has dropped below. An alert needs
+// at least 10 statements in its window, so that one slow statement on an
+// idle database doesn't fire it.
+type SLO struct {
+	// Name identifies the SLO in reports and metrics.
+	Name string
+
+	// Match selects the statements the SLO covers. If it is nil, it covers
+	// every statement. ReadStatement and WriteStatement cover reads and
+	// writes.
+	Match func(TimerInfo) bool
+
+	// Threshold is the latency a good statement is within. If it is zero,
+	// only failed statements are bad.
+	Threshold time.Duration
+
+	// Objective is the fraction of statements that should be good, between
+	// 0 and 1, such as 0.99.
+	Objective float64
+
+	// Window is the period compliance is measured over. The default is 30
+	// days.
+	Window time.Duration
+
+	// BurnAlerts are the burn rates that call OnBurn. The default is a rate
+	// of 14.4 over an hour and 6 over six hours.
+	BurnAlerts []BurnAlert
+
+	// OnBurn, if set, is called when a burn rate alert fires.
+	OnBurn func(BurnRateAlert)
+
+	// Owner is the team the SLO's alerts go to. It is usually paired with
+	// a Match of OwnedBy.
+	Owner string
+}
+
+// BurnAlert fires when the burn rate of an SLO's error budget over Window
+// reaches Rate.
+type BurnAlert struct {
+	Window time.Duration
+	Rate   float64
+}
+
+// BurnRateAlert is a BurnAlert that fired.
+type BurnRateAlert struct {
+	SLO    string
+	Owner  string
+	Alert  BurnAlert
+	Rate   float64
+	Status SLOStatus
+}
+
+// SLOStatus is the compliance of an SLO over its window. Budget is the
+// fraction of the error budget that remains, which is negative once it is
+// overspent. BurnRates are the burn rates over the windows of the
+// BurnAlerts, in their order.
+type SLOStatus struct {
+	Name       string
+	Objective  float64
+	Window     time.Duration
+	Good       int64
+	Total      int64
+	Compliance float64
+	Budget     float64
+	BurnRates  []BurnRate
+}
+
+// BurnRate is the burn rate of an SLO's error budget over Window, in which
+// Total statements ran.
+type BurnRate struct {
+	Window time.Duration
+	Rate   float64
+	Total  int64
+}
+
+// ReadStatement reports whether ti runs a read: a SELECT or a WITH query.
+func ReadStatement(ti TimerInfo) bool {
+	return isRead(ti.Query)
+}
+
+// WriteStatement reports whether ti runs a statement that isn't a read.
+func WriteStatement(ti TimerInfo) bool {
+	return !isRead(ti.Query)
+}
+
+// sloBuckets is how many buckets an SLO's window is divided into.
+const sloBuckets = 8640
+
+// sloMinAlertStatements is the number of statements a burn alert's window
+// needs for it to fire.
+const sloMinAlertStatements = 10
+
+// sloCheckEvery is how often, in the time of events, burn rates are checked.
+const sloCheckEvery = 10 * time.Second
+
+type sloState struct {
+	cfg       SLO
+	width     time.Duration
+	buckets   []sloBucket
+	firing    []bool
+	nextCheck time.Time
+}
+
+type sloBucket struct {
+	epoch int64
+	good  int64
+	total int64
+}
+
+func newSLOState(cfg SLO) (*sloState, error) {
+	if cfg.Objective <= 0 || cfg.Objective >= 1 {
+		return nil, fmt.Errorf("SLO %q has objective %v, which is not between 0 and 1", cfg.Name, cfg.Objective)
+	}
+	if cfg.Window <= 0 {
+		cfg.Window = 30 * 24 * time.Hour
+	}
+	if len(cfg.BurnAlerts) == 0 {
+		cfg.BurnAlerts = []BurnAlert{{time.Hour, 14.4}, {6 * time.Hour, 6}}
+	}
+	for _, a := range cfg.BurnAlerts {
+		if a.Window <= 0 || a.Window > cfg.Window || a.Rate <= 0 {
+			return nil, fmt.Errorf("SLO %q has a burn alert of %v over %v, which needs a positive rate and a window within the SLO's", cfg.Name, a.Rate, a.Window)
+		}
+	}
+	width := cfg.Window / sloBuckets
+	if width < time.Second {
+		width = time.Second
+	}
+	n := int((cfg.Window + width - 1) / width)
+	return &sloState{
+		cfg:     cfg,
+		width:   width,
+		buckets: make([]sloBucket, n),
+		firing:  make([]bool, len(cfg.BurnAlerts)),
+	}, nil
+}
+
+// burnCall is an alert that fired and the OnBurn to call with it.
+type burnCall struct {
+	onBurn func(BurnRateAlert)
+	alert  BurnRateAlert
+}
+
+// observe adds ti to the SLO, and returns the alerts that fire. Events of a
+// driver's warm-up are left out.
+func (ss *sloState) observe(ti TimerInfo) []burnCall {
+	if ti.Warmup || ss.cfg.Match != nil && !ss.cfg.Match(ti) {
+		return nil
+	}
+	epoch := ti.End.UnixNano() / int64(ss.width)
+	b := &ss.buckets[int(epoch%int64(len(ss.buckets)))]
+	if b.epoch > epoch {
+		return nil
+	}
+	if b.epoch != epoch {
+		*b = sloBucket{epoch: epoch}
+	}
+	b.total++
+	if ti.Err == nil && (ss.cfg.Threshold == 0 || ti.Elapsed() <= ss.cfg.Threshold) {
+		b.good++
+	}
+	if ti.End.Before(ss.nextCheck) {
+		return nil
+	}
+	ss.nextCheck = ti.End.Add(sloCheckEvery)
+	st := ss.status(ti.End)
+	var fired []burnCall
+	for i, a := range ss.cfg.BurnAlerts {
+		rate := st.BurnRates[i].Rate
+		switch {
+		case st.BurnRates[i].Total < sloMinAlertStatements:
+		case rate >= a.Rate && !ss.firing[i]:
+			ss.firing[i] = true
+			if ss.cfg.OnBurn != nil {
+				fired = append(fired, burnCall{ss.cfg.OnBurn, BurnRateAlert{SLO: ss.cfg.Name, Owner: ss.cfg.Owner, Alert: a, Rate: rate, Status: st}})
+			}
+		case rate < a.Rate:
+			ss.firing[i] = false
+		}
+	}
+	return fired
+}
+
+// sum returns the good and total statements in the window before now.
+func (ss *sloState) sum(now time.Time, window time.Duration) (int64, int64) {
+	last := now.UnixNano() / int64(ss.width)
+	first := last - int64((window+ss.width-1)/ss.width) + 1
+	var good, total int64
+	for _, b := range ss.buckets {
+		if b.epoch >= first && b.epoch <= last {
+			good += b.good
+			total += b.total
+		}
+	}
+	return good, total
+}
+
+func (ss *sloState) status(now time.Time) SLOStatus {
+	st := SLOStatus{Name: ss.cfg.Name, Objective: ss.cfg.Objective, Window: ss.cfg.Window, Compliance: 1, Budget: 1}
+	st.Good, st.Total = ss.sum(now, ss.cfg.Window)
+	allowed := 1 - ss.cfg.Objective
+	if st.Total > 0 {
+		st.Compliance = float64(st.Good) / float64(st.Total)
+		st.Budget = 1 - (1-st.Compliance)/allowed
+	}
+	st.BurnRates = make([]BurnRate, len(ss.cfg.BurnAlerts))
+	for i, a := range ss.cfg.BurnAlerts {
+		st.BurnRates[i].Window = a.Window
+		good, total := ss.sum(now, a.Window)
+		st.BurnRates[i].Total = total
+		if total > 0 {
+			st.BurnRates[i].Rate = float64(total-good) / float64(total) / allowed
+		}
+	}
+	return st
+}
+
+// observeSLOs adds ti to the Stats' SLOs, setting them up on the first
+// event, and returns the alerts that fire. SLOs that aren't valid are
+// reported to the error handler as ErrConfig errors and skipped. s.mu is
+// held.
+func (s *Stats) observeSLOs(ti TimerInfo) []burnCall {
+	if s.slos == nil && len(s.SLOs) > 0 {
+		s.slos = make([]*sloState, 0, len(s.SLOs))
+		for _, cfg := range s.SLOs {
+			ss, err := newSLOState(cfg)
+			if err != nil {
+				handleError(&Error{Kind: ErrConfig, Err: err})
+				continue
+			}
+			s.slos = append(s.slos, ss)
+		}
+	}
+	var fired []burnCall
+	for _, ss := range s.slos {
+		fired = append(fired, ss.observe(ti)...)
+	}
+	return fired
+}
+
+// SLOStatus returns the compliance of each of the Stats' SLOs over its
+// window before now, in the order of SLOs.
+func (s *Stats) SLOStatus(now time.Time) []SLOStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]SLOStatus, 0, len(s.slos))
+	for _, ss := range s.slos {
+		out = append(out, ss.status(now))
+	}
+	return out
+}
+
+// fireBurnAlerts calls the OnBurn of each alert that fired.
+func fireBurnAlerts(fired []burnCall) {
+	for _, bc := range fired {
+		bc.onBurn(bc.alert)
+	}
+}
+
+// writeSLOPrometheus writes the compliance of the Stats' SLOs over their
+// windows before now.
+func (s *Stats) writeSLOPrometheus(w io.Writer, now time.Time) {
+	status := s.SLOStatus(now)
+	if len(status) == 0 {
+		return
+	}
+	for _, m := range []struct {
+		name, help string
+		value      func(SLOStatus) float64
+	}{
+		{"dbtimer_slo_compliance", "Fraction of statements within the SLO over its window.", func(st SLOStatus) float64 { return st.Compliance }},
+		{"dbtimer_slo_objective", "Fraction of statements the SLO requires to be good.", func(st SLOStatus) float64 { return st.Objective }},
+		{"dbtimer_slo_error_budget_remaining", "Fraction of the SLO's error budget that remains.", func(st SLOStatus) float64 { return st.Budget }},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", m.name)
+		for _, st := range status {
+			fmt.Fprintf(w, "%s{slo=\"%s\"} %s\n", m.name, promLabel(st.Name), promFloat(m.value(st)))
+		}
+	}
+	fmt.Fprintln(w, "# HELP dbtimer_slo_burn_rate Rate the SLO's error budget is spent at over a window; 1 spends it over the SLO's window.")
+	fmt.Fprintln(w, "# TYPE dbtimer_slo_burn_rate gauge")
+	for _, st := range status {
+		for _, br := range st.BurnRates {
+			fmt.Fprintf(w, "dbtimer_slo_burn_rate{slo=\"%s\",window=\"%s\"} %s\n", promLabel(st.Name), br.Window, promFloat(br.Rate))
+		}
+	}
+}
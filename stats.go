@@ -0,0 +1,320 @@
+package dbtimer
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats is a TimerLogger that aggregates the statements that run by
+// fingerprint: how often each ran, how long it took in total and at most, and
+// a histogram of its latency. Calls of stored procedures are aggregated by
+// procedure name instead, so that each procedure has one entry however its
+// calls are written. Install it alongside any other logger with MultiLogger.
+type Stats struct {
+	// Buckets are the upper bounds of the latency histograms. If it is empty,
+	// DefaultBuckets is used. Pick bounds that bracket your workload's
+	// latencies; LinearBuckets and ExponentialBuckets build common shapes.
+	// Changing Buckets after the first event has no effect until Reset.
+	Buckets []time.Duration
+
+	// Interval, if set, also keeps a histogram of every statement's latency
+	// for each interval of this length, for plotting latency over time. The
+	// most recent 1000 intervals are kept.
+	Interval time.Duration
+
+	// Labels are tag keys, such as those of labels set with WithLabels, to
+	// aggregate by as well as the fingerprint, so that the stats of each
+	// database can be told apart. Events without one of the tags have it as
+	// "".
+	Labels []string
+
+	// Windows are the lengths of rolling windows, such as a minute, five
+	// minutes and an hour, to keep the stats of each fingerprint over as
+	// well as over its lifetime; see WindowReport. Changing Windows after
+	// the first event has no effect until Reset.
+	Windows []time.Duration
+
+	// SLOs are the service level objectives to track. Changing SLOs after
+	// the first event has no effect. Reset doesn't forget their compliance,
+	// which is measured over their own windows.
+	SLOs []SLO
+
+	// Cost, if set, is the cost model that WritePrometheus prices each
+	// fingerprint's time under. See CostReport.
+	Cost *CostModel
+
+	mu        sync.Mutex
+	queries   map[string]*QueryStats
+	intervals []IntervalStats
+	slos      []*sloState
+}
+
+// IntervalStats is the latency of every statement that started in one
+// interval.
+type IntervalStats struct {
+	Start   time.Time
+	Latency Histogram
+}
+
+const maxIntervals = 1000
+
+// QueryStats is the aggregate of every execution of one fingerprint, or of
+// every call of one stored procedure. For a procedure, Procedure is its name
+// and Fingerprint that of the first call seen.
+type QueryStats struct {
+	Fingerprint string
+	Procedure   string
+	Labels      map[string]string
+	Count       int64
+	Errors      int64
+	Total       time.Duration
+	Max         time.Duration
+	Latency     Histogram
+
+	// Rows is the number of rows inserted by statements with a BatchSize,
+	// and RowLatency the histogram of their latency divided by their
+	// BatchSize, so that bulk loads can be judged per row.
+	Rows       int64
+	RowLatency Histogram
+	rowSum     time.Duration
+
+	// ResponseBytes is the estimated size of the rows read from the
+	// statement's results, if the driver estimates response sizes. See
+	// SetResponseSize.
+	ResponseBytes int64
+
+	// Baseline is the total of the round trips to the server measured on
+	// the connections the statement ran on, if the driver has a
+	// RoundTripBaseline. See Excess.
+	Baseline time.Duration
+
+	// Deadlines is the number of statements run with a context deadline,
+	// DeadlineMisses the number of those that didn't finish within it, and
+	// DeadlineBudget the total of the time they had left when they started.
+	// Many misses with a small mean budget point to timeouts that are too
+	// tight; many with a budget well above Mean point to a slow database.
+	Deadlines      int64
+	DeadlineMisses int64
+	DeadlineBudget time.Duration
+
+	// Cancels is the number of statements whose context was canceled while
+	// the driver ran them, and CancelLatency the histogram of how long the
+	// driver took to return after that.
+	Cancels       int64
+	CancelLatency Histogram
+	cancelSum     time.Duration
+
+	windows []*windowRing
+}
+
+// Excess returns the total time spent running the statement beyond the round
+// trips to the server: Total less Baseline, or zero if that is negative.
+func (qs QueryStats) Excess() time.Duration {
+	if d := qs.Total - qs.Baseline; d > 0 {
+		return d
+	}
+	return 0
+}
+
+// Quantile estimates the q-quantile of the latency from the Latency
+// histogram, no greater than Max.
+func (qs QueryStats) Quantile(q float64) time.Duration {
+	if d := qs.Latency.Quantile(q); d < qs.Max {
+		return d
+	}
+	return qs.Max
+}
+
+// MeanDeadlineBudget returns the average time statements with a deadline
+// had left when they started.
+func (qs QueryStats) MeanDeadlineBudget() time.Duration {
+	if qs.Deadlines == 0 {
+		return 0
+	}
+	return qs.DeadlineBudget / time.Duration(qs.Deadlines)
+}
+
+// Mean returns the average latency.
+func (qs QueryStats) Mean() time.Duration {
+	if qs.Count == 0 {
+		return 0
+	}
+	return qs.Total / time.Duration(qs.Count)
+}
+
+// Log adds ti to the stats for its fingerprint, or its procedure. Events that
+// don't run a statement, such as reads served from a ResultCache, are
+// ignored, except that the ResponseBytes of a
+// "rows.Close" event are added to its statement's.
+func (s *Stats) Log(ti TimerInfo) {
+	if ti.Method == "rows.Close" && ti.Query != "" {
+		k := s.key(ti)
+		s.mu.Lock()
+		s.entry(k, ti).ResponseBytes += ti.ResponseBytes
+		s.mu.Unlock()
+		return
+	}
+	if !runsStatement(ti.Method) || ti.Query == "" || ti.CacheHit {
+		return
+	}
+	k := s.key(ti)
+	d := ti.Elapsed()
+	s.mu.Lock()
+	fired := s.observeSLOs(ti)
+	defer fireBurnAlerts(fired)
+	defer s.mu.Unlock()
+	qs := s.entry(k, ti)
+	qs.Count++
+	if ti.Err != nil {
+		qs.Errors++
+	}
+	qs.Total += d
+	qs.Baseline += ti.Baseline
+	if d > qs.Max {
+		qs.Max = d
+	}
+	qs.Latency.Observe(d)
+	if ti.DeadlineSource != "" {
+		qs.Deadlines++
+		qs.DeadlineBudget += ti.Deadline
+		if ti.MissedDeadline() {
+			qs.DeadlineMisses++
+		}
+	}
+	if ti.Canceled {
+		qs.Cancels++
+		qs.CancelLatency.Observe(ti.CancelLatency)
+		qs.cancelSum += ti.CancelLatency
+	}
+	s.observeWindows(qs, ti.End, d, ti.Err)
+	if ti.BatchSize > 0 {
+		qs.Rows += int64(ti.BatchSize)
+		perRow := d / time.Duration(ti.BatchSize)
+		qs.RowLatency.Observe(perRow)
+		qs.rowSum += perRow
+	}
+	if s.Interval > 0 {
+		s.observeInterval(ti.Start.Truncate(s.Interval), d)
+	}
+}
+
+// statsKey identifies the stats an event is added to.
+type statsKey struct {
+	key         string
+	fingerprint string
+	procedure   string
+}
+
+// key returns the key of ti's fingerprint, or its procedure, and label
+// values.
+func (s *Stats) key(ti TimerInfo) statsKey {
+	k := statsKey{fingerprint: Fingerprint(ti.Query), procedure: Procedure(ti.Query)}
+	k.key = k.fingerprint
+	if k.procedure != "" {
+		k.key = "\x01" + k.procedure
+	}
+	for _, l := range s.Labels {
+		k.key += "\x00" + ti.Tags[l]
+	}
+	return k
+}
+
+// entry returns the stats for k, creating them if they are new. s.mu must be
+// held.
+func (s *Stats) entry(k statsKey, ti TimerInfo) *QueryStats {
+	if s.queries == nil {
+		s.queries = map[string]*QueryStats{}
+	}
+	qs := s.queries[k.key]
+	if qs == nil {
+		qs = &QueryStats{Fingerprint: k.fingerprint, Procedure: k.procedure, Latency: NewHistogram(s.Buckets), RowLatency: NewHistogram(s.Buckets), CancelLatency: NewHistogram(s.Buckets)}
+		if len(s.Labels) > 0 {
+			qs.Labels = make(map[string]string, len(s.Labels))
+			for _, l := range s.Labels {
+				qs.Labels[l] = ti.Tags[l]
+			}
+		}
+		s.queries[k.key] = qs
+	}
+	return qs
+}
+
+func (s *Stats) observeInterval(start time.Time, d time.Duration) {
+	n := len(s.intervals)
+	i := sort.Search(n, func(i int) bool { return !s.intervals[i].Start.Before(start) })
+	if i == n || !s.intervals[i].Start.Equal(start) {
+		if i == 0 && n == maxIntervals {
+			return
+		}
+		s.intervals = append(s.intervals, IntervalStats{})
+		copy(s.intervals[i+1:], s.intervals[i:])
+		s.intervals[i] = IntervalStats{Start: start, Latency: NewHistogram(s.Buckets)}
+		if len(s.intervals) > maxIntervals {
+			s.intervals = s.intervals[1:]
+			i--
+		}
+	}
+	s.intervals[i].Latency.Observe(d)
+}
+
+// Intervals returns the histogram of each interval that had a statement, in
+// order. It is empty unless Interval is set.
+func (s *Stats) Intervals() []IntervalStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]IntervalStats, len(s.intervals))
+	for i, is := range s.intervals {
+		out[i] = IntervalStats{Start: is.Start, Latency: is.Latency.clone()}
+	}
+	return out
+}
+
+// Report returns the stats of every fingerprint, or fingerprint and label
+// values, seen since the stats were created or last reset, the most total
+// time first.
+func (s *Stats) Report() []QueryStats {
+	s.mu.Lock()
+	out := make([]QueryStats, 0, len(s.queries))
+	for _, qs := range s.queries {
+		c := *qs
+		c.Latency = qs.Latency.clone()
+		c.RowLatency = qs.RowLatency.clone()
+		c.CancelLatency = qs.CancelLatency.clone()
+		c.windows = nil
+		out = append(out, c)
+	}
+	s.mu.Unlock()
+	s.sortReport(out)
+	return out
+}
+
+// sortReport sorts stats the most total time first, then by procedure,
+// fingerprint and label values.
+func (s *Stats) sortReport(out []QueryStats) {
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Total != out[j].Total {
+			return out[i].Total > out[j].Total
+		}
+		if out[i].Procedure != out[j].Procedure {
+			return out[i].Procedure < out[j].Procedure
+		}
+		if out[i].Fingerprint != out[j].Fingerprint {
+			return out[i].Fingerprint < out[j].Fingerprint
+		}
+		for _, l := range s.Labels {
+			if out[i].Labels[l] != out[j].Labels[l] {
+				return out[i].Labels[l] < out[j].Labels[l]
+			}
+		}
+		return false
+	})
+}
+
+// Reset forgets all stats.
+func (s *Stats) Reset() {
+	s.mu.Lock()
+	s.queries = nil
+	s.intervals = nil
+	s.mu.Unlock()
+}
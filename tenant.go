@@ -0,0 +1,122 @@
+package dbtimer
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// TenantTracker is a TimerLogger that attributes database time and query
+// counts to the tenant named by a tag on each event, for capacity attribution
+// in multi-tenant services. Tag calls with WithTag(ctx, "tenant", id) and
+// install the tracker alongside any other logger with MultiLogger.
+//
+// If Quota and Interval are set, OnQuotaExceeded is called the first time in
+// each interval that a tenant's database time goes over Quota.
+type TenantTracker struct {
+	// Key is the tag that holds the tenant ID. The default is "tenant".
+	Key string
+
+	Interval        time.Duration
+	Quota           time.Duration
+	OnQuotaExceeded func(TenantUsage)
+
+	mu      sync.Mutex
+	totals  map[string]*TenantUsage
+	windows map[string]*tenantWindow
+}
+
+// TenantUsage is the database use of one tenant. Queries counts the calls
+// that ran a statement; DBTime includes every call, such as prepares and
+// commits.
+type TenantUsage struct {
+	Tenant  string
+	Queries int64
+	Errors  int64
+	DBTime  time.Duration
+}
+
+type tenantWindow struct {
+	start    time.Time
+	usage    TenantUsage
+	exceeded bool
+}
+
+// Log attributes ti to its tenant. Events without the tenant tag are ignored.
+func (tt *TenantTracker) Log(ti TimerInfo) {
+	key := tt.Key
+	if key == "" {
+		key = "tenant"
+	}
+	tenant, ok := ti.Tags[key]
+	if !ok {
+		return
+	}
+	d := ti.Elapsed()
+	var exceeded *TenantUsage
+	tt.mu.Lock()
+	if tt.totals == nil {
+		tt.totals = map[string]*TenantUsage{}
+		tt.windows = map[string]*tenantWindow{}
+	}
+	total := tt.totals[tenant]
+	if total == nil {
+		total = &TenantUsage{Tenant: tenant}
+		tt.totals[tenant] = total
+	}
+	total.add(ti, d)
+	if tt.Interval > 0 && tt.Quota > 0 {
+		start := ti.Start.Truncate(tt.Interval)
+		w := tt.windows[tenant]
+		if w == nil || !w.start.Equal(start) {
+			w = &tenantWindow{start: start, usage: TenantUsage{Tenant: tenant}}
+			tt.windows[tenant] = w
+		}
+		w.usage.add(ti, d)
+		if !w.exceeded && w.usage.DBTime > tt.Quota {
+			w.exceeded = true
+			u := w.usage
+			exceeded = &u
+		}
+	}
+	tt.mu.Unlock()
+	if exceeded != nil && tt.OnQuotaExceeded != nil {
+		tt.OnQuotaExceeded(*exceeded)
+	}
+}
+
+func (tu *TenantUsage) add(ti TimerInfo, d time.Duration) {
+	if runsStatement(ti.Method) {
+		tu.Queries++
+	}
+	if ti.Err != nil {
+		tu.Errors++
+	}
+	tu.DBTime += d
+}
+
+// Report returns the usage of every tenant seen since the tracker was created
+// or last reset, busiest first.
+func (tt *TenantTracker) Report() []TenantUsage {
+	tt.mu.Lock()
+	out := make([]TenantUsage, 0, len(tt.totals))
+	for _, u := range tt.totals {
+		out = append(out, *u)
+	}
+	tt.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].DBTime != out[j].DBTime {
+			return out[i].DBTime > out[j].DBTime
+		}
+		return out[i].Tenant < out[j].Tenant
+	})
+	return out
+}
+
+// Reset forgets all usage.
+func (tt *TenantTracker) Reset() {
+	tt.mu.Lock()
+	tt.totals = nil
+	tt.windows = nil
+	tt.mu.Unlock()
+}
@@ -0,0 +1,253 @@
+package dbtimer
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var lastTxID uint64
+
+// newTx wraps a transaction begun on the connection and gives it an ID.
+func (cs *connState) newTx(tx driver.Tx) *Tx {
+	atomic.StoreUint64(&cs.txID, atomic.AddUint64(&lastTxID, 1))
+	if on, _ := cs.d.misuse.Load().(bool); on {
+		cs.txSite.Store(callSite())
+	}
+	return &Tx{tx, cs, cs.newGuard("tx")}
+}
+
+// endTx clears the ID of the connection's transaction once it has been
+// committed or rolled back.
+func (cs *connState) endTx() {
+	atomic.StoreUint64(&cs.txID, 0)
+	cs.txWrites = nil
+	if site, _ := cs.txSite.Load().(string); site != "" {
+		cs.txSite.Store("")
+	}
+}
+
+// TxTimelines is a TimerLogger that keeps the statements of recent
+// transactions, by TxID, so that the timeline of one can be examined: what
+// ran, for how long, and how long the application took between statements
+// while the transaction held its locks.
+type TxTimelines struct {
+	// MaxTransactions is how many of the most recently begun transactions
+	// are kept. The default is 1000.
+	MaxTransactions int
+
+	// OnLockError, if set, is called when a statement in a transaction fails
+	// with a deadlock or a lock timeout, as IsLockError reports, with the
+	// failing event and the timeline of the transaction up to and including
+	// it. The failing statement alone rarely explains a deadlock; the
+	// statements before it show which locks the transaction held.
+	OnLockError func(ti TimerInfo, tl *TxTimeline)
+
+	mu    sync.Mutex
+	txs   map[uint64]*TxTimeline
+	order []uint64
+}
+
+// TxTimeline is the statements of one transaction, in the order they started.
+type TxTimeline struct {
+	TxID       uint64        `json:"tx_id"`
+	ConnID     uint64        `json:"conn_id,omitempty"`
+	Statements []TxStatement `json:"statements"`
+}
+
+// TxStatement is one call in a transaction's timeline. Gap is the time from
+// the end of the previous call to the start of this one, spent in the
+// application.
+type TxStatement struct {
+	Method   string        `json:"method"`
+	Query    string        `json:"query,omitempty"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration_nanos"`
+	Gap      time.Duration `json:"gap_nanos"`
+	Err      string        `json:"error,omitempty"`
+}
+
+// Log adds ti to the timeline of its transaction. Events outside a
+// transaction are ignored.
+func (tt *TxTimelines) Log(ti TimerInfo) {
+	if ti.TxID == 0 {
+		return
+	}
+	st := TxStatement{Method: ti.Method, Query: ti.Query, Start: ti.Start, Duration: ti.Elapsed()}
+	if ti.Err != nil {
+		st.Err = ti.Err.Error()
+	}
+	max := tt.MaxTransactions
+	if max <= 0 {
+		max = 1000
+	}
+	tt.mu.Lock()
+	if tt.txs == nil {
+		tt.txs = map[uint64]*TxTimeline{}
+	}
+	tl := tt.txs[ti.TxID]
+	if tl == nil {
+		tl = &TxTimeline{TxID: ti.TxID, ConnID: ti.ConnID}
+		tt.txs[ti.TxID] = tl
+		tt.order = append(tt.order, ti.TxID)
+		for len(tt.order) > max {
+			delete(tt.txs, tt.order[0])
+			tt.order = tt.order[1:]
+		}
+	}
+	tl.Statements = append(tl.Statements, st)
+	tt.mu.Unlock()
+	if tt.OnLockError != nil && IsLockError(ti.Err) {
+		if tl, ok := tt.Timeline(ti.TxID); ok {
+			tt.OnLockError(ti, tl)
+		}
+	}
+}
+
+// Timeline returns the timeline of the transaction with the ID txID, and
+// whether it was found.
+func (tt *TxTimelines) Timeline(txID uint64) (*TxTimeline, bool) {
+	tt.mu.Lock()
+	tl, ok := tt.txs[txID]
+	var out TxTimeline
+	if ok {
+		out = TxTimeline{TxID: tl.TxID, ConnID: tl.ConnID, Statements: append([]TxStatement(nil), tl.Statements...)}
+	}
+	tt.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	sort.SliceStable(out.Statements, func(i, j int) bool {
+		return out.Statements[i].Start.Before(out.Statements[j].Start)
+	})
+	for i := range out.Statements {
+		out.Statements[i].Gap = 0
+		if i > 0 {
+			prev := out.Statements[i-1]
+			if gap := out.Statements[i].Start.Sub(prev.Start.Add(prev.Duration)); gap > 0 {
+				out.Statements[i].Gap = gap
+			}
+		}
+	}
+	return &out, true
+}
+
+// Duration returns the time from the start of the transaction's first call to
+// the end of its last.
+func (tl *TxTimeline) Duration() time.Duration {
+	if len(tl.Statements) == 0 {
+		return 0
+	}
+	first, last := tl.Statements[0], tl.Statements[len(tl.Statements)-1]
+	return last.Start.Add(last.Duration).Sub(first.Start)
+}
+
+// AppTime returns the total of the gaps between calls: the time the
+// transaction was open while the application, not the database, was working.
+func (tl *TxTimeline) AppTime() time.Duration {
+	var total time.Duration
+	for _, st := range tl.Statements {
+		total += st.Gap
+	}
+	return total
+}
+
+// WriteJSON writes the timeline as a JSON object.
+func (tl *TxTimeline) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(tl)
+}
+
+const (
+	timelineRowHeight = 18
+	timelineLeft      = 260
+	timelineWidth     = 800
+)
+
+type timelineBar struct {
+	Y, LabelY  int
+	X, W       int
+	Fill       string
+	Title      string
+	Label      string
+	GapX, GapW int
+	GapTitle   string
+}
+
+// WriteHTML writes the timeline as a Gantt-style chart in an HTML fragment,
+// with no external resources, for embedding in a page or an incident review.
+// Each call is a bar, red if it failed, and the gaps before calls are shaded
+// so that long pauses in the application stand out.
+func (tl *TxTimeline) WriteHTML(w io.Writer) error {
+	data := struct {
+		TxID          uint64
+		Summary       string
+		Width, Height int
+		LabelX        int
+		Bars          []timelineBar
+	}{TxID: tl.TxID, LabelX: timelineLeft - 6}
+	total := tl.Duration()
+	data.Summary = fmt.Sprintf("%d calls over %v, %v of it between calls.", len(tl.Statements), total, tl.AppTime())
+	if len(tl.Statements) == 0 || total <= 0 {
+		total = 1
+	}
+	scale := func(d time.Duration) int {
+		return int(float64(d) / float64(total) * timelineWidth)
+	}
+	for i, st := range tl.Statements {
+		offset := st.Start.Sub(tl.Statements[0].Start)
+		bar := timelineBar{
+			Y:      i * timelineRowHeight,
+			LabelY: i*timelineRowHeight + 13,
+			X:      timelineLeft + scale(offset),
+			W:      scale(st.Duration),
+			Fill:   "#4a7ab5",
+			Title:  fmt.Sprintf("%s %v", st.Method, st.Duration),
+			Label:  timelineLabel(st),
+		}
+		if bar.W < 1 {
+			bar.W = 1
+		}
+		if st.Err != "" {
+			bar.Fill = "#c0392b"
+			bar.Title += ": " + st.Err
+		}
+		if st.Gap > 0 {
+			bar.GapW = scale(st.Gap)
+			bar.GapX = bar.X - bar.GapW
+			bar.GapTitle = fmt.Sprintf("%v in the application", st.Gap)
+		}
+		data.Bars = append(data.Bars, bar)
+	}
+	data.Width = timelineLeft + timelineWidth + 10
+	data.Height = len(tl.Statements)*timelineRowHeight + 4
+	return timelineTemplate.Execute(w, data)
+}
+
+// timelineLabel returns the text shown beside a call's bar: its query, or its
+// method if it has none, shortened to fit.
+func timelineLabel(st TxStatement) string {
+	label := st.Query
+	if label == "" {
+		label = st.Method
+	}
+	if r := []rune(label); len(r) > 40 {
+		label = string(r[:39]) + "…"
+	}
+	return label
+}
+
+var timelineTemplate = template.Must(template.New("timeline").Parse(`<div class="dbtimer-timeline">
+<p>Transaction {{.TxID}}: {{.Summary}}</p>
+<svg width="{{.Width}}" height="{{.Height}}" xmlns="http://www.w3.org/2000/svg" style="font-family: sans-serif; font-size: 11px">
+{{range .Bars}}<text x="{{$.LabelX}}" y="{{.LabelY}}" text-anchor="end" fill="#333">{{.Label}}</text>
+{{if .GapW}}<rect x="{{.GapX}}" y="{{.Y}}" width="{{.GapW}}" height="16" fill="#f3d9a4"><title>{{.GapTitle}}</title></rect>
+{{end}}<rect x="{{.X}}" y="{{.Y}}" width="{{.W}}" height="16" fill="{{.Fill}}"><title>{{.Title}}</title></rect>
+{{end}}</svg>
+</div>
+`))
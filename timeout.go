@@ -0,0 +1,204 @@
+package dbtimer
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Timeouts is a safety net against runaway statements. When a call that runs
+// or prepares a statement is made with a context that has no deadline, the
+// timer gives it one: the timeout for its fingerprint if there is one, or
+// else for its method, or else Default. A zero timeout means none.
+//
+// Transactions are left alone, since the context passed to BeginTx bounds the
+// whole transaction in many drivers.
+type Timeouts struct {
+	Default time.Duration
+
+	// Methods are timeouts by event method, such as "conn.Query" or
+	// "stmt.Exec".
+	Methods map[string]time.Duration
+
+	// Fingerprints are timeouts by statement. The keys can be any query
+	// with the same fingerprint.
+	Fingerprints map[string]time.Duration
+}
+
+// TimeoutError is the error of a call that ran out of the time the timer
+// gave it under Timeouts, as opposed to a deadline set by the caller. It
+// is what the call returns and what its event records, and it unwraps to the
+// driver's error, which is usually context.DeadlineExceeded.
+type TimeoutError struct {
+	Timeout time.Duration
+	Err     error
+}
+
+func (te *TimeoutError) Error() string {
+	return fmt.Sprintf("dbtimer: statement timeout of %v enforced: %v", te.Timeout, te.Err)
+}
+
+func (te *TimeoutError) Unwrap() error {
+	return te.Err
+}
+
+// SetTimeouts sets the timeouts enforced on calls made through d. Passing nil
+// turns enforcement off. It is safe to call while d is in use.
+func (d *Driver) SetTimeouts(t *Timeouts) {
+	var ts *Timeouts
+	if t != nil {
+		ts = &Timeouts{Default: t.Default, Methods: map[string]time.Duration{}, Fingerprints: map[string]time.Duration{}}
+		for m, v := range t.Methods {
+			ts.Methods[m] = v
+		}
+		for q, v := range t.Fingerprints {
+			ts.Fingerprints[Fingerprint(q)] = v
+		}
+	}
+	d.timeouts.Store(timeoutsHolder{ts})
+}
+
+// WithTimeouts sets the timeouts enforced by the driver, as SetTimeouts does.
+func WithTimeouts(t *Timeouts) Option {
+	return func(d *Driver) error {
+		d.SetTimeouts(t)
+		return nil
+	}
+}
+
+type timeoutsHolder struct {
+	t *Timeouts
+}
+
+type enforcedKey struct{}
+
+// enforceTimeout returns ctx with the timeout for the call if Timeouts apply
+// to it, and the function that releases the timeout's resources.
+func (cs *connState) enforceTimeout(ctx context.Context, method, query string) (context.Context, context.CancelFunc) {
+	h, _ := cs.d.timeouts.Load().(timeoutsHolder)
+	if h.t == nil {
+		return ctx, func() {}
+	}
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	timeout, ok := h.t.Fingerprints[Fingerprint(query)]
+	if !ok {
+		timeout, ok = h.t.Methods[method]
+	}
+	if !ok {
+		timeout = h.t.Default
+	}
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	ctx, cancel := context.WithTimeout(context.WithValue(ctx, enforcedKey{}, timeout), timeout)
+	return ctx, cancel
+}
+
+// The sources of a call's deadline.
+const (
+	DeadlineCaller   = "caller"
+	DeadlineTimeouts = "timeouts"
+)
+
+// deadlineOf returns how long ctx has left before its deadline, and where the
+// deadline came from, or "" if it has none.
+func deadlineOf(ctx context.Context) (time.Duration, string) {
+	dl, ok := ctx.Deadline()
+	if !ok {
+		return 0, ""
+	}
+	source := DeadlineCaller
+	if _, ok := ctx.Value(enforcedKey{}).(time.Duration); ok {
+		source = DeadlineTimeouts
+	}
+	return time.Until(dl), source
+}
+
+// MissedDeadline reports whether the call had a deadline and didn't finish
+// within it. A call that misses a deadline it had plenty of time for points
+// to a slow database; one that misses a deadline it started with little of
+// points to timeouts that are too tight.
+func (ti TimerInfo) MissedDeadline() bool {
+	if ti.DeadlineSource == "" {
+		return false
+	}
+	return errors.Is(ti.Err, context.DeadlineExceeded) || ti.Elapsed() >= ti.Deadline
+}
+
+// cancelWatch notes when a call's context is done while the driver runs it.
+type cancelWatch struct {
+	stop func() bool
+	mu   sync.Mutex
+	at   time.Time
+}
+
+// watchCancel starts watching ctx, or returns nil if it can't be done.
+func watchCancel(ctx context.Context, now func() time.Time) *cancelWatch {
+	if ctx.Done() == nil {
+		return nil
+	}
+	w := &cancelWatch{}
+	w.stop = context.AfterFunc(ctx, func() {
+		t := now()
+		w.mu.Lock()
+		w.at = t
+		w.mu.Unlock()
+	})
+	return w
+}
+
+// latency stops watching, and reports whether the context was done before
+// end, when the call returned, and how long before.
+func (w *cancelWatch) latency(end time.Time) (bool, time.Duration) {
+	if w == nil || w.stop() {
+		return false, 0
+	}
+	w.mu.Lock()
+	at := w.at
+	w.mu.Unlock()
+	// The context was done just as the call returned, before the watch
+	// could note the time.
+	if at.IsZero() || at.After(end) {
+		return true, 0
+	}
+	return true, end.Sub(at)
+}
+
+// enforced replaces err with a TimeoutError if the call failed because a
+// timeout from enforceTimeout ran out.
+func enforced(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	timeout, ok := ctx.Value(enforcedKey{}).(time.Duration)
+	if !ok {
+		return err
+	}
+	return &TimeoutError{Timeout: timeout, Err: err}
+}
+
+// cancelOnClose keeps a query's timeout running until its rows are closed.
+func cancelOnClose(rows driver.Rows, err error, cancel context.CancelFunc) (driver.Rows, error) {
+	if err != nil || rows == nil {
+		cancel()
+		return rows, err
+	}
+	return keepRowsInterfaces(&cancelRows{Rows: rows, cancel: cancel}, rows), nil
+}
+
+type cancelRows struct {
+	driver.Rows
+	once   sync.Once
+	cancel context.CancelFunc
+}
+
+func (cr *cancelRows) Close() error {
+	err := cr.Rows.Close()
+	cr.once.Do(cr.cancel)
+	return err
+}
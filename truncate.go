@@ -0,0 +1,128 @@
+package dbtimer
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Truncation limits the length of the query text in events from a Driver,
+// so that a bulk INSERT with megabytes of VALUES doesn't have to be held and
+// written by every sink. A query longer than MaxLength keeps its head and its
+// tail, with a comment saying how much was cut out in between. Cuts are made
+// after a comma where one is near, so that the fingerprint of a truncated
+// multi-row INSERT is usually the same as that of the full statement.
+type Truncation struct {
+	// MaxLength is the most bytes of query text kept in an event, not
+	// counting the comment. It must be at least 64.
+	MaxLength int
+
+	// Tail is how many of the bytes kept come from the end of the query. The
+	// default is a quarter of MaxLength.
+	Tail int
+
+	// Compress keeps the full text of truncated queries in the event's
+	// FullQuery, compressed, for sinks that need it. FullQuery is only held in
+	// memory; the wire formats and file loggers don't write it.
+	Compress bool
+}
+
+// CompressedQuery is the full text of a truncated query, compressed with
+// DEFLATE. String decompresses it.
+type CompressedQuery []byte
+
+func (cq CompressedQuery) String() string {
+	if len(cq) == 0 {
+		return ""
+	}
+	b, err := io.ReadAll(flate.NewReader(bytes.NewReader(cq)))
+	if err != nil {
+		handleError(&Error{Kind: ErrSerialization, Err: err})
+	}
+	return string(b)
+}
+
+// SetTruncation sets the truncation of query text in the events from d.
+// Passing nil keeps queries whole. It is an ErrConfig error if MaxLength is
+// less than 64 or Tail isn't less than MaxLength.
+func (d *Driver) SetTruncation(t *Truncation) error {
+	var tr *Truncation
+	if t != nil {
+		if t.MaxLength < 64 {
+			return &Error{Kind: ErrConfig, Err: fmt.Errorf("truncation MaxLength %d is less than 64", t.MaxLength)}
+		}
+		cfg := *t
+		if cfg.Tail <= 0 {
+			cfg.Tail = cfg.MaxLength / 4
+		}
+		if cfg.Tail >= cfg.MaxLength {
+			return &Error{Kind: ErrConfig, Err: fmt.Errorf("truncation Tail %d isn't less than MaxLength %d", cfg.Tail, cfg.MaxLength)}
+		}
+		tr = &cfg
+	}
+	d.truncation.Store(truncationHolder{tr})
+	return nil
+}
+
+// WithTruncation sets the driver's truncation of query text, as SetTruncation
+// does.
+func WithTruncation(t *Truncation) Option {
+	return func(d *Driver) error {
+		return d.SetTruncation(t)
+	}
+}
+
+type truncationHolder struct {
+	t *Truncation
+}
+
+// truncate applies d's Truncation to query. If the query was truncated and
+// Compress is set, it also returns the full text compressed.
+func (d *Driver) truncate(query string) (string, CompressedQuery) {
+	h, _ := d.truncation.Load().(truncationHolder)
+	if h.t == nil || len(query) <= h.t.MaxLength {
+		return query, nil
+	}
+	head := h.t.MaxLength - h.t.Tail
+	tail := len(query) - h.t.Tail
+	head = cutAfterComma(query, head-32, head)
+	tail = cutAfterComma(query, tail, tail+32)
+	var sb strings.Builder
+	sb.WriteString(query[:head])
+	fmt.Fprintf(&sb, " /* %d bytes truncated */ ", tail-head)
+	sb.WriteString(query[tail:])
+	var full CompressedQuery
+	if h.t.Compress {
+		var buf bytes.Buffer
+		fw, _ := flate.NewWriter(&buf, flate.BestSpeed)
+		fw.Write([]byte(query))
+		fw.Close()
+		full = buf.Bytes()
+	}
+	return sb.String(), full
+}
+
+var truncatedRE = regexp.MustCompile(`/\* \d+ bytes truncated \*/`)
+
+// truncated reports whether query was cut short by a Truncation.
+func truncated(query string) bool {
+	return strings.Contains(query, " bytes truncated */") && truncatedRE.MatchString(query)
+}
+
+// cutAfterComma returns the index just past the last comma in q[from:to], or
+// to if there isn't one.
+func cutAfterComma(q string, from, to int) int {
+	if from < 0 {
+		from = 0
+	}
+	if to > len(q) {
+		to = len(q)
+	}
+	if i := strings.LastIndexByte(q[from:to], ','); i != -1 {
+		return from + i + 1
+	}
+	return to
+}
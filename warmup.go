@@ -0,0 +1,68 @@
+package dbtimer
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// processStart is when the package was initialized, which stands in for when
+// the process started.
+var processStart = time.Now()
+
+// Warmup marks the calls a driver makes while the process warms up, when
+// connections are being established and caches are cold, so that they don't
+// skew what is judged against a steady state. Their events are logged as
+// usual, with Warmup set, but SLOs, RegressionDetector and the latency
+// shifts of SetFingerprintWatch leave them out.
+//
+// A call is part of the warm-up if it is made within Duration of the process
+// starting, or is one of the driver's first Statements statements.
+type Warmup struct {
+	Duration   time.Duration
+	Statements int64
+}
+
+type warmupHolder struct {
+	cfg Warmup
+	// statements counts the driver's statements since the Warmup was set.
+	statements *int64
+}
+
+// SetWarmup sets the warm-up of d's calls. The count of statements starts
+// again from zero. It is an ErrConfig error if Duration or Statements is
+// negative; the zero Warmup turns it off.
+func (d *Driver) SetWarmup(w Warmup) error {
+	if w.Duration < 0 || w.Statements < 0 {
+		return &Error{Kind: ErrConfig, Err: errors.New("warm-up duration and statements can't be negative")}
+	}
+	var h warmupHolder
+	if w != (Warmup{}) {
+		h = warmupHolder{cfg: w, statements: new(int64)}
+	}
+	d.warmup.Store(h)
+	return nil
+}
+
+// WithWarmup sets the warm-up of the driver's calls, as SetWarmup does.
+func WithWarmup(w Warmup) Option {
+	return func(d *Driver) error {
+		return d.SetWarmup(w)
+	}
+}
+
+// warmingUp reports whether a call of method made now is part of d's
+// warm-up, counting it if it runs a statement.
+func (d *Driver) warmingUp(method string) bool {
+	h, _ := d.warmup.Load().(warmupHolder)
+	if h.statements == nil {
+		return false
+	}
+	warm := h.cfg.Duration > 0 && time.Since(processStart) < h.cfg.Duration
+	if runsStatement(method) && h.cfg.Statements > 0 {
+		if atomic.AddInt64(h.statements, 1) <= h.cfg.Statements {
+			warm = true
+		}
+	}
+	return warm
+}
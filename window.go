@@ -0,0 +1,146 @@
+package dbtimer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"time"
+)
+
+// windowSlots is the number of slots a rolling window is divided into. A
+// window's stats cover the statements that ended in its last windowSlots
+// slots, so they move in steps of a tenth of the window.
+const windowSlots = 10
+
+// windowRing keeps the stats of one fingerprint over one rolling window, in
+// a ring of slots each a tenth of the window long.
+type windowRing struct {
+	width time.Duration
+	slots [windowSlots]windowSlot
+}
+
+type windowSlot struct {
+	epoch   int64
+	count   int64
+	errors  int64
+	total   time.Duration
+	max     time.Duration
+	latency Histogram
+}
+
+// observeWindows adds a statement that ended at end and took d to qs's
+// rolling windows, creating them on its first statement. s.mu is held.
+func (s *Stats) observeWindows(qs *QueryStats, end time.Time, d time.Duration, err error) {
+	if len(s.Windows) == 0 {
+		return
+	}
+	if qs.windows == nil {
+		qs.windows = make([]*windowRing, len(s.Windows))
+		for i, w := range s.Windows {
+			width := w / windowSlots
+			if width <= 0 {
+				width = 1
+			}
+			qs.windows[i] = &windowRing{width: width}
+		}
+	}
+	for _, wr := range qs.windows {
+		epoch := end.UnixNano() / int64(wr.width)
+		slot := &wr.slots[int(epoch%windowSlots)]
+		if slot.epoch > epoch {
+			continue
+		}
+		if slot.epoch != epoch || slot.latency.Counts == nil {
+			h := slot.latency
+			if h.Counts == nil {
+				h = NewHistogram(s.Buckets)
+			} else {
+				for i := range h.Counts {
+					h.Counts[i] = 0
+				}
+			}
+			*slot = windowSlot{epoch: epoch, latency: h}
+		}
+		slot.count++
+		if err != nil {
+			slot.errors++
+		}
+		slot.total += d
+		if d > slot.max {
+			slot.max = d
+		}
+		slot.latency.Observe(d)
+	}
+}
+
+// WindowReport returns the stats of every fingerprint, or fingerprint and
+// label values, over the rolling window, one of the Stats' Windows, that
+// ends at now, the most total time first. Only Count, Errors, Total, Max and
+// Latency are filled in. It is nil if window isn't one of Windows.
+func (s *Stats) WindowReport(window time.Duration, now time.Time) []QueryStats {
+	idx := -1
+	for i, w := range s.Windows {
+		if w == window {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return nil
+	}
+	s.mu.Lock()
+	var out []QueryStats
+	for _, qs := range s.queries {
+		if idx >= len(qs.windows) {
+			continue
+		}
+		wr := qs.windows[idx]
+		last := now.UnixNano() / int64(wr.width)
+		ws := QueryStats{Fingerprint: qs.Fingerprint, Procedure: qs.Procedure, Labels: qs.Labels, Latency: NewHistogram(s.Buckets)}
+		for _, slot := range wr.slots {
+			if slot.epoch <= last-windowSlots || slot.epoch > last || slot.count == 0 {
+				continue
+			}
+			ws.Count += slot.count
+			ws.Errors += slot.errors
+			ws.Total += slot.total
+			if slot.max > ws.Max {
+				ws.Max = slot.max
+			}
+			for i, c := range slot.latency.Counts {
+				ws.Latency.Counts[i] += c
+			}
+		}
+		if ws.Count > 0 {
+			out = append(out, ws)
+		}
+	}
+	s.mu.Unlock()
+	s.sortReport(out)
+	return out
+}
+
+// writeWindowPrometheus writes the latency of each fingerprint over each of
+// the Stats' Windows, ending at now, as a summary.
+func (s *Stats) writeWindowPrometheus(w *bufio.Writer, now time.Time) {
+	if len(s.Windows) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "# HELP dbtimer_query_recent_duration_seconds Latency of database statements by fingerprint over rolling windows.")
+	fmt.Fprintln(w, "# TYPE dbtimer_query_recent_duration_seconds summary")
+	for _, window := range s.Windows {
+		for _, qs := range s.WindowReport(window, now) {
+			writePromWindow(w, "dbtimer_query_recent_duration_seconds", s.promLabels(qs)+fmt.Sprintf(",window=\"%s\"", window), qs)
+		}
+	}
+}
+
+// writePromWindow writes the quantiles, sum and count of one series of a
+// summary.
+func writePromWindow(w io.Writer, name, labels string, qs QueryStats) {
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		fmt.Fprintf(w, "%s{%s,quantile=\"%s\"} %s\n", name, labels, promFloat(q), promFloat(qs.Quantile(q).Seconds()))
+	}
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, promFloat(qs.Total.Seconds()))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, qs.Count)
+}
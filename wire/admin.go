@@ -0,0 +1,231 @@
+package wire
+
+import (
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// MarshalStatsReport encodes stats as a StatsReport message.
+func MarshalStatsReport(stats []dbtimer.QueryStats) []byte {
+	var b protoBuf
+	for _, qs := range stats {
+		b = b.bytes(1, appendQueryStats(nil, qs))
+	}
+	return b
+}
+
+func appendQueryStats(b protoBuf, qs dbtimer.QueryStats) protoBuf {
+	b = b.string(1, qs.Fingerprint)
+	b = b.string(2, qs.Procedure)
+	b = b.tags(3, qs.Labels)
+	b = b.uint(4, uint64(qs.Count))
+	b = b.uint(5, uint64(qs.Errors))
+	b = b.uint(6, uint64(qs.Total))
+	b = b.uint(7, uint64(qs.Max))
+	if len(qs.Latency.Counts) > 0 {
+		b = b.bytes(8, appendHistogram(nil, qs.Latency))
+	}
+	b = b.uint(9, uint64(qs.Rows))
+	if len(qs.RowLatency.Counts) > 0 {
+		b = b.bytes(10, appendHistogram(nil, qs.RowLatency))
+	}
+	b = b.uint(11, uint64(qs.ResponseBytes))
+	b = b.uint(12, uint64(qs.Baseline))
+	return b
+}
+
+// appendHistogram writes a Histogram message, with its repeated fields
+// packed.
+func appendHistogram(b protoBuf, h dbtimer.Histogram) protoBuf {
+	var bounds, counts protoBuf
+	for _, d := range h.Bounds {
+		bounds = bounds.varint(uint64(d))
+	}
+	for _, c := range h.Counts {
+		counts = counts.varint(uint64(c))
+	}
+	return b.bytes(1, bounds).bytes(2, counts)
+}
+
+// UnmarshalStatsReport decodes a StatsReport message.
+func UnmarshalStatsReport(b []byte) ([]dbtimer.QueryStats, error) {
+	var out []dbtimer.QueryStats
+	err := readRepeated(b, func(msg []byte) error {
+		qs, err := readQueryStats(msg)
+		out = append(out, qs)
+		return err
+	})
+	if err != nil {
+		return nil, serializationError(err)
+	}
+	return out, nil
+}
+
+func readQueryStats(b []byte) (dbtimer.QueryStats, error) {
+	var qs dbtimer.QueryStats
+	r := &protoReader{b: b}
+	for {
+		field, wt, ok := r.next()
+		if !ok {
+			break
+		}
+		var err error
+		switch {
+		case field == 1 && wt == wireBytes:
+			qs.Fingerprint = string(r.bytes())
+		case field == 2 && wt == wireBytes:
+			qs.Procedure = string(r.bytes())
+		case field == 3 && wt == wireBytes:
+			var k, v string
+			k, v, err = readTag(r.bytes())
+			if qs.Labels == nil {
+				qs.Labels = map[string]string{}
+			}
+			qs.Labels[k] = v
+		case field == 4 && wt == wireVarint:
+			qs.Count = int64(r.varint())
+		case field == 5 && wt == wireVarint:
+			qs.Errors = int64(r.varint())
+		case field == 6 && wt == wireVarint:
+			qs.Total = time.Duration(r.varint())
+		case field == 7 && wt == wireVarint:
+			qs.Max = time.Duration(r.varint())
+		case field == 8 && wt == wireBytes:
+			qs.Latency, err = readHistogram(r.bytes())
+		case field == 9 && wt == wireVarint:
+			qs.Rows = int64(r.varint())
+		case field == 10 && wt == wireBytes:
+			qs.RowLatency, err = readHistogram(r.bytes())
+		case field == 11 && wt == wireVarint:
+			qs.ResponseBytes = int64(r.varint())
+		case field == 12 && wt == wireVarint:
+			qs.Baseline = time.Duration(r.varint())
+		default:
+			r.skip(wt)
+		}
+		if err != nil {
+			return qs, err
+		}
+	}
+	return qs, r.err
+}
+
+// readHistogram reads a Histogram message, whose repeated fields may be
+// packed or not.
+func readHistogram(b []byte) (dbtimer.Histogram, error) {
+	var h dbtimer.Histogram
+	r := &protoReader{b: b}
+	for {
+		field, wt, ok := r.next()
+		if !ok {
+			break
+		}
+		var vs []uint64
+		switch wt {
+		case wireVarint:
+			vs = []uint64{r.varint()}
+		case wireBytes:
+			p := &protoReader{b: r.bytes()}
+			for len(p.b) > 0 && p.err == nil {
+				vs = append(vs, p.varint())
+			}
+			if p.err != nil {
+				return h, p.err
+			}
+		default:
+			r.skip(wt)
+			continue
+		}
+		for _, v := range vs {
+			switch field {
+			case 1:
+				h.Bounds = append(h.Bounds, time.Duration(v))
+			case 2:
+				h.Counts = append(h.Counts, int64(v))
+			}
+		}
+	}
+	return h, r.err
+}
+
+// MarshalActiveQueries encodes calls as an ActiveQueries message.
+func MarshalActiveQueries(calls []dbtimer.InFlightQuery) []byte {
+	var b protoBuf
+	for _, q := range calls {
+		var m protoBuf
+		m = m.uint(1, q.ConnID)
+		m = m.string(2, q.Method)
+		m = m.string(3, q.Query)
+		m = m.uint(4, uint64(unixNano(q.Start)))
+		m = m.tags(5, q.Tags)
+		b = b.bytes(1, m)
+	}
+	return b
+}
+
+// UnmarshalActiveQueries decodes an ActiveQueries message.
+func UnmarshalActiveQueries(b []byte) ([]dbtimer.InFlightQuery, error) {
+	var out []dbtimer.InFlightQuery
+	err := readRepeated(b, func(msg []byte) error {
+		q, err := readActiveQuery(msg)
+		out = append(out, q)
+		return err
+	})
+	if err != nil {
+		return nil, serializationError(err)
+	}
+	return out, nil
+}
+
+func readActiveQuery(b []byte) (dbtimer.InFlightQuery, error) {
+	var q dbtimer.InFlightQuery
+	r := &protoReader{b: b}
+	for {
+		field, wt, ok := r.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && wt == wireVarint:
+			q.ConnID = r.varint()
+		case field == 2 && wt == wireBytes:
+			q.Method = string(r.bytes())
+		case field == 3 && wt == wireBytes:
+			q.Query = string(r.bytes())
+		case field == 4 && wt == wireVarint:
+			q.Start = fromUnixNano(int64(r.varint()))
+		case field == 5 && wt == wireBytes:
+			k, v, err := readTag(r.bytes())
+			if err != nil {
+				return q, err
+			}
+			if q.Tags == nil {
+				q.Tags = map[string]string{}
+			}
+			q.Tags[k] = v
+		default:
+			r.skip(wt)
+		}
+	}
+	return q, r.err
+}
+
+// readRepeated calls read with each message in field 1 of b.
+func readRepeated(b []byte, read func([]byte) error) error {
+	r := &protoReader{b: b}
+	for {
+		field, wt, ok := r.next()
+		if !ok {
+			break
+		}
+		if field != 1 || wt != wireBytes {
+			r.skip(wt)
+			continue
+		}
+		if err := read(r.bytes()); err != nil {
+			return err
+		}
+	}
+	return r.err
+}
@@ -0,0 +1,498 @@
+package wire
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// MarshalMsgpack encodes ti as a MessagePack map with the same field names as
+// the protobuf Event: method, query, start, duration_nanos, args, error,
+// conn_id, tags, wait_nanos, batch_size, result_set, row_count, columns, each
+// a map of name and database_type, response_bytes, baseline_nanos and tx_id.
+// Empty fields are left out.
+// Times are MessagePack timestamps.
+func MarshalMsgpack(ti dbtimer.TimerInfo) []byte {
+	var e msgpackEncoder
+	n := 0
+	fields := []bool{
+		ti.Method != "", ti.Query != "", !ti.Start.IsZero(), !ti.Start.IsZero(),
+		len(ti.Args) > 0, ti.Err != nil, ti.ConnID != 0, len(ti.Tags) > 0,
+		ti.Wait != 0, ti.BatchSize != 0, ti.ResultSet != 0, ti.RowCount != 0,
+		len(ti.Columns) > 0, ti.ResponseBytes != 0, ti.Baseline != 0, ti.TxID != 0,
+	}
+	for _, present := range fields {
+		if present {
+			n++
+		}
+	}
+	e.mapHeader(n)
+	if ti.Method != "" {
+		e.str("method")
+		e.str(ti.Method)
+	}
+	if ti.Query != "" {
+		e.str("query")
+		e.str(ti.Query)
+	}
+	if !ti.Start.IsZero() {
+		e.str("start")
+		e.time(ti.Start)
+		e.str("duration_nanos")
+		e.int(int64(ti.Elapsed()))
+	}
+	if len(ti.Args) > 0 {
+		e.str("args")
+		e.arrayHeader(len(ti.Args))
+		for _, a := range ti.Args {
+			e.value(a)
+		}
+	}
+	if ti.Err != nil {
+		e.str("error")
+		e.str(ti.Err.Error())
+	}
+	if ti.ConnID != 0 {
+		e.str("conn_id")
+		e.uint(ti.ConnID)
+	}
+	if len(ti.Tags) > 0 {
+		keys := make([]string, 0, len(ti.Tags))
+		for k := range ti.Tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		e.str("tags")
+		e.mapHeader(len(keys))
+		for _, k := range keys {
+			e.str(k)
+			e.str(ti.Tags[k])
+		}
+	}
+	if ti.Wait != 0 {
+		e.str("wait_nanos")
+		e.int(int64(ti.Wait))
+	}
+	if ti.BatchSize != 0 {
+		e.str("batch_size")
+		e.int(int64(ti.BatchSize))
+	}
+	if ti.ResultSet != 0 {
+		e.str("result_set")
+		e.int(int64(ti.ResultSet))
+	}
+	if ti.RowCount != 0 {
+		e.str("row_count")
+		e.int(int64(ti.RowCount))
+	}
+	if len(ti.Columns) > 0 {
+		e.str("columns")
+		e.arrayHeader(len(ti.Columns))
+		for _, c := range ti.Columns {
+			e.mapHeader(2)
+			e.str("name")
+			e.str(c.Name)
+			e.str("database_type")
+			e.str(c.DatabaseType)
+		}
+	}
+	if ti.ResponseBytes != 0 {
+		e.str("response_bytes")
+		e.int(ti.ResponseBytes)
+	}
+	if ti.Baseline != 0 {
+		e.str("baseline_nanos")
+		e.int(int64(ti.Baseline))
+	}
+	if ti.TxID != 0 {
+		e.str("tx_id")
+		e.uint(ti.TxID)
+	}
+	return e.b
+}
+
+type msgpackEncoder struct {
+	b []byte
+}
+
+func (e *msgpackEncoder) be(v uint64, size int) {
+	for i := size - 1; i >= 0; i-- {
+		e.b = append(e.b, byte(v>>(8*uint(i))))
+	}
+}
+
+func (e *msgpackEncoder) header(n int, fix, fixMax byte, c16, c32 byte) {
+	switch {
+	case n <= int(fixMax):
+		e.b = append(e.b, fix|byte(n))
+	case n <= math.MaxUint16:
+		e.b = append(e.b, c16)
+		e.be(uint64(n), 2)
+	default:
+		e.b = append(e.b, c32)
+		e.be(uint64(n), 4)
+	}
+}
+
+func (e *msgpackEncoder) mapHeader(n int) {
+	e.header(n, 0x80, 15, 0xde, 0xdf)
+}
+
+func (e *msgpackEncoder) arrayHeader(n int) {
+	e.header(n, 0x90, 15, 0xdc, 0xdd)
+}
+
+func (e *msgpackEncoder) str(s string) {
+	if len(s) > 31 && len(s) <= math.MaxUint8 {
+		e.b = append(e.b, 0xd9, byte(len(s)))
+	} else {
+		e.header(len(s), 0xa0, 31, 0xda, 0xdb)
+	}
+	e.b = append(e.b, s...)
+}
+
+func (e *msgpackEncoder) bin(b []byte) {
+	switch {
+	case len(b) <= math.MaxUint8:
+		e.b = append(e.b, 0xc4, byte(len(b)))
+	case len(b) <= math.MaxUint16:
+		e.b = append(e.b, 0xc5)
+		e.be(uint64(len(b)), 2)
+	default:
+		e.b = append(e.b, 0xc6)
+		e.be(uint64(len(b)), 4)
+	}
+	e.b = append(e.b, b...)
+}
+
+func (e *msgpackEncoder) int(v int64) {
+	switch {
+	case v >= 0:
+		e.uint(uint64(v))
+	case v >= -32:
+		e.b = append(e.b, byte(v))
+	default:
+		e.b = append(e.b, 0xd3)
+		e.be(uint64(v), 8)
+	}
+}
+
+func (e *msgpackEncoder) uint(v uint64) {
+	switch {
+	case v < 0x80:
+		e.b = append(e.b, byte(v))
+	case v <= math.MaxUint32:
+		e.b = append(e.b, 0xce)
+		e.be(v, 4)
+	default:
+		e.b = append(e.b, 0xcf)
+		e.be(v, 8)
+	}
+}
+
+// time writes t as a timestamp 96, the extension that holds any time.
+func (e *msgpackEncoder) time(t time.Time) {
+	e.b = append(e.b, 0xc7, 12, 0xff)
+	e.be(uint64(t.Nanosecond()), 4)
+	e.be(uint64(t.Unix()), 8)
+}
+
+func (e *msgpackEncoder) value(v driver.Value) {
+	switch v := v.(type) {
+	case nil:
+		e.b = append(e.b, 0xc0)
+	case int64:
+		e.int(v)
+	case float64:
+		e.b = append(e.b, 0xcb)
+		e.be(math.Float64bits(v), 8)
+	case bool:
+		if v {
+			e.b = append(e.b, 0xc3)
+		} else {
+			e.b = append(e.b, 0xc2)
+		}
+	case []byte:
+		e.bin(v)
+	case string:
+		e.str(v)
+	case time.Time:
+		e.time(v)
+	default:
+		e.str(fmt.Sprint(v))
+	}
+}
+
+// UnmarshalMsgpack decodes an event written by MarshalMsgpack. Keys it
+// doesn't know are skipped.
+func UnmarshalMsgpack(b []byte) (dbtimer.TimerInfo, error) {
+	d := &msgpackDecoder{b: b}
+	v, err := d.decode()
+	if err != nil {
+		return dbtimer.TimerInfo{}, serializationError(err)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return dbtimer.TimerInfo{}, serializationError(errors.New("event is not a map"))
+	}
+	var ti dbtimer.TimerInfo
+	ti.Method, _ = m["method"].(string)
+	ti.Query, _ = m["query"].(string)
+	if start, ok := m["start"].(time.Time); ok {
+		ti.Start = start
+		dur, _ := m["duration_nanos"].(int64)
+		ti.End = start.Add(time.Duration(dur))
+		ti.Duration = time.Duration(dur)
+	}
+	if args, ok := m["args"].([]interface{}); ok {
+		for _, a := range args {
+			ti.Args = append(ti.Args, a)
+		}
+	}
+	if msg, ok := m["error"].(string); ok {
+		ti.Err = errors.New(msg)
+	}
+	switch id := m["conn_id"].(type) {
+	case int64:
+		ti.ConnID = uint64(id)
+	case uint64:
+		ti.ConnID = id
+	}
+	if tags, ok := m["tags"].(map[string]interface{}); ok {
+		ti.Tags = make(map[string]string, len(tags))
+		for k, v := range tags {
+			s, _ := v.(string)
+			ti.Tags[k] = s
+		}
+	}
+	switch wait := m["wait_nanos"].(type) {
+	case int64:
+		ti.Wait = time.Duration(wait)
+	case uint64:
+		ti.Wait = time.Duration(wait)
+	}
+	switch n := m["batch_size"].(type) {
+	case int64:
+		ti.BatchSize = int(n)
+	case uint64:
+		ti.BatchSize = int(n)
+	}
+	switch n := m["result_set"].(type) {
+	case int64:
+		ti.ResultSet = int(n)
+	case uint64:
+		ti.ResultSet = int(n)
+	}
+	switch n := m["row_count"].(type) {
+	case int64:
+		ti.RowCount = int(n)
+	case uint64:
+		ti.RowCount = int(n)
+	}
+	if cols, ok := m["columns"].([]interface{}); ok {
+		for _, c := range cols {
+			cm, _ := c.(map[string]interface{})
+			var col dbtimer.Column
+			col.Name, _ = cm["name"].(string)
+			col.DatabaseType, _ = cm["database_type"].(string)
+			ti.Columns = append(ti.Columns, col)
+		}
+	}
+	switch n := m["response_bytes"].(type) {
+	case int64:
+		ti.ResponseBytes = n
+	case uint64:
+		ti.ResponseBytes = int64(n)
+	}
+	switch n := m["baseline_nanos"].(type) {
+	case int64:
+		ti.Baseline = time.Duration(n)
+	case uint64:
+		ti.Baseline = time.Duration(n)
+	}
+	switch id := m["tx_id"].(type) {
+	case int64:
+		ti.TxID = uint64(id)
+	case uint64:
+		ti.TxID = id
+	}
+	return ti, nil
+}
+
+type msgpackDecoder struct {
+	b []byte
+}
+
+func (d *msgpackDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.b)) {
+		return nil, errTruncated
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v, nil
+}
+
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	b, err := d.take(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// decode reads one value. Integers are int64, or uint64 if they don't fit;
+// maps must have string keys.
+func (d *msgpackDecoder) decode() (interface{}, error) {
+	c, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	switch t := c[0]; {
+	case t <= 0x7f:
+		return int64(t), nil
+	case t >= 0xe0:
+		return int64(int8(t)), nil
+	case t&0xf0 == 0x80:
+		return d.mapOf(uint64(t & 0x0f))
+	case t&0xf0 == 0x90:
+		return d.arrayOf(uint64(t & 0x0f))
+	case t&0xe0 == 0xa0:
+		return d.str(uint64(t & 0x1f))
+	}
+	t := c[0]
+	switch t {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.uint(1 << (t - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		b, err := d.take(n)
+		return append([]byte{}, b...), err
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.uint(1 << (t - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.ext(n)
+	case 0xca:
+		v, err := d.uint(4)
+		return float64(math.Float32frombits(uint32(v))), err
+	case 0xcb:
+		v, err := d.uint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := d.uint(1 << (t - 0xcc))
+		if v > math.MaxInt64 {
+			return v, err
+		}
+		return int64(v), err
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (t - 0xd0)
+		v, err := d.uint(size)
+		shift := uint(64 - 8*size)
+		return int64(v<<shift) >> shift, err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.ext(1 << (t - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.uint(1 << (t - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (t - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.arrayOf(n)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (t - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.mapOf(n)
+	}
+	return nil, fmt.Errorf("unknown MessagePack type 0x%02x", c[0])
+}
+
+func (d *msgpackDecoder) str(n uint64) (interface{}, error) {
+	b, err := d.take(n)
+	return string(b), err
+}
+
+func (d *msgpackDecoder) arrayOf(n uint64) (interface{}, error) {
+	if n > uint64(len(d.b)) {
+		return nil, errTruncated
+	}
+	out := make([]interface{}, n)
+	for i := range out {
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func (d *msgpackDecoder) mapOf(n uint64) (interface{}, error) {
+	if n > uint64(len(d.b)) {
+		return nil, errTruncated
+	}
+	out := make(map[string]interface{}, n)
+	for i := uint64(0); i < n; i++ {
+		k, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		ks, ok := k.(string)
+		if !ok {
+			return nil, fmt.Errorf("map key %v is not a string", k)
+		}
+		v, err := d.decode()
+		if err != nil {
+			return nil, err
+		}
+		out[ks] = v
+	}
+	return out, nil
+}
+
+// ext reads an extension of n bytes. Timestamps become time.Time; other
+// extensions are skipped and read as nil.
+func (d *msgpackDecoder) ext(n uint64) (interface{}, error) {
+	typ, err := d.take(1)
+	if err != nil {
+		return nil, err
+	}
+	b, err := d.take(n)
+	if err != nil || int8(typ[0]) != -1 {
+		return nil, err
+	}
+	switch n {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(b)), 0), nil
+	case 8:
+		v := binary.BigEndian.Uint64(b)
+		return time.Unix(int64(v&(1<<34-1)), int64(v>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(b[4:])), int64(binary.BigEndian.Uint32(b))), nil
+	}
+	return nil, fmt.Errorf("bad timestamp length %d", n)
+}
@@ -0,0 +1,401 @@
+// Package wire encodes dbtimer events in compact binary formats for network
+// sinks: protobuf, using the schema in event.proto, and MessagePack. Both
+// encodings are hand-written, so the package has no dependencies.
+//
+// Decoders skip fields they don't know, so that a reader built against an
+// older schema can read events from a newer writer.
+package wire
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/jonbodner/dbtimer"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+type protoBuf []byte
+
+func (b protoBuf) tag(field, wt int) protoBuf {
+	return b.varint(uint64(field)<<3 | uint64(wt))
+}
+
+func (b protoBuf) varint(v uint64) protoBuf {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func (b protoBuf) bytes(field int, v []byte) protoBuf {
+	b = b.tag(field, wireBytes).varint(uint64(len(v)))
+	return append(b, v...)
+}
+
+func (b protoBuf) string(field int, v string) protoBuf {
+	if v == "" {
+		return b
+	}
+	b = b.tag(field, wireBytes).varint(uint64(len(v)))
+	return append(b, v...)
+}
+
+func (b protoBuf) uint(field int, v uint64) protoBuf {
+	if v == 0 {
+		return b
+	}
+	return b.tag(field, wireVarint).varint(v)
+}
+
+// tags writes a map<string, string> field, in key order.
+func (b protoBuf) tags(field int, tags map[string]string) protoBuf {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var entry protoBuf
+		entry = entry.tag(1, wireBytes).varint(uint64(len(k)))
+		entry = append(entry, k...)
+		entry = entry.tag(2, wireBytes).varint(uint64(len(tags[k])))
+		entry = append(entry, tags[k]...)
+		b = b.bytes(field, entry)
+	}
+	return b
+}
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
+
+// MarshalProto encodes ti as an Event message.
+func MarshalProto(ti dbtimer.TimerInfo) []byte {
+	return appendEvent(nil, ti)
+}
+
+// MarshalProtoBatch encodes events as an EventBatch message.
+func MarshalProtoBatch(events []dbtimer.TimerInfo) []byte {
+	var b protoBuf
+	for _, ti := range events {
+		b = b.bytes(1, appendEvent(nil, ti))
+	}
+	return b
+}
+
+func appendEvent(b protoBuf, ti dbtimer.TimerInfo) protoBuf {
+	b = b.string(1, ti.Method)
+	b = b.string(2, ti.Query)
+	b = b.uint(3, uint64(unixNano(ti.Start)))
+	if !ti.Start.IsZero() {
+		b = b.uint(4, uint64(ti.Elapsed()))
+	}
+	for _, a := range ti.Args {
+		b = b.bytes(5, appendValue(nil, a))
+	}
+	if ti.Err != nil {
+		b = b.string(6, ti.Err.Error())
+	}
+	b = b.uint(7, ti.ConnID)
+	b = b.tags(8, ti.Tags)
+	b = b.uint(9, uint64(ti.Wait))
+	b = b.uint(10, uint64(ti.BatchSize))
+	b = b.uint(11, uint64(ti.ResultSet))
+	b = b.uint(12, uint64(ti.RowCount))
+	for _, c := range ti.Columns {
+		var col protoBuf
+		col = col.string(1, c.Name).string(2, c.DatabaseType)
+		b = b.bytes(13, col)
+	}
+	b = b.uint(14, uint64(ti.ResponseBytes))
+	b = b.uint(15, uint64(ti.Baseline))
+	b = b.uint(16, ti.TxID)
+	return b
+}
+
+func appendValue(b protoBuf, v driver.Value) protoBuf {
+	switch v := v.(type) {
+	case nil:
+		return b.tag(1, wireVarint).varint(1)
+	case int64:
+		return b.tag(2, wireVarint).varint(uint64(v))
+	case float64:
+		var f [8]byte
+		binary.LittleEndian.PutUint64(f[:], math.Float64bits(v))
+		return append(b.tag(3, wireFixed64), f[:]...)
+	case bool:
+		n := uint64(0)
+		if v {
+			n = 1
+		}
+		return b.tag(4, wireVarint).varint(n)
+	case []byte:
+		return b.bytes(5, v)
+	case string:
+		return b.bytes(6, []byte(v))
+	case time.Time:
+		return b.tag(7, wireVarint).varint(uint64(v.UnixNano()))
+	}
+	return b.bytes(6, []byte(fmt.Sprint(v)))
+}
+
+// protoReader reads the fields of a message.
+type protoReader struct {
+	b   []byte
+	err error
+}
+
+var errTruncated = errors.New("truncated message")
+
+func (r *protoReader) varint() uint64 {
+	v, n := binary.Uvarint(r.b)
+	if n <= 0 {
+		r.fail(errTruncated)
+		return 0
+	}
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *protoReader) fail(err error) {
+	if r.err == nil {
+		r.err = err
+	}
+	r.b = nil
+}
+
+// next returns the next field and its wire type, or false at the end of the
+// message.
+func (r *protoReader) next() (field, wt int, ok bool) {
+	if len(r.b) == 0 || r.err != nil {
+		return 0, 0, false
+	}
+	t := r.varint()
+	return int(t >> 3), int(t & 7), r.err == nil
+}
+
+func (r *protoReader) bytes() []byte {
+	n := r.varint()
+	if n > uint64(len(r.b)) {
+		r.fail(errTruncated)
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *protoReader) fixed64() uint64 {
+	if len(r.b) < 8 {
+		r.fail(errTruncated)
+		return 0
+	}
+	v := binary.LittleEndian.Uint64(r.b)
+	r.b = r.b[8:]
+	return v
+}
+
+// skip skips a field of an unknown number.
+func (r *protoReader) skip(wt int) {
+	switch wt {
+	case wireVarint:
+		r.varint()
+	case wireFixed64:
+		r.fixed64()
+	case wireBytes:
+		r.bytes()
+	case wireFixed32:
+		if len(r.b) < 4 {
+			r.fail(errTruncated)
+			return
+		}
+		r.b = r.b[4:]
+	default:
+		r.fail(fmt.Errorf("unknown wire type %d", wt))
+	}
+}
+
+func serializationError(err error) error {
+	return &dbtimer.Error{Kind: dbtimer.ErrSerialization, Err: err}
+}
+
+// UnmarshalProto decodes an Event message.
+func UnmarshalProto(b []byte) (dbtimer.TimerInfo, error) {
+	ti, err := readEvent(b)
+	if err != nil {
+		return dbtimer.TimerInfo{}, serializationError(err)
+	}
+	return ti, nil
+}
+
+// UnmarshalProtoBatch decodes an EventBatch message.
+func UnmarshalProtoBatch(b []byte) ([]dbtimer.TimerInfo, error) {
+	r := &protoReader{b: b}
+	var out []dbtimer.TimerInfo
+	for {
+		field, wt, ok := r.next()
+		if !ok {
+			break
+		}
+		if field != 1 || wt != wireBytes {
+			r.skip(wt)
+			continue
+		}
+		ti, err := readEvent(r.bytes())
+		if err != nil {
+			return nil, serializationError(err)
+		}
+		out = append(out, ti)
+	}
+	if r.err != nil {
+		return nil, serializationError(r.err)
+	}
+	return out, nil
+}
+
+func readEvent(b []byte) (dbtimer.TimerInfo, error) {
+	var ti dbtimer.TimerInfo
+	var start, dur int64
+	r := &protoReader{b: b}
+	for {
+		field, wt, ok := r.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && wt == wireBytes:
+			ti.Method = string(r.bytes())
+		case field == 2 && wt == wireBytes:
+			ti.Query = string(r.bytes())
+		case field == 3 && wt == wireVarint:
+			start = int64(r.varint())
+		case field == 4 && wt == wireVarint:
+			dur = int64(r.varint())
+		case field == 5 && wt == wireBytes:
+			v, err := readValue(r.bytes())
+			if err != nil {
+				return ti, err
+			}
+			ti.Args = append(ti.Args, v)
+		case field == 6 && wt == wireBytes:
+			ti.Err = errors.New(string(r.bytes()))
+		case field == 7 && wt == wireVarint:
+			ti.ConnID = r.varint()
+		case field == 8 && wt == wireBytes:
+			k, v, err := readTag(r.bytes())
+			if err != nil {
+				return ti, err
+			}
+			if ti.Tags == nil {
+				ti.Tags = map[string]string{}
+			}
+			ti.Tags[k] = v
+		case field == 9 && wt == wireVarint:
+			ti.Wait = time.Duration(r.varint())
+		case field == 10 && wt == wireVarint:
+			ti.BatchSize = int(r.varint())
+		case field == 11 && wt == wireVarint:
+			ti.ResultSet = int(r.varint())
+		case field == 12 && wt == wireVarint:
+			ti.RowCount = int(r.varint())
+		case field == 13 && wt == wireBytes:
+			// A Column has the same shape as a tags map entry.
+			name, typ, err := readTag(r.bytes())
+			if err != nil {
+				return ti, err
+			}
+			ti.Columns = append(ti.Columns, dbtimer.Column{Name: name, DatabaseType: typ})
+		case field == 14 && wt == wireVarint:
+			ti.ResponseBytes = int64(r.varint())
+		case field == 15 && wt == wireVarint:
+			ti.Baseline = time.Duration(r.varint())
+		case field == 16 && wt == wireVarint:
+			ti.TxID = r.varint()
+		default:
+			r.skip(wt)
+		}
+	}
+	if r.err != nil {
+		return ti, r.err
+	}
+	ti.Start = fromUnixNano(start)
+	if !ti.Start.IsZero() {
+		ti.End = ti.Start.Add(time.Duration(dur))
+		ti.Duration = time.Duration(dur)
+	}
+	return ti, nil
+}
+
+func readValue(b []byte) (driver.Value, error) {
+	var v driver.Value
+	r := &protoReader{b: b}
+	for {
+		field, wt, ok := r.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && wt == wireVarint:
+			r.varint()
+			v = nil
+		case field == 2 && wt == wireVarint:
+			v = int64(r.varint())
+		case field == 3 && wt == wireFixed64:
+			v = math.Float64frombits(r.fixed64())
+		case field == 4 && wt == wireVarint:
+			v = r.varint() != 0
+		case field == 5 && wt == wireBytes:
+			v = append([]byte{}, r.bytes()...)
+		case field == 6 && wt == wireBytes:
+			v = string(r.bytes())
+		case field == 7 && wt == wireVarint:
+			v = time.Unix(0, int64(r.varint()))
+		default:
+			r.skip(wt)
+		}
+	}
+	return v, r.err
+}
+
+func readTag(b []byte) (string, string, error) {
+	var k, v string
+	r := &protoReader{b: b}
+	for {
+		field, wt, ok := r.next()
+		if !ok {
+			break
+		}
+		switch {
+		case field == 1 && wt == wireBytes:
+			k = string(r.bytes())
+		case field == 2 && wt == wireBytes:
+			v = string(r.bytes())
+		default:
+			r.skip(wt)
+		}
+	}
+	return k, v, r.err
+}
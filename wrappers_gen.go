@@ -0,0 +1,1809 @@
+// Code generated by wrapgen; DO NOT EDIT.
+
+package dbtimer
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+)
+
+// Conn is a timed connection whose underlying connection execs and queries directly.
+type Conn struct {
+	c driver.Conn
+	*connState
+}
+
+// Prepare returns a prepared statement, bound to this connection.
+func (c *Conn) Prepare(query string) (driver.Stmt, error) {
+	return c.prepare(c.c, query)
+}
+
+// PrepareContext returns a prepared statement, bound to this connection.
+// context is for the preparation of the statement,
+// it must not store the context within the statement itself.
+func (c *Conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.prepareContext(ctx, c.c, query)
+}
+
+func (c *Conn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	return c.exec(c.c, query, args)
+}
+
+// ExecContext executes a query that doesn't return rows, such
+// as an INSERT or UPDATE.
+//
+// ExecContext must honor the context timeout and return when it is canceled.
+func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.execContext(ctx, c.c, query, args)
+}
+
+// QueryContext executes a query that may return rows, such as a
+// SELECT.
+//
+// QueryContext must honor the context timeout and return when it is canceled.
+func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.queryContext(ctx, c.c, query, args)
+}
+
+// Close invalidates and potentially stops any current
+// prepared statements and transactions, marking this
+// connection as no longer in use.
+//
+// Because the sql package maintains a free pool of
+// connections and only calls Close when there's a surplus of
+// idle connections, it shouldn't be necessary for drivers to
+// do their own connection caching.
+func (c *Conn) Close() error {
+	return c.close(c.c)
+}
+
+// Begin starts and returns a new transaction.
+func (c *Conn) Begin() (driver.Tx, error) {
+	return c.begin(c.c)
+}
+
+// BeginTx starts and returns a new transaction.
+// If the context is canceled by the user the sql package will
+// call Tx.Rollback before discarding and closing the connection.
+func (c *Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.beginTx(ctx, c.c, opts)
+}
+
+// Ping verifies a connection to the database is still alive.
+func (c *Conn) Ping(ctx context.Context) error {
+	return c.ping(ctx, c.c)
+}
+
+// ResetSession is called prior to executing a query on the connection
+// if the connection has been used before.
+func (c *Conn) ResetSession(ctx context.Context) error {
+	return resetSession(ctx, c.c)
+}
+
+// IsValid is called prior to placing the connection into the
+// connection pool. The connection will be discarded if false is returned.
+func (c *Conn) IsValid() bool {
+	return isValid(c.c)
+}
+
+// CheckNamedValue is called before passing arguments to the driver
+// and is called in place of any ColumnConverter.
+func (c *Conn) CheckNamedValue(nv *driver.NamedValue) error {
+	return checkNamedValue(nv, c.c)
+}
+
+// Unwrap returns the underlying driver's connection.
+func (c *Conn) Unwrap() driver.Conn {
+	return c.c
+}
+
+// NoExecConn is a timed connection whose underlying connection queries directly but doesn't exec, so the sql package prepares each exec.
+type NoExecConn struct {
+	c driver.Conn
+	*connState
+}
+
+// Prepare returns a prepared statement, bound to this connection.
+func (c *NoExecConn) Prepare(query string) (driver.Stmt, error) {
+	return c.prepare(c.c, query)
+}
+
+// PrepareContext returns a prepared statement, bound to this connection.
+// context is for the preparation of the statement,
+// it must not store the context within the statement itself.
+func (c *NoExecConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.prepareContext(ctx, c.c, query)
+}
+
+// QueryContext executes a query that may return rows, such as a
+// SELECT.
+//
+// QueryContext must honor the context timeout and return when it is canceled.
+func (c *NoExecConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.queryContext(ctx, c.c, query, args)
+}
+
+// Close invalidates and potentially stops any current
+// prepared statements and transactions, marking this
+// connection as no longer in use.
+//
+// Because the sql package maintains a free pool of
+// connections and only calls Close when there's a surplus of
+// idle connections, it shouldn't be necessary for drivers to
+// do their own connection caching.
+func (c *NoExecConn) Close() error {
+	return c.close(c.c)
+}
+
+// Begin starts and returns a new transaction.
+func (c *NoExecConn) Begin() (driver.Tx, error) {
+	return c.begin(c.c)
+}
+
+// BeginTx starts and returns a new transaction.
+// If the context is canceled by the user the sql package will
+// call Tx.Rollback before discarding and closing the connection.
+func (c *NoExecConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.beginTx(ctx, c.c, opts)
+}
+
+// Ping verifies a connection to the database is still alive.
+func (c *NoExecConn) Ping(ctx context.Context) error {
+	return c.ping(ctx, c.c)
+}
+
+// ResetSession is called prior to executing a query on the connection
+// if the connection has been used before.
+func (c *NoExecConn) ResetSession(ctx context.Context) error {
+	return resetSession(ctx, c.c)
+}
+
+// IsValid is called prior to placing the connection into the
+// connection pool. The connection will be discarded if false is returned.
+func (c *NoExecConn) IsValid() bool {
+	return isValid(c.c)
+}
+
+// CheckNamedValue is called before passing arguments to the driver
+// and is called in place of any ColumnConverter.
+func (c *NoExecConn) CheckNamedValue(nv *driver.NamedValue) error {
+	return checkNamedValue(nv, c.c)
+}
+
+// Unwrap returns the underlying driver's connection.
+func (c *NoExecConn) Unwrap() driver.Conn {
+	return c.c
+}
+
+// NoQueryConn is a timed connection whose underlying connection execs directly but doesn't query, so the sql package prepares each query.
+type NoQueryConn struct {
+	c driver.Conn
+	*connState
+}
+
+// Prepare returns a prepared statement, bound to this connection.
+func (c *NoQueryConn) Prepare(query string) (driver.Stmt, error) {
+	return c.prepare(c.c, query)
+}
+
+// PrepareContext returns a prepared statement, bound to this connection.
+// context is for the preparation of the statement,
+// it must not store the context within the statement itself.
+func (c *NoQueryConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.prepareContext(ctx, c.c, query)
+}
+
+func (c *NoQueryConn) Exec(query string, args []driver.Value) (driver.Result, error) {
+	return c.exec(c.c, query, args)
+}
+
+// ExecContext executes a query that doesn't return rows, such
+// as an INSERT or UPDATE.
+//
+// ExecContext must honor the context timeout and return when it is canceled.
+func (c *NoQueryConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.execContext(ctx, c.c, query, args)
+}
+
+// Close invalidates and potentially stops any current
+// prepared statements and transactions, marking this
+// connection as no longer in use.
+//
+// Because the sql package maintains a free pool of
+// connections and only calls Close when there's a surplus of
+// idle connections, it shouldn't be necessary for drivers to
+// do their own connection caching.
+func (c *NoQueryConn) Close() error {
+	return c.close(c.c)
+}
+
+// Begin starts and returns a new transaction.
+func (c *NoQueryConn) Begin() (driver.Tx, error) {
+	return c.begin(c.c)
+}
+
+// BeginTx starts and returns a new transaction.
+// If the context is canceled by the user the sql package will
+// call Tx.Rollback before discarding and closing the connection.
+func (c *NoQueryConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.beginTx(ctx, c.c, opts)
+}
+
+// Ping verifies a connection to the database is still alive.
+func (c *NoQueryConn) Ping(ctx context.Context) error {
+	return c.ping(ctx, c.c)
+}
+
+// ResetSession is called prior to executing a query on the connection
+// if the connection has been used before.
+func (c *NoQueryConn) ResetSession(ctx context.Context) error {
+	return resetSession(ctx, c.c)
+}
+
+// IsValid is called prior to placing the connection into the
+// connection pool. The connection will be discarded if false is returned.
+func (c *NoQueryConn) IsValid() bool {
+	return isValid(c.c)
+}
+
+// CheckNamedValue is called before passing arguments to the driver
+// and is called in place of any ColumnConverter.
+func (c *NoQueryConn) CheckNamedValue(nv *driver.NamedValue) error {
+	return checkNamedValue(nv, c.c)
+}
+
+// Unwrap returns the underlying driver's connection.
+func (c *NoQueryConn) Unwrap() driver.Conn {
+	return c.c
+}
+
+// NoExecNoQueryConn is a timed connection whose underlying connection neither execs nor queries directly, so the sql package prepares every statement.
+type NoExecNoQueryConn struct {
+	c driver.Conn
+	*connState
+}
+
+// Prepare returns a prepared statement, bound to this connection.
+func (c *NoExecNoQueryConn) Prepare(query string) (driver.Stmt, error) {
+	return c.prepare(c.c, query)
+}
+
+// PrepareContext returns a prepared statement, bound to this connection.
+// context is for the preparation of the statement,
+// it must not store the context within the statement itself.
+func (c *NoExecNoQueryConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.prepareContext(ctx, c.c, query)
+}
+
+// Close invalidates and potentially stops any current
+// prepared statements and transactions, marking this
+// connection as no longer in use.
+//
+// Because the sql package maintains a free pool of
+// connections and only calls Close when there's a surplus of
+// idle connections, it shouldn't be necessary for drivers to
+// do their own connection caching.
+func (c *NoExecNoQueryConn) Close() error {
+	return c.close(c.c)
+}
+
+// Begin starts and returns a new transaction.
+func (c *NoExecNoQueryConn) Begin() (driver.Tx, error) {
+	return c.begin(c.c)
+}
+
+// BeginTx starts and returns a new transaction.
+// If the context is canceled by the user the sql package will
+// call Tx.Rollback before discarding and closing the connection.
+func (c *NoExecNoQueryConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.beginTx(ctx, c.c, opts)
+}
+
+// Ping verifies a connection to the database is still alive.
+func (c *NoExecNoQueryConn) Ping(ctx context.Context) error {
+	return c.ping(ctx, c.c)
+}
+
+// ResetSession is called prior to executing a query on the connection
+// if the connection has been used before.
+func (c *NoExecNoQueryConn) ResetSession(ctx context.Context) error {
+	return resetSession(ctx, c.c)
+}
+
+// IsValid is called prior to placing the connection into the
+// connection pool. The connection will be discarded if false is returned.
+func (c *NoExecNoQueryConn) IsValid() bool {
+	return isValid(c.c)
+}
+
+// CheckNamedValue is called before passing arguments to the driver
+// and is called in place of any ColumnConverter.
+func (c *NoExecNoQueryConn) CheckNamedValue(nv *driver.NamedValue) error {
+	return checkNamedValue(nv, c.c)
+}
+
+// Unwrap returns the underlying driver's connection.
+func (c *NoExecNoQueryConn) Unwrap() driver.Conn {
+	return c.c
+}
+
+// wrapConn returns the timed connection for c, of the type that execs and
+// queries directly exactly when c does.
+func wrapConn(c driver.Conn, cs *connState) driver.Conn {
+	_, execer := c.(driver.Execer)
+	_, execerContext := c.(driver.ExecerContext)
+	_, queryer := c.(driver.Queryer)
+	_, queryerContext := c.(driver.QueryerContext)
+	exec := execer || execerContext
+	query := queryer || queryerContext
+	switch {
+	case exec && query:
+		return &Conn{c, cs}
+	case !exec && query:
+		return &NoExecConn{c, cs}
+	case exec && !query:
+		return &NoQueryConn{c, cs}
+	case !exec && !query:
+		return &NoExecNoQueryConn{c, cs}
+	}
+	panic("unreachable")
+}
+
+// converterStmt is a Stmt whose underlying statement is a
+// driver.ColumnConverter.
+type converterStmt struct {
+	*Stmt
+	cc driver.ColumnConverter
+}
+
+// ColumnConverter returns the underlying statement's converter for the
+// argument at idx.
+func (s converterStmt) ColumnConverter(idx int) driver.ValueConverter {
+	return s.cc.ColumnConverter(idx)
+}
+
+// wrapStmt returns s as a driver.Stmt, keeping the underlying statement's
+// ColumnConverter if it has one.
+func wrapStmt(s *Stmt) driver.Stmt {
+	if cc, ok := s.s.(driver.ColumnConverter); ok {
+		return converterStmt{s, cc}
+	}
+	return s
+}
+
+// rowsInterfaces are the optional interfaces of wrapped rows.
+type rowsInterfaces struct {
+	next           driver.RowsNextResultSet
+	scanType       driver.RowsColumnTypeScanType
+	databaseType   driver.RowsColumnTypeDatabaseTypeName
+	length         driver.RowsColumnTypeLength
+	nullable       driver.RowsColumnTypeNullable
+	precisionScale driver.RowsColumnTypePrecisionScale
+}
+
+// rows1 is rows with driver.RowsNextResultSet.
+type rows1 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows1) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows1) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+// rows2 is rows with driver.RowsColumnTypeScanType.
+type rows2 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows2) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+// rows3 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType.
+type rows3 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows3) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows3) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows3) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+// rows4 is rows with driver.RowsColumnTypeDatabaseTypeName.
+type rows4 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows4) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+// rows5 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeDatabaseTypeName.
+type rows5 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows5) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows5) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows5) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+// rows6 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName.
+type rows6 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows6) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows6) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+// rows7 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName.
+type rows7 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows7) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows7) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows7) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows7) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+// rows8 is rows with driver.RowsColumnTypeLength.
+type rows8 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows8) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+// rows9 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeLength.
+type rows9 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows9) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows9) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows9) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+// rows10 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeLength.
+type rows10 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows10) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows10) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+// rows11 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeLength.
+type rows11 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows11) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows11) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows11) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows11) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+// rows12 is rows with driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength.
+type rows12 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows12) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows12) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+// rows13 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength.
+type rows13 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows13) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows13) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows13) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows13) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+// rows14 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength.
+type rows14 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows14) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows14) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows14) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+// rows15 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength.
+type rows15 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows15) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows15) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows15) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows15) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows15) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+// rows16 is rows with driver.RowsColumnTypeNullable.
+type rows16 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows16) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows17 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeNullable.
+type rows17 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows17) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows17) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows17) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows18 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeNullable.
+type rows18 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows18) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows18) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows19 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeNullable.
+type rows19 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows19) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows19) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows19) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows19) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows20 is rows with driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeNullable.
+type rows20 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows20) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows20) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows21 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeNullable.
+type rows21 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows21) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows21) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows21) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows21) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows22 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeNullable.
+type rows22 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows22) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows22) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows22) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows23 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeNullable.
+type rows23 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows23) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows23) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows23) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows23) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows23) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows24 is rows with driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable.
+type rows24 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows24) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows24) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows25 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable.
+type rows25 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows25) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows25) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows25) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows25) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows26 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable.
+type rows26 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows26) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows26) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows26) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows27 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable.
+type rows27 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows27) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows27) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows27) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows27) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows27) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows28 is rows with driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable.
+type rows28 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows28) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows28) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows28) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows29 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable.
+type rows29 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows29) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows29) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows29) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows29) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows29) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows30 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable.
+type rows30 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows30) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows30) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows30) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows30) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows31 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable.
+type rows31 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows31) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows31) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows31) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows31) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows31) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows31) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+// rows32 is rows with driver.RowsColumnTypePrecisionScale.
+type rows32 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows32) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows33 is rows with driver.RowsNextResultSet, driver.RowsColumnTypePrecisionScale.
+type rows33 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows33) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows33) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows33) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows34 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypePrecisionScale.
+type rows34 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows34) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows34) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows35 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypePrecisionScale.
+type rows35 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows35) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows35) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows35) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows35) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows36 is rows with driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypePrecisionScale.
+type rows36 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows36) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows36) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows37 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypePrecisionScale.
+type rows37 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows37) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows37) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows37) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows37) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows38 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypePrecisionScale.
+type rows38 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows38) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows38) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows38) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows39 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypePrecisionScale.
+type rows39 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows39) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows39) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows39) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows39) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows39) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows40 is rows with driver.RowsColumnTypeLength, driver.RowsColumnTypePrecisionScale.
+type rows40 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows40) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows40) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows41 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeLength, driver.RowsColumnTypePrecisionScale.
+type rows41 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows41) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows41) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows41) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows41) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows42 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeLength, driver.RowsColumnTypePrecisionScale.
+type rows42 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows42) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows42) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows42) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows43 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeLength, driver.RowsColumnTypePrecisionScale.
+type rows43 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows43) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows43) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows43) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows43) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows43) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows44 is rows with driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength, driver.RowsColumnTypePrecisionScale.
+type rows44 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows44) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows44) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows44) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows45 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength, driver.RowsColumnTypePrecisionScale.
+type rows45 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows45) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows45) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows45) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows45) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows45) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows46 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength, driver.RowsColumnTypePrecisionScale.
+type rows46 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows46) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows46) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows46) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows46) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows47 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength, driver.RowsColumnTypePrecisionScale.
+type rows47 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows47) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows47) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows47) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows47) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows47) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows47) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows48 is rows with driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows48 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows48) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows48) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows49 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows49 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows49) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows49) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows49) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows49) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows50 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows50 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows50) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows50) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows50) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows51 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows51 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows51) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows51) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows51) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows51) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows51) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows52 is rows with driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows52 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows52) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows52) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows52) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows53 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows53 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows53) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows53) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows53) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows53) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows53) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows54 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows54 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows54) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows54) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows54) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows54) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows55 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows55 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows55) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows55) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows55) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows55) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows55) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows55) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows56 is rows with driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows56 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows56) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows56) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows56) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows57 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows57 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows57) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows57) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows57) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows57) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows57) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows58 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows58 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows58) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows58) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows58) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows58) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows59 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows59 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows59) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows59) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows59) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows59) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows59) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows59) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows60 is rows with driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows60 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows60) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows60) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows60) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows60) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows61 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows61 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows61) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows61) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows61) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows61) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows61) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows61) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows62 is rows with driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows62 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows62) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows62) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows62) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows62) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows62) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// rows63 is rows with driver.RowsNextResultSet, driver.RowsColumnTypeScanType, driver.RowsColumnTypeDatabaseTypeName, driver.RowsColumnTypeLength, driver.RowsColumnTypeNullable, driver.RowsColumnTypePrecisionScale.
+type rows63 struct {
+	driver.Rows
+	rowsInterfaces
+}
+
+func (r *rows63) HasNextResultSet() bool {
+	return r.next.HasNextResultSet()
+}
+
+func (r *rows63) NextResultSet() error {
+	return r.next.NextResultSet()
+}
+
+func (r *rows63) ColumnTypeScanType(index int) reflect.Type {
+	return r.scanType.ColumnTypeScanType(index)
+}
+
+func (r *rows63) ColumnTypeDatabaseTypeName(index int) string {
+	return r.databaseType.ColumnTypeDatabaseTypeName(index)
+}
+
+func (r *rows63) ColumnTypeLength(index int) (int64, bool) {
+	return r.length.ColumnTypeLength(index)
+}
+
+func (r *rows63) ColumnTypeNullable(index int) (bool, bool) {
+	return r.nullable.ColumnTypeNullable(index)
+}
+
+func (r *rows63) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
+	return r.precisionScale.ColumnTypePrecisionScale(index)
+}
+
+// wrapRows returns rows with the interfaces in i that aren't nil.
+func wrapRows(rows driver.Rows, i rowsInterfaces) driver.Rows {
+	mask := 0
+	if i.next != nil {
+		mask |= 1
+	}
+	if i.scanType != nil {
+		mask |= 2
+	}
+	if i.databaseType != nil {
+		mask |= 4
+	}
+	if i.length != nil {
+		mask |= 8
+	}
+	if i.nullable != nil {
+		mask |= 16
+	}
+	if i.precisionScale != nil {
+		mask |= 32
+	}
+	switch mask {
+	case 1:
+		return &rows1{rows, i}
+	case 2:
+		return &rows2{rows, i}
+	case 3:
+		return &rows3{rows, i}
+	case 4:
+		return &rows4{rows, i}
+	case 5:
+		return &rows5{rows, i}
+	case 6:
+		return &rows6{rows, i}
+	case 7:
+		return &rows7{rows, i}
+	case 8:
+		return &rows8{rows, i}
+	case 9:
+		return &rows9{rows, i}
+	case 10:
+		return &rows10{rows, i}
+	case 11:
+		return &rows11{rows, i}
+	case 12:
+		return &rows12{rows, i}
+	case 13:
+		return &rows13{rows, i}
+	case 14:
+		return &rows14{rows, i}
+	case 15:
+		return &rows15{rows, i}
+	case 16:
+		return &rows16{rows, i}
+	case 17:
+		return &rows17{rows, i}
+	case 18:
+		return &rows18{rows, i}
+	case 19:
+		return &rows19{rows, i}
+	case 20:
+		return &rows20{rows, i}
+	case 21:
+		return &rows21{rows, i}
+	case 22:
+		return &rows22{rows, i}
+	case 23:
+		return &rows23{rows, i}
+	case 24:
+		return &rows24{rows, i}
+	case 25:
+		return &rows25{rows, i}
+	case 26:
+		return &rows26{rows, i}
+	case 27:
+		return &rows27{rows, i}
+	case 28:
+		return &rows28{rows, i}
+	case 29:
+		return &rows29{rows, i}
+	case 30:
+		return &rows30{rows, i}
+	case 31:
+		return &rows31{rows, i}
+	case 32:
+		return &rows32{rows, i}
+	case 33:
+		return &rows33{rows, i}
+	case 34:
+		return &rows34{rows, i}
+	case 35:
+		return &rows35{rows, i}
+	case 36:
+		return &rows36{rows, i}
+	case 37:
+		return &rows37{rows, i}
+	case 38:
+		return &rows38{rows, i}
+	case 39:
+		return &rows39{rows, i}
+	case 40:
+		return &rows40{rows, i}
+	case 41:
+		return &rows41{rows, i}
+	case 42:
+		return &rows42{rows, i}
+	case 43:
+		return &rows43{rows, i}
+	case 44:
+		return &rows44{rows, i}
+	case 45:
+		return &rows45{rows, i}
+	case 46:
+		return &rows46{rows, i}
+	case 47:
+		return &rows47{rows, i}
+	case 48:
+		return &rows48{rows, i}
+	case 49:
+		return &rows49{rows, i}
+	case 50:
+		return &rows50{rows, i}
+	case 51:
+		return &rows51{rows, i}
+	case 52:
+		return &rows52{rows, i}
+	case 53:
+		return &rows53{rows, i}
+	case 54:
+		return &rows54{rows, i}
+	case 55:
+		return &rows55{rows, i}
+	case 56:
+		return &rows56{rows, i}
+	case 57:
+		return &rows57{rows, i}
+	case 58:
+		return &rows58{rows, i}
+	case 59:
+		return &rows59{rows, i}
+	case 60:
+		return &rows60{rows, i}
+	case 61:
+		return &rows61{rows, i}
+	case 62:
+		return &rows62{rows, i}
+	case 63:
+		return &rows63{rows, i}
+	}
+	return rows
+}